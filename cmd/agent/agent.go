@@ -124,6 +124,8 @@ func main() {
 	gitRepositoryController := agent.GitRepositoryController(kubeEnv, config.Host, config.AgentKey)
 	kustomizationController := agent.KustomizationController(kubeEnv, config.Host, config.AgentKey)
 	helmReleaseController := agent.HelmReleaseController(kubeEnv, config.Host, config.AgentKey)
+	terraformController := agent.TerraformController(kubeEnv, config.Host, config.AgentKey)
+	canaryController := agent.CanaryController(kubeEnv, config.Host, config.AgentKey)
 	go podController.Run(1, stopCh)
 	go deploymentController.Run(1, stopCh)
 	go ingressController.Run(1, stopCh)
@@ -132,11 +134,16 @@ func main() {
 	go gitRepositoryController.Run(1, stopCh)
 	go kustomizationController.Run(1, stopCh)
 	go helmReleaseController.Run(1, stopCh)
+	go terraformController.Run(1, stopCh)
+	go canaryController.Run(1, stopCh)
+
+	idleWatcher := agent.NewIdleWatcher(kubeEnv, config.Host, config.AgentKey, config.IngressNginxMetricsURL)
+	go idleWatcher.Run(stopCh)
 
 	messages := make(chan *streaming.WSMessage)
 
 	go serverWSCommunication(config, messages)
-	go serverCommunication(kubeEnv, config, messages)
+	go serverCommunication(kubeEnv, config, messages, idleWatcher)
 
 	metricsRouter := chi.NewRouter()
 	metricsRouter.Get("/metrics", promhttp.Handler().ServeHTTP)
@@ -209,6 +216,7 @@ func serverCommunication(
 	kubeEnv *agent.KubeEnv,
 	config config.Config,
 	messages chan *streaming.WSMessage,
+	idleWatcher *agent.IdleWatcher,
 ) {
 	for {
 		done := make(chan bool)
@@ -275,6 +283,10 @@ func serverCommunication(
 						namespace := e["namespace"].(string)
 						name := e["name"].(string)
 						go restartDeployment(kubeEnv, namespace, name)
+					case "wakeUpPreview":
+						namespace := e["namespace"].(string)
+						name := e["name"].(string)
+						go idleWatcher.WakeUp(namespace, name)
 					case "imageBuildTrigger":
 						requestString, _ := json.Marshal(e["request"])
 						buildId := e["buildId"].(string)
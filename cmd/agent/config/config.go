@@ -27,13 +27,14 @@ func (c *Config) String() string {
 }
 
 type Config struct {
-	Logging          Logging
-	KubeConfig       string `envconfig:"KUBECONFIG"`
-	Env              string `envconfig:"ENV"`
-	Namespace        string `envconfig:"NAMESPACE"`
-	Host             string `envconfig:"HOST"`
-	AgentKey         string `envconfig:"AGENT_KEY"`
-	ImageBuilderHost string `envconfig:"IMAGE_BUILDER_HOST"`
+	Logging                Logging
+	KubeConfig             string `envconfig:"KUBECONFIG"`
+	Env                    string `envconfig:"ENV"`
+	Namespace              string `envconfig:"NAMESPACE"`
+	Host                   string `envconfig:"HOST"`
+	AgentKey               string `envconfig:"AGENT_KEY"`
+	ImageBuilderHost       string `envconfig:"IMAGE_BUILDER_HOST"`
+	IngressNginxMetricsURL string `envconfig:"INGRESS_NGINX_METRICS_URL"`
 }
 
 // Logging provides the logging configuration.
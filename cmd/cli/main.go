@@ -10,6 +10,7 @@ import (
 	"github.com/gimlet-io/gimlet/pkg/commands/environment"
 	"github.com/gimlet-io/gimlet/pkg/commands/manifest"
 	"github.com/gimlet-io/gimlet/pkg/commands/release"
+	"github.com/gimlet-io/gimlet/pkg/commands/seal"
 	"github.com/gimlet-io/gimlet/pkg/commands/stack"
 	"github.com/gimlet-io/gimlet/pkg/version"
 	"github.com/urfave/cli/v2"
@@ -27,6 +28,7 @@ func main() {
 			&release.Command,
 			&stack.Command,
 			&environment.Command,
+			&seal.Command,
 			&commands.SyncCmd,
 		},
 	}
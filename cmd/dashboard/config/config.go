@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
 )
@@ -106,6 +107,8 @@ type Config struct {
 	WeeklySummaryFeatureFlag       bool   `envconfig:"FEATURE_WEEKLY_SUMMARY"`
 
 	AlertEvaluationFrequencySeconds int `envconfig:"ALERT_EVALUATION_FREQUENCY_SECONDS"`
+	// AlertImageDigestMismatch alerts when a pod runs a different image digest than the released artifact's
+	AlertImageDigestMismatch bool `envconfig:"ALERT_IMAGE_DIGEST_MISMATCH"`
 
 	PosthogFeatureFlagString string `envconfig:"FEATURE_POSTHOG"`
 	PosthogIdentifyUser      bool   `envconfig:"POSTHOG_IDENTIFY_USER"`
@@ -118,6 +121,39 @@ type Config struct {
 
 	Instance string `envconfig:"INSTANCE"`
 	License  string `envconfig:"LICENSE"`
+
+	// KubeVersion turns on the validation of rendered manifests for this Kubernetes version, before they are written to git
+	KubeVersion string `envconfig:"KUBE_VERSION"`
+	// CRDSchemaDir holds CustomResourceDefinitions to validate custom resources in rendered manifests, it turns on validation too
+	CRDSchemaDir string `envconfig:"CRD_SCHEMA_DIR"`
+	// PolicyDir holds policies that apply to every environment. Environment specific policies are in the infra repo
+	PolicyDir string `envconfig:"POLICY_DIR"`
+
+	Retention Retention
+
+	// RegistryWebhookSecret enables container registry push webhooks on /registry-hook, and authenticates them
+	RegistryWebhookSecret string `envconfig:"REGISTRY_WEBHOOK_SECRET"`
+	// RegistryWebhookConfig is a yaml file with the rules that map pushed images to git commits, and the registry credentials.
+	// The image updater uses the same registry credentials
+	RegistryWebhookConfig string `envconfig:"REGISTRY_WEBHOOK_CONFIG"`
+	// ImageUpdateIntervalMinutes is how often the registries of images with an image update policy are polled. Zero disables image updates
+	ImageUpdateIntervalMinutes int `envconfig:"IMAGE_UPDATE_INTERVAL_MINUTES"`
+}
+
+// Retention configures how long artifacts and events are kept in the database
+type Retention struct {
+	// ArtifactDays is how long artifacts are kept, unless they are deployed
+	// or referenced by a release in the release history window. Zero keeps artifacts forever
+	ArtifactDays int `envconfig:"RETENTION_ARTIFACT_DAYS"`
+	// EventDays is how long release, rollback, image build and other events are kept. Zero keeps them forever
+	EventDays int `envconfig:"RETENTION_EVENT_DAYS"`
+	// Archive is a local directory, or s3://bucket/prefix, where expired artifacts and events are archived to.
+	// They are deleted without archival if it is empty
+	Archive     string `envconfig:"RETENTION_ARCHIVE"`
+	S3Endpoint  string `envconfig:"RETENTION_S3_ENDPOINT"`
+	S3Region    string `envconfig:"RETENTION_S3_REGION"`
+	S3AccessKey string `envconfig:"RETENTION_S3_ACCESS_KEY"`
+	S3SecretKey string `envconfig:"RETENTION_S3_SECRET_KEY"`
 }
 
 // Logging provides the logging configuration.
@@ -180,6 +216,15 @@ func (m *Multiline) String() string {
 	return string(*m)
 }
 
+func (r *Retention) ArchiveS3Config() archive.S3Config {
+	return archive.S3Config{
+		Endpoint:  r.S3Endpoint,
+		Region:    r.S3Region,
+		AccessKey: r.S3AccessKey,
+		SecretKey: r.S3SecretKey,
+	}
+}
+
 func (c *Config) GitopsUpdaterFeatureFlag() bool {
 	flag, err := strconv.ParseBool(c.GitopsUpdaterFeatureFlagString)
 	if err != nil {
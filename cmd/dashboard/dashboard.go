@@ -14,12 +14,15 @@ import (
 	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
 	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/alert"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/notifications"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/registry"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/server"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/worker"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/customScm"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
 	"github.com/go-chi/chi/v5"
@@ -89,12 +92,16 @@ func main() {
 	tokenManager := customScm.NewTokenManager(dynamicConfig)
 	notificationsManager := initNotifications(config, dynamicConfig, tokenManager)
 
+	thresholds := alert.Thresholds()
+	if !config.AlertImageDigestMismatch {
+		delete(thresholds, alert.ImageDigestMismatch)
+	}
 	alertStateManager := alert.NewAlertStateManager(
 		notificationsManager,
 		clientHub,
 		*store,
 		config.AlertEvaluationFrequencySeconds,
-		alert.Thresholds(),
+		thresholds,
 		config.Host,
 	)
 	go alertStateManager.Run()
@@ -199,6 +206,27 @@ func main() {
 		go stackUpdater.Run()
 	}
 
+	var schemaValidator *dx.SchemaValidator
+	if config.KubeVersion != "" || config.CRDSchemaDir != "" {
+		schemaValidator, err = dx.NewSchemaValidator(config.KubeVersion, config.CRDSchemaDir)
+		if err != nil {
+			log.Errorf("cannot initialize manifest validation, manifests are not validated: %s", err)
+			schemaValidator = nil
+		}
+	}
+
+	policies := []dx.Policy{}
+	if config.PolicyDir != "" {
+		policies, err = dx.LoadPolicies(config.PolicyDir)
+		if err != nil {
+			panic(fmt.Errorf("cannot load policies: %s", err))
+		}
+		_, err = dx.NewPolicyEngine(policies)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	gitopsWorker := worker.NewGitopsWorker(
 		store,
 		tokenManager,
@@ -211,6 +239,8 @@ func main() {
 		config.GitHost,
 		agentHub,
 		dynamicConfig,
+		schemaValidator,
+		policies,
 	)
 	go gitopsWorker.Run()
 
@@ -229,10 +259,52 @@ func main() {
 		tokenManager,
 		config.RepoCachePath,
 		store,
+		repoCache,
 		stopCh,
 	)
 	go branchDeleteEventWorker.Run()
 
+	if config.Retention.ArtifactDays > 0 || config.Retention.EventDays > 0 {
+		retentionArchive, err := archive.New(config.Retention.Archive, config.Retention.ArchiveS3Config())
+		if err != nil {
+			panic(fmt.Errorf("cannot initialize retention archive: %s", err))
+		}
+		retentionWorker := worker.NewRetentionWorker(
+			store,
+			repoCache,
+			retentionArchive,
+			config.Retention.ArtifactDays,
+			config.Retention.EventDays,
+			config.ReleaseHistorySinceDays,
+			perf,
+		)
+		go retentionWorker.Run()
+	}
+
+	if config.ImageUpdateIntervalMinutes > 0 {
+		registryConfig := &registry.Config{}
+		if config.RegistryWebhookConfig != "" {
+			registryConfigYaml, err := os.ReadFile(config.RegistryWebhookConfig)
+			if err != nil {
+				panic(fmt.Errorf("cannot read registry config: %s", err))
+			}
+			registryConfig, err = registry.ParseConfig(string(registryConfigYaml))
+			if err != nil {
+				panic(err)
+			}
+		}
+		imageUpdater := worker.NewImageUpdater(
+			store,
+			dynamicConfig,
+			tokenManager,
+			repoCache,
+			notificationsManager,
+			registryConfig.Registries,
+			time.Duration(config.ImageUpdateIntervalMinutes)*time.Minute,
+		)
+		go imageUpdater.Run()
+	}
+
 	cloudSettingsWriter := worker.NewCloudSettingsWriter(store, repoCache, tokenManager, gitUser, config, agentHub)
 	go cloudSettingsWriter.Run()
 
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/sirupsen/logrus"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+const canaryCRDName = "canaries.flagger.app"
+
+// CanaryController sends the progress and analysis results of Flagger rollouts to the dashboard
+func CanaryController(kubeEnv *KubeEnv, gimletHost string, agentKey string) *Controller {
+	return NewDynamicController(
+		canaryCRDName,
+		kubeEnv.DynamicClient,
+		canaryResource,
+		func(informerEvent Event, objectMeta meta_v1.ObjectMeta, obj interface{}) error {
+			switch informerEvent.eventType {
+			case "create":
+				fallthrough
+			case "update":
+				namespace, name, err := cache.SplitMetaNamespaceKey(informerEvent.key)
+				if err != nil {
+					return err
+				}
+				canary, err := kubeEnv.DynamicClient.Resource(canaryResource).Namespace(namespace).Get(context.TODO(), name, meta_v1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				sendRollout(kubeEnv, gimletHost, agentKey, rolloutFromCanary(canary))
+			}
+			return nil
+		})
+}
+
+func rolloutFromCanary(canary *unstructured.Unstructured) *api.Rollout {
+	phase, _, _ := unstructured.NestedString(canary.Object, "status", "phase")
+	canaryWeight, _, _ := unstructured.NestedInt64(canary.Object, "status", "canaryWeight")
+	iterations, _, _ := unstructured.NestedInt64(canary.Object, "status", "iterations")
+	failedChecks, _, _ := unstructured.NestedInt64(canary.Object, "status", "failedChecks")
+
+	since := time.Now().Unix()
+	lastTransitionTime, _, _ := unstructured.NestedString(canary.Object, "status", "lastTransitionTime")
+	if t, err := time.Parse(time.RFC3339, lastTransitionTime); err == nil {
+		since = t.Unix()
+	}
+
+	message := ""
+	conditions, _, _ := unstructured.NestedSlice(canary.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if condition["type"] == "Promoted" {
+			message, _ = condition["message"].(string)
+		}
+	}
+
+	annotations := canary.GetAnnotations()
+	return &api.Rollout{
+		Namespace:    canary.GetNamespace(),
+		Name:         canary.GetName(),
+		App:          annotations[dx.AnnotationApp],
+		Repo:         annotations[dx.AnnotationGitRepository],
+		SHA:          annotations[dx.AnnotationGitSha],
+		ArtifactID:   annotations[dx.AnnotationArtifactID],
+		Phase:        phase,
+		CanaryWeight: int(canaryWeight),
+		Iterations:   int(iterations),
+		FailedChecks: int(failedChecks),
+		Message:      message,
+		Since:        since,
+	}
+}
+
+func sendRollout(kubeEnv *KubeEnv, gimletHost string, agentKey string, rollout *api.Rollout) {
+	rolloutString, err := json.Marshal(rollout)
+	if err != nil {
+		logrus.Errorf("could not serialize rollout: %v", err)
+		return
+	}
+
+	params := url.Values{}
+	params.Add("name", kubeEnv.Name)
+	reqUrl := fmt.Sprintf("%s/agent/rollout?%s", gimletHost, params.Encode())
+	req, err := http.NewRequest("POST", reqUrl, bytes.NewBuffer(rolloutString))
+	if err != nil {
+		logrus.Errorf("could not create http request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "BEARER "+agentKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := httpClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Errorf("could not send rollout: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		logrus.Errorf("could not send rollout: %d - %v", resp.StatusCode, string(body))
+		return
+	}
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const ingressNginxRequestsMetric = "nginx_ingress_controller_requests"
+
+// IdleWatcher scales preview deployments with an idle policy to zero when they were not deployed,
+// and optionally not accessed, for the duration of the policy. It also wakes them up on request.
+type IdleWatcher struct {
+	kubeEnv    *KubeEnv
+	gimletHost string
+	agentKey   string
+	traffic    *ingressTraffic
+}
+
+func NewIdleWatcher(kubeEnv *KubeEnv, gimletHost string, agentKey string, ingressNginxMetricsURL string) *IdleWatcher {
+	return &IdleWatcher{
+		kubeEnv:    kubeEnv,
+		gimletHost: gimletHost,
+		agentKey:   agentKey,
+		traffic:    newIngressTraffic(ingressNginxMetricsURL),
+	}
+}
+
+func (w *IdleWatcher) Run(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(1 * time.Minute):
+		}
+
+		err := w.traffic.scrape()
+		if err != nil {
+			logrus.Warnf("could not scrape ingress-nginx metrics: %s", err)
+		}
+
+		w.sleepIdleDeployments()
+	}
+}
+
+func (w *IdleWatcher) sleepIdleDeployments() {
+	deployments, err := w.kubeEnv.Client.AppsV1().Deployments(w.kubeEnv.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		logrus.Errorf("could not get deployments: %s", err)
+		return
+	}
+
+	for _, d := range deployments.Items {
+		annotations := d.GetAnnotations()
+		idleAfter, ok := annotations[dx.AnnotationIdleAfter]
+		if !ok || annotations[dx.AnnotationSleepingSince] != "" {
+			continue
+		}
+		if d.Spec.Replicas != nil && *d.Spec.Replicas == 0 {
+			continue
+		}
+
+		after, err := time.ParseDuration(idleAfter)
+		if err != nil {
+			logrus.Warnf("invalid idle duration on %s/%s: %s", d.Namespace, d.Name, err)
+			continue
+		}
+
+		lastActivity := lastDeploy(d)
+		if annotations[dx.AnnotationIdleTraffic] == "true" {
+			if !w.traffic.known() {
+				// there is no traffic baseline yet, eg. right after an agent restart
+				continue
+			}
+			lastRequest := w.traffic.lastRequest(d.Namespace, d.Name)
+			if lastRequest.After(lastActivity) {
+				lastActivity = lastRequest
+			}
+		}
+
+		if time.Since(lastActivity) > after {
+			err := w.sleep(d)
+			if err != nil {
+				logrus.Errorf("could not scale %s/%s to zero: %s", d.Namespace, d.Name, err)
+			}
+		}
+	}
+}
+
+// lastDeploy is the time of the last rollout, or wake up, of the deployment
+func lastDeploy(d appsv1.Deployment) time.Time {
+	last := d.CreationTimestamp.Time
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.LastUpdateTime.Time.After(last) {
+			last = c.LastUpdateTime.Time
+		}
+	}
+	if wokenAt, err := strconv.ParseInt(d.GetAnnotations()[dx.AnnotationWokenAt], 10, 64); err == nil {
+		if t := time.Unix(wokenAt, 0); t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// sleep scales the deployment to zero. Flux reconciliation is disabled on the object, so it doesn't scale it back
+func (w *IdleWatcher) sleep(d appsv1.Deployment) error {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				dx.AnnotationFluxReconcile:       "disabled",
+				dx.AnnotationSleepingSince:       strconv.FormatInt(time.Now().Unix(), 10),
+				dx.AnnotationReplicasBeforeSleep: strconv.Itoa(int(replicas)),
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 0,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	sleeping, err := w.kubeEnv.Client.AppsV1().Deployments(d.Namespace).Patch(context.TODO(), d.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("%s/%s is idle, scaled to zero", d.Namespace, d.Name)
+	w.report(sleeping, true)
+	return nil
+}
+
+// WakeUp scales a sleeping deployment back to its replica count before the sleep, and gives it back to Flux
+func (w *IdleWatcher) WakeUp(namespace string, name string) {
+	d, err := w.kubeEnv.Client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		logrus.Errorf("could not get deployment %s/%s: %s", namespace, name, err)
+		return
+	}
+	if d.GetAnnotations()[dx.AnnotationSleepingSince] == "" {
+		return
+	}
+
+	replicas, err := strconv.Atoi(d.GetAnnotations()[dx.AnnotationReplicasBeforeSleep])
+	if err != nil || replicas < 1 {
+		replicas = 1
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				dx.AnnotationFluxReconcile:       nil,
+				dx.AnnotationSleepingSince:       nil,
+				dx.AnnotationReplicasBeforeSleep: nil,
+				dx.AnnotationWokenAt:             strconv.FormatInt(time.Now().Unix(), 10),
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+	if err != nil {
+		logrus.Errorf("could not serialize patch: %s", err)
+		return
+	}
+
+	awake, err := w.kubeEnv.Client.AppsV1().Deployments(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		logrus.Errorf("could not wake up %s/%s: %s", namespace, name, err)
+		return
+	}
+
+	logrus.Infof("%s/%s woke up", namespace, name)
+	w.report(awake, false)
+}
+
+func (w *IdleWatcher) report(d *appsv1.Deployment, sleeping bool) {
+	preview := api.IdlePreview{
+		Namespace: d.Namespace,
+		Name:      d.Name,
+		Branch:    d.GetAnnotations()[AnnotationGitBranch],
+		SHA:       d.GetAnnotations()[AnnotationGitSha],
+		Sleeping:  sleeping,
+		Since:     time.Now().Unix(),
+	}
+
+	services, err := w.kubeEnv.annotatedServices("")
+	if err != nil {
+		logrus.Warnf("could not get services: %s", err)
+	}
+	for _, svc := range services {
+		if svc.Namespace == d.Namespace && SelectorsMatch(d.Spec.Selector.MatchLabels, svc.Spec.Selector) {
+			preview.Repo = svc.GetAnnotations()[AnnotationGitRepository]
+		}
+	}
+
+	ingress, err := w.kubeEnv.Client.NetworkingV1().Ingresses(d.Namespace).Get(context.TODO(), d.Name, metav1.GetOptions{})
+	if err == nil && len(ingress.Spec.Rules) > 0 {
+		preview.Host = ingress.Spec.Rules[0].Host
+	}
+
+	previewString, err := json.Marshal(preview)
+	if err != nil {
+		logrus.Errorf("could not serialize idle preview: %v", err)
+		return
+	}
+
+	params := url.Values{}
+	params.Add("name", w.kubeEnv.Name)
+	reqUrl := fmt.Sprintf("%s/agent/idlePreview?%s", w.gimletHost, params.Encode())
+	req, err := http.NewRequest("POST", reqUrl, bytes.NewBuffer(previewString))
+	if err != nil {
+		logrus.Errorf("could not create http request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "BEARER "+w.agentKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := httpClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Errorf("could not send idle preview: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		logrus.Errorf("could not send idle preview: %d - %v", resp.StatusCode, string(body))
+		return
+	}
+}
+
+// ingressTraffic tracks when the request counters of ingress-nginx last changed, per ingress.
+// Gimlet previews have an ingress with the same name as their deployment.
+// The counters are only kept in memory, so an ingress counts as accessed when its counter is first seen.
+type ingressTraffic struct {
+	metricsURL   string
+	scraped      bool
+	requests     map[string]float64
+	lastRequests map[string]time.Time
+}
+
+func newIngressTraffic(metricsURL string) *ingressTraffic {
+	return &ingressTraffic{
+		metricsURL:   metricsURL,
+		requests:     map[string]float64{},
+		lastRequests: map[string]time.Time{},
+	}
+}
+
+func (t *ingressTraffic) scrape() error {
+	if t.metricsURL == "" {
+		return nil
+	}
+
+	resp, err := httpClient().Get(t.metricsURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", t.metricsURL, resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	t.update(requestsPerIngress(families[ingressNginxRequestsMetric]), time.Now())
+	return nil
+}
+
+func (t *ingressTraffic) update(requests map[string]float64, now time.Time) {
+	for key, count := range requests {
+		// without a baseline, the ingress may have been accessed any time, so it is treated as accessed now
+		if previous, ok := t.requests[key]; !ok || count != previous {
+			t.lastRequests[key] = now
+		}
+		t.requests[key] = count
+	}
+	t.scraped = true
+}
+
+// known tells if traffic is tracked: either it is not set up, or the counters were scraped at least once
+func (t *ingressTraffic) known() bool {
+	return t.metricsURL == "" || t.scraped
+}
+
+func (t *ingressTraffic) lastRequest(namespace string, ingress string) time.Time {
+	return t.lastRequests[namespace+"/"+ingress]
+}
+
+// requestsPerIngress sums the request counters of ingress-nginx by namespace and ingress
+func requestsPerIngress(family *dto.MetricFamily) map[string]float64 {
+	requests := map[string]float64{}
+	if family == nil {
+		return requests
+	}
+
+	for _, m := range family.Metric {
+		var namespace, ingress string
+		for _, l := range m.Label {
+			switch l.GetName() {
+			case "namespace":
+				namespace = l.GetValue()
+			case "ingress":
+				ingress = l.GetValue()
+			}
+		}
+		if ingress == "" || m.Counter == nil {
+			continue
+		}
+		requests[namespace+"/"+ingress] += m.Counter.GetValue()
+	}
+	return requests
+}
@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ingressTraffic(t *testing.T) {
+	traffic := newIngressTraffic("http://ingress-nginx-controller-metrics:10254/metrics")
+	assert.False(t, traffic.known(), "there is no baseline before the first scrape")
+
+	started := time.Now()
+	traffic.update(map[string]float64{"preview/myapp-feature": 42}, started)
+	assert.True(t, traffic.known())
+	assert.Equal(t, started, traffic.lastRequest("preview", "myapp-feature"), "a counter without a baseline counts as accessed")
+
+	traffic.update(map[string]float64{"preview/myapp-feature": 42}, started.Add(time.Minute))
+	assert.Equal(t, started, traffic.lastRequest("preview", "myapp-feature"), "an unchanged counter is not an access")
+
+	traffic.update(map[string]float64{"preview/myapp-feature": 43}, started.Add(2*time.Minute))
+	assert.Equal(t, started.Add(2*time.Minute), traffic.lastRequest("preview", "myapp-feature"))
+
+	assert.True(t, newIngressTraffic("").known(), "without traffic tracking only deploys count")
+}
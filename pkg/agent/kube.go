@@ -19,10 +19,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gimlet-io/capacitor/pkg/flux"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
@@ -108,7 +110,7 @@ func (e *KubeEnv) Services(repo string) ([]*api.Stack, error) {
 					if podStatus == "CrashLoopBackOff" || podStatus == "Error" {
 						podLogs = logs(e, pod)
 					}
-					deployment.Pods = append(deployment.Pods, &api.Pod{Name: pod.Name, DeploymentName: deployment.Name, Namespace: pod.Namespace, Status: podStatus, StatusDescription: podErrorCause(pod), Logs: podLogs, ImChannelId: service.ObjectMeta.GetAnnotations()[AnnotationOwnerIm], Containers: PodContainers(pod.Spec)})
+					deployment.Pods = append(deployment.Pods, &api.Pod{Name: pod.Name, DeploymentName: deployment.Name, Namespace: pod.Namespace, Status: podStatus, StatusDescription: podErrorCause(pod), Logs: podLogs, ImChannelId: service.ObjectMeta.GetAnnotations()[AnnotationOwnerIm], Containers: PodContainers(pod.Spec), Images: PodImages(pod)})
 				}
 			}
 		}
@@ -145,6 +147,40 @@ func PodContainers(podSpec v1.PodSpec) (containers []v1.Container) {
 	return containers
 }
 
+// PodImages returns the images of the containers with the digest they run, from the image IDs of the container statuses
+func PodImages(pod v1.Pod) []*api.ContainerImage {
+	specImages := map[string]string{}
+	for _, container := range PodContainers(pod.Spec) {
+		specImages[container.Name] = container.Image
+	}
+
+	images := []*api.ContainerImage{}
+	statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		image := specImages[status.Name]
+		if image == "" {
+			image = status.Image
+		}
+		images = append(images, &api.ContainerImage{
+			Container: status.Name,
+			Image:     image,
+			Digest:    imageIDDigest(status.ImageID),
+		})
+	}
+	return images
+}
+
+// imageIDDigest returns the repo digest of an image ID, eg.: docker-pullable://nginx@sha256:...
+// Image IDs of local images have no repo digest
+func imageIDDigest(imageID string) string {
+	parts := strings.SplitN(imageID, "@", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
 func (e *KubeEnv) FluxState() (*flux.FluxState, error) {
 	return flux.State(e.Client.(*kubernetes.Clientset), e.DynamicClient.(*dynamic.DynamicClient))
 }
@@ -293,7 +329,9 @@ func (e *KubeEnv) deploymentForService(service v1.Service, deployments []appsv1.
 				branch = b
 			}
 
-			deployment = &api.Deployment{Name: d.Name, Namespace: d.Namespace, Branch: branch, SHA: sha}
+			artifactID := d.GetAnnotations()[dx.AnnotationArtifactID]
+
+			deployment = &api.Deployment{Name: d.Name, Namespace: d.Namespace, Branch: branch, SHA: sha, ArtifactID: artifactID}
 		}
 	}
 
@@ -313,7 +351,9 @@ func (e *KubeEnv) statefulsetForService(service v1.Service, statefulsets []appsv
 				branch = b
 			}
 
-			statefulset = &api.Deployment{Name: s.Name, Namespace: s.Namespace, Branch: branch, SHA: sha}
+			artifactID := s.GetAnnotations()[dx.AnnotationArtifactID]
+
+			statefulset = &api.Deployment{Name: s.Name, Namespace: s.Namespace, Branch: branch, SHA: sha, ArtifactID: artifactID}
 		}
 	}
 
@@ -425,3 +465,15 @@ func count(e v1.Event) int32 {
 	}
 	return 0
 }
+
+var terraformResource = schema.GroupVersionResource{
+	Group:    "infra.contrib.fluxcd.io",
+	Version:  "v1alpha2",
+	Resource: "terraforms",
+}
+
+var canaryResource = schema.GroupVersionResource{
+	Group:    "flagger.app",
+	Version:  "v1beta1",
+	Resource: "canaries",
+}
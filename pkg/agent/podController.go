@@ -152,6 +152,7 @@ func newFunction(matchLabels map[string]string, namespace string, name string, s
 				ErrorCause:  podErrorCause(*updatedPod),
 				Logs:        podLogs,
 				ImChannelId: svc.GetAnnotations()[AnnotationOwnerIm],
+				Images:      PodImages(*updatedPod),
 			}
 			sendUpdate(gimletHost, agentKey, kubeEnv.Name, update)
 		}
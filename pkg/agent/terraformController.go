@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/sirupsen/logrus"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+const terraformCRDName = "terraforms.infra.contrib.fluxcd.io"
+
+// TerraformController sends the pending plans of manually approved Terraform objects to the dashboard for review
+func TerraformController(kubeEnv *KubeEnv, gimletHost string, agentKey string) *Controller {
+	return NewDynamicController(
+		terraformCRDName,
+		kubeEnv.DynamicClient,
+		terraformResource,
+		func(informerEvent Event, objectMeta meta_v1.ObjectMeta, obj interface{}) error {
+			switch informerEvent.eventType {
+			case "create":
+				fallthrough
+			case "update":
+				namespace, name, err := cache.SplitMetaNamespaceKey(informerEvent.key)
+				if err != nil {
+					return err
+				}
+				terraform, err := kubeEnv.DynamicClient.Resource(terraformResource).Namespace(namespace).Get(context.TODO(), name, meta_v1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				plan := pendingTerraformPlan(kubeEnv, terraform)
+				if plan != nil {
+					sendTerraformPlan(kubeEnv, gimletHost, agentKey, plan)
+				}
+			}
+			return nil
+		})
+}
+
+// pendingTerraformPlan returns the plan that waits for approval, or nil if there is none
+func pendingTerraformPlan(kubeEnv *KubeEnv, terraform *unstructured.Unstructured) *api.TerraformPlan {
+	planID, _, _ := unstructured.NestedString(terraform.Object, "status", "plan", "pending")
+	if planID == "" {
+		return nil
+	}
+	approvePlan, _, _ := unstructured.NestedString(terraform.Object, "spec", "approvePlan")
+	if approvePlan == "auto" || approvePlan == planID {
+		return nil
+	}
+
+	workspace, _, _ := unstructured.NestedString(terraform.Object, "spec", "workspace")
+	if workspace == "" {
+		workspace = "default"
+	}
+
+	readablePlan := ""
+	configMapName := fmt.Sprintf("tfplan-%s-%s", workspace, terraform.GetName())
+	configMap, err := kubeEnv.Client.CoreV1().ConfigMaps(terraform.GetNamespace()).Get(context.TODO(), configMapName, meta_v1.GetOptions{})
+	if err != nil {
+		logrus.Warnf("could not get readable plan for %s/%s: %s", terraform.GetNamespace(), terraform.GetName(), err)
+	} else {
+		readablePlan = configMap.Data["tfplan"]
+	}
+
+	return &api.TerraformPlan{
+		Name:      terraform.GetName(),
+		Namespace: terraform.GetNamespace(),
+		PlanID:    planID,
+		Plan:      readablePlan,
+		Summary:   terraformPlanSummary(readablePlan),
+		Status:    api.TerraformPlanPending,
+		Created:   time.Now().Unix(),
+	}
+}
+
+// terraformPlanSummary returns the "Plan: 1 to add, 0 to change, 0 to destroy." line of a human readable plan
+func terraformPlanSummary(plan string) string {
+	for _, line := range strings.Split(plan, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Plan:") || strings.HasPrefix(line, "No changes.") {
+			return line
+		}
+	}
+	return ""
+}
+
+func sendTerraformPlan(kubeEnv *KubeEnv, gimletHost string, agentKey string, plan *api.TerraformPlan) {
+	planString, err := json.Marshal(plan)
+	if err != nil {
+		logrus.Errorf("could not serialize terraform plan: %v", err)
+		return
+	}
+
+	params := url.Values{}
+	params.Add("name", kubeEnv.Name)
+	reqUrl := fmt.Sprintf("%s/agent/terraformPlan?%s", gimletHost, params.Encode())
+	req, err := http.NewRequest("POST", reqUrl, bytes.NewBuffer(planString))
+	if err != nil {
+		logrus.Errorf("could not create http request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "BEARER "+agentKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := httpClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Errorf("could not send terraform plan: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		logrus.Errorf("could not send terraform plan: %d - %v", resp.StatusCode, string(body))
+		return
+	}
+}
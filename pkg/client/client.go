@@ -27,6 +27,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dx"
 )
@@ -45,6 +46,8 @@ const (
 	pathGitopsRepo         = "%s/api/gitopsRepo"
 	pathGitopsCommits      = "%s/api/gitopsCommits"
 	pathGitopsManifests    = "%s/api/gitopsManifests"
+	pathSealValues         = "%s/api/env/%s/sealValues"
+	pathReseal             = "%s/api/env/%s/reseal"
 )
 
 type client struct {
@@ -407,6 +410,28 @@ func (c *client) GitopsManifestsGet(envName string) (map[string]map[string]strin
 	return res, nil
 }
 
+// SealValuesPost seals a map of values with the sealed-secrets key of the environment
+func (c *client) SealValuesPost(env string, values map[string]interface{}) (*api.SealedValues, error) {
+	uri := fmt.Sprintf(pathSealValues, c.addr, env)
+	result := new(api.SealedValues)
+	err := c.post(uri, values, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResealPost re-seals the sealed values of an environment with its current sealed-secrets key
+func (c *client) ResealPost(env string, request api.ResealRequest) (*api.ResealResult, error) {
+	uri := fmt.Sprintf(pathReseal, c.addr, env)
+	result := new(api.ResealResult)
+	err := c.post(uri, request, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *client) get(rawURL string, out interface{}) error {
 	return c.do(rawURL, "GET", nil, out)
 }
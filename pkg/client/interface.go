@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dx"
 )
@@ -88,4 +89,10 @@ type Client interface {
 
 	//GitopsManifestsGet retrieve the gitops manifests from the infrastructure and applications repository of the environment
 	GitopsManifestsGet(envName string) (map[string]map[string]string, error)
+
+	// SealValuesPost seals a map of values with the sealed-secrets key of the environment
+	SealValuesPost(env string, values map[string]interface{}) (*api.SealedValues, error)
+
+	// ResealPost re-seals the sealed values of an environment with its current sealed-secrets key
+	ResealPost(env string, request api.ResealRequest) (*api.ResealResult, error)
 }
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -19,6 +21,10 @@ var artifactAddCmd = cli.Command{
 	UsageText: `gimlet artifact add \
      --field name=CI \
      --field url=https://jenkins.example.com/job/dev/84/display/redirect \
+     --image ghcr.io/gimlet-io/myapp:ea9ab7c@sha256:0d2f6a39cf5f21b7a0c3c15e34cc2f1ed2ba3f8c02ec01c8e5b8e1bd1d9cb3a4 \
+     --secret-var SENTRY_DSN=https://key@sentry.example.com/42 \
+     --attach type=sbom,file=sbom.spdx.json \
+     --attach type=test,file=junit.xml \
      -f artifact.json`,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
@@ -38,10 +44,33 @@ var artifactAddCmd = cli.Command{
 			Name:  "envFile",
 			Usage: "a Gimlet environment file to attach to the artifact",
 		},
+		&cli.StringSliceFlag{
+			Name:  "jpath",
+			Usage: "a vendored Jsonnet library directory (eg.: lib/) to attach for the Jsonnet environment files",
+		},
 		&cli.StringSliceFlag{
 			Name:  "var",
 			Usage: "variables to make available in the Gimlet environment file",
 		},
+		&cli.StringSliceFlag{
+			Name:  "image",
+			Usage: "a container image of the build in a repository:tag[@sha256:digest] format. Gimlet verifies that deployments run this digest, or the first digest it sees if it is left out",
+		},
+		&cli.GenericFlag{
+			Name:  "attach",
+			Usage: "attach a build output in a type=<sbom|provenance|test|coverage>,file=<path>[,name=<name>] format. SBOMs are SPDX or CycloneDX JSON, provenance is SLSA, test reports are JUnit XML, coverage is Cobertura, LCOV or a Go cover profile",
+			Value: &repeatedFlag{},
+		},
+		&cli.GenericFlag{
+			Name:  "secret-var",
+			Usage: "add a sensitive variable in a NAME=value format. Sensitive variables are masked everywhere but in manifest templating. Variables with a secret-like name, eg. API_TOKEN, are sensitive without this flag",
+			Value: &repeatedFlag{},
+		},
+		&cli.StringFlag{
+			Name:    "signing-key",
+			Usage:   "sign the updated artifact with this PEM encoded ed25519 or ECDSA private key, GIMLET_SIGNING_KEY environment variable alternatively",
+			EnvVars: []string{"GIMLET_SIGNING_KEY"},
+		},
 	},
 	Action: add,
 }
@@ -73,6 +102,23 @@ func add(c *cli.Context) error {
 		a.Items = append(a.Items, item)
 	}
 
+	if secretVars, ok := c.Generic("secret-var").(*repeatedFlag); ok {
+		defer func() { secretVars.values = nil }() // the flag value outlives the command run
+		for _, secretVar := range secretVars.values {
+			name, value, found := strings.Cut(secretVar, "=")
+			if !found || name == "" {
+				return fmt.Errorf("invalid secret var, use the NAME=value format")
+			}
+			if a.Vars == nil {
+				a.Vars = map[string]string{}
+			}
+			a.Vars[name] = value
+			if !a.IsSensitiveVar(name) {
+				a.SecretVars = append(a.SecretVars, name)
+			}
+		}
+	}
+
 	envFiles := c.StringSlice("envFile")
 	envs := []*dx.Manifest{}
 	for _, envFile := range envFiles {
@@ -80,6 +126,10 @@ func add(c *cli.Context) error {
 		if err != nil {
 			return fmt.Errorf("cannot read file %s", err)
 		}
+		if strings.HasSuffix(envFile, ".jsonnet") {
+			a.JsonnetEnvironments = append(a.JsonnetEnvironments, string(envString))
+			continue
+		}
 		var m dx.Manifest
 		err = yaml.Unmarshal(envString, &m)
 		if err != nil {
@@ -89,6 +139,19 @@ func add(c *cli.Context) error {
 	}
 	a.Environments = append(a.Environments, envs...)
 
+	for _, libPath := range c.StringSlice("jpath") {
+		libraries, err := jsonnetLibraries(libPath)
+		if err != nil {
+			return fmt.Errorf("cannot read jsonnet libraries %s", err)
+		}
+		for k, v := range libraries {
+			if a.JsonnetLibraries == nil {
+				a.JsonnetLibraries = map[string]string{}
+			}
+			a.JsonnetLibraries[k] = v
+		}
+	}
+
 	vars := c.StringSlice("var")
 	context := map[string]string{}
 	for _, v := range vars {
@@ -119,6 +182,34 @@ func add(c *cli.Context) error {
 		}
 	}
 
+	for _, reference := range c.StringSlice("image") {
+		image, err := dx.ParseArtifactImage(reference)
+		if err != nil {
+			return err
+		}
+		if existing := a.Image(image.Name); existing != nil {
+			existing.Digest = image.Digest
+		} else {
+			a.Images = append(a.Images, image)
+		}
+	}
+
+	if attachments, ok := c.Generic("attach").(*repeatedFlag); ok {
+		defer func() { attachments.values = nil }() // the flag value outlives the command run
+		for _, spec := range attachments.values {
+			err = attach(&a, spec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	a.Signature = "" // the signature of the original artifact doesn't hold anymore
+	err = sign(&a, c.String("signing-key"))
+	if err != nil {
+		return err
+	}
+
 	jsonString := bytes.NewBufferString("")
 	e := json.NewEncoder(jsonString)
 	e.SetIndent("", "  ")
@@ -131,3 +222,34 @@ func add(c *cli.Context) error {
 
 	return nil
 }
+
+// jsonnetLibraries reads the Jsonnet and JSON files of a vendored library directory,
+// keyed by their path relative to the library root, the way Jsonnet imports reference them
+func jsonnetLibraries(libPath string) (map[string]string, error) {
+	libraries := map[string]string{}
+	err := filepath.WalkDir(libPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		extension := filepath.Ext(path)
+		if extension != ".jsonnet" && extension != ".libsonnet" && extension != ".json" {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(libPath, path)
+		if err != nil {
+			return err
+		}
+		libraries[filepath.ToSlash(relativePath)] = string(content)
+		return nil
+	})
+
+	return libraries, err
+}
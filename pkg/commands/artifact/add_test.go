@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -343,3 +344,220 @@ func Test_add(t *testing.T) {
 		}
 	})
 }
+
+const jsonnetEnv = `
+local app = import 'app.libsonnet';
+
+{
+  configs: [app.new('fosdem-2021', env) for env in ['staging', 'production']],
+}
+`
+
+const jsonnetAppLibrary = `
+{
+  new(name, env):: {
+    app: name,
+    env: env,
+    namespace: 'default',
+    chart: {
+      repository: 'https://chart.onechart.dev',
+      name: 'onechart',
+      version: '0.10.0',
+    },
+  },
+}
+`
+
+func Test_addJsonnet(t *testing.T) {
+	artifactFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	if err != nil {
+		t.Fatalf("Error creating artifact file: %s", err)
+	}
+	defer os.Remove(artifactFile.Name())
+	ioutil.WriteFile(artifactFile.Name(), []byte(artifactToExtend), commands.File_RW_RW_R)
+
+	envFile, err := ioutil.TempFile("", "gimlet-cli-test-*.jsonnet")
+	if err != nil {
+		t.Fatalf("Error creating env file: %s", err)
+	}
+	defer os.Remove(envFile.Name())
+	ioutil.WriteFile(envFile.Name(), []byte(jsonnetEnv), commands.File_RW_RW_R)
+
+	libDir, err := ioutil.TempDir("", "gimlet-cli-test-lib")
+	if err != nil {
+		t.Fatalf("Error creating lib dir: %s", err)
+	}
+	defer os.RemoveAll(libDir)
+	ioutil.WriteFile(filepath.Join(libDir, "app.libsonnet"), []byte(jsonnetAppLibrary), commands.File_RW_RW_R)
+	ioutil.WriteFile(filepath.Join(libDir, "README.md"), []byte("vendored libs"), commands.File_RW_RW_R)
+
+	args := strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--envFile", envFile.Name())
+	args = append(args, "--jpath", libDir)
+	if err := commands.Run(&Command, args); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(artifactFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	var a dx.Artifact
+	if err := json.Unmarshal(content, &a); err != nil {
+		t.Fatalf("Error unmarshaling JSON: %s", err)
+	}
+
+	if len(a.JsonnetEnvironments) != 1 {
+		t.Errorf("Expected 1 jsonnet env, got %d", len(a.JsonnetEnvironments))
+	}
+
+	if len(a.JsonnetLibraries) != 1 {
+		t.Errorf("Expected 1 jsonnet library, got %d", len(a.JsonnetLibraries))
+	}
+
+	manifests, err := a.JsonnetEnvironmentsToManifests()
+	if err != nil {
+		t.Fatalf("Error rendering jsonnet environments: %s", err)
+	}
+
+	if len(manifests) != 2 {
+		t.Errorf("Expected 2 manifests, got %d", len(manifests))
+	}
+}
+
+func Test_addAttachment(t *testing.T) {
+	artifactFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	if err != nil {
+		t.Fatalf("Error creating artifact file: %s", err)
+	}
+	defer os.Remove(artifactFile.Name())
+	ioutil.WriteFile(artifactFile.Name(), []byte(artifactToExtend), commands.File_RW_RW_R)
+
+	coverDir, err := ioutil.TempDir("", "gimlet-cli-test-cover")
+	if err != nil {
+		t.Fatalf("Error creating cover dir: %s", err)
+	}
+	defer os.RemoveAll(coverDir)
+	coverFile := filepath.Join(coverDir, "cover.out")
+	ioutil.WriteFile(coverFile, []byte(`mode: set
+github.com/gimlet-io/gimlet/pkg/dx/artifact.go:10.1,12.2 3 1
+github.com/gimlet-io/gimlet/pkg/dx/artifact.go:14.1,16.2 1 0
+`), commands.File_RW_RW_R)
+
+	args := strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--attach", "type=coverage,file="+coverFile)
+	if err := commands.Run(&Command, args); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(artifactFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	var a dx.Artifact
+	if err := json.Unmarshal(content, &a); err != nil {
+		t.Fatalf("Error unmarshaling JSON: %s", err)
+	}
+
+	if len(a.Attachments) != 1 {
+		t.Fatalf("Expected 1 attachment, got %d", len(a.Attachments))
+	}
+	if a.Attachments[0].Name != "cover.out" || a.Attachments[0].Format != "go" {
+		t.Errorf("Expected a go cover profile named cover.out, got %s %s", a.Attachments[0].Format, a.Attachments[0].Name)
+	}
+	if a.Attachments[0].Summary.Coverage != 75 {
+		t.Errorf("Expected 75%% coverage, got %f", a.Attachments[0].Summary.Coverage)
+	}
+	if err := a.Attachments[0].VerifyContent(); err != nil {
+		t.Errorf("Expected the content to match the digest: %s", err)
+	}
+
+	args = strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--attach", "type=unknown,file="+coverFile)
+	if err := commands.Run(&Command, args); err == nil {
+		t.Errorf("Expected an error for an unknown attachment type")
+	}
+}
+
+func Test_addImage(t *testing.T) {
+	artifactFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	if err != nil {
+		t.Fatalf("Error creating artifact file: %s", err)
+	}
+	defer os.Remove(artifactFile.Name())
+	ioutil.WriteFile(artifactFile.Name(), []byte(artifactToExtend), commands.File_RW_RW_R)
+
+	args := strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--image", "ghcr.io/gimlet-io/my-app:ea9ab7c@sha256:0d2f6a39")
+	args = append(args, "--image", "ghcr.io/gimlet-io/my-app-worker:ea9ab7c")
+	if err := commands.Run(&Command, args); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(artifactFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	var a dx.Artifact
+	if err := json.Unmarshal(content, &a); err != nil {
+		t.Fatalf("Error unmarshaling JSON: %s", err)
+	}
+
+	if len(a.Images) != 2 {
+		t.Fatalf("Expected 2 images, got %d", len(a.Images))
+	}
+	if a.Images[0].Name != "ghcr.io/gimlet-io/my-app:ea9ab7c" || a.Images[0].Digest != "sha256:0d2f6a39" {
+		t.Errorf("Expected the digest to be pinned, got %s@%s", a.Images[0].Name, a.Images[0].Digest)
+	}
+	if a.Images[1].Digest != "" {
+		t.Errorf("Expected no digest, got %s", a.Images[1].Digest)
+	}
+}
+
+func Test_addSecretVar(t *testing.T) {
+	artifactFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	if err != nil {
+		t.Fatalf("Error creating artifact file: %s", err)
+	}
+	defer os.Remove(artifactFile.Name())
+	ioutil.WriteFile(artifactFile.Name(), []byte(artifactToExtend), commands.File_RW_RW_R)
+
+	args := strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--secret-var", "SENTRY_DSN=https://key@sentry.example.com/42?a=1,b=2")
+	args = append(args, "--secret-var", "API_TOKEN=abc")
+	if err := commands.Run(&Command, args); err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(artifactFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	var a dx.Artifact
+	if err := json.Unmarshal(content, &a); err != nil {
+		t.Fatalf("Error unmarshaling JSON: %s", err)
+	}
+
+	if a.Vars["SENTRY_DSN"] != "https://key@sentry.example.com/42?a=1,b=2" {
+		t.Errorf("Expected the secret var to be set as it is, got %s", a.Vars["SENTRY_DSN"])
+	}
+	if len(a.SecretVars) != 1 || a.SecretVars[0] != "SENTRY_DSN" {
+		t.Errorf("Expected only SENTRY_DSN to be marked, API_TOKEN is sensitive by its name, got %v", a.SecretVars)
+	}
+
+	args = strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile.Name())
+	args = append(args, "--secret-var", "SENTRY_DSN")
+	if err := commands.Run(&Command, args); err == nil {
+		t.Errorf("Expected an error for a secret var without a value")
+	}
+}
@@ -11,5 +11,6 @@ var Command = cli.Command{
 		&artifactPushCmd,
 		&artifactListCmd,
 		&artifactTrackCmd,
+		&artifactVerifyCmd,
 	},
 }
@@ -0,0 +1,63 @@
+package artifact
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/gimlet-io/gimlet/pkg/dx"
+)
+
+// repeatedFlag collects the values of a repeated flag as they are, eg. the --attach flags.
+// A string slice flag would split them on the commas of the type=sbom,file=sbom.json format
+type repeatedFlag struct {
+	values []string
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	f.values = append(f.values, value)
+	return nil
+}
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(f.values, " ")
+}
+
+// attach reads the file of an attachment spec, eg.: type=sbom,file=sbom.spdx.json[,name=sbom],
+// and adds it to the artifact, replacing an earlier attachment with the same name
+func attach(a *dx.Artifact, spec string) error {
+	params := map[string]string{}
+	for _, param := range strings.Split(spec, ",") {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) != 2 {
+			return fmt.Errorf("invalid attachment %s, use the type=sbom,file=sbom.spdx.json format", spec)
+		}
+		params[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+	}
+	if params["type"] == "" || params["file"] == "" {
+		return fmt.Errorf("type and file are mandatory for attachment %s", spec)
+	}
+	name := params["name"]
+	if name == "" {
+		name = filepath.Base(params["file"])
+	}
+
+	content, err := ioutil.ReadFile(params["file"])
+	if err != nil {
+		return fmt.Errorf("cannot read file %s", err)
+	}
+	attachment, err := dx.NewAttachment(params["type"], name, content)
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range a.Attachments {
+		if existing.Name == name {
+			a.Attachments[i] = attachment
+			return nil
+		}
+	}
+	a.Attachments = append(a.Attachments, attachment)
+	return nil
+}
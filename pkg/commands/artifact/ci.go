@@ -0,0 +1,406 @@
+package artifact
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// versionFlags are the artifact create flags that can be detected from the CI environment, in output order
+var versionFlags = []string{
+	"repository",
+	"sha",
+	"created",
+	"branch",
+	"event",
+	"sourceBranch",
+	"targetBranch",
+	"tag",
+	"authorName",
+	"authorEmail",
+	"committerName",
+	"committerEmail",
+	"message",
+	"url",
+}
+
+type detectedValue struct {
+	value  string
+	source string
+}
+
+// ciContext is what's known about the build from the CI provider's environment variables and the local git repo
+type ciContext struct {
+	provider string
+	values   map[string]detectedValue
+	vars     map[string]string
+}
+
+func (c *ciContext) set(flag string, value string, source string) {
+	if value == "" || c.values[flag].value != "" {
+		return
+	}
+	c.values[flag] = detectedValue{value: value, source: source}
+}
+
+func (c *ciContext) value(flag string) string {
+	return c.values[flag].value
+}
+
+type ciProvider struct {
+	name string
+	// detect tells if the build runs on this provider
+	detect func(getenv func(string) string) bool
+	// version fills the version fields from the provider's environment variables
+	version func(c *ciContext, getenv func(string) string)
+	// vars are the build variables passed along in the artifact vars
+	vars []string
+}
+
+var ciProviders = []ciProvider{
+	{
+		name: "GitHub Actions",
+		detect: func(getenv func(string) string) bool {
+			return getenv("GITHUB_ACTIONS") == "true"
+		},
+		version: githubVersion,
+		vars:    []string{"GITHUB_RUN_ID", "GITHUB_RUN_NUMBER", "GITHUB_WORKFLOW", "GITHUB_ACTOR"},
+	},
+	{
+		name: "GitLab CI",
+		detect: func(getenv func(string) string) bool {
+			return getenv("GITLAB_CI") == "true"
+		},
+		version: gitlabVersion,
+		vars:    []string{"CI_PIPELINE_ID", "CI_PIPELINE_URL", "CI_JOB_ID", "GITLAB_USER_LOGIN"},
+	},
+	{
+		name: "CircleCI",
+		detect: func(getenv func(string) string) bool {
+			return getenv("CIRCLECI") == "true"
+		},
+		version: circleVersion,
+		vars:    []string{"CIRCLE_WORKFLOW_ID", "CIRCLE_BUILD_NUM", "CIRCLE_BUILD_URL", "CIRCLE_USERNAME"},
+	},
+	{
+		name: "Drone",
+		detect: func(getenv func(string) string) bool {
+			return getenv("DRONE") == "true"
+		},
+		version: droneVersion,
+		vars:    []string{"DRONE_BUILD_NUMBER", "DRONE_BUILD_LINK", "DRONE_COMMIT_AUTHOR"},
+	},
+	{
+		name: "Woodpecker",
+		detect: func(getenv func(string) string) bool {
+			return getenv("CI") == "woodpecker"
+		},
+		version: woodpeckerVersion,
+		vars:    []string{"CI_PIPELINE_NUMBER", "CI_PIPELINE_URL", "CI_COMMIT_AUTHOR"},
+	},
+	{
+		name: "Jenkins",
+		detect: func(getenv func(string) string) bool {
+			return getenv("JENKINS_URL") != ""
+		},
+		version: jenkinsVersion,
+		vars:    []string{"BUILD_ID", "BUILD_NUMBER", "BUILD_URL", "JOB_NAME"},
+	},
+	{
+		name: "Bitbucket Pipelines",
+		detect: func(getenv func(string) string) bool {
+			return getenv("BITBUCKET_BUILD_NUMBER") != ""
+		},
+		version: bitbucketVersion,
+		vars:    []string{"BITBUCKET_BUILD_NUMBER", "BITBUCKET_PIPELINE_UUID"},
+	},
+	{
+		// Tekton sets no environment variables, but mounts /tekton into every step
+		name: "Tekton",
+		detect: func(getenv func(string) string) bool {
+			_, err := os.Stat("/tekton/run")
+			return err == nil
+		},
+		version: func(c *ciContext, getenv func(string) string) {},
+	},
+}
+
+func githubVersion(c *ciContext, getenv func(string) string) {
+	repository := getenv("GITHUB_REPOSITORY")
+	c.set("repository", repository, "GITHUB_REPOSITORY")
+
+	if strings.HasPrefix(getenv("GITHUB_EVENT_NAME"), "pull_request") {
+		// GITHUB_SHA is the merge commit on pull requests, the head is in the event payload
+		c.set("sha", githubPullRequestHead(getenv("GITHUB_EVENT_PATH")), "GITHUB_EVENT_PATH")
+		c.set("event", "pr", "GITHUB_EVENT_NAME")
+		c.set("branch", getenv("GITHUB_BASE_REF"), "GITHUB_BASE_REF")
+		c.set("sourceBranch", getenv("GITHUB_HEAD_REF"), "GITHUB_HEAD_REF")
+		c.set("targetBranch", getenv("GITHUB_BASE_REF"), "GITHUB_BASE_REF")
+	} else if getenv("GITHUB_REF_TYPE") == "tag" {
+		c.set("event", "tag", "GITHUB_REF_TYPE")
+		c.set("tag", getenv("GITHUB_REF_NAME"), "GITHUB_REF_NAME")
+	} else {
+		c.set("event", "push", "GITHUB_EVENT_NAME")
+		c.set("branch", getenv("GITHUB_REF_NAME"), "GITHUB_REF_NAME")
+	}
+	c.set("sha", getenv("GITHUB_SHA"), "GITHUB_SHA")
+
+	if serverURL := getenv("GITHUB_SERVER_URL"); serverURL != "" && repository != "" && c.value("sha") != "" {
+		c.set("url", serverURL+"/"+repository+"/commit/"+c.value("sha"), "GITHUB_SERVER_URL")
+	}
+}
+
+func githubPullRequestHead(eventPath string) string {
+	if eventPath == "" {
+		return ""
+	}
+	eventJson, err := os.ReadFile(eventPath)
+	if err != nil {
+		return ""
+	}
+	var event struct {
+		PullRequest struct {
+			Head struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+	}
+	json.Unmarshal(eventJson, &event)
+	return event.PullRequest.Head.SHA
+}
+
+func gitlabVersion(c *ciContext, getenv func(string) string) {
+	c.set("repository", getenv("CI_PROJECT_PATH"), "CI_PROJECT_PATH")
+	c.set("sha", getenv("CI_COMMIT_SHA"), "CI_COMMIT_SHA")
+	c.set("created", getenv("CI_COMMIT_TIMESTAMP"), "CI_COMMIT_TIMESTAMP")
+
+	if getenv("CI_MERGE_REQUEST_IID") != "" {
+		c.set("event", "pr", "CI_MERGE_REQUEST_IID")
+		c.set("branch", getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"), "CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+		c.set("sourceBranch", getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"), "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")
+		c.set("targetBranch", getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"), "CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+	} else if getenv("CI_COMMIT_TAG") != "" {
+		c.set("event", "tag", "CI_COMMIT_TAG")
+		c.set("tag", getenv("CI_COMMIT_TAG"), "CI_COMMIT_TAG")
+	} else {
+		c.set("event", "push", "CI_COMMIT_BRANCH")
+		c.set("branch", getenv("CI_COMMIT_BRANCH"), "CI_COMMIT_BRANCH")
+	}
+
+	if name, email := splitAuthor(getenv("CI_COMMIT_AUTHOR")); name != "" {
+		c.set("authorName", name, "CI_COMMIT_AUTHOR")
+		c.set("authorEmail", email, "CI_COMMIT_AUTHOR")
+	}
+	c.set("message", getenv("CI_COMMIT_MESSAGE"), "CI_COMMIT_MESSAGE")
+	if projectURL := getenv("CI_PROJECT_URL"); projectURL != "" && c.value("sha") != "" {
+		c.set("url", projectURL+"/-/commit/"+c.value("sha"), "CI_PROJECT_URL")
+	}
+}
+
+func circleVersion(c *ciContext, getenv func(string) string) {
+	if getenv("CIRCLE_PROJECT_USERNAME") != "" {
+		c.set("repository", getenv("CIRCLE_PROJECT_USERNAME")+"/"+getenv("CIRCLE_PROJECT_REPONAME"), "CIRCLE_PROJECT_USERNAME")
+	}
+	c.set("sha", getenv("CIRCLE_SHA1"), "CIRCLE_SHA1")
+
+	if getenv("CIRCLE_TAG") != "" {
+		c.set("event", "tag", "CIRCLE_TAG")
+		c.set("tag", getenv("CIRCLE_TAG"), "CIRCLE_TAG")
+	} else if getenv("CIRCLE_PULL_REQUEST") != "" {
+		// CircleCI doesn't know the target branch, only the feature branch
+		c.set("event", "pr", "CIRCLE_PULL_REQUEST")
+		c.set("sourceBranch", getenv("CIRCLE_BRANCH"), "CIRCLE_BRANCH")
+	} else {
+		c.set("event", "push", "CIRCLE_BRANCH")
+		c.set("branch", getenv("CIRCLE_BRANCH"), "CIRCLE_BRANCH")
+	}
+}
+
+func droneVersion(c *ciContext, getenv func(string) string) {
+	c.set("repository", getenv("DRONE_REPO"), "DRONE_REPO")
+	c.set("sha", getenv("DRONE_COMMIT_SHA"), "DRONE_COMMIT_SHA")
+
+	switch getenv("DRONE_BUILD_EVENT") {
+	case "pull_request":
+		c.set("event", "pr", "DRONE_BUILD_EVENT")
+		c.set("branch", getenv("DRONE_TARGET_BRANCH"), "DRONE_TARGET_BRANCH")
+		c.set("sourceBranch", getenv("DRONE_SOURCE_BRANCH"), "DRONE_SOURCE_BRANCH")
+		c.set("targetBranch", getenv("DRONE_TARGET_BRANCH"), "DRONE_TARGET_BRANCH")
+	case "tag":
+		c.set("event", "tag", "DRONE_BUILD_EVENT")
+		c.set("tag", getenv("DRONE_TAG"), "DRONE_TAG")
+	default:
+		c.set("event", "push", "DRONE_BUILD_EVENT")
+		c.set("branch", getenv("DRONE_BRANCH"), "DRONE_BRANCH")
+	}
+
+	c.set("authorName", getenv("DRONE_COMMIT_AUTHOR_NAME"), "DRONE_COMMIT_AUTHOR_NAME")
+	c.set("authorEmail", getenv("DRONE_COMMIT_AUTHOR_EMAIL"), "DRONE_COMMIT_AUTHOR_EMAIL")
+	c.set("message", getenv("DRONE_COMMIT_MESSAGE"), "DRONE_COMMIT_MESSAGE")
+	c.set("url", getenv("DRONE_COMMIT_LINK"), "DRONE_COMMIT_LINK")
+}
+
+func woodpeckerVersion(c *ciContext, getenv func(string) string) {
+	c.set("repository", getenv("CI_REPO"), "CI_REPO")
+	c.set("sha", getenv("CI_COMMIT_SHA"), "CI_COMMIT_SHA")
+
+	switch getenv("CI_PIPELINE_EVENT") {
+	case "pull_request":
+		c.set("event", "pr", "CI_PIPELINE_EVENT")
+		c.set("branch", getenv("CI_COMMIT_TARGET_BRANCH"), "CI_COMMIT_TARGET_BRANCH")
+		c.set("sourceBranch", getenv("CI_COMMIT_SOURCE_BRANCH"), "CI_COMMIT_SOURCE_BRANCH")
+		c.set("targetBranch", getenv("CI_COMMIT_TARGET_BRANCH"), "CI_COMMIT_TARGET_BRANCH")
+	case "tag":
+		c.set("event", "tag", "CI_PIPELINE_EVENT")
+		c.set("tag", getenv("CI_COMMIT_TAG"), "CI_COMMIT_TAG")
+	default:
+		c.set("event", "push", "CI_PIPELINE_EVENT")
+		c.set("branch", getenv("CI_COMMIT_BRANCH"), "CI_COMMIT_BRANCH")
+	}
+
+	c.set("authorName", getenv("CI_COMMIT_AUTHOR"), "CI_COMMIT_AUTHOR")
+	c.set("authorEmail", getenv("CI_COMMIT_AUTHOR_EMAIL"), "CI_COMMIT_AUTHOR_EMAIL")
+	c.set("message", getenv("CI_COMMIT_MESSAGE"), "CI_COMMIT_MESSAGE")
+	c.set("url", getenv("CI_PIPELINE_FORGE_URL"), "CI_PIPELINE_FORGE_URL")
+}
+
+func jenkinsVersion(c *ciContext, getenv func(string) string) {
+	if _, repository := repositoryFromRemote(getenv("GIT_URL")); repository != "" {
+		c.set("repository", repository, "GIT_URL")
+	}
+	c.set("sha", getenv("GIT_COMMIT"), "GIT_COMMIT")
+
+	if getenv("CHANGE_ID") != "" {
+		c.set("event", "pr", "CHANGE_ID")
+		c.set("branch", getenv("CHANGE_TARGET"), "CHANGE_TARGET")
+		c.set("sourceBranch", getenv("CHANGE_BRANCH"), "CHANGE_BRANCH")
+		c.set("targetBranch", getenv("CHANGE_TARGET"), "CHANGE_TARGET")
+	} else if getenv("TAG_NAME") != "" {
+		c.set("event", "tag", "TAG_NAME")
+		c.set("tag", getenv("TAG_NAME"), "TAG_NAME")
+	} else {
+		c.set("event", "push", "GIT_BRANCH")
+		c.set("branch", strings.TrimPrefix(getenv("GIT_BRANCH"), "origin/"), "GIT_BRANCH")
+	}
+}
+
+func bitbucketVersion(c *ciContext, getenv func(string) string) {
+	repository := getenv("BITBUCKET_REPO_FULL_NAME")
+	c.set("repository", repository, "BITBUCKET_REPO_FULL_NAME")
+	c.set("sha", getenv("BITBUCKET_COMMIT"), "BITBUCKET_COMMIT")
+
+	if getenv("BITBUCKET_PR_ID") != "" {
+		c.set("event", "pr", "BITBUCKET_PR_ID")
+		c.set("branch", getenv("BITBUCKET_PR_DESTINATION_BRANCH"), "BITBUCKET_PR_DESTINATION_BRANCH")
+		c.set("sourceBranch", getenv("BITBUCKET_BRANCH"), "BITBUCKET_BRANCH")
+		c.set("targetBranch", getenv("BITBUCKET_PR_DESTINATION_BRANCH"), "BITBUCKET_PR_DESTINATION_BRANCH")
+	} else if getenv("BITBUCKET_TAG") != "" {
+		c.set("event", "tag", "BITBUCKET_TAG")
+		c.set("tag", getenv("BITBUCKET_TAG"), "BITBUCKET_TAG")
+	} else {
+		c.set("event", "push", "BITBUCKET_BRANCH")
+		c.set("branch", getenv("BITBUCKET_BRANCH"), "BITBUCKET_BRANCH")
+	}
+
+	if repository != "" && c.value("sha") != "" {
+		c.set("url", "https://bitbucket.org/"+repository+"/commits/"+c.value("sha"), "BITBUCKET_REPO_FULL_NAME")
+	}
+}
+
+// detectCIContext detects the CI provider, then fills what the provider doesn't tell from the local git repo
+func detectCIContext(getenv func(string) string, git func(args ...string) (string, error)) *ciContext {
+	c := &ciContext{
+		values: map[string]detectedValue{},
+		vars:   map[string]string{},
+	}
+
+	for _, provider := range ciProviders {
+		if !provider.detect(getenv) {
+			continue
+		}
+		c.provider = provider.name
+		provider.version(c, getenv)
+		for _, name := range provider.vars {
+			if value := getenv(name); value != "" {
+				c.vars[name] = value
+			}
+		}
+		break
+	}
+
+	gitVersion(c, git)
+	return c
+}
+
+func gitVersion(c *ciContext, git func(args ...string) (string, error)) {
+	sha := c.value("sha")
+	if sha == "" {
+		sha, _ = git("rev-parse", "HEAD")
+		c.set("sha", sha, "git")
+	}
+	if sha == "" {
+		return
+	}
+
+	logFormats := map[string]string{
+		"created":        "%cI",
+		"authorName":     "%an",
+		"authorEmail":    "%ae",
+		"committerName":  "%cn",
+		"committerEmail": "%ce",
+		"message":        "%B",
+	}
+	for flag, format := range logFormats {
+		if c.value(flag) != "" {
+			continue
+		}
+		value, err := git("log", "-1", "--format="+format, sha)
+		if err != nil {
+			// shallow clones may not have the commit that the CI provider reports, eg. the head of a pull request
+			value, _ = git("log", "-1", "--format="+format, "HEAD")
+		}
+		c.set(flag, value, "git")
+	}
+
+	if c.value("event") == "" && c.value("branch") == "" {
+		branch, _ := git("rev-parse", "--abbrev-ref", "HEAD")
+		if branch != "HEAD" {
+			c.set("branch", branch, "git")
+		}
+	}
+
+	remote, _ := git("config", "--get", "remote.origin.url")
+	host, repository := repositoryFromRemote(remote)
+	c.set("repository", repository, "git")
+	if host != "" && c.value("repository") != "" {
+		c.set("url", "https://"+host+"/"+c.value("repository")+"/commit/"+sha, "git")
+	}
+}
+
+var remotePattern = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?([^:/]+)(?::\d+)?[:/](.+?)(?:\.git)?/?$`)
+
+// repositoryFromRemote parses the host and the owner/repo from a git remote URL
+func repositoryFromRemote(remote string) (string, string) {
+	matches := remotePattern.FindStringSubmatch(strings.TrimSpace(remote))
+	if matches == nil {
+		return "", ""
+	}
+	return matches[1], matches[2]
+}
+
+// splitAuthor splits the `Name <email>` format
+func splitAuthor(author string) (string, string) {
+	start := strings.LastIndex(author, "<")
+	end := strings.LastIndex(author, ">")
+	if start == -1 || end < start {
+		return strings.TrimSpace(author), ""
+	}
+	return strings.TrimSpace(author[:start]), author[start+1 : end]
+}
+
+func runGit(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
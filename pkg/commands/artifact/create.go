@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/btubbs/datetime"
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -14,7 +18,11 @@ import (
 var artifactCreateCmd = cli.Command{
 	Name:  "create",
 	Usage: "Creates a release artifact",
-	UsageText: `gimlet artifact create \
+	Description: `The version fields are detected from GitHub Actions, GitLab CI, CircleCI, Drone, Woodpecker, Jenkins,
+Bitbucket Pipelines and Tekton environment variables, and from the local git repository. Flags override the detected values.`,
+	UsageText: `gimlet artifact create > artifact.json
+
+   gimlet artifact create \
      --repository=my-app \
      --sha=26fc62ffa5cf63204ccbce6876c6d610 \
      --branch=master \
@@ -28,24 +36,20 @@ var artifactCreateCmd = cli.Command{
      > artifact.json`,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:     "repository",
-			Usage:    "The git repository name (mandatory)",
-			Required: true,
+			Name:  "repository",
+			Usage: "The git repository name (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "sha",
-			Usage:    "The git sha (mandatory)",
-			Required: true,
+			Name:  "sha",
+			Usage: "The git sha (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "created",
-			Usage:    "The git commit created date (mandatory), ISO 8601 output of `git log -1 --format=%cI`",
-			Required: true,
+			Name:  "created",
+			Usage: "The git commit created date (mandatory, detected in CI), ISO 8601 output of `git log -1 --format=%cI`",
 		},
 		&cli.StringFlag{
-			Name:     "branch",
-			Usage:    "The git branch, or target branch for pull request builds (mandatory)",
-			Required: true,
+			Name:  "branch",
+			Usage: "The git branch, or target branch for pull request builds (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
 			Name:  "event",
@@ -64,79 +68,106 @@ var artifactCreateCmd = cli.Command{
 			Usage: "For tag builds, the name of the tag",
 		},
 		&cli.StringFlag{
-			Name:     "authorName",
-			Usage:    "The person who originally wrote the code (mandatory)",
-			Required: true,
+			Name:  "authorName",
+			Usage: "The person who originally wrote the code (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "authorEmail",
-			Usage:    "The person who originally wrote the code (mandatory)",
-			Required: true,
+			Name:  "authorEmail",
+			Usage: "The person who originally wrote the code (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "committerName",
-			Usage:    "The person who originally wrote the code (mandatory)",
-			Required: true,
+			Name:  "committerName",
+			Usage: "The person who originally wrote the code (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "committerEmail",
-			Usage:    "The committer is the person who committed the code. Important in case of history rewrite (mandatory)",
-			Required: true,
+			Name:  "committerEmail",
+			Usage: "The committer is the person who committed the code. Important in case of history rewrite (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "message",
-			Usage:    "The git commit message (mandatory)",
-			Required: true,
+			Name:  "message",
+			Usage: "The git commit message (mandatory, detected in CI)",
 		},
 		&cli.StringFlag{
-			Name:     "url",
-			Usage:    "URL to the git commit (mandatory)",
-			Required: true,
+			Name:  "url",
+			Usage: "URL to the git commit (mandatory, detected in CI)",
+		},
+		&cli.BoolFlag{
+			Name:  "explain",
+			Usage: "print the detected CI context and where each value comes from",
 		},
 		&cli.StringFlag{
 			Name:    "output",
 			Aliases: []string{"o"},
 			Usage:   "output manifest file",
 		},
+		&cli.StringFlag{
+			Name:    "signing-key",
+			Usage:   "sign the artifact with this PEM encoded ed25519 or ECDSA private key, GIMLET_SIGNING_KEY environment variable alternatively",
+			EnvVars: []string{"GIMLET_SIGNING_KEY"},
+		},
 	},
 	Action: create,
 }
 
 func create(c *cli.Context) error {
-	eventStr := c.String("event")
+	ci := detectCIContext(os.Getenv, runGit)
+	for _, flag := range versionFlags {
+		if c.IsSet(flag) {
+			ci.values[flag] = detectedValue{value: c.String(flag), source: "flag"}
+		}
+	}
+	if c.Bool("explain") {
+		explain(ci)
+	}
+
+	eventStr := ci.value("event")
 	event := dx.Push
 	err := event.UnmarshalJSON([]byte(`"` + eventStr + `"`))
 	if err != nil {
 		return fmt.Errorf("cannot parse event: %s", err)
 	}
 
+	for _, flag := range []string{"repository", "sha", "created", "branch", "authorName", "authorEmail", "committerName", "committerEmail", "message", "url"} {
+		if flag == "branch" && event == dx.Tag {
+			continue
+		}
+		if ci.value(flag) == "" {
+			return fmt.Errorf("cannot detect --%s from the CI environment or git, please set it", flag)
+		}
+	}
+
 	// parses ISO 8601 output of `git log -1 --format=%cI`
-	created, err := datetime.ParseLocal(c.String("created"))
+	created, err := datetime.ParseLocal(ci.value("created"))
 	if err != nil {
 		return fmt.Errorf("cannot parse created time: %s", err)
 	}
 
 	artifact := &dx.Artifact{
 		Version: dx.Version{
-			RepositoryName: c.String("repository"),
-			SHA:            c.String("sha"),
+			RepositoryName: ci.value("repository"),
+			SHA:            ci.value("sha"),
 			Created:        created.Unix(),
-			Branch:         c.String("branch"),
+			Branch:         ci.value("branch"),
 			Event:          event,
-			SourceBranch:   c.String("sourceBranch"),
-			TargetBranch:   c.String("targetBranch"),
-			Tag:            c.String("tag"),
-			AuthorName:     c.String("authorName"),
-			AuthorEmail:    c.String("authorEmail"),
-			CommitterName:  c.String("committerName"),
-			CommitterEmail: c.String("committerEmail"),
-			Message:        c.String("message"),
-			URL:            c.String("url"),
+			SourceBranch:   ci.value("sourceBranch"),
+			TargetBranch:   ci.value("targetBranch"),
+			Tag:            ci.value("tag"),
+			AuthorName:     ci.value("authorName"),
+			AuthorEmail:    ci.value("authorEmail"),
+			CommitterName:  ci.value("committerName"),
+			CommitterEmail: ci.value("committerEmail"),
+			Message:        ci.value("message"),
+			URL:            ci.value("url"),
 		},
 		Context:      map[string]string{},
 		Environments: []*dx.Manifest{},
 		Items:        []map[string]interface{}{},
-		Vars:         map[string]string{},
+		Vars:         ci.vars,
+	}
+
+	err = sign(artifact, c.String("signing-key"))
+	if err != nil {
+		return err
 	}
 
 	jsonString := bytes.NewBufferString("")
@@ -156,3 +187,28 @@ func create(c *cli.Context) error {
 
 	return nil
 }
+
+// explain prints the detected values to stderr, so they don't mix with the artifact on stdout
+func explain(ci *ciContext) {
+	provider := ci.provider
+	if provider == "" {
+		provider = "none detected"
+	}
+	fmt.Fprintf(os.Stderr, "CI provider: %s\n", provider)
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, flag := range versionFlags {
+		detected := ci.values[flag]
+		value := strings.SplitN(detected.value, "\n", 2)[0]
+		fmt.Fprintf(w, "--%s\t%s\t%s\n", flag, value, detected.source)
+	}
+	var names []string
+	for name := range ci.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "var %s\t%s\t%s\n", name, ci.vars[name], name)
+	}
+	w.Flush()
+}
@@ -168,6 +168,12 @@ func list(c *cli.Context) error {
 			}
 			artifact.Environments = append(artifact.Environments, manifests...)
 
+			manifests, err = artifact.JsonnetEnvironmentsToManifests()
+			if err != nil {
+				return err
+			}
+			artifact.Environments = append(artifact.Environments, manifests...)
+
 			for _, env := range artifact.Environments {
 				fmt.Printf("%s\n", gray(fmt.Sprintf("  %s -> %s%s", env.App, env.Env, triggerString(env.Deploy))))
 			}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"github.com/gimlet-io/gimlet/pkg/client"
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -38,6 +39,10 @@ var artifactPushCmd = cli.Command{
 			EnvVars:  []string{"GIMLET_TOKEN"},
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "idempotency-key",
+			Usage: "key that identifies this push, so retries don't create duplicate artifacts. Defaults to the repo, SHA, event, CI build ID and artifact digest",
+		},
 		&cli.StringFlag{
 			Name:    "output",
 			Aliases: []string{"o"},
@@ -57,6 +62,11 @@ func push(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse artifact file %s", err)
 	}
+	if c.String("idempotency-key") != "" {
+		a.IdempotencyKey = c.String("idempotency-key")
+	} else if a.IdempotencyKey == "" {
+		a.IdempotencyKey = a.DefaultIdempotencyKey(os.Getenv)
+	}
 
 	serverURL := c.String("server")
 	token := c.String("token")
@@ -0,0 +1,86 @@
+package artifact
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/enescakir/emoji"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/urfave/cli/v2"
+)
+
+var artifactVerifyCmd = cli.Command{
+	Name:  "verify",
+	Usage: "Verifies the signature of a release artifact",
+	UsageText: `gimlet artifact verify \
+     -f artifact.json \
+     --public-key signing-key.pub`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "artifact file to verify",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "public-key",
+			Usage:    "PEM encoded ed25519 or ECDSA public key to verify with",
+			Required: true,
+		},
+	},
+	Action: verify,
+}
+
+func verify(c *cli.Context) error {
+	content, err := ioutil.ReadFile(c.String("file"))
+	if err != nil {
+		return fmt.Errorf("cannot read file %s", err)
+	}
+	var a dx.Artifact
+	err = json.Unmarshal(content, &a)
+	if err != nil {
+		return fmt.Errorf("cannot parse artifact file %s", err)
+	}
+	if a.Signature == "" {
+		return fmt.Errorf("artifact is not signed")
+	}
+
+	publicKeyPEM, err := ioutil.ReadFile(c.String("public-key"))
+	if err != nil {
+		return fmt.Errorf("cannot read public key %s", err)
+	}
+	publicKey, err := dx.ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("cannot parse public key %s", err)
+	}
+
+	canonical, err := a.CanonicalJSON()
+	if err != nil {
+		return err
+	}
+	err = dx.VerifySignature(publicKey, canonical, a.Signature)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%v Artifact signature verified\n", emoji.CheckMarkButton)
+	return nil
+}
+
+// sign signs the artifact if a signing key is given
+func sign(a *dx.Artifact, signingKeyPath string) error {
+	if signingKeyPath == "" {
+		return nil
+	}
+	signingKey, err := ioutil.ReadFile(signingKeyPath)
+	if err != nil {
+		return fmt.Errorf("cannot read signing key %s", err)
+	}
+	err = a.Sign(signingKey)
+	if err != nil {
+		return fmt.Errorf("cannot sign artifact %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package artifact
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/commands"
+)
+
+func Test_signAndVerify(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(publicKey)
+
+	privateKeyFile := tempFile(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes}))
+	defer os.Remove(privateKeyFile)
+	publicKeyFile := tempFile(t, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}))
+	defer os.Remove(publicKeyFile)
+	artifactFile := tempFile(t, []byte(artifactToExtend))
+	defer os.Remove(artifactFile)
+	envFile := tempFile(t, []byte(env))
+	defer os.Remove(envFile)
+
+	args := strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile, "--envFile", envFile, "--signing-key", privateKeyFile)
+	err := commands.Run(&Command, args)
+	if err != nil {
+		t.Fatalf("Error signing artifact: %s", err)
+	}
+
+	args = strings.Split("gimlet artifact verify", " ")
+	args = append(args, "-f", artifactFile, "--public-key", publicKeyFile)
+	err = commands.Run(&Command, args)
+	if err != nil {
+		t.Fatalf("Error verifying artifact: %s", err)
+	}
+
+	args = strings.Split("gimlet artifact add", " ")
+	args = append(args, "-f", artifactFile, "--field", "name=CI")
+	err = commands.Run(&Command, args)
+	if err != nil {
+		t.Fatalf("Error adding field: %s", err)
+	}
+
+	args = strings.Split("gimlet artifact verify", " ")
+	args = append(args, "-f", artifactFile, "--public-key", publicKeyFile)
+	err = commands.Run(&Command, args)
+	if err == nil {
+		t.Errorf("Artifacts modified after signing should not verify")
+	}
+}
+
+func tempFile(t *testing.T, content []byte) string {
+	file, err := ioutil.TempFile("", "gimlet-cli-test")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+	ioutil.WriteFile(file.Name(), content, commands.File_RW_RW_R)
+	return file.Name()
+}
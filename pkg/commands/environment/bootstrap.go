@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/enescakir/emoji"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/gitops"
 	"github.com/go-git/go-git/v5"
 	"github.com/urfave/cli/v2"
@@ -50,6 +51,10 @@ var environmentBootstrapCmd = cli.Command{
 			Name:  "kustomization-per-app",
 			Usage: "to apply only the flux/ folder in gitops. Separate kustomization objects must be created to apply other folders. Used in `*-apps` repos",
 		},
+		&cli.StringFlag{
+			Name:  "sops-age-recipient",
+			Usage: "age public key of the environment, to decrypt SOPS encrypted secrets with. Generate the key pair with `age-keygen -o age.agekey`",
+		},
 	},
 }
 
@@ -84,6 +89,7 @@ func Bootstrap(c *cli.Context) error {
 		ShouldGenerateDeployKey:            true,
 		GitopsRepoUrl:                      c.String("gitops-repo-url"),
 		Branch:                             branch,
+		SopsAgeRecipient:                   c.String("sops-age-recipient"),
 	})
 	if err != nil {
 		return err
@@ -93,6 +99,11 @@ func Bootstrap(c *cli.Context) error {
 
 	fmt.Print(guidingTextFMTPrint)
 
+	if c.String("sops-age-recipient") != "" {
+		fmt.Printf("%v Flux decrypts SOPS encrypted secrets with the age private key. Keep it out of git, and create its secret on the cluster:\n\n", emoji.BackhandIndexPointingRight)
+		fmt.Printf("kubectl create secret generic %s --namespace=flux-system --from-file=age.agekey=age.agekey\n\n", dx.SopsAgeSecret)
+	}
+
 	return nil
 }
 
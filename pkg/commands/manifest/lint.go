@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -17,22 +18,99 @@ import (
 )
 
 var manifestLintCmd = cli.Command{
-	Name:      "lint",
-	Usage:     "Lints a Gimlet manifest",
-	UsageText: `gimlet manifest lint -f .gimlet/staging.yaml`,
-	Action:    lint,
+	Name:  "lint",
+	Usage: "Lints a Gimlet manifest",
+	UsageText: `gimlet manifest lint -f .gimlet/staging.yaml
+
+     gimlet manifest lint --env production --policies policies/`,
+	Action: lint,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:     "file",
-			Aliases:  []string{"f"},
-			Usage:    "Gimlet manifest file to lint",
-			Required: true,
+			Name:    "file",
+			Aliases: []string{"f"},
+			Usage:   "Gimlet manifest file to lint",
+		},
+		&cli.StringFlag{
+			Name:  "env",
+			Usage: "lints the manifests of the environment in the .gimlet folder, or checks that the manifest file is for the environment",
+		},
+		&cli.StringFlag{
+			Name:    "vars",
+			Aliases: []string{"v"},
+			Usage:   "an .env file for template variables",
+		},
+		kubeVersionFlag,
+		crdDirFlag,
+		&cli.StringFlag{
+			Name:  "policies",
+			Usage: "a directory of policy files to check the manifest against, like the policies folder of the infra repo",
 		},
 	},
 }
 
 func lint(c *cli.Context) error {
-	envFile := c.String("file")
+	env := c.String("env")
+	if c.String("file") != "" {
+		return lintFile(c, c.String("file"), env)
+	}
+	if env == "" {
+		return fmt.Errorf("either --file or --env is mandatory")
+	}
+
+	envFiles, err := envManifestFiles(".gimlet", env)
+	if err != nil {
+		return err
+	}
+	if len(envFiles) == 0 {
+		return fmt.Errorf("there is no manifest for %s in .gimlet/", env)
+	}
+
+	var errs []string
+	for _, envFile := range envFiles {
+		err = lintFile(c, envFile, env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", envFile, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// envManifestFiles lists the manifest files of an environment in a folder
+func envManifestFiles(dir string, env string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", dir, err)
+	}
+
+	envFiles := []string{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		envFile := filepath.Join(dir, entry.Name())
+		envString, err := ioutil.ReadFile(envFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file %s", err)
+		}
+		var m struct {
+			Env string `yaml:"env"`
+		}
+		err = yaml.Unmarshal(envString, &m)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", envFile, err)
+		}
+		if m.Env == env {
+			envFiles = append(envFiles, envFile)
+		}
+	}
+	return envFiles, nil
+}
+
+func lintFile(c *cli.Context, envFile string, env string) error {
 	envString, err := ioutil.ReadFile(envFile)
 	if err != nil {
 		return fmt.Errorf("cannot read file %s", err)
@@ -43,6 +121,9 @@ func lint(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if env != "" && m.Env != env {
+		return fmt.Errorf("%s is a manifest of %s, not %s", envFile, m.Env, env)
+	}
 
 	var tmpChartName string
 	if strings.HasPrefix(m.Chart.Name, "git@") {
@@ -95,5 +176,55 @@ func lint(c *cli.Context) error {
 		return fmt.Errorf("schema validation failed: \n%s", errs.String())
 	}
 
-	return nil
+	// rendering needs the chart, it is only done if validation or policies are asked for
+	validator, err := schemaValidator(c)
+	if err != nil {
+		return err
+	}
+	policyDir := c.String("policies")
+	if validator == nil && policyDir == "" {
+		return nil
+	}
+
+	vars, err := templateVars(c.String("vars"))
+	if err != nil {
+		return err
+	}
+	resolvedManifest, err := parseAndResolveManifest(envString, vars, nil)
+	if err != nil {
+		return err
+	}
+	templatedManifests, err := resolvedManifest.Render(nil)
+	if err != nil {
+		return err
+	}
+
+	if validator != nil {
+		err = validator.Validate(templatedManifests)
+		if err != nil {
+			return err
+		}
+	}
+
+	if policyDir == "" {
+		return nil
+	}
+	policies, err := dx.LoadPolicies(policyDir)
+	if err != nil {
+		return fmt.Errorf("cannot load policies: %s", err)
+	}
+	policyEngine, err := dx.NewPolicyEngine(policies)
+	if err != nil {
+		return err
+	}
+	violations, err := policyEngine.Evaluate(resolvedManifest, templatedManifests)
+	if err != nil {
+		return err
+	}
+	for _, violation := range violations {
+		if violation.Enforcement == dx.PolicyWarn {
+			fmt.Printf("warning: %s\n", violation.String())
+		}
+	}
+	return dx.DeniedPolicyViolations(violations)
 }
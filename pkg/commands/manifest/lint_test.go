@@ -3,6 +3,7 @@ package manifest
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -51,6 +52,49 @@ values:
   replicas: 'string'
 `
 
+const localChart = `
+apiVersion: v2
+name: local
+version: 0.1.0
+`
+
+const localChartDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: {{ .Release.Name }}
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`
+
+const localChartEnv = `
+app: fosdem-2021
+env: staging
+namespace: default
+chart:
+  name: CHART_DIR
+values:
+  image:
+    repository: ghcr.io/gimlet-io/fosdem-2021
+    tag: abc123
+`
+
+const imagePolicy = `
+policies:
+- name: production-images
+  target: image
+  image:
+    registries:
+    - ghcr.io/gimlet-io
+    requireDigest: true
+  envs:
+    staging: "off"
+`
+
 func Test_lint(t *testing.T) {
 	t.Run("Should parse a gimlet manifest", func(t *testing.T) {
 		envFile, err := ioutil.TempFile("", "gimlet-cli-test")
@@ -102,4 +146,57 @@ func Test_lint(t *testing.T) {
 			t.Fatal("Expected error on schema error, but got nil")
 		}
 	})
+	t.Run("Should fail on image policy violations", func(t *testing.T) {
+		gimletDir, err := ioutil.TempDir("", "gimlet-cli-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(gimletDir)
+		chartDir := filepath.Join(gimletDir, "chart")
+		os.MkdirAll(filepath.Join(chartDir, "templates"), 0755)
+		ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(localChart), commands.File_RW_RW_R)
+		ioutil.WriteFile(filepath.Join(chartDir, "values.schema.json"), []byte(`{"type": "object"}`), commands.File_RW_RW_R)
+		ioutil.WriteFile(filepath.Join(chartDir, "templates", "deployment.yaml"), []byte(localChartDeployment), commands.File_RW_RW_R)
+
+		env := strings.Replace(localChartEnv, "CHART_DIR", chartDir, 1)
+		ioutil.WriteFile(filepath.Join(gimletDir, "staging.yaml"), []byte(env), commands.File_RW_RW_R)
+		ioutil.WriteFile(filepath.Join(gimletDir, "production.yaml"),
+			[]byte(strings.Replace(env, "env: staging", "env: production", 1)), commands.File_RW_RW_R)
+
+		policyDir, err := ioutil.TempDir("", "gimlet-cli-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(policyDir)
+		ioutil.WriteFile(filepath.Join(policyDir, "images.yaml"), []byte(imagePolicy), commands.File_RW_RW_R)
+
+		envFiles, err := envManifestFiles(gimletDir, "production")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(envFiles) != 1 || filepath.Base(envFiles[0]) != "production.yaml" {
+			t.Fatalf("Expected production.yaml, got %v", envFiles)
+		}
+
+		args := strings.Split("gimlet manifest lint --env staging", " ")
+		args = append(args, "-f", filepath.Join(gimletDir, "staging.yaml"), "--policies", policyDir)
+		err = commands.Run(&Command, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		args = strings.Split("gimlet manifest lint --env production", " ")
+		args = append(args, "-f", filepath.Join(gimletDir, "production.yaml"), "--policies", policyDir)
+		err = commands.Run(&Command, args)
+		if err == nil || !strings.Contains(err.Error(), "is not pinned with a digest") {
+			t.Fatalf("Expected the image policy to deny the undigested image, got %v", err)
+		}
+
+		args = strings.Split("gimlet manifest lint --env production", " ")
+		args = append(args, "-f", filepath.Join(gimletDir, "staging.yaml"))
+		err = commands.Run(&Command, args)
+		if err == nil {
+			t.Fatal("Expected error on env mismatch, but got nil")
+		}
+	})
 }
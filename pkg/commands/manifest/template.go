@@ -10,6 +10,7 @@ import (
 
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -19,7 +20,8 @@ var manifestTemplateCmd = cli.Command{
 	UsageText: `gimlet manifest template \
     -f .gimlet/staging.yaml \
     -o manifests.yaml \
-    --vars ci.env`,
+    --vars ci.env \
+    --env-defaults gitops-repo/staging/.gimlet`,
 	Action: templateCmd,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
@@ -33,34 +35,51 @@ var manifestTemplateCmd = cli.Command{
 			Aliases: []string{"v"},
 			Usage:   "an .env file for template variables",
 		},
+		&cli.StringFlag{
+			Name:  "env-defaults",
+			Usage: "the .gimlet folder of the environment in the gitops repo, with the defaults.yaml and overrides.yaml values files",
+		},
+		&cli.StringSliceFlag{
+			Name:  "jpath",
+			Usage: "a Jsonnet library directory, like the vendored lib/ folder",
+		},
 		&cli.StringFlag{
 			Name:    "output",
 			Aliases: []string{"o"},
 			Usage:   "output file",
 		},
+		kubeVersionFlag,
+		crdDirFlag,
 	},
 }
 
-func templateCmd(c *cli.Context) error {
-	varsPath := c.String("vars")
-	vars := map[string]string{}
-	if varsPath != "" {
-		yamlString, err := ioutil.ReadFile(varsPath)
-		if err != nil {
-			return fmt.Errorf("cannot read vars file: %s", err.Error())
-		}
+var kubeVersionFlag = &cli.StringFlag{
+	Name:  "kube-version",
+	Usage: "validate the rendered manifests against the bundled OpenAPI schema of a Kubernetes version, eg. 1.27",
+}
 
-		vars, err = godotenv.Parse(strings.NewReader(string(yamlString)))
-		if err != nil {
-			return fmt.Errorf("cannot parse vars: %s", err.Error())
-		}
+var crdDirFlag = &cli.StringFlag{
+	Name:  "crd-dir",
+	Usage: "validate custom resources in the rendered manifests with the CustomResourceDefinitions of a directory",
+}
+
+// schemaValidator is nil if validation was not asked for with --kube-version or --crd-dir
+func schemaValidator(c *cli.Context) (*dx.SchemaValidator, error) {
+	if !c.IsSet("kube-version") && !c.IsSet("crd-dir") {
+		return nil, nil
 	}
+	return dx.NewSchemaValidator(c.String("kube-version"), c.String("crd-dir"))
+}
 
-	for _, v := range os.Environ() {
-		pair := strings.SplitN(v, "=", 2)
-		if _, exists := vars[pair[0]]; !exists {
-			vars[pair[0]] = pair[1]
-		}
+func templateCmd(c *cli.Context) error {
+	vars, err := templateVars(c.String("vars"))
+	if err != nil {
+		return err
+	}
+
+	envValues, err := loadEnvValues(c.String("env-defaults"))
+	if err != nil {
+		return err
 	}
 
 	var templatedManifests string
@@ -78,7 +97,22 @@ func templateCmd(c *cli.Context) error {
 		}
 
 		for _, m := range manifests {
-			tm, err := parseResolveAndRenderManifest([]byte(m), vars)
+			tm, err := parseResolveAndRenderManifest([]byte(m), vars, envValues)
+			if err != nil {
+				return fmt.Errorf(err.Error())
+			}
+
+			templatedManifests += tm
+		}
+	} else if strings.HasSuffix(filePath, ".jsonnet") { // handling Jsonnet format
+		libPaths := append([]string{filepath.Dir(filePath)}, c.StringSlice("jpath")...)
+		manifests, err := dx.RenderJsonnetToManifests(string(fileContent), nil, libPaths)
+		if err != nil {
+			return fmt.Errorf("cannot parse jsonnet file: %s", err.Error())
+		}
+
+		for _, m := range manifests {
+			tm, err := parseResolveAndRenderManifest([]byte(m), vars, envValues)
 			if err != nil {
 				return fmt.Errorf(err.Error())
 			}
@@ -86,12 +120,23 @@ func templateCmd(c *cli.Context) error {
 			templatedManifests += tm
 		}
 	} else { // handling YAML format
-		templatedManifests, err = parseResolveAndRenderManifest(fileContent, vars)
+		templatedManifests, err = parseResolveAndRenderManifest(fileContent, vars, envValues)
 		if err != nil {
 			return fmt.Errorf(err.Error())
 		}
 	}
 
+	validator, err := schemaValidator(c)
+	if err != nil {
+		return err
+	}
+	if validator != nil {
+		err = validator.Validate(templatedManifests)
+		if err != nil {
+			return err
+		}
+	}
+
 	outputPath := c.String("output")
 	if outputPath != "" {
 		err := ioutil.WriteFile(outputPath, []byte(templatedManifests), 0666)
@@ -105,18 +150,71 @@ func templateCmd(c *cli.Context) error {
 	return nil
 }
 
-func parseResolveAndRenderManifest(manifestString []byte, vars map[string]string) (string, error) {
+// templateVars reads the vars file, and complements it with the environment variables
+func templateVars(varsPath string) (map[string]string, error) {
+	vars := map[string]string{}
+	if varsPath != "" {
+		yamlString, err := ioutil.ReadFile(varsPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read vars file: %s", err.Error())
+		}
+
+		vars, err = godotenv.Parse(strings.NewReader(string(yamlString)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse vars: %s", err.Error())
+		}
+	}
+
+	for _, v := range os.Environ() {
+		pair := strings.SplitN(v, "=", 2)
+		if _, exists := vars[pair[0]]; !exists {
+			vars[pair[0]] = pair[1]
+		}
+	}
+
+	return vars, nil
+}
+
+// loadEnvValues reads the value defaults and overrides of an environment, like the dashboard does on deploy
+func loadEnvValues(gimletPath string) (*dx.EnvValues, error) {
+	if gimletPath == "" {
+		return nil, nil
+	}
+
+	files := map[string]string{}
+	for _, fileName := range []string{dx.EnvDefaultsFile, dx.EnvOverridesFile} {
+		content, err := ioutil.ReadFile(filepath.Join(gimletPath, fileName))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot read %s: %s", fileName, err.Error())
+		}
+		files[fileName] = string(content)
+	}
+
+	return dx.ParseEnvValues(files[dx.EnvDefaultsFile], files[dx.EnvOverridesFile])
+}
+
+func parseResolveAndRenderManifest(manifestString []byte, vars map[string]string, envValues *dx.EnvValues) (string, error) {
+	m, err := parseAndResolveManifest(manifestString, vars, envValues)
+	if err != nil {
+		return "", err
+	}
+
+	return m.Render(nil)
+}
+
+func parseAndResolveManifest(manifestString []byte, vars map[string]string, envValues *dx.EnvValues) (*dx.Manifest, error) {
 	var m dx.Manifest
 	err := yaml.Unmarshal(manifestString, &m)
 	if err != nil {
-		return "", fmt.Errorf("cannot unmarshal manifest: %s", err.Error())
+		return nil, fmt.Errorf("cannot unmarshal manifest: %s", err.Error())
 	}
 
 	m.PrepPreview("")
+	m.ApplyEnvValues(envValues)
 	err = m.ResolveVars(vars)
 	if err != nil {
-		return "", fmt.Errorf("cannot resolve manifest vars %s", err.Error())
+		return nil, fmt.Errorf("cannot resolve manifest vars %s", err.Error())
 	}
 
-	return m.Render()
+	return &m, nil
 }
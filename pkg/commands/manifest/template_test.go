@@ -546,3 +546,34 @@ a: "hello"
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "should have a `configs` field"))
 }
+
+const manifestWithRemovedAPI = `
+app: myapp
+env: staging
+namespace: my-team
+manifests: |
+  ---
+  apiVersion: extensions/v1beta1
+  kind: Ingress
+  metadata:
+    name: myapp
+`
+
+func Test_templateValidation(t *testing.T) {
+	manifestFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	assert.NoError(t, err)
+	defer os.Remove(manifestFile.Name())
+	templatedFile, err := ioutil.TempFile("", "gimlet-cli-test")
+	assert.NoError(t, err)
+	defer os.Remove(templatedFile.Name())
+	ioutil.WriteFile(manifestFile.Name(), []byte(manifestWithRemovedAPI), commands.File_RW_RW_R)
+
+	args := strings.Split("gimlet manifest template", " ")
+	args = append(args, "-f", manifestFile.Name(), "-o", templatedFile.Name())
+	err = commands.Run(&Command, args)
+	assert.NoError(t, err, "validation is opt-in")
+
+	args = append(args, "--kube-version", "1.27")
+	err = commands.Run(&Command, args)
+	assert.ErrorContains(t, err, "not served by Kubernetes 1.27", "removed APIs should fail validation")
+}
@@ -164,5 +164,8 @@ func printGitopsStatuses(releaseStatus *dx.ReleaseStatus) {
 		} else {
 			fmt.Printf("\t%v %s -> %s, gitops hash %s, status is %s\n", emoji.OpenBook, result.App, result.Env, result.Hash, result.GitopsCommitStatus)
 		}
+		for _, violation := range result.PolicyViolations {
+			fmt.Printf("\t\t%v %s\n", emoji.Warning, violation.String())
+		}
 	}
 }
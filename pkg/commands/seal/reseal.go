@@ -0,0 +1,86 @@
+package seal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/enescakir/emoji"
+	"github.com/gimlet-io/gimlet/pkg/client"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+)
+
+var resealCmd = cli.Command{
+	Name:  "reseal",
+	Usage: "Re-seals the sealed values of an environment with its current sealed-secrets key",
+	UsageText: `gimlet seal reseal \
+     --env staging \
+     --private-key old-sealed-secrets-key.pem \
+     --server http://gimlet.mycompany.com
+     --token c012367f6e6f71de17ae4c6a7baac2e9`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "server",
+			Usage:    "Gimlet server URL, GIMLET_SERVER environment variable alternatively",
+			EnvVars:  []string{"GIMLET_SERVER"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "token",
+			Usage:    "Gimlet server api token, GIMLET_TOKEN environment variable alternatively",
+			EnvVars:  []string{"GIMLET_TOKEN"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "env",
+			Usage:    "re-seal the values of this environment",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:     "private-key",
+			Usage:    "PEM encoded private key the values were sealed with, can be repeated. The keys are not stored",
+			Required: true,
+		},
+	},
+	Action: reseal,
+}
+
+func reseal(c *cli.Context) error {
+	var privateKeys []string
+	for _, file := range c.StringSlice("private-key") {
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read private key %s", err)
+		}
+		privateKeys = append(privateKeys, string(key))
+	}
+
+	config := new(oauth2.Config)
+	auth := config.Client(
+		context.Background(),
+		&oauth2.Token{
+			AccessToken: c.String("token"),
+		},
+	)
+
+	client := client.NewClient(c.String("server"), auth)
+	result, err := client.ResealPost(c.String("env"), api.ResealRequest{
+		PrivateKeys: privateKeys,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, value := range result.Failed {
+		fmt.Fprintf(os.Stderr, "%v %s %s %s: %s\n", emoji.CrossMark, value.Repo, value.File, value.Path, value.Error)
+	}
+	fmt.Fprintf(os.Stderr, "%v Re-sealed %d value(s) with key %s\n", emoji.CheckMarkButton, len(result.Resealed), result.Fingerprint)
+	for _, pullRequest := range result.PullRequests {
+		fmt.Fprintf(os.Stderr, "Review and merge %s\n", pullRequest)
+	}
+
+	return nil
+}
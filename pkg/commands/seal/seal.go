@@ -0,0 +1,12 @@
+package seal
+
+import "github.com/urfave/cli/v2"
+
+var Command = cli.Command{
+	Name:  "seal",
+	Usage: "Seals secrets with the sealed-secrets key of an environment",
+	Subcommands: []*cli.Command{
+		&sealValuesCmd,
+		&resealCmd,
+	},
+}
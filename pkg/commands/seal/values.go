@@ -0,0 +1,141 @@
+package seal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/enescakir/emoji"
+	"github.com/gimlet-io/gimlet/pkg/client"
+	"github.com/gimlet-io/gimlet/pkg/commands"
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+	"sigs.k8s.io/yaml"
+)
+
+var sealValuesCmd = cli.Command{
+	Name:  "values",
+	Usage: "Seals every value of a yaml, json or .env file, or a whole file",
+	UsageText: `gimlet seal values \
+     --env staging \
+     -f secrets.yaml \
+     -o sealed-secrets.yaml \
+     --server http://gimlet.mycompany.com
+     --token c012367f6e6f71de17ae4c6a7baac2e9`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "server",
+			Usage:    "Gimlet server URL, GIMLET_SERVER environment variable alternatively",
+			EnvVars:  []string{"GIMLET_SERVER"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "token",
+			Usage:    "Gimlet server api token, GIMLET_TOKEN environment variable alternatively",
+			EnvVars:  []string{"GIMLET_TOKEN"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "env",
+			Usage:    "seal with the key of this environment",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "a yaml, json or .env file to seal value by value, any other file is sealed whole (\"-\" for stdin)",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "output file (stdout by default)",
+		},
+	},
+	Action: sealValues,
+}
+
+func sealValues(c *cli.Context) error {
+	file := c.String("file")
+	var contents []byte
+	var err error
+	if file == "-" {
+		contents, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		contents, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read file %s", err)
+	}
+
+	values, err := valuesToSeal(file, contents)
+	if err != nil {
+		return err
+	}
+
+	config := new(oauth2.Config)
+	auth := config.Client(
+		context.Background(),
+		&oauth2.Token{
+			AccessToken: c.String("token"),
+		},
+	)
+
+	client := client.NewClient(c.String("server"), auth)
+	sealed, err := client.SealValuesPost(c.String("env"), values)
+	if err != nil {
+		return err
+	}
+
+	sealedYaml, err := yaml.Marshal(sealed.Values)
+	if err != nil {
+		return fmt.Errorf("cannot marshal sealed values %s", err)
+	}
+
+	output := c.String("output")
+	if output == "" {
+		fmt.Print(string(sealedYaml))
+	} else {
+		err = ioutil.WriteFile(output, sealedYaml, commands.File_RW_RW_R)
+		if err != nil {
+			return fmt.Errorf("cannot write sealed values %s", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%v Sealed %d value(s) with key %s\n", emoji.CheckMarkButton, len(values), sealed.Fingerprint)
+	return nil
+}
+
+// valuesToSeal reads a map from yaml, json and .env files.
+// Any other file is sealed as a single value under its base name.
+func valuesToSeal(file string, contents []byte) (map[string]interface{}, error) {
+	base := filepath.Base(file)
+	switch {
+	case strings.HasSuffix(base, ".yaml"), strings.HasSuffix(base, ".yml"),
+		strings.HasSuffix(base, ".json"), file == "-":
+		var values map[string]interface{}
+		err := yaml.Unmarshal(contents, &values)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s as a map: %s", file, err)
+		}
+		return values, nil
+	case base == ".env" || strings.HasSuffix(base, ".env"):
+		env, err := godotenv.Unmarshal(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", file, err)
+		}
+		values := map[string]interface{}{}
+		for k, v := range env {
+			values[k] = v
+		}
+		return values, nil
+	default:
+		return map[string]interface{}{
+			base: string(contents),
+		}, nil
+	}
+}
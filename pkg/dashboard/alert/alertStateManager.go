@@ -265,6 +265,52 @@ func (a AlertStateManager) TrackPod(pod *api.Pod, repoName string, envName strin
 	return nil
 }
 
+// TrackImageDigestMismatch creates an alert for a pod that runs a different image digest than the released artifact's.
+// It is a noop if the alert is not enabled
+func (a *AlertStateManager) TrackImageDigestMismatch(pod *api.Pod, repoName string, envName string) error {
+	t, ok := a.thresholds[ImageDigestMismatch]
+	if !ok {
+		return nil
+	}
+
+	podName := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	deploymentName := fmt.Sprintf("%s/%s", pod.Namespace, pod.DeploymentName)
+	alerts, err := a.store.RelatedAlerts(podName)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	nonResolvedAlerts := []*model.Alert{}
+	for _, a := range alerts {
+		if a.Status != model.RESOLVED {
+			nonResolvedAlerts = append(nonResolvedAlerts, a)
+		}
+	}
+
+	alertToCreate := &model.Alert{
+		ObjectName:     podName,
+		Type:           thresholdType(t),
+		DeploymentName: deploymentName,
+		Status:         model.PENDING,
+		PendingAt:      time.Now().Unix(),
+		ImChannelId:    pod.ImChannelId,
+		DeploymentUrl:  fmt.Sprintf("%s/repo/%s/%s/%s", a.host, repoName, envName, pod.DeploymentName),
+	}
+	if alertExists(nonResolvedAlerts, alertToCreate) {
+		return nil
+	}
+
+	_, err = a.store.CreateAlert(alertToCreate)
+	if err != nil {
+		return err
+	}
+	silencedUntil, err := a.store.DeploymentSilencedUntil(alertToCreate.DeploymentName, alertToCreate.Type)
+	if err != nil {
+		logrus.Errorf("couldn't get deployment silenced until: %s", err)
+	}
+	a.broadcast(api.NewAlert(alertToCreate, t.Text(), t.Name(), silencedUntil), streaming.AlertPendingEventString)
+	return nil
+}
+
 func (a AlertStateManager) DeletePod(podName string) error {
 	alerts, err := a.store.RelatedAlerts(podName)
 	if err != nil && err != sql.ErrNoRows {
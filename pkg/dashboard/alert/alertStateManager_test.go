@@ -316,6 +316,54 @@ func TestPodsTrack(t *testing.T) {
 	assert.Equal(t, "imagePullBackOffThreshold", relatedAlerts[0].Type)
 }
 
+func TestTrackImageDigestMismatch(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		store.Close()
+	}()
+
+	dummyNotificationsManager := notifications.NewDummyManager()
+
+	pod := &api.Pod{
+		Namespace:      "ns1",
+		Name:           "pod1",
+		DeploymentName: "deployment1",
+		Status:         model.POD_RUNNING,
+	}
+
+	disabled := NewAlertStateManager(dummyNotificationsManager, nil, *store, 0, map[string]threshold{}, "")
+	disabled.TrackImageDigestMismatch(pod, "", "")
+	relatedAlerts, _ := store.RelatedAlerts("ns1/pod1")
+	assert.Equal(t, 0, len(relatedAlerts))
+
+	alertStateManager := NewAlertStateManager(
+		dummyNotificationsManager,
+		nil,
+		*store,
+		0,
+		map[string]threshold{
+			ImageDigestMismatch: imageDigestMismatchThreshold{},
+		},
+		"",
+	)
+
+	alertStateManager.TrackPod(pod, "", "")
+	alertStateManager.TrackImageDigestMismatch(pod, "", "")
+	alertStateManager.TrackImageDigestMismatch(pod, "", "")
+	relatedAlerts, _ = store.RelatedAlerts("ns1/pod1")
+	assert.Equal(t, 1, len(relatedAlerts))
+	assert.Equal(t, model.PENDING, relatedAlerts[0].Status)
+
+	alertStateManager.evaluatePendingAlerts()
+	alertStateManager.TrackPod(pod, "", "")
+	relatedAlerts, _ = store.RelatedAlerts("ns1/pod1")
+	assert.Equal(t, model.FIRING, relatedAlerts[0].Status, "a running pod doesn't resolve the alert")
+
+	alertStateManager.DeletePod("ns1/pod1")
+	relatedAlerts, _ = store.RelatedAlerts("ns1/pod1")
+	assert.Equal(t, model.RESOLVED, relatedAlerts[0].Status)
+}
+
 // func TestTrackEvents(t *testing.T) {
 // 	store := store.NewTest(encryptionKey, encryptionKeyNew)
 // 	defer func() {
@@ -36,9 +36,13 @@ func Thresholds() map[string]threshold {
 		"OOMKilled": oomKilledThreshold{
 			waitToResolve: 300,
 		},
+		ImageDigestMismatch: imageDigestMismatchThreshold{},
 	}
 }
 
+// ImageDigestMismatch is not a pod status, the alert is tracked with TrackImageDigestMismatch
+const ImageDigestMismatch = "ImageDigestMismatch"
+
 func ThresholdByType(thresholds map[string]threshold, thresholdTypeString string) threshold {
 	for _, t := range thresholds {
 		if thresholdType(t) == thresholdTypeString {
@@ -82,6 +86,9 @@ type oomKilledThreshold struct {
 	waitToResolve time.Duration
 }
 
+type imageDigestMismatchThreshold struct {
+}
+
 func (s imagePullBackOffThreshold) Reached(relatedObject interface{}, alert *model.Alert) bool {
 	alertPendingSince := time.Unix(alert.PendingAt, 0)
 	waitTime := time.Now().Add(-time.Second * s.waitTime)
@@ -166,6 +173,16 @@ func (s oomKilledThreshold) Resolved(relatedObject interface{}) bool {
 	return pod.Status == model.POD_RUNNING && runningSince.Before(waitToResolveTime)
 }
 
+func (s imageDigestMismatchThreshold) Reached(relatedObject interface{}, alert *model.Alert) bool {
+	return true
+}
+
+// Resolved is never reached by the pod state, the image of a running pod doesn't change.
+// The alert is resolved when the pod is deleted
+func (s imageDigestMismatchThreshold) Resolved(relatedObject interface{}) bool {
+	return false
+}
+
 func (t imagePullBackOffThreshold) Text() string {
 	return `
 ### When It Happens
@@ -243,6 +260,20 @@ You can also use the ` + "`" + `kubectl describe pod <pod-name>` + "`" + ` comma
 `
 }
 
+func (t imageDigestMismatchThreshold) Text() string {
+	return `
+### When It Happens
+
+The pod runs a different image digest than the released artifact's. Image tags are mutable: someone re-pushed the tag after the release, and the pod pulled the new image.
+
+### How to Fix It
+
+Check who pushed the tag in your registry's audit log. Redeploy the artifact with a digest pinned image, or delete the pod if the node still has the released image cached.
+
+Pin image digests on the artifact with ` + "`" + `gimlet artifact add --image <image>:<tag>@<digest>` + "`" + ` so Gimlet doesn't have to trust the first digest it sees.
+`
+}
+
 func (t imagePullBackOffThreshold) Name() string {
 	return "ImagePullBackOff"
 }
@@ -266,3 +297,7 @@ func (t failedEventThreshold) Name() string {
 func (t oomKilledThreshold) Name() string {
 	return "OOMKilled"
 }
+
+func (t imageDigestMismatchThreshold) Name() string {
+	return ImageDigestMismatch
+}
@@ -29,15 +29,25 @@ type Service struct {
 }
 
 type Pod struct {
-	Name              string         `json:"name"`
-	DeploymentName    string         `json:"deploymentName"`
-	Namespace         string         `json:"namespace"`
-	Status            string         `json:"status"`
-	StatusDescription string         `json:"statusDescription"`
-	Logs              string         `json:"logs"`
-	ImChannelId       string         `json:"imChannelId"`
-	Details           string         `json:"details,omitempty"`
-	Containers        []v1.Container `json:"containers,omitempty"`
+	Name              string            `json:"name"`
+	DeploymentName    string            `json:"deploymentName"`
+	Namespace         string            `json:"namespace"`
+	Status            string            `json:"status"`
+	StatusDescription string            `json:"statusDescription"`
+	Logs              string            `json:"logs"`
+	ImChannelId       string            `json:"imChannelId"`
+	Details           string            `json:"details,omitempty"`
+	Containers        []v1.Container    `json:"containers,omitempty"`
+	Images            []*ContainerImage `json:"images,omitempty"`
+}
+
+// ContainerImage is the image of a container, with the digest that the container runs
+type ContainerImage struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+	// ReleasedDigest is set when the running digest is not the digest of the released artifact's image
+	ReleasedDigest string `json:"releasedDigest,omitempty"`
 }
 
 func (p *Pod) FQN() string {
@@ -52,6 +62,8 @@ type Deployment struct {
 	Branch        string `json:"branch"`
 	CommitMessage string `json:"commitMessage"`
 	Details       string `json:"details,omitempty"`
+	// ArtifactID is the artifact that the deployment was released from
+	ArtifactID string `json:"artifactId,omitempty"`
 }
 
 func (d *Deployment) FQN() string {
@@ -110,6 +122,113 @@ func (h HelmRelease) String() string {
 	return fmt.Sprintf("HelmRelease %s/%s - %d - %s: %s", h.Namespace, h.Name, h.LastTransitionTime, h.Status, h.StatusDesc)
 }
 
+const TerraformPlanPending = "pending"
+const TerraformPlanApproved = "approved"
+const TerraformPlanRejected = "rejected"
+
+// TerraformPlan is a plan of a Terraform dependency that waits for a manual approval
+type TerraformPlan struct {
+	Env       string `json:"env"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	PlanID    string `json:"planId"`
+	Summary   string `json:"summary"`
+	Plan      string `json:"plan"`
+	Status    string `json:"status"`
+	Created   int64  `json:"created"`
+	// ReviewedBy is the user who approved or rejected the plan
+	ReviewedBy string `json:"reviewedBy,omitempty"`
+}
+
+// IdlePreview is a preview deployment with an idle policy, reported by the agent when it goes to sleep or wakes up
+type IdlePreview struct {
+	Env       string `json:"env"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Repo      string `json:"repo"`
+	Branch    string `json:"branch"`
+	SHA       string `json:"sha"`
+	Host      string `json:"host,omitempty"`
+	Sleeping  bool   `json:"sleeping"`
+	// Since is the time of the last state change
+	Since int64 `json:"since"`
+}
+
+const RolloutProgressing = "Progressing"
+const RolloutSucceeded = "Succeeded"
+const RolloutFailed = "Failed"
+
+// Rollout is the progress of a Flagger canary or blue/green rollout, reported by the agent
+type Rollout struct {
+	Env        string `json:"env"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	App        string `json:"app"`
+	Repo       string `json:"repo"`
+	SHA        string `json:"sha"`
+	ArtifactID string `json:"artifactId"`
+	// Phase is the Flagger phase of the rollout, eg.: Progressing, Succeeded (promoted) or Failed (aborted)
+	Phase        string `json:"phase"`
+	CanaryWeight int    `json:"canaryWeight"`
+	Iterations   int    `json:"iterations"`
+	FailedChecks int    `json:"failedChecks"`
+	// Message is the latest analysis result
+	Message string `json:"message"`
+	// Since is the time of the last phase change
+	Since int64 `json:"since"`
+}
+
+// ImageUpdate is an image tag update of an env config, made when a newer tag matched its image update policy
+type ImageUpdate struct {
+	Repo  string `json:"repo"`
+	Env   string `json:"env"`
+	App   string `json:"app"`
+	Image string `json:"image"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// SHA is the commit of the update. Link is the pull request, if the update was proposed in one
+	SHA     string `json:"sha,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// SealedValues are values sealed with the sealed-secrets certificate of an environment
+type SealedValues struct {
+	// Fingerprint is the fingerprint of the certificate the values were sealed with
+	Fingerprint string                 `json:"fingerprint"`
+	Values      map[string]interface{} `json:"values"`
+}
+
+// SealingKey tells if the sealed-secrets key of an environment was rotated since values were last sealed with it
+type SealingKey struct {
+	Fingerprint string `json:"fingerprint"`
+	SealedWith  string `json:"sealedWith,omitempty"`
+	Rotated     bool   `json:"rotated"`
+}
+
+// ResealRequest holds the PEM encoded sealed-secrets private keys that the stale values were sealed with.
+// The keys are only used for the duration of the request, and never stored
+type ResealRequest struct {
+	PrivateKeys []string `json:"privateKeys"`
+}
+
+// ResealedValue is a sealed value found in an env config
+type ResealedValue struct {
+	Repo string `json:"repo"`
+	File string `json:"file"`
+	Path string `json:"path"`
+	// Fingerprint is the fingerprint of the key the value was sealed with
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type ResealResult struct {
+	Fingerprint  string           `json:"fingerprint"`
+	Resealed     []*ResealedValue `json:"resealed"`
+	Failed       []*ResealedValue `json:"failed"`
+	PullRequests []string         `json:"pullRequests"`
+}
+
 type Event struct {
 	FirstTimestamp int64  `json:"firstTimestamp"`
 	Count          int32  `json:"count"`
@@ -203,11 +322,12 @@ type StackUpdate struct {
 	Svc     string `json:"svc"`
 
 	// Pod
-	Status      string `json:"status"`
-	Deployment  string `json:"deployment"`
-	ErrorCause  string `json:"errorCause"`
-	Logs        string `json:"logs"`
-	ImChannelId string `json:"imChannelId"`
+	Status      string            `json:"status"`
+	Deployment  string            `json:"deployment"`
+	ErrorCause  string            `json:"errorCause"`
+	Logs        string            `json:"logs"`
+	ImChannelId string            `json:"imChannelId"`
+	Images      []*ContainerImage `json:"images,omitempty"`
 
 	// Deployment
 	Branch        string `json:"branch"`
@@ -268,6 +388,8 @@ type CommitEvent struct {
 	Status            string                `json:"status"`
 	StatusDesc        string                `json:"statusDesc"`
 	Results           []CommitEventResult   `json:"results,omitempty"`
+	ArtifactID        string                `json:"artifactId,omitempty"`
+	Attachments       []*dx.Attachment      `json:"attachments,omitempty"`
 }
 
 type CommitEventResult struct {
@@ -0,0 +1,172 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+)
+
+var ErrNotFound = errors.New("not found in archive")
+
+// Archive stores expired events as compressed JSON
+type Archive interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+// New returns the archive at location, that is a local directory, or s3://bucket/prefix.
+// Returns nil if location is empty, meaning expired events are not archived
+func New(location string, s3Config S3Config) (Archive, error) {
+	if location == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(location, "s3://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse archive location %s: %s", location, err)
+		}
+		return newS3Archive(u.Host, strings.Trim(u.Path, "/"), s3Config), nil
+	}
+
+	return &dirArchive{dir: location}, nil
+}
+
+// Store archives an event. Artifacts are stored under their artifact ID so they can be restored by it.
+// The values of sensitive vars are not part of the event, they are archived encrypted with StoreSensitiveVars
+func Store(a Archive, event *model.Event) error {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err = w.Write(eventJson)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return a.Put(key(event), compressed.Bytes())
+}
+
+// Restore reads an archived artifact
+func Restore(a Archive, artifactID string) (*model.Event, error) {
+	compressed, err := a.Get(artifactKey(artifactID))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	eventJson, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var event model.Event
+	err = json.Unmarshal(eventJson, &event)
+	return &event, err
+}
+
+// StoreAttachment archives the content of an artifact attachment, it is restored with the artifact
+func StoreAttachment(a Archive, attachment *model.Attachment) error {
+	return a.Put(attachmentKey(attachment.ArtifactID, attachment.Name), attachment.Content)
+}
+
+// RestoreAttachment reads the archived content of an artifact attachment
+func RestoreAttachment(a Archive, artifactID string, name string) ([]byte, error) {
+	return a.Get(attachmentKey(artifactID, name))
+}
+
+// StoreSensitiveVars archives the sensitive vars of an artifact, as encrypted in the database
+func StoreSensitiveVars(a Archive, artifactID string, encrypted string) error {
+	return a.Put(sensitiveVarsKey(artifactID), []byte(encrypted))
+}
+
+// RestoreSensitiveVars reads the archived, encrypted sensitive vars of an artifact
+func RestoreSensitiveVars(a Archive, artifactID string) (string, error) {
+	encrypted, err := a.Get(sensitiveVarsKey(artifactID))
+	return string(encrypted), err
+}
+
+func sensitiveVarsKey(artifactID string) string {
+	return fmt.Sprintf("sensitive-vars/%s", artifactID)
+}
+
+// StoreImageDigests archives the image digests recorded for an artifact, they are restored with the artifact
+func StoreImageDigests(a Archive, artifactID string, imageDigests []*model.ImageDigest) error {
+	imageDigestsJson, err := json.Marshal(imageDigests)
+	if err != nil {
+		return err
+	}
+	return a.Put(imageDigestsKey(artifactID), imageDigestsJson)
+}
+
+// RestoreImageDigests reads the archived image digests of an artifact
+func RestoreImageDigests(a Archive, artifactID string) ([]*model.ImageDigest, error) {
+	imageDigestsJson, err := a.Get(imageDigestsKey(artifactID))
+	if err != nil {
+		return nil, err
+	}
+
+	var imageDigests []*model.ImageDigest
+	err = json.Unmarshal(imageDigestsJson, &imageDigests)
+	return imageDigests, err
+}
+
+func imageDigestsKey(artifactID string) string {
+	return fmt.Sprintf("image-digests/%s.json", artifactID)
+}
+
+func attachmentKey(artifactID string, name string) string {
+	return fmt.Sprintf("attachments/%s/%s", artifactID, url.PathEscape(name))
+}
+
+func key(event *model.Event) string {
+	if event.Type == model.ArtifactCreatedEvent {
+		return artifactKey(event.ArtifactID)
+	}
+	return fmt.Sprintf("events/%s.json.gz", event.ID)
+}
+
+func artifactKey(artifactID string) string {
+	return fmt.Sprintf("artifacts/%s.json.gz", artifactID)
+}
+
+type dirArchive struct {
+	dir string
+}
+
+func (a *dirArchive) Put(key string, data []byte) error {
+	path := filepath.Join(a.dir, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (a *dirArchive) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(a.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
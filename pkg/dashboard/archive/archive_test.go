@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dirArchive(t *testing.T) {
+	a, err := New(t.TempDir(), S3Config{})
+	assert.Nil(t, err)
+
+	testRoundTrip(t, a)
+}
+
+func Test_s3Archive(t *testing.T) {
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, sha256Hex(body), r.Header.Get("x-amz-content-sha256"))
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	a, err := New("s3://my-bucket/gimlet", S3Config{
+		Endpoint:  server.URL,
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	assert.Nil(t, err)
+
+	testRoundTrip(t, a)
+	_, ok := objects["/my-bucket/gimlet/artifacts/gimlet-io/my-app-1234.json.gz"]
+	assert.True(t, ok, "objects should be stored under the prefix")
+}
+
+func Test_noArchive(t *testing.T) {
+	a, err := New("", S3Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, a)
+}
+
+func testRoundTrip(t *testing.T, a Archive) {
+	err := Store(a, &model.Event{
+		ID:         "5678",
+		Type:       model.ArtifactCreatedEvent,
+		Blob:       `{"id":"gimlet-io/my-app-1234"}`,
+		Status:     model.StatusProcessed,
+		ArtifactID: "gimlet-io/my-app-1234",
+	})
+	assert.Nil(t, err)
+
+	restored, err := Restore(a, "gimlet-io/my-app-1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "5678", restored.ID)
+	assert.Equal(t, `{"id":"gimlet-io/my-app-1234"}`, restored.Blob)
+	assert.Equal(t, model.StatusProcessed, restored.Status)
+
+	_, err = Restore(a, "gimlet-io/my-app-0000")
+	assert.Equal(t, ErrNotFound, err)
+
+	err = StoreAttachment(a, &model.Attachment{ArtifactID: "gimlet-io/my-app-1234", Name: "sbom.spdx.json", Content: []byte("{}")})
+	assert.Nil(t, err)
+	content, err := RestoreAttachment(a, "gimlet-io/my-app-1234", "sbom.spdx.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("{}"), content)
+
+	err = StoreSensitiveVars(a, "gimlet-io/my-app-1234", `"encrypted"`)
+	assert.Nil(t, err)
+	encrypted, err := RestoreSensitiveVars(a, "gimlet-io/my-app-1234")
+	assert.Nil(t, err)
+	assert.Equal(t, `"encrypted"`, encrypted)
+
+	err = StoreImageDigests(a, "gimlet-io/my-app-1234", []*model.ImageDigest{{ArtifactID: "gimlet-io/my-app-1234", Image: "nginx:1.25", Digest: "sha256:1111"}})
+	assert.Nil(t, err)
+	imageDigests, err := RestoreImageDigests(a, "gimlet-io/my-app-1234")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(imageDigests))
+	assert.Equal(t, "sha256:1111", imageDigests[0].Digest)
+}
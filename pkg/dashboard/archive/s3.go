@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Config is the access to an S3 compatible storage
+type S3Config struct {
+	// Endpoint defaults to AWS S3 in the region, set it for MinIO, R2, etc
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// s3Archive talks to S3 compatible storages with path-style requests, signed with AWS Signature Version 4
+type s3Archive struct {
+	config S3Config
+	bucket string
+	prefix string
+	client *http.Client
+}
+
+func newS3Archive(bucket string, prefix string, config S3Config) *s3Archive {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &s3Archive{
+		config: config,
+		bucket: bucket,
+		prefix: prefix,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (a *s3Archive) Put(key string, data []byte) error {
+	resp, err := a.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("cannot put %s: %s %s", key, resp.Status, string(body))
+	}
+	return nil
+}
+
+func (a *s3Archive) Get(key string) ([]byte, error) {
+	resp, err := a.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot get %s: %s %s", key, resp.Status, string(body))
+	}
+	return body, nil
+}
+
+func (a *s3Archive) do(method string, key string, payload []byte) (*http.Response, error) {
+	objectURL := fmt.Sprintf("%s/%s/%s", a.config.Endpoint, a.bucket, path.Join(a.prefix, key))
+	req, err := http.NewRequest(method, objectURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	a.sign(req, payload, time.Now().UTC())
+
+	return a.client.Do(req)
+}
+
+func (a *s3Archive) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+a.config.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, a.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
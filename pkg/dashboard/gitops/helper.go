@@ -11,10 +11,12 @@ import (
 
 	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/gimlet-io/go-scm/scm"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -326,6 +328,35 @@ func Version(
 	}, nil
 }
 
+// FakeArtifact makes an artifact for a commit, for repos that don't push artifacts from CI
+func FakeArtifact(
+	repo *git.Repository,
+	repoName string,
+	hash string,
+	branch string,
+	manifests []*dx.Manifest,
+) (*dx.Artifact, error) {
+	owner, name := scm.Split(repoName)
+	version, err := Version(owner, name, repo, hash, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dx.Artifact{
+		ID:           fmt.Sprintf("%s-%s", repoName, uuid.New().String()),
+		Created:      time.Now().Unix(),
+		Fake:         true,
+		Environments: manifests,
+		Version:      *version,
+		Vars: map[string]string{
+			"SHA":    hash,
+			"REPO":   repoName,
+			"OWNER":  owner,
+			"BRANCH": branch,
+		},
+	}, nil
+}
+
 func Manifest(
 	repo *git.Repository,
 	sha string,
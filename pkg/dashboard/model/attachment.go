@@ -0,0 +1,13 @@
+package model
+
+// Attachment is the content of an artifact attachment: an SBOM, a provenance attestation, a test or a coverage report.
+// The artifact only holds its digest and summary
+type Attachment struct {
+	ID         int64  `json:"id" meddler:"id,pk"`
+	ArtifactID string `json:"artifactId" meddler:"artifact_id"`
+	Name       string `json:"name" meddler:"name"`
+	Type       string `json:"type" meddler:"type"`
+	Digest     string `json:"digest" meddler:"digest"`
+	Content    []byte `json:"-" meddler:"content"`
+	Created    int64  `json:"created" meddler:"created"`
+}
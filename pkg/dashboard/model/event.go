@@ -16,6 +16,9 @@ const ReleaseRequestedEvent = "release"
 const ImageBuildRequestedEvent = "imageBuild"
 const RollbackRequestedEvent = "rollback"
 const BranchDeletedEvent = "branchDeleted"
+const PRClosedEvent = "prClosed"
+const PRMergedEvent = "prMerged"
+const TTLExpiredEvent = "ttlExpired"
 
 type Status int
 
@@ -50,6 +53,8 @@ type Result struct {
 	GitopsRef  string
 	GitopsRepo string
 
+	PolicyViolations []dx.PolicyViolation `json:"policyViolations,omitempty"`
+
 	TriggeredImageBuildRequestID string `json:"triggeredImageBuildRequestID,omitempty"`
 	TriggeredDeployRequestID     string `json:"triggeredDeployRequestID,omitempty"`
 	Log                          string `json:"log,omitempty"`
@@ -73,14 +78,41 @@ type Event struct {
 	Tag          string      `json:"tag,omitempty"  meddler:"tag"`
 	SHA          string      `json:"sha"  meddler:"sha"`
 	ArtifactID   string      `json:"artifactID"  meddler:"artifact_id"`
+
+	IdempotencyKey string `json:"idempotencyKey,omitempty"  meddler:"idempotency_key"`
+	// Restored is when the event was restored from the retention archive, it is kept for another retention period from then
+	Restored int64 `json:"restored,omitempty"  meddler:"restored"`
+
+	// the original values of the sensitive vars that are masked in the blob
+	SensitiveVars string `json:"-"  meddler:"sensitive_vars,encrypted"`
 }
 
+// ToEvent masks the sensitive vars of the artifact in the blob, and keeps their values apart, to be stored encrypted
 func ToEvent(artifact dx.Artifact) (*Event, error) {
 	artifactStr, err := json.Marshal(artifact)
 	if err != nil {
 		return nil, fmt.Errorf("cannot serialize artifact: %s", err)
 	}
 
+	// a copy, so masking doesn't touch the vars of the caller
+	var masked dx.Artifact
+	err = json.Unmarshal(artifactStr, &masked)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serialize artifact: %s", err)
+	}
+	sensitiveVarsStr := ""
+	if sensitiveVars := masked.MaskSensitiveVars(); sensitiveVars != nil {
+		sensitiveVarsBytes, err := json.Marshal(sensitiveVars)
+		if err != nil {
+			return nil, fmt.Errorf("cannot serialize sensitive vars: %s", err)
+		}
+		sensitiveVarsStr = string(sensitiveVarsBytes)
+		artifactStr, err = json.Marshal(masked)
+		if err != nil {
+			return nil, fmt.Errorf("cannot serialize artifact: %s", err)
+		}
+	}
+
 	return &Event{
 		Type:         ArtifactCreatedEvent,
 		Repository:   artifact.Version.RepositoryName,
@@ -92,11 +124,35 @@ func ToEvent(artifact dx.Artifact) (*Event, error) {
 		Blob:         string(artifactStr),
 		SHA:          artifact.Version.SHA,
 		ArtifactID:   artifact.ID,
+
+		IdempotencyKey: artifact.IdempotencyKey,
+		SensitiveVars:  sensitiveVarsStr,
 	}, nil
 }
 
+// ToArtifact returns the artifact with its sensitive vars masked.
+// Artifacts that were stored before sensitive vars were masked are masked on read
 func ToArtifact(a *Event) (*dx.Artifact, error) {
 	var artifact dx.Artifact
 	json.Unmarshal([]byte(a.Blob), &artifact)
+	artifact.MaskSensitiveVars()
 	return &artifact, nil
 }
+
+// ToSensitiveVars returns the original values of the sensitive vars that are masked in the artifact blob.
+// Only the worker should use it, to resolve the templates of the artifact
+func ToSensitiveVars(a *Event) (*dx.SensitiveVars, error) {
+	if a.SensitiveVars == "" {
+		// stored before sensitive vars were masked, the blob has the values
+		var artifact dx.Artifact
+		json.Unmarshal([]byte(a.Blob), &artifact)
+		return artifact.MaskSensitiveVars(), nil
+	}
+
+	var sensitiveVars dx.SensitiveVars
+	err := json.Unmarshal([]byte(a.SensitiveVars), &sensitiveVars)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse sensitive vars: %s", err)
+	}
+	return &sensitiveVars, nil
+}
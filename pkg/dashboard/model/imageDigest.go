@@ -0,0 +1,11 @@
+package model
+
+// ImageDigest is the digest that an agent first saw running for an image of an artifact.
+// It is recorded for the images that the artifact didn't pin a digest for
+type ImageDigest struct {
+	ID         int64  `json:"id" meddler:"id,pk"`
+	ArtifactID string `json:"artifactId" meddler:"artifact_id"`
+	Image      string `json:"image" meddler:"image"`
+	Digest     string `json:"digest" meddler:"digest"`
+	Created    int64  `json:"created" meddler:"created"`
+}
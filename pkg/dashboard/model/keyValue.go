@@ -27,6 +27,21 @@ const ReposWithCleanupPolicy = "reposWithCleanupPolicy"
 
 const ReposWithPullRequestPolicy = "reposWithPullRequestPolicy"
 
+// TerraformPlans is a prefix for the key that holds the Terraform plans of an environment
+const TerraformPlans = "terraformPlans"
+
+// IdlePreviews is a prefix for the key that holds the idle state of the preview deployments of an environment
+const IdlePreviews = "idlePreviews"
+
+// Rollouts is a prefix for the key that holds the progressive rollouts of an environment
+const Rollouts = "rollouts"
+
+// SealedSecretsFingerprint is a prefix for the key that holds the fingerprint of the certificate that values were last sealed with in an environment
+const SealedSecretsFingerprint = "sealedSecretsFingerprint"
+
+// ImageUpdates is a prefix for the key that holds the image tag update history of a repo
+const ImageUpdates = "imageUpdates"
+
 // KeyValue is a key-value pair for simple storage for things fit in the data model
 type KeyValue struct {
 	// ID for this repo
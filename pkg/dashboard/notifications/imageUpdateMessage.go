@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+)
+
+type imageUpdateMessage struct {
+	imageUpdate api.ImageUpdate
+}
+
+func (im *imageUpdateMessage) text() string {
+	if im.imageUpdate.Link != "" {
+		return fmt.Sprintf("%s:%s is available, the update of *%s* from %s is proposed in %s",
+			im.imageUpdate.Image, im.imageUpdate.To, im.imageUpdate.App, im.imageUpdate.From, im.imageUpdate.Link)
+	}
+	return fmt.Sprintf("*%s* is updated from %s to %s:%s",
+		im.imageUpdate.App, im.imageUpdate.From, im.imageUpdate.Image, im.imageUpdate.To)
+}
+
+func (im *imageUpdateMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text: fmt.Sprintf("IMAGE UPDATE: :arrow_up: %s on %s", im.text(), im.imageUpdate.Env),
+	}
+
+	msg.Blocks = []Block{
+		{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: msg.Text,
+			},
+		},
+	}
+	if im.imageUpdate.SHA != "" {
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{
+						Type: markdown,
+						Text: fmt.Sprintf(":clipboard: %s", commitLink(im.imageUpdate.Repo, im.imageUpdate.SHA)),
+					},
+				},
+			},
+		)
+	}
+
+	return msg, nil
+}
+
+func (im *imageUpdateMessage) Env() string {
+	return im.imageUpdate.Env
+}
+
+func (im *imageUpdateMessage) AsStatus() (*status, error) {
+	return nil, nil
+}
+
+func (im *imageUpdateMessage) AsDiscordMessage() (*discordMessage, error) {
+	description := strings.ReplaceAll(im.text(), "*", "**")
+	if im.imageUpdate.SHA != "" {
+		description += "\n" + discordCommitLink(im.imageUpdate.Repo, im.imageUpdate.SHA)
+	}
+
+	return &discordMessage{
+		Text: fmt.Sprintf("IMAGE UPDATE: %s on %s", im.imageUpdate.App, strings.Title(im.imageUpdate.Env)),
+		Embed: &discordgo.MessageEmbed{
+			Type:        "article",
+			Description: description,
+			Color:       3066993,
+		},
+	}, nil
+}
+
+func MessageFromImageUpdate(imageUpdate api.ImageUpdate) Message {
+	return &imageUpdateMessage{
+		imageUpdate: imageUpdate,
+	}
+}
+
+func (im *imageUpdateMessage) RepositoryName() string {
+	return im.imageUpdate.Repo
+}
+
+func (im *imageUpdateMessage) SHA() string {
+	return im.imageUpdate.SHA
+}
+
+func (im *imageUpdateMessage) CustomChannel() string {
+	return ""
+}
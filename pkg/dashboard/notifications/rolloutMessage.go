@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+)
+
+const rolloutContextFormat = "rollout/%s"
+
+type rolloutMessage struct {
+	rollout api.Rollout
+}
+
+func (rm *rolloutMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text:   "",
+		Blocks: []Block{},
+	}
+
+	switch rm.rollout.Phase {
+	case api.RolloutSucceeded:
+		msg.Text = fmt.Sprintf("ROLLOUT: :white_check_mark: *%s* %s is promoted on %s", rm.rollout.App, commitLink(rm.rollout.Repo, rm.rollout.SHA), rm.rollout.Env)
+	case api.RolloutFailed:
+		msg.Text = fmt.Sprintf("ROLLOUT: :exclamation: *%s* %s is aborted and rolled back on %s", rm.rollout.App, commitLink(rm.rollout.Repo, rm.rollout.SHA), rm.rollout.Env)
+	default:
+		msg.Text = fmt.Sprintf("ROLLOUT: :hourglass_flowing_sand: Progressive rollout of *%s* %s started on %s", rm.rollout.App, commitLink(rm.rollout.Repo, rm.rollout.SHA), rm.rollout.Env)
+	}
+
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: msg.Text,
+			},
+		},
+	)
+	if rm.rollout.Message != "" {
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{
+						Type: markdown,
+						Text: rm.rollout.Message,
+					},
+				},
+			},
+		)
+	}
+
+	return msg, nil
+}
+
+func (rm *rolloutMessage) Env() string {
+	return rm.rollout.Env
+}
+
+func (rm *rolloutMessage) AsStatus() (*status, error) {
+	if rm.rollout.Repo == "" || rm.rollout.SHA == "" {
+		return nil, nil
+	}
+
+	state := "pending"
+	switch rm.rollout.Phase {
+	case api.RolloutSucceeded:
+		state = "success"
+	case api.RolloutFailed:
+		state = "failure"
+	}
+
+	desc := rm.rollout.Message
+	if len(desc) > 140 {
+		desc = desc[:140]
+	}
+
+	return &status{
+		state:       state,
+		context:     fmt.Sprintf(rolloutContextFormat, rm.rollout.Env),
+		description: desc,
+		repo:        rm.rollout.Repo,
+		sha:         rm.rollout.SHA,
+	}, nil
+}
+
+func (rm *rolloutMessage) AsDiscordMessage() (*discordMessage, error) {
+	msg := &discordMessage{
+		Text: fmt.Sprintf("ROLLOUT: %s on %s", rm.rollout.App, strings.Title(rm.rollout.Env)),
+		Embed: &discordgo.MessageEmbed{
+			Type:        "article",
+			Description: "",
+			Color:       3066993,
+		},
+	}
+
+	switch rm.rollout.Phase {
+	case api.RolloutSucceeded:
+		msg.Embed.Description = fmt.Sprintf(":white_check_mark: %s is promoted", discordCommitLink(rm.rollout.Repo, rm.rollout.SHA))
+	case api.RolloutFailed:
+		msg.Embed.Description = fmt.Sprintf(":exclamation: %s is aborted and rolled back", discordCommitLink(rm.rollout.Repo, rm.rollout.SHA))
+		msg.Embed.Color = 15158332
+	default:
+		msg.Embed.Description = fmt.Sprintf(":hourglass_flowing_sand: Progressive rollout of %s started", discordCommitLink(rm.rollout.Repo, rm.rollout.SHA))
+	}
+	if rm.rollout.Message != "" {
+		msg.Embed.Description += "\n" + rm.rollout.Message
+	}
+
+	return msg, nil
+}
+
+func MessageFromRollout(rollout api.Rollout) Message {
+	return &rolloutMessage{
+		rollout: rollout,
+	}
+}
+
+func (rm *rolloutMessage) RepositoryName() string {
+	return rm.rollout.Repo
+}
+
+func (rm *rolloutMessage) SHA() string {
+	return rm.rollout.SHA
+}
+
+func (rm *rolloutMessage) CustomChannel() string {
+	return ""
+}
@@ -0,0 +1,251 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const LabelRevision = "org.opencontainers.image.revision"
+const LabelSource = "org.opencontainers.image.source"
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+var challengeParams = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Registry holds the credentials of a container registry, to read image labels
+type Registry struct {
+	Host     string `yaml:"host" json:"host"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	// Insecure uses plain http
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Labels reads the labels of an image from the registry's v2 API.
+// reference is a tag or a digest. For multi-platform images, the linux/amd64 image's labels are returned
+func Labels(image string, reference string, registries []*Registry) (map[string]string, error) {
+	host, name := splitImage(image)
+	client := newRegistryClient(host, registries)
+
+	m, err := client.manifest(name, reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Manifests) > 0 {
+		digest := m.Manifests[0].Digest
+		for _, platformManifest := range m.Manifests {
+			if platformManifest.Platform.OS == "linux" && platformManifest.Platform.Architecture == "amd64" {
+				digest = platformManifest.Digest
+			}
+		}
+		m, err = client.manifest(name, digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("%s:%s has no image config", image, reference)
+	}
+
+	configJson, err := client.get(fmt.Sprintf("/v2/%s/blobs/%s", name, m.Config.Digest), "")
+	if err != nil {
+		return nil, err
+	}
+	var imageConfig struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	err = json.Unmarshal(configJson, &imageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse image config: %s", err)
+	}
+	return imageConfig.Config.Labels, nil
+}
+
+// splitImage splits an image name to the registry host and the repository name in the registry
+func splitImage(image string) (string, string) {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if parts[0] == "docker.io" {
+			return "registry-1.docker.io", dockerHubName(parts[1])
+		}
+		return parts[0], parts[1]
+	}
+	return "registry-1.docker.io", dockerHubName(image)
+}
+
+func dockerHubName(name string) string {
+	if !strings.Contains(name, "/") {
+		return "library/" + name
+	}
+	return name
+}
+
+type registryClient struct {
+	registry *Registry
+	client   *http.Client
+	token    string
+}
+
+// newRegistryClient uses the credentials of the host, if there are any
+func newRegistryClient(host string, registries []*Registry) *registryClient {
+	client := &registryClient{
+		registry: &Registry{Host: host},
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, r := range registries {
+		if r.Host == host {
+			client.registry = r
+		}
+	}
+	return client
+}
+
+func (c *registryClient) manifest(name string, reference string) (*manifest, error) {
+	manifestJson, err := c.get(fmt.Sprintf("/v2/%s/manifests/%s", name, reference), strings.Join(manifestMediaTypes, ","))
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	err = json.Unmarshal(manifestJson, &m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %s", err)
+	}
+	return &m, nil
+}
+
+func (c *registryClient) get(path string, accept string) ([]byte, error) {
+	body, _, err := c.getWithHeader(path, accept)
+	return body, err
+}
+
+func (c *registryClient) getWithHeader(path string, accept string) ([]byte, http.Header, error) {
+	scheme := "https"
+	if c.registry.Insecure {
+		scheme = "http"
+	}
+	requestURL := fmt.Sprintf("%s://%s%s", scheme, c.registry.Host, path)
+
+	resp, err := c.do(requestURL, accept)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		err = c.authenticate(challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err = c.do(requestURL, accept)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("cannot get %s: %s", requestURL, resp.Status)
+	}
+	return body, resp.Header, nil
+}
+
+func (c *registryClient) do(requestURL string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	} else if c.registry.Username != "" {
+		req.SetBasicAuth(c.registry.Username, c.registry.Password)
+	}
+	return c.client.Do(req)
+}
+
+// authenticate gets a bearer token with the Docker token auth flow
+func (c *registryClient) authenticate(challenge string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return fmt.Errorf("registry authentication failed")
+	}
+
+	params := map[string]string{}
+	for _, match := range challengeParams.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication challenge: %s", challenge)
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.registry.Username != "" {
+		req.SetBasicAuth(c.registry.Username, c.registry.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot get registry token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("cannot parse registry token: %s", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	c.token = "Bearer " + token.Token
+	return nil
+}
@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseDockerRegistryNotification(t *testing.T) {
+	pushes, err := ParseWebhook(http.Header{}, []byte(`{
+  "events": [
+    {
+      "action": "push",
+      "target": {
+        "mediaType": "application/vnd.docker.container.image.rootfs.diff+x-gtar",
+        "digest": "sha256:c3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8b",
+        "repository": "team/my-app"
+      },
+      "request": {"host": "registry.example.com"}
+    },
+    {
+      "action": "push",
+      "target": {
+        "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+        "digest": "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+        "repository": "team/my-app",
+        "tag": "main-ea9ab7c"
+      },
+      "request": {"host": "registry.example.com"}
+    }
+  ]
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pushes), "blob pushes should be ignored")
+	assert.Equal(t, "registry.example.com/team/my-app", pushes[0].Image)
+	assert.Equal(t, "main-ea9ab7c", pushes[0].Tag)
+	assert.Equal(t, "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf", pushes[0].Digest)
+}
+
+func Test_parseHarborWebhook(t *testing.T) {
+	pushes, err := ParseWebhook(http.Header{}, []byte(`{
+  "type": "PUSH_ARTIFACT",
+  "event_data": {
+    "resources": [
+      {
+        "digest": "sha256:954b378c375d852eb3c63ab88978f640b4348b01c1b3456a024a81536dafbbf4",
+        "tag": "v1.0.0",
+        "resource_url": "harbor.example.com/library/my-app:v1.0.0"
+      }
+    ],
+    "repository": {"name": "my-app", "namespace": "library", "repo_full_name": "library/my-app"}
+  }
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pushes))
+	assert.Equal(t, "harbor.example.com/library/my-app", pushes[0].Image)
+	assert.Equal(t, "v1.0.0", pushes[0].Tag)
+}
+
+func Test_parseGithubPackageEvent(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-GitHub-Event", "package")
+	pushes, err := ParseWebhook(header, []byte(`{
+  "action": "published",
+  "package": {
+    "name": "My-App",
+    "namespace": "gimlet-io",
+    "package_type": "CONTAINER",
+    "package_version": {
+      "version": "sha256:3da5a1f04dba0ec5b4e2ba0e9b6b5f3c1c2fba1fdbd0e2bf9b8f3ab2ba0b1c2d",
+      "container_metadata": {"tag": {"name": "ea9ab7cc", "digest": "sha256:3da5a1f04dba0ec5b4e2ba0e9b6b5f3c1c2fba1fdbd0e2bf9b8f3ab2ba0b1c2d"}}
+    }
+  },
+  "repository": {"full_name": "gimlet-io/my-app"}
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pushes))
+	assert.Equal(t, "ghcr.io/gimlet-io/my-app", pushes[0].Image)
+	assert.Equal(t, "ea9ab7cc", pushes[0].Tag)
+	assert.Equal(t, "gimlet-io/my-app", pushes[0].SourceRepository)
+}
+
+func Test_resolve(t *testing.T) {
+	config, err := ParseConfig(`
+rules:
+  - image: registry.example.com/team/*
+    repository: gimlet-io/my-app
+    tag: '^(?P<branch>[a-z-]+)-(?P<sha>[0-9a-f]{7,40})$'
+  - image: registry.example.com/release/*
+    repository: gimlet-io/my-app
+    branch: main
+`)
+	assert.Nil(t, err)
+	noLabels := func() (map[string]string, error) {
+		return nil, fmt.Errorf("no labels")
+	}
+
+	source, err := config.Resolve(&ImagePush{Image: "registry.example.com/team/my-app", Tag: "my-feature-ea9ab7c"}, noLabels, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &Source{Repository: "gimlet-io/my-app", SHA: "ea9ab7c", Branch: "my-feature"}, source)
+
+	_, err = config.Resolve(&ImagePush{Image: "registry.example.com/team/my-app", Tag: "latest"}, noLabels, nil)
+	assert.NotNil(t, err, "tags not matching the rule can't be resolved without labels")
+
+	source, err = config.Resolve(&ImagePush{Image: "registry.example.com/release/my-app", Tag: "v1.0.0"}, func() (map[string]string, error) {
+		return map[string]string{LabelRevision: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"}, nil
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &Source{Repository: "gimlet-io/my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", Branch: "main"}, source)
+
+	otherAppLabels := func() (map[string]string, error) {
+		return map[string]string{
+			LabelRevision: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			LabelSource:   "https://github.com/gimlet-io/other-app",
+		}, nil
+	}
+	source, err = (&Config{}).Resolve(&ImagePush{Image: "ghcr.io/gimlet-io/other-app", Tag: "v1.0.0"}, otherAppLabels, []string{"gimlet-io/other-app"})
+	assert.Nil(t, err)
+	assert.Equal(t, "gimlet-io/other-app", source.Repository)
+
+	_, err = (&Config{}).Resolve(&ImagePush{Image: "ghcr.io/gimlet-io/other-app", Tag: "v1.0.0"}, otherAppLabels, []string{"gimlet-io/my-app"})
+	assert.NotNil(t, err, "labels should only map to trusted repos")
+
+	_, err = (&Config{}).Resolve(&ImagePush{
+		Image:            "ghcr.io/gimlet-io/other-app",
+		Tag:              "v1.0.0",
+		SourceRepository: "gimlet-io/my-app",
+	}, otherAppLabels, nil)
+	assert.NotNil(t, err, "webhook payloads should only map to trusted repos")
+}
+
+func Test_labels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:team/my-app:pull", r.URL.Query().Get("scope"))
+			json.NewEncoder(w).Encode(map[string]string{"token": "abc"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry",scope="repository:team/my-app:pull"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/team/my-app/manifests/v1.0.0":
+			assert.True(t, strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json"))
+			w.Write([]byte(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[
+{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},
+{"digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`))
+		case "/v2/team/my-app/manifests/sha256:amd":
+			w.Write([]byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"sha256:config"}}`))
+		case "/v2/team/my-app/blobs/sha256:config":
+			w.Write([]byte(`{"config":{"Labels":{"org.opencontainers.image.revision":"ea9ab7cc31b2599bf4afcfd639da516ca27a4780"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	labels, err := Labels(host+"/team/my-app", "v1.0.0", []*Registry{{Host: host, Insecure: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", labels[LabelRevision])
+}
+
+func Test_splitImage(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"nginx":                    {"registry-1.docker.io", "library/nginx"},
+		"docker.io/bitnami/redis":  {"registry-1.docker.io", "bitnami/redis"},
+		"ghcr.io/gimlet-io/gimlet": {"ghcr.io", "gimlet-io/gimlet"},
+		"localhost:5000/my-app":    {"localhost:5000", "my-app"},
+	} {
+		host, name := splitImage(image)
+		assert.Equal(t, expected, [2]string{host, name}, image)
+	}
+}
+
+func Test_tags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/vendor/agent/tags/list", r.URL.Path)
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/vendor/agent/tags/list?last=1.1.0&n=2>; rel="next"`)
+			w.Write([]byte(`{"name":"vendor/agent","tags":["1.0.0","1.1.0"]}`))
+			return
+		}
+		w.Write([]byte(`{"name":"vendor/agent","tags":["1.2.0"]}`))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	tags, err := Tags(host+"/vendor/agent", []*Registry{{Host: host, Insecure: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "1.2.0"}, tags)
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config maps pushed images to the git repository and commit they were built from
+type Config struct {
+	Registries []*Registry `yaml:"registries,omitempty" json:"registries,omitempty"`
+	Rules      []*Rule     `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// Rule maps the images matching a pattern to their source.
+// What a rule doesn't tell is read from the org.opencontainers.image.source and revision labels,
+// a repository is only taken from the labels if it is imported
+type Rule struct {
+	// Image is a glob pattern of the image name without the tag, eg.: registry.example.com/team/*
+	Image string `yaml:"image" json:"image"`
+	// Repository is the owner/repo of the source repository
+	Repository string `yaml:"repository,omitempty" json:"repository,omitempty"`
+	// Tag is a regular expression on the image tag, its `sha` and `branch` named groups are used
+	Tag string `yaml:"tag,omitempty" json:"tag,omitempty"`
+	// Branch is the branch of the built commits
+	Branch string `yaml:"branch,omitempty" json:"branch,omitempty"`
+}
+
+// Source is the commit that an image was built from
+type Source struct {
+	Repository string
+	// SHA may be abbreviated if it comes from the image tag
+	SHA    string
+	Branch string
+}
+
+func ParseConfig(config string) (*Config, error) {
+	registryConfig := &Config{}
+	err := yaml.Unmarshal([]byte(config), registryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse registry webhook config: %s", err)
+	}
+	for _, rule := range registryConfig.Rules {
+		if _, err := path.Match(rule.Image, ""); err != nil {
+			return nil, fmt.Errorf("invalid image pattern %s: %s", rule.Image, err)
+		}
+		if _, err := regexp.Compile(rule.Tag); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %s: %s", rule.Tag, err)
+		}
+	}
+	return registryConfig, nil
+}
+
+// Resolve finds the source of a pushed image with the first matching rule, and with the image labels.
+// Anyone who can push an image sets its labels and the webhook payload, so a repository that is not set by a rule
+// must be one of the trusted repos, eg. the imported ones
+func (c *Config) Resolve(push *ImagePush, labels func() (map[string]string, error), trustedRepos []string) (*Source, error) {
+	source := &Source{
+		Repository: push.SourceRepository,
+	}
+	repositoryFromRule := false
+
+	for _, rule := range c.Rules {
+		if matched, _ := path.Match(rule.Image, push.Image); !matched {
+			continue
+		}
+		if rule.Tag != "" {
+			tagPattern := regexp.MustCompile(rule.Tag)
+			matches := tagPattern.FindStringSubmatch(push.Tag)
+			if matches == nil {
+				continue
+			}
+			for i, group := range tagPattern.SubexpNames() {
+				switch group {
+				case "sha":
+					source.SHA = matches[i]
+				case "branch":
+					source.Branch = matches[i]
+				}
+			}
+		}
+		if rule.Repository != "" {
+			source.Repository = rule.Repository
+			repositoryFromRule = true
+		}
+		if rule.Branch != "" {
+			source.Branch = rule.Branch
+		}
+		break
+	}
+
+	if source.Repository == "" || source.SHA == "" {
+		imageLabels, err := labels()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read image labels: %s", err)
+		}
+		if source.SHA == "" {
+			source.SHA = imageLabels[LabelRevision]
+		}
+		if source.Repository == "" {
+			source.Repository = repositoryFromSourceURL(imageLabels[LabelSource])
+		}
+	}
+
+	if source.Repository == "" {
+		return nil, fmt.Errorf("no rule or %s label maps %s to a git repository", LabelSource, push.Image)
+	}
+	if !repositoryFromRule && !trusted(source.Repository, trustedRepos) {
+		return nil, fmt.Errorf("no rule maps %s to %s, and it is not an imported repository", push.Image, source.Repository)
+	}
+	if source.SHA == "" {
+		return nil, fmt.Errorf("no rule or %s label maps %s:%s to a commit", LabelRevision, push.Image, push.Tag)
+	}
+	return source, nil
+}
+
+func trusted(repository string, trustedRepos []string) bool {
+	for _, trustedRepo := range trustedRepos {
+		if strings.EqualFold(trustedRepo, repository) {
+			return true
+		}
+	}
+	return false
+}
+
+// repositoryFromSourceURL makes owner/repo from a source label, like https://github.com/owner/repo
+func repositoryFromSourceURL(sourceURL string) string {
+	sourceURL = strings.TrimSuffix(strings.TrimSuffix(sourceURL, "/"), ".git")
+	parts := strings.Split(sourceURL, "/")
+	if len(parts) < 2 || !strings.Contains(sourceURL, "://") {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Tags lists the tags of an image from the registry's v2 API, following the pages of the list
+func Tags(image string, registries []*Registry) ([]string, error) {
+	host, name := splitImage(image)
+	client := newRegistryClient(host, registries)
+
+	tags := []string{}
+	path := fmt.Sprintf("/v2/%s/tags/list?n=1000", name)
+	for path != "" {
+		tagsJson, header, err := client.getWithHeader(path, "")
+		if err != nil {
+			return nil, err
+		}
+		var tagList struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.Unmarshal(tagsJson, &tagList)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tag list: %s", err)
+		}
+		tags = append(tags, tagList.Tags...)
+
+		path = ""
+		if match := nextLink.FindStringSubmatch(header.Get("Link")); match != nil {
+			next, err := url.Parse(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid next page link: %s", match[1])
+			}
+			path = next.RequestURI()
+		}
+	}
+	return tags, nil
+}
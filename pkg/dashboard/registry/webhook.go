@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ImagePush is an image tag pushed to a container registry
+type ImagePush struct {
+	// Image is the image name with the registry host, without the tag
+	Image  string
+	Tag    string
+	Digest string
+	// SourceRepository is the owner/repo of the git repository, if the registry knows it, like GHCR
+	SourceRepository string
+}
+
+// ParseWebhook parses Docker Registry v2 notifications, Harbor webhooks and GitHub package events.
+// Only tag pushes are returned, other events are ignored
+func ParseWebhook(header http.Header, body []byte) ([]*ImagePush, error) {
+	githubEvent := header.Get("X-GitHub-Event")
+	if githubEvent == "package" || githubEvent == "registry_package" {
+		return parseGithubPackageEvent(body)
+	}
+
+	var probe struct {
+		Events []interface{} `json:"events"`
+		Type   string        `json:"type"`
+	}
+	err := json.Unmarshal(body, &probe)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse webhook: %s", err)
+	}
+
+	if probe.Events != nil {
+		return parseDockerRegistryNotification(body)
+	} else if probe.Type != "" {
+		return parseHarborWebhook(body)
+	}
+	return nil, fmt.Errorf("unknown webhook format")
+}
+
+// https://distribution.github.io/distribution/about/notifications/
+func parseDockerRegistryNotification(body []byte) ([]*ImagePush, error) {
+	var notification struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Repository string `json:"repository"`
+				Digest     string `json:"digest"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+	err := json.Unmarshal(body, &notification)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse registry notification: %s", err)
+	}
+
+	var pushes []*ImagePush
+	for _, event := range notification.Events {
+		if event.Action != "push" || event.Target.Tag == "" { // blob pushes and untagged manifests
+			continue
+		}
+		image := event.Target.Repository
+		if event.Request.Host != "" {
+			image = event.Request.Host + "/" + image
+		}
+		pushes = append(pushes, &ImagePush{
+			Image:  image,
+			Tag:    event.Target.Tag,
+			Digest: event.Target.Digest,
+		})
+	}
+	return pushes, nil
+}
+
+// https://goharbor.io/docs/main/working-with-projects/project-configuration/configure-webhooks/
+func parseHarborWebhook(body []byte) ([]*ImagePush, error) {
+	var webhook struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Digest      string `json:"digest"`
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	err := json.Unmarshal(body, &webhook)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Harbor webhook: %s", err)
+	}
+	if webhook.Type != "PUSH_ARTIFACT" && webhook.Type != "pushImage" {
+		return nil, nil
+	}
+
+	var pushes []*ImagePush
+	for _, resource := range webhook.EventData.Resources {
+		if resource.Tag == "" {
+			continue
+		}
+		pushes = append(pushes, &ImagePush{
+			Image:  strings.TrimSuffix(resource.ResourceURL, ":"+resource.Tag),
+			Tag:    resource.Tag,
+			Digest: resource.Digest,
+		})
+	}
+	return pushes, nil
+}
+
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#package
+func parseGithubPackageEvent(body []byte) ([]*ImagePush, error) {
+	type githubPackage struct {
+		Name           string `json:"name"`
+		Namespace      string `json:"namespace"`
+		PackageType    string `json:"package_type"`
+		PackageVersion struct {
+			Version           string `json:"version"`
+			ContainerMetadata struct {
+				Tag struct {
+					Name   string `json:"name"`
+					Digest string `json:"digest"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+	}
+	var event struct {
+		Action          string         `json:"action"`
+		Package         *githubPackage `json:"package"`
+		RegistryPackage *githubPackage `json:"registry_package"`
+		Repository      struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GitHub package event: %s", err)
+	}
+
+	pkg := event.Package
+	if pkg == nil {
+		pkg = event.RegistryPackage
+	}
+	if event.Action != "published" || pkg == nil || !strings.EqualFold(pkg.PackageType, "container") {
+		return nil, nil
+	}
+	tag := pkg.PackageVersion.ContainerMetadata.Tag
+	if tag.Name == "" {
+		return nil, nil
+	}
+
+	digest := tag.Digest
+	if digest == "" {
+		digest = pkg.PackageVersion.Version
+	}
+	return []*ImagePush{{
+		Image:            strings.ToLower(fmt.Sprintf("ghcr.io/%s/%s", pkg.Namespace, pkg.Name)),
+		Tag:              tag.Name,
+		Digest:           digest,
+		SourceRepository: event.Repository.FullName,
+	}}, nil
+}
@@ -159,6 +159,7 @@ func state(w http.ResponseWriter, r *http.Request) {
 
 	stacks := agentState.Stacks
 	alertStateManager, _ := r.Context().Value("alertStateManager").(*alert.AlertStateManager)
+	db := r.Context().Value("store").(*store.Store)
 	for _, stack := range stacks {
 		if stack.Deployment == nil {
 			continue
@@ -169,6 +170,17 @@ func state(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(500), 500)
 			return
 		}
+
+		mismatchingPods, err := verifyImageDigests(db, stack.Deployment.ArtifactID, stack.Deployment.Pods)
+		if err != nil {
+			logrus.Warnf("cannot verify image digests: %s", err)
+		}
+		for _, pod := range mismatchingPods {
+			err = alertStateManager.TrackImageDigestMismatch(pod, stack.Repo, name)
+			if err != nil {
+				logrus.Errorf("cannot track image digest mismatch: %s", err)
+			}
+		}
 	}
 
 	agentHub, _ := r.Context().Value("agentHub").(*streaming.AgentHub)
@@ -299,6 +311,46 @@ func sendFluxEvents(w http.ResponseWriter, r *http.Request) {
 	clientHub.Broadcast <- jsonString
 }
 
+func terraformPlan(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	var plan api.TerraformPlan
+	err := json.NewDecoder(r.Body).Decode(&plan)
+	if err != nil {
+		logrus.Errorf("cannot decode terraform plan: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+	plan.Env = name
+
+	store := r.Context().Value("store").(*store.Store)
+	saved, err := store.UpdateTerraformPlan(name, plan.Namespace, plan.Name, func(existing *api.TerraformPlan) (*api.TerraformPlan, error) {
+		if existing != nil && existing.PlanID == plan.PlanID {
+			// the plan was already reported, don't reset its review status
+			return nil, nil
+		}
+		return &plan, nil
+	})
+	if err != nil {
+		logrus.Errorf("cannot save terraform plan: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if saved == nil {
+		return
+	}
+
+	clientHub, _ := r.Context().Value("clientHub").(*streaming.ClientHub)
+	jsonString, _ := json.Marshal(streaming.TerraformPlanEvent{
+		StreamingEvent: streaming.StreamingEvent{Event: streaming.TerraformPlanEventString},
+		EnvName:        name,
+		Plan:           &plan,
+	})
+	clientHub.Broadcast <- jsonString
+}
+
 func deploymentDetails(w http.ResponseWriter, r *http.Request) {
 	var deployment api.Deployment
 	err := json.NewDecoder(r.Body).Decode(&deployment)
@@ -358,6 +410,14 @@ func update(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(500), 500)
 			return
 		}
+
+		if update.Event == agent.EventPodUpdated {
+			agentHub, _ := r.Context().Value("agentHub").(*streaming.AgentHub)
+			err = verifyPodImageDigests(agentHub, alertStateManager, db, update)
+			if err != nil {
+				logrus.Warnf("cannot verify image digests: %s", err)
+			}
+		}
 	}
 
 	update = decorateDeploymentUpdateWithCommitMessage(update, r)
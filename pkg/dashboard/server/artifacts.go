@@ -1,12 +1,18 @@
 package server
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -20,24 +26,107 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 
 	var artifact dx.Artifact
 	json.NewDecoder(r.Body).Decode(&artifact)
+	if _, err := base64.StdEncoding.DecodeString(artifact.Signature); err != nil {
+		http.Error(w, fmt.Sprintf("%s - malformed signature", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+	if artifact.IdempotencyKey != "" {
+		existingEvent, err := store.ArtifactByIdempotencyKey(artifact.IdempotencyKey)
+		if err == nil {
+			writeRetriedArtifact(w, existingEvent, &artifact)
+			return
+		} else if err != sql.ErrNoRows {
+			logrus.Errorf("cannot get artifact by idempotency key: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+	}
+
+	attachments, err := validateAttachments(artifact.Attachments)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+	artifact.Attachments = attachments
+
 	artifact.ID = fmt.Sprintf("%s-%s", artifact.Version.RepositoryName, uuid.New().String())
 	artifact.Created = time.Now().Unix()
 
+	err = saveAttachments(store, &artifact)
+	if err != nil {
+		logrus.Errorf("cannot save attachments: %s", err)
+		store.DeleteAttachments(artifact.ID)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
 	event, err := model.ToEvent(artifact)
 	if err != nil {
 		logrus.Errorf("cannot convert to artifact model: %s", err)
+		store.DeleteAttachments(artifact.ID)
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
 
 	savedEvent, err := store.CreateEvent(event)
 	if err != nil {
+		store.DeleteAttachments(artifact.ID)
+		if artifact.IdempotencyKey != "" {
+			// a concurrent push with the same idempotency key saved the artifact first, the key is unique
+			existingEvent, lookupErr := store.ArtifactByIdempotencyKey(artifact.IdempotencyKey)
+			if lookupErr == nil {
+				writeRetriedArtifact(w, existingEvent, &artifact)
+				return
+			}
+		}
 		logrus.Errorf("cannot save artifact: %s", err)
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
 
-	savedArtifact, err := model.ToArtifact(savedEvent)
+	writeArtifact(w, savedEvent, http.StatusCreated)
+}
+
+// writeRetriedArtifact responds to a push with an idempotency key that was already used, with the saved artifact
+func writeRetriedArtifact(w http.ResponseWriter, existingEvent *model.Event, artifact *dx.Artifact) {
+	samePayload, err := sameArtifact(existingEvent, artifact)
+	if err != nil {
+		logrus.Errorf("cannot compare artifacts: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	if !samePayload {
+		http.Error(w, fmt.Sprintf("%s - the idempotency key was used for a different artifact", http.StatusText(http.StatusConflict)), http.StatusConflict)
+		return
+	}
+
+	// a retried push, the artifact is already saved
+	writeArtifact(w, existingEvent, http.StatusOK)
+}
+
+// sameArtifact tells if a pushed artifact is the same as a saved one, apart from the fields that the dashboard sets
+func sameArtifact(event *model.Event, artifact *dx.Artifact) (bool, error) {
+	savedArtifact, err := model.ToArtifact(event)
+	if err != nil {
+		return false, err
+	}
+	sensitiveVars, err := model.ToSensitiveVars(event)
+	if err != nil {
+		return false, err
+	}
+	saved, err := savedArtifact.WithSensitiveVars(sensitiveVars).CanonicalJSON()
+	if err != nil {
+		return false, err
+	}
+	pushed, err := artifact.CanonicalJSON()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(saved, pushed), nil
+}
+
+func writeArtifact(w http.ResponseWriter, event *model.Event, status int) {
+	savedArtifact, err := model.ToArtifact(event)
 	if err != nil {
 		logrus.Errorf("cannot serialize artifact: %s", err)
 		http.Error(w, http.StatusText(500), 500)
@@ -50,10 +139,140 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	w.Write(artifactStr)
 }
 
+// restoreArtifact brings back an artifact from the retention archive, eg. to roll back to it
+func restoreArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	config := ctx.Value("config").(*config.Config)
+
+	artifactID := r.URL.Query().Get("id")
+	if artifactID == "" {
+		http.Error(w, fmt.Sprintf("%s - id is mandatory", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+	if !validArtifactID(artifactID) {
+		http.Error(w, fmt.Sprintf("%s - invalid id", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	existingEvent, err := store.Artifact(artifactID)
+	if err == nil {
+		writeArtifact(w, existingEvent, http.StatusOK)
+		return
+	} else if err != sql.ErrNoRows {
+		logrus.Errorf("cannot get artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	a, err := archive.New(config.Retention.Archive, config.Retention.ArchiveS3Config())
+	if err != nil {
+		logrus.Errorf("cannot open archive: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	if a == nil {
+		http.Error(w, fmt.Sprintf("%s - artifacts are not archived", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	event, err := archive.Restore(a, artifactID)
+	if err == archive.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("cannot restore artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	// so the restored artifact is kept for another retention period
+	event.Restored = time.Now().Unix()
+	err = store.RestoreEvent(event)
+	if err != nil {
+		logrus.Errorf("cannot restore artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	encryptedSensitiveVars, err := archive.RestoreSensitiveVars(a, artifactID)
+	if err == nil {
+		err = store.RestoreEncryptedSensitiveVars(artifactID, encryptedSensitiveVars)
+		if err != nil {
+			logrus.Errorf("cannot restore the sensitive vars of %s: %s", artifactID, err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+	} else if err != archive.ErrNotFound {
+		logrus.Errorf("cannot restore the sensitive vars of %s: %s", artifactID, err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		logrus.Errorf("cannot parse restored artifact: %s", err)
+	}
+	for _, attachment := range artifact.Attachments {
+		content, err := archive.RestoreAttachment(a, artifactID, attachment.Name)
+		if err != nil {
+			logrus.Warnf("cannot restore attachment %s of %s: %s", attachment.Name, artifactID, err)
+			continue
+		}
+		err = store.CreateAttachment(&model.Attachment{
+			ArtifactID: artifactID,
+			Name:       attachment.Name,
+			Type:       attachment.Type,
+			Digest:     attachment.Digest,
+			Content:    content,
+			Created:    event.Restored,
+		})
+		if err != nil {
+			logrus.Warnf("cannot restore attachment %s of %s: %s", attachment.Name, artifactID, err)
+		}
+	}
+
+	imageDigests, err := archive.RestoreImageDigests(a, artifactID)
+	if err != nil && err != archive.ErrNotFound {
+		logrus.Warnf("cannot restore the image digests of %s: %s", artifactID, err)
+	}
+	for _, imageDigest := range imageDigests {
+		err = store.CreateImageDigest(&model.ImageDigest{
+			ArtifactID: artifactID,
+			Image:      imageDigest.Image,
+			Digest:     imageDigest.Digest,
+			Created:    imageDigest.Created,
+		})
+		if err != nil {
+			logrus.Warnf("cannot restore the image digest of %s of %s: %s", imageDigest.Image, artifactID, err)
+		}
+	}
+
+	writeArtifact(w, event, http.StatusOK)
+}
+
+// validArtifactID tells if an id has the owner/repo-uuid form of artifact IDs.
+// The id is part of the archive key, so it must not have other path separators, or relative path elements
+func validArtifactID(artifactID string) bool {
+	if strings.Contains(artifactID, "\\") {
+		return false
+	}
+	segments := strings.Split(artifactID, "/")
+	if len(segments) > 2 {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
 func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	store := ctx.Value("store").(*store.Store)
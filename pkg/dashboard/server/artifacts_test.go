@@ -6,9 +6,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dx"
@@ -60,6 +64,162 @@ func Test_saveArtifact(t *testing.T) {
 	assert.NotEqual(t, response.Created, 0, "should set created time")
 }
 
+func Test_saveArtifactIdempotency(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+
+	artifactStr := `
+{
+  "version": {
+    "repositoryName": "my-app",
+    "sha": "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+    "branch": "master"
+  },
+  "vars": {
+    "GITHUB_RUN_ID": "1234",
+    "API_TOKEN": "secret"
+  },
+  "idempotencyKey": "my-app/1234"
+}
+`
+	withStore := func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, "store", store)
+	}
+
+	code, body, err := testPostEndpoint(saveArtifact, withStore, "/path", artifactStr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code)
+	var saved dx.Artifact
+	json.Unmarshal([]byte(body), &saved)
+	assert.Equal(t, "my-app/1234", saved.IdempotencyKey)
+
+	code, body, err = testPostEndpoint(saveArtifact, withStore, "/path", artifactStr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code, "a retried push should return the existing artifact")
+	var retried dx.Artifact
+	json.Unmarshal([]byte(body), &retried)
+	assert.Equal(t, saved.ID, retried.ID)
+
+	artifacts, _ := store.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	assert.Equal(t, 1, len(artifacts))
+
+	code, _, err = testPostEndpoint(saveArtifact, withStore, "/path", strings.Replace(artifactStr, `"secret"`, `"other-secret"`, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, code, "a different artifact with the same key should be rejected")
+
+	withoutKey := strings.Replace(artifactStr, `,
+  "idempotencyKey": "my-app/1234"`, "", 1)
+	code, _, err = testPostEndpoint(saveArtifact, withStore, "/path", withoutKey)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code)
+	code, _, err = testPostEndpoint(saveArtifact, withStore, "/path", withoutKey)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code, "artifacts without a key should not be deduplicated")
+
+	concurrentPush := strings.Replace(artifactStr, "my-app/1234", "my-app/5678", 1)
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _, _ := testPostEndpoint(saveArtifact, withStore, "/path", concurrentPush)
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		} else {
+			assert.Equal(t, http.StatusOK, code, "concurrent pushes should get the saved artifact")
+		}
+	}
+	assert.Equal(t, 1, created, "concurrent pushes with the same key should save the artifact once")
+	artifacts, _ = store.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	assert.Equal(t, 4, len(artifacts))
+}
+
+func Test_restoreArtifact(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	archiveDir := t.TempDir()
+	a, _ := archive.New(archiveDir, archive.S3Config{})
+	archive.Store(a, &model.Event{
+		ID:         "1234",
+		Type:       model.ArtifactCreatedEvent,
+		Created:    1000,
+		Blob:       `{"id":"my-app-1234"}`,
+		Status:     model.StatusProcessed,
+		ArtifactID: "my-app-1234",
+	})
+	archive.StoreImageDigests(a, "my-app-1234", []*model.ImageDigest{{ArtifactID: "my-app-1234", Image: "nginx:1.25", Digest: "sha256:1111", Created: 1000}})
+
+	withConfig := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "config", &config.Config{Retention: config.Retention{Archive: archiveDir}})
+	}
+
+	code, _, err := testPostEndpoint(restoreArtifact, withConfig, "/path?id=my-app-0000", "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body, err := testPostEndpoint(restoreArtifact, withConfig, "/path?id=my-app-1234", "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	var restored dx.Artifact
+	json.Unmarshal([]byte(body), &restored)
+	assert.Equal(t, "my-app-1234", restored.ID)
+
+	event, err := store.Artifact("my-app-1234")
+	assert.Nil(t, err)
+	assert.Equal(t, model.StatusProcessed, event.Status, "restored artifacts should not be processed again")
+	assert.Equal(t, int64(1000), event.Created, "restored artifacts should keep their creation time")
+
+	expired, _ := store.ExpiredArtifacts(time.Now().Add(-time.Hour).Unix(), 10, 0)
+	assert.Equal(t, 0, len(expired), "restored artifacts should be kept for another retention period")
+
+	imageDigest, err := store.ImageDigest("my-app-1234", "nginx:1.25")
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:1111", imageDigest.Digest, "image digests should be restored with the artifact")
+
+	for _, id := range []string{"../my-app-1234", "gimlet-io/../../my-app-1234", "gimlet-io/my-app/1234", "gimlet-io\\my-app-1234"} {
+		code, _, err = testPostEndpoint(restoreArtifact, withConfig, "/path?id="+url.QueryEscape(id), "")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, code, id)
+	}
+}
+
+func Test_restoreArtifactSensitiveVars(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	archiveDir := t.TempDir()
+	a, _ := archive.New(archiveDir, archive.S3Config{})
+
+	event, _ := model.ToEvent(dx.Artifact{ID: "my-app-1234", Vars: map[string]string{"API_TOKEN": "s3cr3t"}})
+	event, err := store.CreateEvent(event)
+	assert.Nil(t, err)
+	encrypted, _ := store.EncryptedSensitiveVars("my-app-1234")
+	archive.Store(a, event)
+	archive.StoreSensitiveVars(a, "my-app-1234", encrypted)
+	store.DeleteEventByID(event.ID)
+
+	withConfig := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "config", &config.Config{Retention: config.Retention{Archive: archiveDir}})
+	}
+
+	code, body, err := testPostEndpoint(restoreArtifact, withConfig, "/path?id=my-app-1234", "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "s3cr3t")
+
+	restored, err := store.Artifact("my-app-1234")
+	assert.Nil(t, err)
+	sensitiveVars, err := model.ToSensitiveVars(restored)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", sensitiveVars.Vars["API_TOKEN"], "sensitive vars should be restored with the artifact")
+}
+
 func Test_getArtifacts(t *testing.T) {
 	store := store.NewTest(encryptionKey, encryptionKeyNew)
 	setupArtifacts(store)
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/sirupsen/logrus"
+)
+
+// validateAttachments rebuilds the pushed attachments from their content, so the type, format and summary
+// shown on the dashboard are derived on the server and not taken from the pushed artifact
+func validateAttachments(attachments []*dx.Attachment) ([]*dx.Attachment, error) {
+	names := map[string]bool{}
+	var rebuilt []*dx.Attachment
+	for _, attachment := range attachments {
+		if attachment.Name == "" {
+			return nil, fmt.Errorf("attachment name is mandatory")
+		}
+		if names[attachment.Name] {
+			return nil, fmt.Errorf("attachment %s is attached twice", attachment.Name)
+		}
+		names[attachment.Name] = true
+
+		err := attachment.VerifyContent()
+		if err != nil {
+			return nil, err
+		}
+		serverSide, err := dx.NewAttachment(attachment.Type, attachment.Name, attachment.Content)
+		if err != nil {
+			return nil, err
+		}
+		rebuilt = append(rebuilt, serverSide)
+	}
+	return rebuilt, nil
+}
+
+// saveAttachments stores the attachment contents apart from the artifact, and leaves only their digest and summary on it
+func saveAttachments(store *store.Store, artifact *dx.Artifact) error {
+	for _, attachment := range artifact.Attachments {
+		err := store.CreateAttachment(&model.Attachment{
+			ArtifactID: artifact.ID,
+			Name:       attachment.Name,
+			Type:       attachment.Type,
+			Digest:     attachment.Digest,
+			Content:    attachment.Content,
+			Created:    time.Now().Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		attachment.Content = nil
+	}
+	return nil
+}
+
+// getAttachment downloads an attachment of an artifact
+func getAttachment(w http.ResponseWriter, r *http.Request) {
+	artifactID := r.URL.Query().Get("artifactId")
+	name := r.URL.Query().Get("name")
+	if artifactID == "" || name == "" {
+		http.Error(w, fmt.Sprintf("%s - artifactId and name are mandatory", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	store := r.Context().Value("store").(*store.Store)
+	attachment, err := store.Attachment(artifactID, name)
+	if err == sql.ErrNoRows {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("cannot get attachment: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/plain"
+	trimmed := strings.TrimSpace(string(attachment.Content))
+	if strings.HasPrefix(trimmed, "{") {
+		contentType = "application/json"
+	} else if strings.HasPrefix(trimmed, "<") {
+		contentType = "application/xml"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Name))
+	w.Header().Set("Digest", attachment.Digest)
+	w.WriteHeader(http.StatusOK)
+	w.Write(attachment.Content)
+}
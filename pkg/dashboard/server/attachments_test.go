@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_saveArtifactWithAttachments(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	withStore := func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, "store", store)
+	}
+
+	coverage, _ := dx.NewAttachment(dx.AttachmentCoverage, "cover.out", []byte("mode: set\nmain.go:1.1,2.2 1 1\n"))
+	artifact := dx.Artifact{
+		Version:     dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Attachments: []*dx.Attachment{coverage},
+	}
+	artifactJson, _ := json.Marshal(artifact)
+
+	code, body, err := testPostEndpoint(saveArtifact, withStore, "/path", string(artifactJson))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code)
+	var saved dx.Artifact
+	json.Unmarshal([]byte(body), &saved)
+	assert.Equal(t, 1, len(saved.Attachments))
+	assert.Nil(t, saved.Attachments[0].Content, "attachment contents are stored apart")
+	assert.Equal(t, 100.0, saved.Attachments[0].Summary.Coverage)
+
+	code, body, err = testEndpoint(getAttachment, withStore,
+		"/path?artifactId="+url.QueryEscape(saved.ID)+"&name=cover.out")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "mode: set\nmain.go:1.1,2.2 1 1\n", body)
+
+	code, _, _ = testEndpoint(getAttachment, withStore, "/path?artifactId="+url.QueryEscape(saved.ID)+"&name=junit.xml")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	coverage.Content = []byte("tampered")
+	artifactJson, _ = json.Marshal(artifact)
+	code, _, _ = testPostEndpoint(saveArtifact, withStore, "/path", string(artifactJson))
+	assert.Equal(t, http.StatusBadRequest, code, "the content must match the digest")
+}
+
+func Test_saveArtifactWithForgedAttachmentSummary(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	withStore := func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, "store", store)
+	}
+
+	testReport, _ := dx.NewAttachment(dx.AttachmentTestReport, "junit.xml", []byte(`<testsuite tests="2" failures="1"><testcase name="a"/><testcase name="b"><failure/></testcase></testsuite>`))
+	testReport.Summary = &dx.AttachmentSummary{Tests: 2}
+	testReport.Format = "forged"
+	artifact := dx.Artifact{
+		Version:     dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Attachments: []*dx.Attachment{testReport},
+	}
+	artifactJson, _ := json.Marshal(artifact)
+
+	code, body, err := testPostEndpoint(saveArtifact, withStore, "/path", string(artifactJson))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code)
+	var saved dx.Artifact
+	json.Unmarshal([]byte(body), &saved)
+	assert.Equal(t, 1, saved.Attachments[0].Summary.Failures, "the summary should be derived from the content")
+	assert.Equal(t, "junit", saved.Attachments[0].Format)
+
+	testReport.Type = "malware-scan"
+	artifactJson, _ = json.Marshal(artifact)
+	code, _, _ = testPostEndpoint(saveArtifact, withStore, "/path", string(artifactJson))
+	assert.Equal(t, http.StatusBadRequest, code, "unknown attachment types should be rejected")
+}
@@ -340,6 +340,15 @@ func AsCommitEvent(event *model.Event) *api.CommitEvent {
 		rollbackRequest = &r
 	}
 
+	var attachments []*dx.Attachment
+	if event.Type == model.ArtifactCreatedEvent {
+		artifact, err := model.ToArtifact(event)
+		if err != nil {
+			logrus.Warnf("could not unmarshal blob for: %s - %s", event.ID, err)
+		}
+		attachments = artifact.Attachments
+	}
+
 	results := []api.CommitEventResult{}
 	for _, r := range event.Results {
 		var app string
@@ -375,6 +384,8 @@ func AsCommitEvent(event *model.Event) *api.CommitEvent {
 		Status:            event.Status,
 		StatusDesc:        event.StatusDesc,
 		Results:           results,
+		ArtifactID:        event.ArtifactID,
+		Attachments:       attachments,
 	}
 }
 
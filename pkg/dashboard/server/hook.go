@@ -13,6 +13,7 @@ import (
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/customScm"
 	"github.com/gimlet-io/gimlet/pkg/git/genericScm"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
@@ -109,6 +110,9 @@ func hook(writer http.ResponseWriter, r *http.Request) {
 		processStatusHook(owner, name, w.SHA, gitRepoCache, gitService, token, dao, clientHub)
 	case *scm.BranchHook:
 		processBranchHook(webhook, gitRepoCache)
+	case *scm.PullRequestHook:
+		dao := ctx.Value("store").(*store.Store)
+		processPullRequestHook(webhook, dao)
 	}
 
 	writer.WriteHeader(http.StatusOK)
@@ -190,6 +194,68 @@ func processBranchHook(webhook scm.Webhook, repoCache *nativeGit.RepoCache) {
 	repoCache.Invalidate(scm.Join(owner, name))
 }
 
+// processPullRequestHook creates cleanup events for closed and merged pull requests.
+// The manifests are taken from the latest artifact of the pull request's source branch
+func processPullRequestHook(webhook scm.Webhook, dao *store.Store) {
+	w := webhook.(*scm.PullRequestHook)
+	if w.Action != scm.ActionClose && w.Action != scm.ActionMerge {
+		return
+	}
+
+	repoName := scm.Join(webhook.Repository().Namespace, webhook.Repository().Name)
+	branch := w.PullRequest.Source
+
+	eventType := model.PRClosedEvent
+	if w.Action == scm.ActionMerge || w.PullRequest.Merged {
+		eventType = model.PRMergedEvent
+	}
+
+	artifactEvents, err := dao.Artifacts(repoName, branch, nil, "", nil, 1, 0, nil, nil)
+	if err != nil {
+		logrus.Errorf("could not load artifacts for %s: %s", branch, err)
+		return
+	}
+	if len(artifactEvents) == 0 {
+		return
+	}
+	artifact, err := model.ToArtifact(artifactEvents[0])
+	if err != nil {
+		logrus.Errorf("could not parse artifact: %s", err)
+		return
+	}
+	if !artifact.HasCleanupPolicy() && !hasPreview(artifact.Environments) {
+		return
+	}
+
+	cleanupEventStr, err := json.Marshal(dx.BranchDeletedEvent{
+		Repo:      repoName,
+		Branch:    branch,
+		Manifests: artifact.Environments,
+	})
+	if err != nil {
+		logrus.Errorf("could not serialize %s event: %s", eventType, err)
+		return
+	}
+
+	_, err = dao.CreateEvent(&model.Event{
+		Type:       eventType,
+		Blob:       string(cleanupEventStr),
+		Repository: repoName,
+	})
+	if err != nil {
+		logrus.Errorf("could not store %s event: %s", eventType, err)
+	}
+}
+
+func hasPreview(manifests []*dx.Manifest) bool {
+	for _, m := range manifests {
+		if m.Preview != nil && *m.Preview {
+			return true
+		}
+	}
+	return false
+}
+
 type checkRunHook struct {
 	CheckRun struct {
 		HeadSHA string `json:"head_sha"`
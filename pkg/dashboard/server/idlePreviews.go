@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
+	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/git/customScm"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+func getIdlePreviews(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+
+	store := r.Context().Value("store").(*store.Store)
+	previews, err := store.IdlePreviews(env)
+	if err != nil {
+		logrus.Errorf("cannot get idle previews: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	previewsString, err := json.Marshal(previews)
+	if err != nil {
+		logrus.Errorf("cannot serialize idle previews: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(previewsString)
+}
+
+// wakeUpPreview asks the agent to scale a sleeping preview back up. The agent reports back once it is awake
+func wakeUpPreview(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	agentHub, _ := r.Context().Value("agentHub").(*streaming.AgentHub)
+	agentHub.WakeUpPreview(env, namespace, name)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+// idlePreview records that a preview deployment went to sleep or woke up, and updates the pull request comment
+func idlePreview(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	var preview api.IdlePreview
+	err := json.NewDecoder(r.Body).Decode(&preview)
+	if err != nil {
+		logrus.Errorf("cannot decode idle preview: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+	preview.Env = name
+
+	store := r.Context().Value("store").(*store.Store)
+	err = store.SaveIdlePreview(&preview)
+	if err != nil {
+		logrus.Errorf("cannot save idle preview: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	clientHub, _ := r.Context().Value("clientHub").(*streaming.ClientHub)
+	jsonString, _ := json.Marshal(streaming.IdlePreviewEvent{
+		StreamingEvent: streaming.StreamingEvent{Event: streaming.IdlePreviewEventString},
+		EnvName:        name,
+		Preview:        &preview,
+	})
+	clientHub.Broadcast <- jsonString
+
+	if preview.Repo == "" || preview.Branch == "" {
+		return
+	}
+	config := r.Context().Value("config").(*config.Config)
+	dynamicConfig := r.Context().Value("dynamicConfig").(*dynamicconfig.DynamicConfig)
+	tokenManager := r.Context().Value("tokenManager").(customScm.NonImpersonatedTokenManager)
+	token, _, _ := tokenManager.Token()
+	go func() {
+		err := customScm.CommentOnPR(dynamicConfig, token, preview.Repo, preview.Branch, idlePreviewComment(preview, config.Host))
+		if err != nil {
+			logrus.Warnf("could not update comment %v", err)
+		}
+	}()
+}
+
+func idlePreviewComment(preview api.IdlePreview, dashboardHost string) string {
+	if preview.Sleeping {
+		wakeUpLink := fmt.Sprintf("%s/repo/%s/previews", dashboardHost, preview.Repo)
+		return fmt.Sprintf(customScm.BodySleeping, preview.Name, preview.SHA, wakeUpLink, wakeUpLink)
+	}
+	return fmt.Sprintf(customScm.BodyReady, preview.Name, preview.SHA, preview.Host, preview.Host)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/alert"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+)
+
+// verifyImageDigests compares the image digests that the pods of a deployment run with the released artifact's.
+// The artifact is the one in the gimlet.io/artifact-id annotation of the deployment, as a SHA may have many artifacts.
+// Images that the artifact doesn't pin a digest for are trusted on first sight: the first running digest is recorded.
+// Mismatching images get the released digest set, and the pods with mismatches are returned
+func verifyImageDigests(dao *store.Store, artifactID string, pods []*api.Pod) ([]*api.Pod, error) {
+	if artifactID == "" { // not released from an artifact
+		return nil, nil
+	}
+
+	event, err := dao.Artifact(artifactID)
+	if err == sql.ErrNoRows { // expired
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatchingPods := []*api.Pod{}
+	for _, pod := range pods {
+		mismatch := false
+		for _, image := range pod.Images {
+			image.ReleasedDigest = ""
+			if image.Digest == "" { // not pulled yet
+				continue
+			}
+
+			releasedDigest, err := releasedImageDigest(dao, artifact, image)
+			if err != nil {
+				return nil, err
+			}
+			if releasedDigest != image.Digest {
+				image.ReleasedDigest = releasedDigest
+				mismatch = true
+			}
+		}
+		if mismatch {
+			mismatchingPods = append(mismatchingPods, pod)
+		}
+	}
+	return mismatchingPods, nil
+}
+
+// releasedImageDigest is the digest that the artifact pinned for the image, or the one that was first seen running
+func releasedImageDigest(dao *store.Store, artifact *dx.Artifact, image *api.ContainerImage) (string, error) {
+	if pinned := artifact.Image(image.Image); pinned != nil && pinned.Digest != "" {
+		return pinned.Digest, nil
+	}
+
+	normalizedImage := dx.NormalizeImage(image.Image)
+	firstSeen, err := dao.ImageDigest(artifact.ID, normalizedImage)
+	if err == nil {
+		return firstSeen.Digest, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	err = dao.CreateImageDigest(&model.ImageDigest{
+		ArtifactID: artifact.ID,
+		Image:      normalizedImage,
+		Digest:     image.Digest,
+		Created:    time.Now().Unix(),
+	})
+	if err != nil { // another pod got recorded first
+		firstSeen, err = dao.ImageDigest(artifact.ID, normalizedImage)
+		if err != nil {
+			return "", err
+		}
+		return firstSeen.Digest, nil
+	}
+	return image.Digest, nil
+}
+
+// verifyPodImageDigests verifies the images of an updated pod against the released artifact of the deployment
+func verifyPodImageDigests(
+	agentHub *streaming.AgentHub,
+	alertStateManager *alert.AlertStateManager,
+	dao *store.Store,
+	update api.StackUpdate,
+) error {
+	if agentHub == nil || agentHub.Agents[update.Env] == nil {
+		return nil
+	}
+
+	for _, stack := range agentHub.Agents[update.Env].Stacks {
+		if stack.Deployment == nil || stack.Deployment.FQN() != update.Deployment {
+			continue
+		}
+
+		namespace, name, _ := strings.Cut(update.Subject, "/")
+		pod := &api.Pod{
+			Name:           name,
+			Namespace:      namespace,
+			DeploymentName: stack.Deployment.Name,
+			Status:         update.Status,
+			ImChannelId:    update.ImChannelId,
+			Images:         update.Images,
+		}
+		mismatchingPods, err := verifyImageDigests(dao, stack.Deployment.ArtifactID, []*api.Pod{pod})
+		if err != nil {
+			return err
+		}
+		for _, pod := range mismatchingPods {
+			err = alertStateManager.TrackImageDigestMismatch(pod, stack.Repo, update.Env)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_verifyImageDigests(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		store.Close()
+	}()
+
+	artifact := dx.Artifact{
+		ID:      "my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d",
+		Version: dx.Version{RepositoryName: "gimlet-io/my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Images:  []*dx.ArtifactImage{{Name: "ghcr.io/gimlet-io/my-app:ea9ab7c", Digest: "sha256:1111"}},
+	}
+	event, _ := model.ToEvent(artifact)
+	_, err := store.CreateEvent(event)
+	assert.Nil(t, err)
+
+	pods := []*api.Pod{
+		{Name: "my-app-1", Images: []*api.ContainerImage{
+			{Container: "my-app", Image: "ghcr.io/gimlet-io/my-app:ea9ab7c", Digest: "sha256:1111"},
+			{Container: "proxy", Image: "envoyproxy/envoy:v1.29", Digest: "sha256:aaaa"},
+		}},
+		{Name: "my-app-2", Images: []*api.ContainerImage{
+			{Container: "my-app", Image: "ghcr.io/gimlet-io/my-app:ea9ab7c", Digest: "sha256:2222"},
+			{Container: "proxy", Image: "docker.io/envoyproxy/envoy:v1.29", Digest: "sha256:bbbb"},
+		}},
+		{Name: "my-app-3", Images: []*api.ContainerImage{
+			{Container: "my-app", Image: "ghcr.io/gimlet-io/my-app:ea9ab7c"},
+		}},
+	}
+
+	// a later artifact of the same SHA, eg. from a re-run build
+	newerArtifact := artifact
+	newerArtifact.ID = "my-app-5d1c9d1e-8a67-4a8e-a8c3-6f0a8d1b2c3d"
+	newerArtifact.Images = []*dx.ArtifactImage{{Name: "ghcr.io/gimlet-io/my-app:ea9ab7c", Digest: "sha256:2222"}}
+	event, _ = model.ToEvent(newerArtifact)
+	event.Created = 1
+	_, err = store.CreateEvent(event)
+	assert.Nil(t, err)
+
+	mismatchingPods, err := verifyImageDigests(store, artifact.ID, pods)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mismatchingPods))
+	assert.Equal(t, "my-app-2", mismatchingPods[0].Name)
+	assert.Equal(t, "", pods[0].Images[0].ReleasedDigest)
+	assert.Equal(t, "", pods[0].Images[1].ReleasedDigest, "the first seen digest is trusted")
+	assert.Equal(t, "sha256:1111", pods[1].Images[0].ReleasedDigest, "the tag was re-pushed")
+	assert.Equal(t, "sha256:aaaa", pods[1].Images[1].ReleasedDigest)
+	assert.Equal(t, "", pods[2].Images[0].ReleasedDigest, "the image is not pulled yet")
+
+	mismatchingPods, err = verifyImageDigests(store, "", pods)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mismatchingPods), "not released from an artifact")
+
+	mismatchingPods, err = verifyImageDigests(store, "my-app-expired", pods)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mismatchingPods), "expired artifacts are not verified")
+}
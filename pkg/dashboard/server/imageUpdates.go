@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// getImageUpdates returns the image tag updates that the image updater made in the env configs of a repo
+func getImageUpdates(w http.ResponseWriter, r *http.Request) {
+	owner := chi.URLParam(r, "owner")
+	name := chi.URLParam(r, "name")
+	repoName := fmt.Sprintf("%s/%s", owner, name)
+
+	store := r.Context().Value("store").(*store.Store)
+	imageUpdates, err := store.ImageUpdates(repoName)
+	if err != nil {
+		logrus.Errorf("cannot get image updates: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	imageUpdatesString, err := json.Marshal(imageUpdates)
+	if err != nil {
+		logrus.Errorf("cannot serialize image updates: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(imageUpdatesString)
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/gitops"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/registry"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/sirupsen/logrus"
+)
+
+// registryHook creates artifacts from container registry push webhooks,
+// for repos that are built by systems that can't push artifacts to Gimlet
+func registryHook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	config := ctx.Value("config").(*config.Config)
+	if config.RegistryWebhookSecret == "" {
+		http.Error(w, fmt.Sprintf("%s - registry webhooks are not enabled", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10000000))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !registryWebhookAuthorized(r.Header, body, config.RegistryWebhookSecret) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	registryConfig := &registry.Config{}
+	if config.RegistryWebhookConfig != "" {
+		registryConfigYaml, err := os.ReadFile(config.RegistryWebhookConfig)
+		if err != nil {
+			logrus.Errorf("cannot read registry webhook config: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		registryConfig, err = registry.ParseConfig(string(registryConfigYaml))
+		if err != nil {
+			logrus.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pushes, err := registry.ParseWebhook(r.Header, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+
+	if len(pushes) > 0 {
+		store := ctx.Value("store").(*store.Store)
+		gitRepoCache := ctx.Value("gitRepoCache").(*nativeGit.RepoCache)
+		go func() {
+			for _, push := range pushes {
+				err := artifactFromImagePush(store, gitRepoCache, registryConfig, push)
+				if err != nil {
+					logrus.Warnf("cannot create artifact for %s:%s: %s", push.Image, push.Tag, err)
+				}
+			}
+		}()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// registryWebhookAuthorized accepts the secret in the Authorization header, as a bearer token or as is,
+// or a GitHub webhook signature made with the secret
+func registryWebhookAuthorized(header http.Header, body []byte, secret string) bool {
+	if signature := header.Get("X-Hub-Signature-256"); signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+
+	token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// artifactFromImagePush makes an artifact with the .gimlet manifests of the commit that the image was built from.
+// It goes through the deploy policies like any other artifact
+func artifactFromImagePush(
+	store *store.Store,
+	gitRepoCache *nativeGit.RepoCache,
+	registryConfig *registry.Config,
+	push *registry.ImagePush,
+) error {
+	idempotencyKey := fmt.Sprintf("registry/%s:%s@%s", push.Image, push.Tag, push.Digest)
+	if _, err := store.ArtifactByIdempotencyKey(idempotencyKey); err == nil {
+		return nil // redelivered webhook
+	}
+
+	importedRepos, err := getImportedRepos(store)
+	if err != nil {
+		return fmt.Errorf("cannot get imported repos: %s", err)
+	}
+	source, err := registryConfig.Resolve(push, func() (map[string]string, error) {
+		reference := push.Digest
+		if reference == "" {
+			reference = push.Tag
+		}
+		return registry.Labels(push.Image, reference, registryConfig.Registries)
+	}, importedRepos)
+	if err != nil {
+		return err
+	}
+
+	return gitRepoCache.PerformAction(source.Repository, func(repo *git.Repository) error {
+		hash, branch, err := findCommit(repo, source.SHA, source.Branch)
+		if err != nil {
+			return err
+		}
+
+		manifests, err := gitops.Manifests(repo, hash)
+		if err != nil {
+			return err
+		}
+		if len(manifests) == 0 {
+			return fmt.Errorf("%s has no .gimlet manifests at %s", source.Repository, hash)
+		}
+
+		artifact, err := gitops.FakeArtifact(repo, source.Repository, hash, branch, manifests)
+		if err != nil {
+			return err
+		}
+		artifact.Vars["IMAGE"] = push.Image
+		artifact.Vars["TAG"] = push.Tag
+		artifact.Vars["DIGEST"] = push.Digest
+		if push.Digest != "" {
+			artifact.Images = []*dx.ArtifactImage{{Name: push.Image + ":" + push.Tag, Digest: push.Digest}}
+		}
+		artifact.IdempotencyKey = idempotencyKey
+
+		event, err := model.ToEvent(*artifact)
+		if err != nil {
+			return err
+		}
+		_, err = store.CreateEvent(event)
+		if err != nil {
+			return err
+		}
+
+		// the image push made the artifact of the commit, the artifacts worker should not make another one
+		return store.SaveKeyValue(&model.KeyValue{
+			Key: fmt.Sprintf("%s-%s", model.CommitArtifactsGenerated, hash),
+		})
+	})
+}
+
+// findCommit resolves a possibly abbreviated SHA on the branch, or on the branch that has it closest to its head, head branch first
+func findCommit(repo *git.Repository, sha string, branch string) (string, string, error) {
+	branches := []string{branch}
+	if branch == "" {
+		headBranch, _ := nativeGit.HeadBranch(repo)
+		branches = append([]string{headBranch}, nativeGit.BranchList(repo)...)
+	}
+
+	// the branch that has the commit closest to its head, as that is most likely where it was pushed to
+	found, foundOn, distance := "", "", -1
+	for _, b := range branches {
+		head := nativeGit.BranchHeadHash(repo, b)
+		if head.IsZero() {
+			continue
+		}
+		commits, err := repo.Log(&git.LogOptions{From: head})
+		if err != nil {
+			continue
+		}
+
+		i := 0
+		commits.ForEach(func(c *object.Commit) error {
+			if distance != -1 && i >= distance {
+				return storer.ErrStop
+			}
+			if strings.HasPrefix(c.Hash.String(), sha) {
+				found, foundOn, distance = c.Hash.String(), b, i
+				return storer.ErrStop
+			}
+			i++
+			return nil
+		})
+	}
+
+	if found == "" {
+		return "", "", fmt.Errorf("cannot find commit %s", sha)
+	}
+	return found, foundOn, nil
+}
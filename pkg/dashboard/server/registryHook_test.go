@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimlet/cmd/dashboard/config"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_registryHook(t *testing.T) {
+	withConfig := func(secret string) contextFunc {
+		return func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, "config", &config.Config{RegistryWebhookSecret: secret})
+		}
+	}
+
+	code, _, _ := testPostEndpoint(registryHook, withConfig(""), "/registry-hook", `{"events":[]}`)
+	assert.Equal(t, http.StatusNotFound, code, "registry webhooks are disabled without a secret")
+
+	code, _, _ = testPostEndpoint(registryHook, withConfig("s3cr3t"), "/registry-hook", `{"events":[]}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func Test_registryWebhookAuthorized(t *testing.T) {
+	body := []byte(`{"action":"published"}`)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer s3cr3t")
+	assert.True(t, registryWebhookAuthorized(header, body, "s3cr3t"))
+	header.Set("Authorization", "s3cr3t")
+	assert.True(t, registryWebhookAuthorized(header, body, "s3cr3t"), "Harbor sends the auth header as is")
+	header.Set("Authorization", "Bearer nope")
+	assert.False(t, registryWebhookAuthorized(header, body, "s3cr3t"))
+
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(body)
+	header = http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	assert.True(t, registryWebhookAuthorized(header, body, "s3cr3t"))
+	assert.False(t, registryWebhookAuthorized(header, []byte(`{}`), "s3cr3t"))
+}
+
+func Test_findCommit(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	worktree, _ := repo.Worktree()
+	commit := func(message string) plumbing.Hash {
+		hash, err := worktree.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{Name: "Jane Doe", Email: "jane@doe.org", When: time.Now()},
+		})
+		assert.Nil(t, err)
+		return hash
+	}
+
+	first := commit("first")
+	repo.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/main", first))
+	second := commit("second")
+	repo.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/my-feature", second))
+
+	hash, branch, err := findCommit(repo, first.String()[:7], "")
+	assert.Nil(t, err)
+	assert.Equal(t, first.String(), hash)
+	assert.Equal(t, "main", branch)
+
+	hash, branch, err = findCommit(repo, second.String(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, second.String(), hash)
+	assert.Equal(t, "my-feature", branch)
+
+	_, _, err = findCommit(repo, second.String(), "main")
+	assert.NotNil(t, err, "the commit is not on main")
+}
@@ -142,6 +142,12 @@ func getReleases(w http.ResponseWriter, r *http.Request) {
 		r.GitopsCommitCreated = gitopsCommitCreated
 	}
 
+	rollouts, err := store.Rollouts(env)
+	if err != nil {
+		logrus.Warnf("cannot get rollouts: %s", err)
+	}
+	setRolloutStatus(releases, rollouts)
+
 	releasesStr, err := json.Marshal(releases)
 	if err != nil {
 		logrus.Errorf("cannot serialize artifacts: %s", err)
@@ -627,6 +633,7 @@ func dxResults(store *store.Store, event *model.Event) []dx.Result {
 			GitopsCommitStatus:     gitopsCommitStatus,
 			GitopsCommitStatusDesc: gitopsCommitStatusDesc,
 			StatusDesc:             result.StatusDesc,
+			PolicyViolations:       result.PolicyViolations,
 		})
 	}
 	return results
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/notifications"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+func getRollouts(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+
+	store := r.Context().Value("store").(*store.Store)
+	rollouts, err := store.Rollouts(env)
+	if err != nil {
+		logrus.Errorf("cannot get rollouts: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rolloutsString, err := json.Marshal(rollouts)
+	if err != nil {
+		logrus.Errorf("cannot serialize rollouts: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(rolloutsString)
+}
+
+// rollout records the progress of a Flagger rollout, and notifies when it starts, gets promoted or aborted
+func rollout(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	var rollout api.Rollout
+	err := json.NewDecoder(r.Body).Decode(&rollout)
+	if err != nil {
+		logrus.Errorf("cannot decode rollout: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+	rollout.Env = name
+
+	store := r.Context().Value("store").(*store.Store)
+	var notify bool
+	saved, err := store.UpdateRollout(name, rollout.Namespace, rollout.Name, func(existing *api.Rollout) (*api.Rollout, error) {
+		var record bool
+		record, notify = rolloutTransition(existing, &rollout)
+		if !record {
+			return nil, nil
+		}
+		return &rollout, nil
+	})
+	if err != nil {
+		logrus.Errorf("cannot save rollout: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	if saved == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	clientHub, _ := r.Context().Value("clientHub").(*streaming.ClientHub)
+	jsonString, _ := json.Marshal(streaming.RolloutEvent{
+		StreamingEvent: streaming.StreamingEvent{Event: streaming.RolloutEventString},
+		EnvName:        name,
+		Rollout:        &rollout,
+	})
+	clientHub.Broadcast <- jsonString
+
+	if notify {
+		notificationsManager := r.Context().Value("notificationsManager").(notifications.Manager)
+		notificationsManager.Broadcast(notifications.MessageFromRollout(rollout))
+	}
+}
+
+// rolloutTransition tells if a rollout update should be recorded, and if it should be notified about.
+// Flagger keeps reporting the phase of the previous rollout until it starts the analysis of a new sha,
+// so Succeeded and Failed are only trusted for a sha that was seen in progress before
+func rolloutTransition(existing *api.Rollout, rollout *api.Rollout) (bool, bool) {
+	finished := rollout.Phase == api.RolloutSucceeded || rollout.Phase == api.RolloutFailed
+	if finished && (existing == nil || existing.SHA != rollout.SHA) {
+		return false, false
+	}
+
+	phaseChanged := existing == nil || existing.Phase != rollout.Phase || existing.SHA != rollout.SHA
+	switch rollout.Phase {
+	case api.RolloutProgressing, api.RolloutSucceeded, api.RolloutFailed:
+		return true, phaseChanged
+	}
+	return true, false
+}
+
+// setRolloutStatus marks the releases that were rolled out progressively as promoted or aborted
+func setRolloutStatus(releases []*dx.Release, rollouts []*api.Rollout) {
+	for _, release := range releases {
+		if release.Version == nil {
+			continue
+		}
+		for _, rollout := range rollouts {
+			if rollout.App == release.App && rollout.SHA == release.Version.SHA {
+				release.RolloutStatus = rollout.Phase
+				release.RolloutStatusDesc = rollout.Message
+			}
+		}
+	}
+}
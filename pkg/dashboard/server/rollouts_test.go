@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_setRolloutStatus(t *testing.T) {
+	releases := []*dx.Release{
+		{App: "my-app", Version: &dx.Version{SHA: "abc123"}},
+		{App: "my-app", Version: &dx.Version{SHA: "def456"}},
+		{App: "other-app", Version: &dx.Version{SHA: "abc123"}},
+		{App: "my-app"},
+	}
+	rollouts := []*api.Rollout{
+		{App: "my-app", SHA: "abc123", Phase: api.RolloutFailed, Message: "Canary analysis failed, Deployment scaled to zero."},
+	}
+
+	setRolloutStatus(releases, rollouts)
+	assert.Equal(t, api.RolloutFailed, releases[0].RolloutStatus)
+	assert.Equal(t, "Canary analysis failed, Deployment scaled to zero.", releases[0].RolloutStatusDesc)
+	assert.Empty(t, releases[1].RolloutStatus)
+	assert.Empty(t, releases[2].RolloutStatus)
+	assert.Empty(t, releases[3].RolloutStatus)
+}
+
+func Test_rolloutTransition(t *testing.T) {
+	promoted := &api.Rollout{SHA: "abc123", Phase: api.RolloutSucceeded}
+
+	record, notify := rolloutTransition(promoted, &api.Rollout{SHA: "def456", Phase: api.RolloutSucceeded})
+	assert.False(t, record, "the phase of the previous rollout should not be recorded for a new sha")
+	assert.False(t, notify)
+
+	record, _ = rolloutTransition(nil, &api.Rollout{SHA: "def456", Phase: api.RolloutFailed})
+	assert.False(t, record, "finished rollouts that were not seen in progress should be ignored")
+
+	progressing := &api.Rollout{SHA: "def456", Phase: api.RolloutProgressing}
+	record, notify = rolloutTransition(promoted, progressing)
+	assert.True(t, record)
+	assert.True(t, notify, "a started rollout should be notified")
+
+	record, notify = rolloutTransition(progressing, &api.Rollout{SHA: "def456", Phase: api.RolloutProgressing, CanaryWeight: 20})
+	assert.True(t, record)
+	assert.False(t, notify, "analysis steps should not be notified")
+
+	record, notify = rolloutTransition(&api.Rollout{SHA: "def456", Phase: "Promoting"}, &api.Rollout{SHA: "def456", Phase: api.RolloutSucceeded})
+	assert.True(t, record)
+	assert.True(t, notify, "a promotion should be notified")
+}
@@ -93,6 +93,7 @@ func SetupRouter(
 	r.Handle("/builtin/apps*", gitServer)
 
 	r.Post("/hook", hook)
+	r.Post("/registry-hook", registryHook)
 
 	r.Get("/flags", getFlags)
 
@@ -118,10 +119,12 @@ func gimletdRoutes(r *chi.Mux) {
 		r.Use(session.MustUser())
 		r.Post("/api/artifact", saveArtifact)
 		r.Get("/api/artifacts", getArtifacts)
+		r.Get("/api/artifacts/attachment", getAttachment)
 		r.Get("/api/releases", getReleases)
 		r.Get("/api/status", getStatus)
 		r.Post("/api/releases", release)
 		r.Post("/api/rollback", performRollback)
+		r.Post("/api/env/{env}/sealValues", sealValues)
 		r.Post("/api/delete", delete)
 		r.Get("/api/eventReleaseTrack", getEventReleaseTrack)
 		r.Get("/api/eventArtifactTrack", getEventArtifactTrack)
@@ -134,6 +137,10 @@ func gimletdRoutes(r *chi.Mux) {
 		r.Use(session.MustAdmin())
 		r.Post("/api/deleteUser", deleteUser)
 		r.Get("/api/users", getUsers)
+		r.Post("/api/env/{env}/terraformPlans/{namespace}/{name}/approve", approveTerraformPlan)
+		r.Post("/api/env/{env}/terraformPlans/{namespace}/{name}/reject", rejectTerraformPlan)
+		r.Post("/api/env/{env}/reseal", reseal)
+		r.Post("/api/artifacts/restore", restoreArtifact)
 	})
 }
 
@@ -168,6 +175,7 @@ func userRoutes(r *chi.Mux, clientHub *streaming.ClientHub) {
 		r.Get("/api/repo/{owner}/{name}/pullRequests", getPullRequests)
 		r.Get("/api/repo/{owner}/{name}/pullRequestPolicy", repoPullRequestPolicy)
 		r.Post("/api/repo/{owner}/{name}/saveRepoPullRequestPolicy", saveRepoPullRequestPolicy)
+		r.Get("/api/repo/{owner}/{name}/imageUpdates", getImageUpdates)
 		r.Get("/api/chartUpdatePullRequests", getChartUpdatePullRequests)
 		r.Get("/api/gitopsUpdatePullRequests", getGitopsUpdatePullRequests)
 		r.Get("/api/infraRepoPullRequests", getPullRequestsFromInfraRepos)
@@ -185,7 +193,12 @@ func userRoutes(r *chi.Mux, clientHub *streaming.ClientHub) {
 		r.Post(("/api/environments"), saveInfrastructureComponents)
 		r.Post(("/api/bootstrapGitops"), bootstrapGitops)
 		r.Post(("/api/env/{env}/seal"), seal)
+		r.Get("/api/env/{env}/sealingKey", sealingKey)
 		r.Get(("/api/env/{env}/stackConfig"), stackConfig)
+		r.Get("/api/env/{env}/terraformPlans", getTerraformPlans)
+		r.Get("/api/env/{env}/idlePreviews", getIdlePreviews)
+		r.Get("/api/env/{env}/rollouts", getRollouts)
+		r.Post("/api/env/{env}/idlePreviews/{namespace}/{name}/wakeUp", wakeUpPreview)
 		r.Post("/api/silenceAlert", silenceAlert)
 		r.Post("/api/restartDeployment", restartDeployment)
 
@@ -206,6 +219,9 @@ func agentRoutes(r *chi.Mux, agentWSHub *streaming.AgentWSHub) {
 		r.Post("/agent/events", events)
 		r.Post("/agent/fluxState", fluxState)
 		r.Post("/agent/fluxEvents", sendFluxEvents)
+		r.Post("/agent/terraformPlan", terraformPlan)
+		r.Post("/agent/idlePreview", idlePreview)
+		r.Post("/agent/rollout", rollout)
 		r.Post("/agent/deploymentDetails", deploymentDetails)
 		r.Post("/agent/podDetails", podDetails)
 		r.Get("/agent/ws/", func(w http.ResponseWriter, r *http.Request) {
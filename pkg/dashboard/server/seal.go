@@ -0,0 +1,505 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/apis/sealedsecrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/gimlet-io/gimlet/pkg/git/customScm"
+	"github.com/gimlet-io/gimlet/pkg/git/genericScm"
+	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// sealValues seals every string in a map of values, recursively
+func sealValues(w http.ResponseWriter, r *http.Request) {
+	var values map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&values)
+	if err != nil {
+		logrus.Errorf("cannot decode values: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	env := chi.URLParam(r, "env")
+	agentHub, _ := r.Context().Value("agentHub").(*streaming.AgentHub)
+	cert, err := extractCert(agentHub.Agents, env)
+	if err != nil {
+		logrus.Errorf("cannot extract certificate from agenthub: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	key, err := parseKey(cert)
+	if err != nil {
+		logrus.Errorf("cannot parse public key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sealed, err := sealMap(key, values)
+	if err != nil {
+		logrus.Errorf("cannot seal values: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the fingerprint is only recorded for the env once all its values are resealed with the key,
+	// sealing a new value doesn't mean the values sealed earlier are decryptable with it
+	fingerprint, err := crypto.PublicKeyFingerprint(key)
+	if err != nil {
+		logrus.Errorf("cannot get fingerprint: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sealedValuesString, err := json.Marshal(api.SealedValues{
+		Fingerprint: fingerprint,
+		Values:      sealed,
+	})
+	if err != nil {
+		logrus.Errorf("cannot serialize sealed values: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(sealedValuesString)
+}
+
+// sealingKey tells if the sealed-secrets certificate of the env changed since values were last sealed with it
+func sealingKey(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+	agentHub, _ := r.Context().Value("agentHub").(*streaming.AgentHub)
+	cert, err := extractCert(agentHub.Agents, env)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	key, err := parseKey(cert)
+	if err != nil {
+		logrus.Errorf("cannot parse public key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	fingerprint, err := crypto.PublicKeyFingerprint(key)
+	if err != nil {
+		logrus.Errorf("cannot get fingerprint: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dao := r.Context().Value("store").(*store.Store)
+	sealedWith, err := dao.SealedSecretsFingerprint(env)
+	if err != nil {
+		logrus.Errorf("cannot get sealing key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sealingKeyString, err := json.Marshal(api.SealingKey{
+		Fingerprint: fingerprint,
+		SealedWith:  sealedWith,
+		Rotated:     sealedWith != "" && sealedWith != fingerprint,
+	})
+	if err != nil {
+		logrus.Errorf("cannot serialize sealing key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(sealingKeyString)
+}
+
+// reseal re-encrypts the sealed values in the env configs of all imported repos with the current certificate of the env.
+// Changes are opened as pull requests, one per repo
+func reseal(w http.ResponseWriter, r *http.Request) {
+	var resealRequest api.ResealRequest
+	err := json.NewDecoder(r.Body).Decode(&resealRequest)
+	if err != nil {
+		logrus.Errorf("cannot decode reseal request: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	oldKeys, err := parsePrivateKeys(resealRequest.PrivateKeys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	env := chi.URLParam(r, "env")
+	ctx := r.Context()
+	agentHub, _ := ctx.Value("agentHub").(*streaming.AgentHub)
+	cert, err := extractCert(agentHub.Agents, env)
+	if err != nil {
+		logrus.Errorf("cannot extract certificate from agenthub: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	key, err := parseKey(cert)
+	if err != nil {
+		logrus.Errorf("cannot parse public key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dao := ctx.Value("store").(*store.Store)
+	gitRepoCache, _ := ctx.Value("gitRepoCache").(*nativeGit.RepoCache)
+	tokenManager := ctx.Value("tokenManager").(customScm.NonImpersonatedTokenManager)
+	token, _, _ := tokenManager.Token()
+	dynamicConfig := ctx.Value("dynamicConfig").(*dynamicconfig.DynamicConfig)
+	user := ctx.Value("user").(*model.User)
+	goScm := genericScm.NewGoScmHelper(dynamicConfig, nil)
+
+	importedRepos, err := getImportedRepos(dao)
+	if err != nil {
+		logrus.Errorf("cannot get imported repos: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	result := api.ResealResult{
+		Resealed:     []*api.ResealedValue{},
+		Failed:       []*api.ResealedValue{},
+		PullRequests: []string{},
+	}
+	result.Fingerprint, err = crypto.PublicKeyFingerprint(key)
+	if err != nil {
+		logrus.Errorf("cannot get fingerprint: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for _, repoName := range importedRepos {
+		resealed, failed, prLink, err := resealRepo(gitRepoCache, goScm, token, user, repoName, env, oldKeys, key)
+		if err != nil {
+			logrus.Errorf("cannot reseal %s: %s", repoName, err)
+			failed = append(failed, &api.ResealedValue{Repo: repoName, Error: err.Error()})
+		}
+		result.Resealed = append(result.Resealed, resealed...)
+		result.Failed = append(result.Failed, failed...)
+		if prLink != "" {
+			result.PullRequests = append(result.PullRequests, prLink)
+		}
+	}
+
+	if len(result.Failed) == 0 {
+		err = dao.SaveSealedSecretsFingerprint(env, result.Fingerprint)
+		if err != nil {
+			logrus.Errorf("cannot record sealing key: %s", err)
+		}
+	}
+
+	resultString, err := json.Marshal(result)
+	if err != nil {
+		logrus.Errorf("cannot serialize reseal result: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultString)
+}
+
+func resealRepo(
+	gitRepoCache *nativeGit.RepoCache,
+	goScm *genericScm.GoScmHelper,
+	token string,
+	user *model.User,
+	repoName string,
+	env string,
+	oldKeys []*rsa.PrivateKey,
+	key *rsa.PublicKey,
+) ([]*api.ResealedValue, []*api.ResealedValue, string, error) {
+	repo, tmpPath, err := gitRepoCache.InstanceForWrite(repoName)
+	defer os.RemoveAll(tmpPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	headBranch, err := nativeGit.HeadBranch(repo)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	envConfigs, err := existingEnvConfigs(repo, headBranch)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var resealed, failed []*api.ResealedValue
+	changedFiles := map[string]string{}
+	for fileName, envConfig := range envConfigs {
+		if envConfig.Env != env {
+			continue
+		}
+
+		values, err := resealEnvConfig(envConfig, oldKeys, key)
+		if err != nil {
+			failed = append(failed, &api.ResealedValue{Repo: repoName, File: fileName, Error: err.Error()})
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(tmpPath, ".gimlet", fileName))
+		if err != nil {
+			return nil, nil, "", err
+		}
+		// only the sealed values are rewritten, the rest of the file is kept as is with its comments and formatting
+		rawEnvConfig := string(raw)
+		for _, v := range values {
+			v.Repo = repoName
+			v.File = fileName
+			if v.Error == "" && !strings.Contains(rawEnvConfig, v.sealed) {
+				v.Error = "cannot rewrite the value in place"
+			}
+			if v.Error != "" {
+				failed = append(failed, v.ResealedValue)
+			} else {
+				rawEnvConfig = strings.ReplaceAll(rawEnvConfig, v.sealed, v.resealed)
+				resealed = append(resealed, v.ResealedValue)
+				changedFiles[fileName] = rawEnvConfig
+			}
+		}
+	}
+
+	if len(changedFiles) == 0 {
+		return resealed, failed, "", nil
+	}
+
+	sourceBranch, err := GenerateBranchNameWithUniqueHash(fmt.Sprintf("gimlet-reseal-%s", env), 4)
+	if err != nil {
+		return resealed, failed, "", err
+	}
+	err = nativeGit.Branch(repo, fmt.Sprintf("refs/heads/%s", sourceBranch))
+	if err != nil {
+		return resealed, failed, "", err
+	}
+
+	var fileNames []string
+	for fileName, rawEnvConfig := range changedFiles {
+		err = os.WriteFile(filepath.Join(tmpPath, ".gimlet", fileName), []byte(rawEnvConfig), nativeGit.Dir_RWX_RX_R)
+		if err != nil {
+			return resealed, failed, "", err
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	_, err = stageCommitAndPushWithHash(repo, tmpPath, token, fmt.Sprintf("[Gimlet] Resealing secrets for the %s env", env))
+	if err != nil {
+		return resealed, failed, "", err
+	}
+	gitRepoCache.Invalidate(repoName)
+
+	createdPR, _, err := goScm.CreatePR(token, repoName, sourceBranch, headBranch,
+		fmt.Sprintf("[Gimlet] Resealing secrets for `%s`", env),
+		fmt.Sprintf("@%s is resealing secrets with the current sealed-secrets key of the `%s` environment in %s.", user.Login, env, strings.Join(fileNames, ", ")))
+	if err != nil {
+		return resealed, failed, "", err
+	}
+
+	return resealed, failed, createdPR.Link, nil
+}
+
+// resealedValue is a sealed value of an env config with its re-encrypted form
+type resealedValue struct {
+	*api.ResealedValue
+	sealed   string
+	resealed string
+}
+
+// resealEnvConfig re-encrypts the `sealedSecrets` values and the SealedSecret objects of an env config with the new key.
+// Each found value is returned with the fingerprint of the old key it was sealed with, or with an error if none of the old keys could decrypt it
+func resealEnvConfig(envConfig *dx.Manifest, oldKeys []*rsa.PrivateKey, key *rsa.PublicKey) ([]*resealedValue, error) {
+	var values []*resealedValue
+
+	if sealedSecrets, ok := envConfig.Values["sealedSecrets"].(map[string]interface{}); ok {
+		values = append(values, resealMap("values.sealedSecrets", sealedSecrets, oldKeys, key)...)
+	}
+
+	if envConfig.Manifests != "" {
+		_, err := dx.MapYamlDocuments(envConfig.Manifests, func(object map[string]interface{}) bool {
+			if object["kind"] != "SealedSecret" {
+				return false
+			}
+			metadata, _ := object["metadata"].(map[string]interface{})
+			spec, _ := object["spec"].(map[string]interface{})
+			encryptedData, _ := spec["encryptedData"].(map[string]interface{})
+			if len(encryptedData) == 0 {
+				return false
+			}
+
+			objectMeta := &metav1.ObjectMeta{}
+			objectMeta.Name, _ = metadata["name"].(string)
+			objectMeta.Namespace, _ = metadata["namespace"].(string)
+			if objectMeta.Namespace == "" {
+				objectMeta.Namespace = envConfig.Namespace
+			}
+			if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+				objectMeta.Annotations = map[string]string{}
+				for k, v := range annotations {
+					objectMeta.Annotations[k], _ = v.(string)
+				}
+			}
+			label := v1alpha1.EncryptionLabel(objectMeta.Namespace, objectMeta.Name, v1alpha1.SecretScope(objectMeta))
+
+			for k, v := range encryptedData {
+				sealedValue, _ := v.(string)
+				values = append(values, resealString(
+					fmt.Sprintf("manifests.SealedSecret/%s.%s", objectMeta.Name, k),
+					sealedValue, oldKeys, key, label,
+				))
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Path < values[j].Path })
+	return values, nil
+}
+
+// resealMap re-encrypts the sealed values of a map recursively, like sealMap seals them
+func resealMap(path string, sealedValues map[string]interface{}, oldKeys []*rsa.PrivateKey, key *rsa.PublicKey) []*resealedValue {
+	var values []*resealedValue
+	for k, v := range sealedValues {
+		switch sealedValue := v.(type) {
+		case string:
+			values = append(values, resealString(path+"."+k, sealedValue, oldKeys, key, []byte("")))
+		case map[string]interface{}:
+			values = append(values, resealMap(path+"."+k, sealedValue, oldKeys, key)...)
+		default:
+			values = append(values, &resealedValue{
+				ResealedValue: &api.ResealedValue{Path: path + "." + k, Error: "not a sealed value"},
+			})
+		}
+	}
+	return values
+}
+
+func resealString(path string, sealedValue string, oldKeys []*rsa.PrivateKey, key *rsa.PublicKey, label []byte) *resealedValue {
+	resealed, fingerprint, err := resealValue(sealedValue, oldKeys, key, label)
+	value := &resealedValue{
+		ResealedValue: &api.ResealedValue{Path: path, Fingerprint: fingerprint},
+		sealed:        sealedValue,
+		resealed:      resealed,
+	}
+	if err != nil {
+		value.Error = err.Error()
+	}
+	return value
+}
+
+func resealValue(sealedValue string, oldKeys []*rsa.PrivateKey, key *rsa.PublicKey, label []byte) (string, string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(sealedValue)
+	if err != nil {
+		return "", "", fmt.Errorf("not a sealed value")
+	}
+
+	for _, oldKey := range oldKeys {
+		fingerprint, err := crypto.PublicKeyFingerprint(&oldKey.PublicKey)
+		if err != nil {
+			return "", "", err
+		}
+		plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fingerprint: oldKey}, ciphertext, label)
+		if err != nil {
+			continue
+		}
+
+		resealed, err := crypto.HybridEncrypt(rand.Reader, key, plaintext, label)
+		if err != nil {
+			return "", fingerprint, err
+		}
+		return base64.StdEncoding.EncodeToString(resealed), fingerprint, nil
+	}
+
+	return "", "", fmt.Errorf("none of the provided keys can decrypt the value")
+}
+
+func sealMap(key *rsa.PublicKey, values map[string]interface{}) (map[string]interface{}, error) {
+	sealed := map[string]interface{}{}
+	for k, v := range values {
+		switch value := v.(type) {
+		case string:
+			sealedValue, err := sealValue(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot seal %s: %s", k, err)
+			}
+			sealed[k] = sealedValue
+		case map[string]interface{}:
+			sealedMap, err := sealMap(key, value)
+			if err != nil {
+				return nil, err
+			}
+			sealed[k] = sealedMap
+		default:
+			return nil, fmt.Errorf("cannot seal %s: only strings and maps can be sealed", k)
+		}
+	}
+	return sealed, nil
+}
+
+func parsePrivateKeys(pemKeys []string) ([]*rsa.PrivateKey, error) {
+	var keys []*rsa.PrivateKey
+	for _, pemKey := range pemKeys {
+		rest := []byte(pemKey)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+
+			switch block.Type {
+			case "RSA PRIVATE KEY":
+				key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse private key: %s", err)
+				}
+				keys = append(keys, key)
+			case "PRIVATE KEY":
+				key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse private key: %s", err)
+				}
+				rsaKey, ok := key.(*rsa.PrivateKey)
+				if !ok {
+					return nil, fmt.Errorf("expected an RSA private key")
+				}
+				keys = append(keys, rsaKey)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no private key found, provide the PEM encoded keys of the sealed-secrets controller")
+	}
+	return keys, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resealEnvConfig(t *testing.T) {
+	oldKey, _, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "old")
+	assert.Nil(t, err)
+	newKey, _, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "new")
+	assert.Nil(t, err)
+	unknownKey, _, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "unknown")
+	assert.Nil(t, err)
+
+	sealedValue, err := sealValue(&oldKey.PublicKey, "hunter2")
+	assert.Nil(t, err)
+	sealedWithUnknownKey, err := sealValue(&unknownKey.PublicKey, "hunter3")
+	assert.Nil(t, err)
+	sealedConfig, err := sealValue(&oldKey.PublicKey, "{}")
+	assert.Nil(t, err)
+	strictlySealed, err := crypto.HybridEncrypt(rand.Reader, &oldKey.PublicKey, []byte("s3cr3t"), []byte("staging/my-app"))
+	assert.Nil(t, err)
+
+	envConfig := &dx.Manifest{
+		App:       "my-app",
+		Env:       "staging",
+		Namespace: "staging",
+		Values: map[string]interface{}{
+			"sealedSecrets": map[string]interface{}{
+				"DB_PASSWORD": sealedValue,
+				"API_KEY":     sealedWithUnknownKey,
+				"files": map[string]interface{}{
+					"config.json": sealedConfig,
+				},
+				"REPLICAS": 2,
+			},
+		},
+		Manifests: `---
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: my-app
+spec:
+  encryptedData:
+    TOKEN: ` + base64.StdEncoding.EncodeToString(strictlySealed) + `
+`,
+	}
+
+	values, err := resealEnvConfig(envConfig, []*rsa.PrivateKey{oldKey}, &newKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(values))
+
+	oldFingerprint, _ := crypto.PublicKeyFingerprint(&oldKey.PublicKey)
+	assert.Equal(t, "manifests.SealedSecret/my-app.TOKEN", values[0].Path)
+	assert.Equal(t, oldFingerprint, values[0].Fingerprint)
+	assert.Equal(t, "values.sealedSecrets.API_KEY", values[1].Path)
+	assert.NotEmpty(t, values[1].Error, "values sealed with an unknown key can't be resealed")
+	assert.Equal(t, "values.sealedSecrets.DB_PASSWORD", values[2].Path)
+	assert.Empty(t, values[2].Error)
+	assert.Equal(t, "values.sealedSecrets.REPLICAS", values[3].Path)
+	assert.NotEmpty(t, values[3].Error, "values that are not sealed should be reported")
+	assert.Equal(t, "values.sealedSecrets.files.config.json", values[4].Path)
+	assert.Empty(t, values[4].Error, "nested maps should be resealed")
+
+	newKeys := map[string]*rsa.PrivateKey{"new": newKey}
+	assert.Equal(t, sealedValue, values[2].sealed)
+	resealed, _ := base64.StdEncoding.DecodeString(values[2].resealed)
+	plaintext, err := crypto.HybridDecrypt(rand.Reader, newKeys, resealed, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", string(plaintext))
+
+	resealed, _ = base64.StdEncoding.DecodeString(values[4].resealed)
+	plaintext, err = crypto.HybridDecrypt(rand.Reader, newKeys, resealed, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(plaintext))
+
+	resealed, _ = base64.StdEncoding.DecodeString(values[0].resealed)
+	plaintext, err = crypto.HybridDecrypt(rand.Reader, newKeys, resealed, []byte("staging/my-app"))
+	assert.Nil(t, err, "strict scoped secrets should be resealed with the namespace/name label")
+	assert.Equal(t, "s3cr3t", string(plaintext))
+}
+
+func Test_sealMap(t *testing.T) {
+	key, _, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "key")
+	assert.Nil(t, err)
+
+	sealed, err := sealMap(&key.PublicKey, map[string]interface{}{
+		"DB_PASSWORD": "hunter2",
+		"files": map[string]interface{}{
+			"config.json": "{}",
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "hunter2", sealed["DB_PASSWORD"])
+	assert.NotEmpty(t, sealed["files"].(map[string]interface{})["config.json"])
+
+	_, err = sealMap(&key.PublicKey, map[string]interface{}{"REPLICAS": 2})
+	assert.NotNil(t, err, "only strings can be sealed")
+}
+
+func Test_sealValuesKeepsRotation(t *testing.T) {
+	oldKey, _, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "old")
+	assert.Nil(t, err)
+	newKey, newCert, err := crypto.GeneratePrivateKeyAndCert(2048, time.Hour, "new")
+	assert.Nil(t, err)
+
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	oldFingerprint, _ := crypto.PublicKeyFingerprint(&oldKey.PublicKey)
+	store.SaveSealedSecretsFingerprint("staging", oldFingerprint)
+	agentHub := &streaming.AgentHub{Agents: map[string]*streaming.ConnectedAgent{
+		"staging": {SealedSecretsCertificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newCert.Raw})},
+	}}
+
+	withContext := func(ctx context.Context) context.Context {
+		routeContext := chi.NewRouteContext()
+		routeContext.URLParams.Add("env", "staging")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, routeContext)
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "agentHub", agentHub)
+	}
+
+	code, body, _ := testPostEndpoint(sealValues, withContext, "/api/env/staging/sealValues", `{"DB_PASSWORD": "hunter2"}`)
+	assert.Equal(t, http.StatusOK, code)
+	var sealedValues api.SealedValues
+	assert.Nil(t, json.Unmarshal([]byte(body), &sealedValues))
+	newFingerprint, _ := crypto.PublicKeyFingerprint(&newKey.PublicKey)
+	assert.Equal(t, newFingerprint, sealedValues.Fingerprint)
+
+	_, body, _ = testEndpoint(sealingKey, withContext, "/api/env/staging/sealingKey")
+	var key api.SealingKey
+	assert.Nil(t, json.Unmarshal([]byte(body), &key))
+	assert.Equal(t, oldFingerprint, key.SealedWith, "sealing a new value should not hide values sealed with the old key")
+	assert.True(t, key.Rotated)
+}
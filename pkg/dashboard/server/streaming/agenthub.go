@@ -185,6 +185,28 @@ func (h *AgentHub) RestartDeployment(namespace string, name string) {
 	}
 }
 
+// WakeUpPreview scales a sleeping preview deployment back to its original replica count
+func (h *AgentHub) WakeUpPreview(env string, namespace string, name string) {
+	wakeUpRequest := map[string]interface{}{
+		"action":    "wakeUpPreview",
+		"namespace": namespace,
+		"name":      name,
+	}
+
+	wakeUpRequestString, err := json.Marshal(wakeUpRequest)
+	if err != nil {
+		logrus.Errorf("could not serialize request: %s", err)
+		return
+	}
+
+	for _, a := range h.Agents {
+		if a.Name != env {
+			continue
+		}
+		a.EventChannel <- []byte(wakeUpRequestString)
+	}
+}
+
 func (a *ConnectedAgent) RepoStacks(repo string) []*api.Stack {
 	stacks := []*api.Stack{}
 
@@ -22,6 +22,9 @@ const AlertPendingEventString = "alertPending"
 const AlertFiredEventString = "alertFired"
 const AlertResolvedEventString = "alertResolved"
 const CommitEventString = "commitEvent"
+const TerraformPlanEventString = "terraformPlanEvent"
+const IdlePreviewEventString = "idlePreviewEvent"
+const RolloutEventString = "rolloutEvent"
 
 type StreamingEvent struct {
 	Event string `json:"event"`
@@ -54,6 +57,24 @@ type FluxK8sEventsUpdatedEvent struct {
 	StreamingEvent
 }
 
+type TerraformPlanEvent struct {
+	EnvName string             `json:"envName"`
+	Plan    *api.TerraformPlan `json:"plan"`
+	StreamingEvent
+}
+
+type IdlePreviewEvent struct {
+	EnvName string           `json:"envName"`
+	Preview *api.IdlePreview `json:"preview"`
+	StreamingEvent
+}
+
+type RolloutEvent struct {
+	EnvName string       `json:"envName"`
+	Rollout *api.Rollout `json:"rollout"`
+	StreamingEvent
+}
+
 type DeploymentDetailsEvent struct {
 	Deployment string `json:"deployment"`
 	Details    string `json:"details"`
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/git/customScm"
+	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/gimlet-io/go-scm/scm"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+func getTerraformPlans(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+
+	store := r.Context().Value("store").(*store.Store)
+	plans, err := store.TerraformPlans(env)
+	if err != nil {
+		logrus.Errorf("cannot get terraform plans: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	plansString, err := json.Marshal(plans)
+	if err != nil {
+		logrus.Errorf("cannot serialize terraform plans: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(plansString)
+}
+
+// approveTerraformPlan writes the ID of the pending plan to the Terraform object in the gitops repo,
+// so tf-controller applies exactly the plan that was reviewed
+func approveTerraformPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value("user").(*model.User)
+	store := ctx.Value("store").(*store.Store)
+
+	// the plan is checked, approved in git and saved under the plans lock, so it is applied only once
+	status := http.StatusInternalServerError
+	plan, err := store.UpdateTerraformPlan(
+		chi.URLParam(r, "env"),
+		chi.URLParam(r, "namespace"),
+		chi.URLParam(r, "name"),
+		func(existing *api.TerraformPlan) (*api.TerraformPlan, error) {
+			err := pendingTerraformPlan(existing, r)
+			if err != nil {
+				status = http.StatusBadRequest
+				return nil, err
+			}
+
+			status, err = approvePlanInGitops(r, existing, user)
+			if err != nil {
+				return nil, err
+			}
+
+			existing.Status = api.TerraformPlanApproved
+			existing.ReviewedBy = user.Login
+			return existing, nil
+		},
+	)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			logrus.Errorf("cannot approve terraform plan: %s", err)
+			http.Error(w, http.StatusText(status), status)
+		} else {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(status), err), status)
+		}
+		return
+	}
+
+	writeTerraformPlanReview(w, r, plan)
+}
+
+// approvePlanInGitops commits and pushes the approved plan ID to the Terraform object of the plan.
+// Returns the http status to respond with on error
+func approvePlanInGitops(r *http.Request, plan *api.TerraformPlan, user *model.User) (int, error) {
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitRepoCache").(*nativeGit.RepoCache)
+	store := ctx.Value("store").(*store.Store)
+
+	envFromStore, err := store.GetEnvironment(plan.Env)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	repo, pathToCleanUp, err := gitopsRepoCache.InstanceForWriteWithHistory(envFromStore.AppsRepo)
+	defer gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot get gitops repo for write: %s", err)
+	}
+
+	root := plan.Env
+	if envFromStore.RepoPerEnv {
+		root = "."
+	}
+	filePath, content, err := terraformManifestWithApprovedPlan(repo, root, plan)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if filePath == "" {
+		return http.StatusNotFound, fmt.Errorf("terraform object not found in the gitops repo")
+	}
+
+	gitMessage := fmt.Sprintf("[Gimlet] %s/%s terraform plan %s approved by %s", plan.Env, plan.Name, plan.PlanID, user.Login)
+	_, err = nativeGit.CommitFilesToGit(repo, map[string]string{filePath: content}, []string{}, gitMessage)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot commit approved plan: %s", err)
+	}
+
+	// pushing to the origin of the cached repo, so the configured git host is respected
+	owner, _ := scm.Split(envFromStore.AppsRepo)
+	if owner == "builtin" {
+		gitUser := ctx.Value("gitUser").(*model.User)
+		err = nativeGit.PushWithBasicAuth(repo, gitUser.Login, gitUser.Token)
+	} else {
+		tokenManager := ctx.Value("tokenManager").(customScm.NonImpersonatedTokenManager)
+		token, _, _ := tokenManager.Token()
+		err = nativeGit.PushWithToken(repo, token)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("could not push: %s", err)
+	}
+	gitopsRepoCache.Invalidate(envFromStore.AppsRepo)
+
+	return http.StatusOK, nil
+}
+
+// rejectTerraformPlan records the rejection. The plan is never applied as its ID is not written to the gitops repo
+func rejectTerraformPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value("user").(*model.User)
+	store := ctx.Value("store").(*store.Store)
+
+	status := http.StatusInternalServerError
+	plan, err := store.UpdateTerraformPlan(
+		chi.URLParam(r, "env"),
+		chi.URLParam(r, "namespace"),
+		chi.URLParam(r, "name"),
+		func(existing *api.TerraformPlan) (*api.TerraformPlan, error) {
+			err := pendingTerraformPlan(existing, r)
+			if err != nil {
+				status = http.StatusBadRequest
+				return nil, err
+			}
+
+			existing.Status = api.TerraformPlanRejected
+			existing.ReviewedBy = user.Login
+			return existing, nil
+		},
+	)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			logrus.Errorf("cannot reject terraform plan: %s", err)
+			http.Error(w, http.StatusText(status), status)
+		} else {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(status), err), status)
+		}
+		return
+	}
+
+	writeTerraformPlanReview(w, r, plan)
+}
+
+// pendingTerraformPlan tells if the plan can be reviewed
+func pendingTerraformPlan(plan *api.TerraformPlan, r *http.Request) error {
+	if plan == nil {
+		return fmt.Errorf("no pending plan for %s/%s", chi.URLParam(r, "namespace"), chi.URLParam(r, "name"))
+	}
+	if plan.Status != api.TerraformPlanPending {
+		return fmt.Errorf("plan %s is already %s", plan.PlanID, plan.Status)
+	}
+	return nil
+}
+
+func writeTerraformPlanReview(w http.ResponseWriter, r *http.Request, plan *api.TerraformPlan) {
+	clientHub, _ := r.Context().Value("clientHub").(*streaming.ClientHub)
+	jsonString, _ := json.Marshal(streaming.TerraformPlanEvent{
+		StreamingEvent: streaming.StreamingEvent{Event: streaming.TerraformPlanEventString},
+		EnvName:        plan.Env,
+		Plan:           plan,
+	})
+	clientHub.Broadcast <- jsonString
+
+	planString, _ := json.Marshal(plan)
+	w.WriteHeader(http.StatusOK)
+	w.Write(planString)
+}
+
+// terraformManifestWithApprovedPlan looks up the Terraform object of the plan in the app folders of the environment,
+// and returns the path and the content of the file with the approved plan ID set
+func terraformManifestWithApprovedPlan(repo *git.Repository, root string, plan *api.TerraformPlan) (string, string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", "", err
+	}
+
+	appFolders, err := worktree.Filesystem.ReadDir(root)
+	if err != nil {
+		return "", "", err
+	}
+	for _, appFolder := range appFolders {
+		if !appFolder.IsDir() {
+			continue
+		}
+		folder := filepath.Join(root, appFolder.Name())
+		files, err := nativeGit.Folder(repo, folder)
+		if err != nil {
+			return "", "", err
+		}
+		for fileName, content := range files {
+			approved, found, err := approvePlanInManifest(content, plan.Namespace, plan.Name, plan.PlanID)
+			if err != nil {
+				return "", "", fmt.Errorf("cannot parse %s: %s", fileName, err)
+			}
+			if found {
+				return filepath.Join(folder, fileName), approved, nil
+			}
+		}
+	}
+
+	return "", "", nil
+}
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// approvePlanInManifest sets spec.approvePlan on the matching Terraform object of a multi-document yaml.
+// Other documents are kept as is.
+func approvePlanInManifest(content string, namespace string, name string, planID string) (string, bool, error) {
+	separators := yamlDocumentSeparator.FindAllStringIndex(content, -1)
+	start := 0
+	for i := 0; i <= len(separators); i++ {
+		end := len(content)
+		if i < len(separators) {
+			end = separators[i][0]
+		}
+		doc := content[start:end]
+
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return "", false, err
+		}
+		if isTerraformObject(object, namespace, name) {
+			spec, _ := object["spec"].(map[string]interface{})
+			if spec == nil {
+				spec = map[string]interface{}{}
+			}
+			spec["approvePlan"] = planID
+			object["spec"] = spec
+
+			approved, err := yaml.Marshal(object)
+			if err != nil {
+				return "", false, err
+			}
+			prefix := ""
+			if start > 0 {
+				prefix = "\n"
+			}
+			return content[:start] + prefix + string(approved) + content[end:], true, nil
+		}
+
+		if i < len(separators) {
+			start = separators[i][1]
+		}
+	}
+
+	return content, false, nil
+}
+
+func isTerraformObject(object map[string]interface{}, namespace string, name string) bool {
+	if object["kind"] != "Terraform" {
+		return false
+	}
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		return false
+	}
+	return metadata["name"] == name && metadata["namespace"] == namespace
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server/streaming"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_approvePlanInManifest(t *testing.T) {
+	content := `---
+apiVersion: source.toolkit.fluxcd.io/v1
+kind: GitRepository
+metadata:
+  name: myapp-db
+  namespace: default
+---
+apiVersion: infra.contrib.fluxcd.io/v1alpha2
+kind: Terraform
+metadata:
+  name: myapp-db
+  namespace: default
+spec:
+  path: ./db
+  storeReadablePlan: human
+`
+
+	approved, found, err := approvePlanInManifest(content, "default", "myapp-db", "plan-main-abc")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.True(t, strings.Contains(approved, "approvePlan: plan-main-abc"), "plan ID must be set")
+	assert.True(t, strings.HasPrefix(approved, `---
+apiVersion: source.toolkit.fluxcd.io/v1
+kind: GitRepository
+metadata:
+  name: myapp-db
+  namespace: default
+---
+`), "other documents must be kept")
+
+	_, found, err = approvePlanInManifest(content, "other-namespace", "myapp-db", "plan-main-abc")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func Test_rejectTerraformPlanOnce(t *testing.T) {
+	store := store.NewTest(encryptionKey, encryptionKeyNew)
+	store.SaveTerraformPlan(&api.TerraformPlan{
+		Env:       "staging",
+		Namespace: "default",
+		Name:      "myapp-db",
+		PlanID:    "plan-main-abc",
+		Status:    api.TerraformPlanPending,
+	})
+	clientHub := &streaming.ClientHub{Broadcast: make(chan []byte, 10)}
+
+	withContext := func(ctx context.Context) context.Context {
+		routeContext := chi.NewRouteContext()
+		routeContext.URLParams.Add("env", "staging")
+		routeContext.URLParams.Add("namespace", "default")
+		routeContext.URLParams.Add("name", "myapp-db")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, routeContext)
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "clientHub", clientHub)
+		return context.WithValue(ctx, "user", &model.User{Login: "jane"})
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _, _ := testPostEndpoint(rejectTerraformPlan, withContext, "/path", "")
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		} else {
+			assert.Equal(t, http.StatusBadRequest, code)
+		}
+	}
+	assert.Equal(t, 1, succeeded, "a plan should be reviewed only once")
+
+	code, _, _ := testPostEndpoint(terraformPlan, withContext, "/path?name=staging",
+		`{"namespace":"default","name":"myapp-db","planId":"plan-main-abc","status":"pending"}`)
+	assert.Equal(t, http.StatusOK, code)
+	plans, _ := store.TerraformPlans("staging")
+	assert.Equal(t, api.TerraformPlanRejected, plans[0].Status, "a plan reported again should keep its review status")
+	assert.Equal(t, 1, len(clientHub.Broadcast))
+}
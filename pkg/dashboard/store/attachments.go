@@ -0,0 +1,40 @@
+package store
+
+import (
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/russross/meddler"
+)
+
+func (db *Store) CreateAttachment(attachment *model.Attachment) error {
+	return meddler.Insert(db, "attachments", attachment)
+}
+
+// Attachment returns an attachment of an artifact with its content
+func (db *Store) Attachment(artifactID string, name string) (*model.Attachment, error) {
+	query := `
+SELECT id, artifact_id, name, type, digest, content, created
+FROM attachments
+WHERE artifact_id = $1 AND name = $2;
+`
+	var attachment model.Attachment
+	err := meddler.QueryRow(db, &attachment, query, artifactID, name)
+	return &attachment, err
+}
+
+// Attachments returns the attachments of an artifact with their content
+func (db *Store) Attachments(artifactID string) ([]*model.Attachment, error) {
+	query := `
+SELECT id, artifact_id, name, type, digest, content, created
+FROM attachments
+WHERE artifact_id = $1
+ORDER BY name;
+`
+	var attachments []*model.Attachment
+	err := meddler.QueryAll(db, &attachments, query, artifactID)
+	return attachments, err
+}
+
+func (db *Store) DeleteAttachments(artifactID string) error {
+	_, err := db.Exec(`DELETE FROM attachments WHERE artifact_id = $1;`, artifactID)
+	return err
+}
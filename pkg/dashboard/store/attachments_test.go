@@ -0,0 +1,44 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	for _, name := range []string{"sbom.spdx.json", "junit.xml"} {
+		err := s.CreateAttachment(&model.Attachment{
+			ArtifactID: "my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d",
+			Name:       name,
+			Type:       "sbom",
+			Content:    []byte(name),
+		})
+		assert.Nil(t, err)
+	}
+	err := s.CreateAttachment(&model.Attachment{
+		ArtifactID: "my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d",
+		Name:       "junit.xml",
+	})
+	assert.NotNil(t, err, "attachment names are unique within an artifact")
+
+	attachment, err := s.Attachment("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d", "junit.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("junit.xml"), attachment.Content)
+
+	attachments, err := s.Attachments("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(attachments))
+
+	err = s.DeleteAttachments("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d")
+	assert.Nil(t, err)
+	_, err = s.Attachment("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d", "junit.xml")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
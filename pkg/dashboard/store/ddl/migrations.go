@@ -55,6 +55,12 @@ const defaultValueForRepos = "defaultValueForRepos"
 const addEphemeralColumnToEnvironmentsTable = "addEphemeralColumnToEnvironmentsTable"
 const defaultValueForEphemeralColumnInEnvironmentsTable = "defaultValueForEphemeralColumnInEnvironmentsTable"
 const defaultValueForExpiryColumnInEnvironmentsTable = "defaultValueForExpiryColumnInEnvironmentsTable"
+const addIdempotencyKeyToEventsTable = "add-idempotency-key-to-events-table"
+const createTableAttachments = "create-table-attachments"
+const createTableImageDigests = "create-table-image-digests"
+const addSensitiveVarsToEventsTable = "add-sensitive-vars-to-events-table"
+const addIdempotencyKeyIndexToEventsTable = "add-idempotency-key-index-to-events-table"
+const addRestoredToEventsTable = "add-restored-to-events-table"
 
 type migration struct {
 	name string
@@ -321,6 +327,52 @@ UNIQUE(id)
 			name: defaultValueForExpiryColumnInEnvironmentsTable,
 			stmt: `update environments set expiry=0 where expiry is null;`,
 		},
+		{
+			name: addIdempotencyKeyToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN idempotency_key TEXT default '';`,
+		},
+		{
+			name: createTableAttachments,
+			stmt: `
+CREATE TABLE IF NOT EXISTS attachments (
+id          INTEGER PRIMARY KEY AUTOINCREMENT,
+artifact_id TEXT,
+name        TEXT,
+type        TEXT,
+digest      TEXT,
+content     BLOB,
+created     INTEGER DEFAULT 0,
+UNIQUE(id),
+UNIQUE(artifact_id, name)
+);
+`,
+		},
+		{
+			name: createTableImageDigests,
+			stmt: `
+CREATE TABLE IF NOT EXISTS image_digests (
+id          INTEGER PRIMARY KEY AUTOINCREMENT,
+artifact_id TEXT,
+image       TEXT,
+digest      TEXT,
+created     INTEGER DEFAULT 0,
+UNIQUE(id),
+UNIQUE(artifact_id, image)
+);
+`,
+		},
+		{
+			name: addSensitiveVarsToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN sensitive_vars TEXT default '';`,
+		},
+		{
+			name: addIdempotencyKeyIndexToEventsTable,
+			stmt: `CREATE UNIQUE INDEX IF NOT EXISTS events_idempotency_key ON events(idempotency_key) WHERE idempotency_key != '';`,
+		},
+		{
+			name: addRestoredToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN restored INTEGER default 0;`,
+		},
 	},
 	"postgres": {
 		{
@@ -580,5 +632,51 @@ UNIQUE(id)
 			name: defaultValueForExpiryColumnInEnvironmentsTable,
 			stmt: `update environments set expiry=0 where expiry is null;`,
 		},
+		{
+			name: addIdempotencyKeyToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN idempotency_key TEXT default '';`,
+		},
+		{
+			name: createTableAttachments,
+			stmt: `
+CREATE TABLE IF NOT EXISTS attachments (
+id          SERIAL,
+artifact_id TEXT,
+name        TEXT,
+type        TEXT,
+digest      TEXT,
+content     BYTEA,
+created     INTEGER DEFAULT 0,
+UNIQUE(id),
+UNIQUE(artifact_id, name)
+);
+`,
+		},
+		{
+			name: createTableImageDigests,
+			stmt: `
+CREATE TABLE IF NOT EXISTS image_digests (
+id          SERIAL,
+artifact_id TEXT,
+image       TEXT,
+digest      TEXT,
+created     INTEGER DEFAULT 0,
+UNIQUE(id),
+UNIQUE(artifact_id, image)
+);
+`,
+		},
+		{
+			name: addSensitiveVarsToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN sensitive_vars TEXT default '';`,
+		},
+		{
+			name: addIdempotencyKeyIndexToEventsTable,
+			stmt: `CREATE UNIQUE INDEX IF NOT EXISTS events_idempotency_key ON events(idempotency_key) WHERE idempotency_key != '';`,
+		},
+		{
+			name: addRestoredToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN restored INTEGER default 0;`,
+		},
 	},
 }
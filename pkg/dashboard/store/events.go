@@ -123,7 +123,7 @@ ORDER BY created desc
 // Artifact returns an artifact by id
 func (db *Store) Artifact(id string) (*model.Event, error) {
 	query := `
-SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, sensitive_vars
 FROM events
 WHERE artifact_id = $1;
 `
@@ -133,6 +133,22 @@ WHERE artifact_id = $1;
 	return &data, err
 }
 
+// ArtifactByIdempotencyKey returns the artifact that was saved with the given idempotency key
+func (db *Store) ArtifactByIdempotencyKey(key string) (*model.Event, error) {
+	query := `
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, idempotency_key, sensitive_vars
+FROM events
+WHERE type = 'artifact'
+AND idempotency_key = $1
+ORDER BY created desc
+LIMIT 1;
+`
+
+	var data model.Event
+	err := meddler.QueryRow(db, &data, query, key)
+	return &data, err
+}
+
 // Event returns an event by id
 func (db *Store) Event(id string) (*model.Event, error) {
 	query := `
@@ -159,6 +175,22 @@ WHERE artifact_id = $1;
 	return &data, err
 }
 
+// ReleaseEventsCreatedAfter returns the artifact, release and rollback events that were created after the given event
+func (db *Store) ReleaseEventsCreatedAfter(event *model.Event) ([]*model.Event, error) {
+	query := `
+SELECT id, created, type, blob, status, status_desc, results, repository, sha
+FROM events
+WHERE type IN ('artifact', 'release', 'rollback')
+AND created > $1
+AND id != $2
+ORDER BY created ASC;
+`
+
+	var data []*model.Event
+	err := meddler.QueryAll(db, &data, query, event.Created, event.ID)
+	return data, err
+}
+
 // UnprocessedEvents selects an event timeline
 func (db *Store) UnprocessedEvents() (events []*model.Event, err error) {
 	stmt := sql.Stmt(db.driver, sql.SelectUnprocessedEvents)
@@ -201,6 +233,57 @@ func (db *Store) UpdateImageBuildLogs(id string, results string) error {
 	return nil
 }
 
+// ExpiredArtifacts returns the processed artifacts that were created, and restored if ever, before the given time, oldest first
+func (db *Store) ExpiredArtifacts(before int64, limit int, offset int) ([]*model.Event, error) {
+	return db.expiredEvents("type = 'artifact'", before, limit, offset)
+}
+
+// ExpiredEvents returns the processed events, other than artifacts, that were created before the given time, oldest first
+func (db *Store) ExpiredEvents(before int64, limit int, offset int) ([]*model.Event, error) {
+	return db.expiredEvents("type != 'artifact'", before, limit, offset)
+}
+
+func (db *Store) expiredEvents(typeFilter string, before int64, limit int, offset int) ([]*model.Event, error) {
+	query := fmt.Sprintf(`
+SELECT id, created, type, blob, status, status_desc, results, repository, branch, event, source_branch, target_branch, tag, sha, artifact_id, idempotency_key, restored
+FROM events
+WHERE %s
+AND status != 'new'
+AND created < $1
+AND restored < $1
+ORDER BY created asc
+LIMIT %d OFFSET %d;
+`, typeFilter, limit, offset)
+
+	var data []*model.Event
+	err := meddler.QueryAll(db, &data, query, before)
+	return data, err
+}
+
+// DeleteEventByID deletes an event, used when it expired
+func (db *Store) DeleteEventByID(id string) error {
+	_, err := db.Exec(`DELETE FROM events WHERE id = $1;`, id)
+	return err
+}
+
+// RestoreEvent stores an archived event again, keeping its ID and status
+func (db *Store) RestoreEvent(event *model.Event) error {
+	return meddler.Insert(db, "events", event)
+}
+
+// EncryptedSensitiveVars returns the sensitive vars of an artifact as stored, encrypted
+func (db *Store) EncryptedSensitiveVars(artifactID string) (string, error) {
+	var encrypted string
+	err := db.QueryRow(`SELECT sensitive_vars FROM events WHERE artifact_id = $1;`, artifactID).Scan(&encrypted)
+	return encrypted, err
+}
+
+// RestoreEncryptedSensitiveVars sets the sensitive vars of an artifact as they were stored, encrypted
+func (db *Store) RestoreEncryptedSensitiveVars(artifactID string, encrypted string) error {
+	_, err := db.Exec(`UPDATE events SET sensitive_vars = $1 WHERE artifact_id = $2;`, encrypted, artifactID)
+	return err
+}
+
 func addFilter(filters []string, filter string) []string {
 	if len(filters) == 0 {
 		return append(filters, "WHERE "+filter)
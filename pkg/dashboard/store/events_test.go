@@ -57,6 +57,23 @@ func TestEventCRUD(t *testing.T) {
 	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", artifacts[0].SHA)
 }
 
+func TestIdempotencyKeyIsUnique(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	_, err := s.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}", IdempotencyKey: "my-app/1234"})
+	assert.Nil(t, err)
+	_, err = s.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}", IdempotencyKey: "my-app/1234"})
+	assert.NotNil(t, err, "an idempotency key should be used only once")
+
+	_, err = s.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}"})
+	assert.Nil(t, err)
+	_, err = s.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}"})
+	assert.Nil(t, err, "events without an idempotency key should not conflict")
+}
+
 func TestAdvancedArtifactQueries(t *testing.T) {
 	s := NewTest(encryptionKey, encryptionKeyNew)
 	defer func() {
@@ -87,6 +104,45 @@ func TestAdvancedArtifactQueries(t *testing.T) {
 	assert.Equal(t, 2, len(artifacts))
 }
 
+func TestExpiredEvents(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	err := setupData(s)
+	assert.Nil(t, err)
+	fiveHoursAgo := time.Now().Add(-5 * time.Hour).Unix()
+
+	expired, err := s.ExpiredArtifacts(fiveHoursAgo, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(expired), "unprocessed artifacts should not expire")
+
+	artifacts, _ := s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	for _, a := range artifacts {
+		s.UpdateEventStatus(a.ID, model.StatusProcessed, "", "[]")
+	}
+	expired, err = s.ExpiredArtifacts(fiveHoursAgo, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(expired))
+	assert.Equal(t, "sha2", expired[0].SHA)
+
+	events, err := s.ExpiredEvents(fiveHoursAgo, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events), "artifacts are not listed among events")
+
+	err = s.DeleteEventByID(expired[0].ID)
+	assert.Nil(t, err)
+	artifacts, _ = s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	assert.Equal(t, 1, len(artifacts))
+
+	err = s.RestoreEvent(expired[0])
+	assert.Nil(t, err)
+	restored, err := s.Event(expired[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, model.StatusProcessed, restored.Status, "restored events should not be processed again")
+}
+
 func setupData(s *Store) error {
 	anHourAgo := time.Now().Add(-1 * time.Hour)
 	aModel, _ := model.ToEvent(dx.Artifact{
@@ -108,3 +164,80 @@ func setupData(s *Store) error {
 	_, err = s.createEvent(aModel, tenHoursAgo.Unix())
 	return err
 }
+
+func TestSensitiveVars(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	artifact := dx.Artifact{
+		ID:      "my-app-1",
+		Version: dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Vars:    map[string]string{"API_TOKEN": "s3cr3t", "IMAGE_TAG": "ea9ab7c"},
+	}
+	aModel, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", artifact.Vars["API_TOKEN"], "the artifact of the caller should not be masked")
+	_, err = s.CreateEvent(aModel)
+	assert.Nil(t, err)
+
+	var storedSensitiveVars string
+	err = s.QueryRow("SELECT sensitive_vars FROM events WHERE artifact_id = $1", "my-app-1").Scan(&storedSensitiveVars)
+	assert.Nil(t, err)
+	assert.NotContains(t, storedSensitiveVars, "s3cr3t", "sensitive vars should be encrypted")
+
+	artifacts, err := s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+	assert.NotContains(t, artifacts[0].Blob, "s3cr3t")
+	masked, _ := model.ToArtifact(artifacts[0])
+	assert.Equal(t, dx.SensitiveVarMask, masked.Vars["API_TOKEN"])
+	assert.Equal(t, "ea9ab7c", masked.Vars["IMAGE_TAG"])
+
+	unprocessed, err := s.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unprocessed))
+	sensitiveVars, err := model.ToSensitiveVars(unprocessed[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", masked.WithSensitiveVars(sensitiveVars).Vars["API_TOKEN"])
+
+	savedArtifact, err := s.Artifact("my-app-1")
+	assert.Nil(t, err)
+	sensitiveVars, err = model.ToSensitiveVars(savedArtifact)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", sensitiveVars.Vars["API_TOKEN"])
+
+	encrypted, err := s.EncryptedSensitiveVars("my-app-1")
+	assert.Nil(t, err)
+	assert.Equal(t, storedSensitiveVars, encrypted)
+	err = s.RestoreEncryptedSensitiveVars("my-app-1", encrypted)
+	assert.Nil(t, err)
+	savedArtifact, _ = s.Artifact("my-app-1")
+	sensitiveVars, _ = model.ToSensitiveVars(savedArtifact)
+	assert.Equal(t, "s3cr3t", sensitiveVars.Vars["API_TOKEN"])
+}
+
+func TestSensitiveVarsStoredBeforeMasking(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	_, err := s.CreateEvent(&model.Event{
+		Type:       model.ArtifactCreatedEvent,
+		Blob:       `{"id":"my-app-1","vars":{"API_TOKEN":"s3cr3t","IMAGE_TAG":"ea9ab7c"}}`,
+		ArtifactID: "my-app-1",
+	})
+	assert.Nil(t, err)
+
+	savedArtifact, err := s.Artifact("my-app-1")
+	assert.Nil(t, err)
+	masked, _ := model.ToArtifact(savedArtifact)
+	assert.Equal(t, dx.SensitiveVarMask, masked.Vars["API_TOKEN"], "artifacts stored before masking should be masked on read")
+	assert.Equal(t, "ea9ab7c", masked.Vars["IMAGE_TAG"])
+
+	sensitiveVars, err := model.ToSensitiveVars(savedArtifact)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", masked.WithSensitiveVars(sensitiveVars).Vars["API_TOKEN"])
+}
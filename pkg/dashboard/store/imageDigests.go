@@ -0,0 +1,40 @@
+package store
+
+import (
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/russross/meddler"
+)
+
+func (db *Store) CreateImageDigest(imageDigest *model.ImageDigest) error {
+	return meddler.Insert(db, "image_digests", imageDigest)
+}
+
+// ImageDigest returns the digest that was first seen for an image of an artifact
+func (db *Store) ImageDigest(artifactID string, image string) (*model.ImageDigest, error) {
+	query := `
+SELECT id, artifact_id, image, digest, created
+FROM image_digests
+WHERE artifact_id = $1 AND image = $2;
+`
+	var imageDigest model.ImageDigest
+	err := meddler.QueryRow(db, &imageDigest, query, artifactID, image)
+	return &imageDigest, err
+}
+
+// ImageDigests returns the digests that were recorded for the images of an artifact
+func (db *Store) ImageDigests(artifactID string) ([]*model.ImageDigest, error) {
+	query := `
+SELECT id, artifact_id, image, digest, created
+FROM image_digests
+WHERE artifact_id = $1
+ORDER BY image;
+`
+	var imageDigests []*model.ImageDigest
+	err := meddler.QueryAll(db, &imageDigests, query, artifactID)
+	return imageDigests, err
+}
+
+func (db *Store) DeleteImageDigests(artifactID string) error {
+	_, err := db.Exec(`DELETE FROM image_digests WHERE artifact_id = $1;`, artifactID)
+	return err
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageDigests(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	err := s.CreateImageDigest(&model.ImageDigest{
+		ArtifactID: "my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d",
+		Image:      "ghcr.io/gimlet-io/myapp:abc123",
+		Digest:     "sha256:4e3f",
+	})
+	assert.Nil(t, err)
+	err = s.CreateImageDigest(&model.ImageDigest{
+		ArtifactID: "my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d",
+		Image:      "ghcr.io/gimlet-io/myapp:abc123",
+		Digest:     "sha256:9a8b",
+	})
+	assert.NotNil(t, err, "only the first seen digest is recorded")
+
+	imageDigest, err := s.ImageDigest("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d", "ghcr.io/gimlet-io/myapp:abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:4e3f", imageDigest.Digest)
+
+	err = s.DeleteImageDigests("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d")
+	assert.Nil(t, err)
+	_, err = s.ImageDigest("my-app-b2ab0f6c-2d0e-4d8b-9d7c-3a1f7c0e5e4d", "ghcr.io/gimlet-io/myapp:abc123")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store/sql"
 	"github.com/russross/meddler"
@@ -155,3 +156,266 @@ func filter(slice []string, elem string) []string {
 	}
 	return slice[:n]
 }
+
+func (db *Store) TerraformPlans(env string) ([]*api.TerraformPlan, error) {
+	terraformPlansKeyValue, err := db.KeyValue(fmt.Sprintf("%s-%s", model.TerraformPlans, env))
+	if err == database_sql.ErrNoRows {
+		return []*api.TerraformPlan{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var terraformPlans []*api.TerraformPlan
+	err = json.Unmarshal([]byte(terraformPlansKeyValue.Value), &terraformPlans)
+	if err != nil {
+		return nil, err
+	}
+	return terraformPlans, nil
+}
+
+// SaveTerraformPlan stores the plan of a Terraform object, replacing its earlier plan
+func (db *Store) SaveTerraformPlan(plan *api.TerraformPlan) error {
+	_, err := db.UpdateTerraformPlan(plan.Env, plan.Namespace, plan.Name, func(existing *api.TerraformPlan) (*api.TerraformPlan, error) {
+		return plan, nil
+	})
+	return err
+}
+
+// UpdateTerraformPlan reads, updates and stores the plan of a Terraform object under the plans lock,
+// so concurrent agent reports and reviews act on a plan only once.
+// The update gets the stored plan or nil, and returns the plan to store, or nil to keep the stored one.
+// Returns the stored plan, or nil if the update didn't change it
+func (db *Store) UpdateTerraformPlan(
+	env string,
+	namespace string,
+	name string,
+	update func(existing *api.TerraformPlan) (*api.TerraformPlan, error),
+) (*api.TerraformPlan, error) {
+	db.terraformPlansLock.Lock()
+	defer db.terraformPlansLock.Unlock()
+
+	terraformPlans, err := db.TerraformPlans(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing *api.TerraformPlan
+	index := -1
+	for i, p := range terraformPlans {
+		if p.Namespace == namespace && p.Name == name {
+			existing = p
+			index = i
+		}
+	}
+
+	plan, err := update(existing)
+	if err != nil || plan == nil {
+		return nil, err
+	}
+	if index >= 0 {
+		terraformPlans[index] = plan
+	} else {
+		terraformPlans = append(terraformPlans, plan)
+	}
+
+	terraformPlansBytes, err := json.Marshal(terraformPlans)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SaveKeyValue(&model.KeyValue{
+		Key:   fmt.Sprintf("%s-%s", model.TerraformPlans, env),
+		Value: string(terraformPlansBytes),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (db *Store) IdlePreviews(env string) ([]*api.IdlePreview, error) {
+	idlePreviewsKeyValue, err := db.KeyValue(fmt.Sprintf("%s-%s", model.IdlePreviews, env))
+	if err == database_sql.ErrNoRows {
+		return []*api.IdlePreview{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var idlePreviews []*api.IdlePreview
+	err = json.Unmarshal([]byte(idlePreviewsKeyValue.Value), &idlePreviews)
+	if err != nil {
+		return nil, err
+	}
+	return idlePreviews, nil
+}
+
+// SaveIdlePreview stores the idle state of a preview deployment, replacing its earlier state
+func (db *Store) SaveIdlePreview(preview *api.IdlePreview) error {
+	db.idlePreviewsLock.Lock()
+	defer db.idlePreviewsLock.Unlock()
+
+	idlePreviews, err := db.IdlePreviews(preview.Env)
+	if err != nil {
+		return err
+	}
+
+	updated := false
+	for i, p := range idlePreviews {
+		if p.Namespace == preview.Namespace && p.Name == preview.Name {
+			idlePreviews[i] = preview
+			updated = true
+		}
+	}
+	if !updated {
+		idlePreviews = append(idlePreviews, preview)
+	}
+
+	idlePreviewsBytes, err := json.Marshal(idlePreviews)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   fmt.Sprintf("%s-%s", model.IdlePreviews, preview.Env),
+		Value: string(idlePreviewsBytes),
+	})
+}
+
+func (db *Store) Rollouts(env string) ([]*api.Rollout, error) {
+	rolloutsKeyValue, err := db.KeyValue(fmt.Sprintf("%s-%s", model.Rollouts, env))
+	if err == database_sql.ErrNoRows {
+		return []*api.Rollout{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rollouts []*api.Rollout
+	err = json.Unmarshal([]byte(rolloutsKeyValue.Value), &rollouts)
+	if err != nil {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+// SaveRollout stores the progress of a rollout, replacing its earlier state
+func (db *Store) SaveRollout(rollout *api.Rollout) error {
+	_, err := db.UpdateRollout(rollout.Env, rollout.Namespace, rollout.Name, func(existing *api.Rollout) (*api.Rollout, error) {
+		return rollout, nil
+	})
+	return err
+}
+
+// UpdateRollout reads, updates and stores the progress of a rollout under the rollouts lock,
+// so concurrent reports of the same rollout transition it only once.
+// The update gets the stored rollout or nil, and returns the rollout to store, or nil to keep the stored one.
+// Returns the stored rollout, or nil if the update didn't change it
+func (db *Store) UpdateRollout(
+	env string,
+	namespace string,
+	name string,
+	update func(existing *api.Rollout) (*api.Rollout, error),
+) (*api.Rollout, error) {
+	db.rolloutsLock.Lock()
+	defer db.rolloutsLock.Unlock()
+
+	rollouts, err := db.Rollouts(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing *api.Rollout
+	index := -1
+	for i, r := range rollouts {
+		if r.Namespace == namespace && r.Name == name {
+			existing = r
+			index = i
+		}
+	}
+
+	rollout, err := update(existing)
+	if err != nil || rollout == nil {
+		return nil, err
+	}
+	if index >= 0 {
+		rollouts[index] = rollout
+	} else {
+		rollouts = append(rollouts, rollout)
+	}
+
+	rolloutsBytes, err := json.Marshal(rollouts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SaveKeyValue(&model.KeyValue{
+		Key:   fmt.Sprintf("%s-%s", model.Rollouts, env),
+		Value: string(rolloutsBytes),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// SealedSecretsFingerprint returns the fingerprint of the certificate that values were last sealed with in the env
+func (db *Store) SealedSecretsFingerprint(env string) (string, error) {
+	fingerprint, err := db.KeyValue(fmt.Sprintf("%s-%s", model.SealedSecretsFingerprint, env))
+	if err == database_sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return fingerprint.Value, nil
+}
+
+func (db *Store) SaveSealedSecretsFingerprint(env string, fingerprint string) error {
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   fmt.Sprintf("%s-%s", model.SealedSecretsFingerprint, env),
+		Value: fingerprint,
+	})
+}
+
+// imageUpdateHistoryLength is the number of image updates kept per repo
+const imageUpdateHistoryLength = 100
+
+// ImageUpdates returns the image tag update history of a repo, latest first
+func (db *Store) ImageUpdates(repo string) ([]*api.ImageUpdate, error) {
+	imageUpdatesKeyValue, err := db.KeyValue(fmt.Sprintf("%s-%s", model.ImageUpdates, repo))
+	if err == database_sql.ErrNoRows {
+		return []*api.ImageUpdate{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var imageUpdates []*api.ImageUpdate
+	err = json.Unmarshal([]byte(imageUpdatesKeyValue.Value), &imageUpdates)
+	if err != nil {
+		return nil, err
+	}
+	return imageUpdates, nil
+}
+
+func (db *Store) SaveImageUpdate(imageUpdate *api.ImageUpdate) error {
+	db.imageUpdatesLock.Lock()
+	defer db.imageUpdatesLock.Unlock()
+
+	imageUpdates, err := db.ImageUpdates(imageUpdate.Repo)
+	if err != nil {
+		return err
+	}
+
+	imageUpdates = append([]*api.ImageUpdate{imageUpdate}, imageUpdates...)
+	if len(imageUpdates) > imageUpdateHistoryLength {
+		imageUpdates = imageUpdates[:imageUpdateHistoryLength]
+	}
+
+	imageUpdatesBytes, err := json.Marshal(imageUpdates)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   fmt.Sprintf("%s-%s", model.ImageUpdates, imageUpdate.Repo),
+		Value: string(imageUpdatesBytes),
+	})
+}
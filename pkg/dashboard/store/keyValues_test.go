@@ -0,0 +1,214 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerraformPlans(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	plans, err := s.TerraformPlans("staging")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plans))
+
+	err = s.SaveTerraformPlan(&api.TerraformPlan{
+		Env:       "staging",
+		Name:      "myapp-db",
+		Namespace: "default",
+		PlanID:    "plan-main-abc",
+		Status:    api.TerraformPlanPending,
+	})
+	assert.Nil(t, err)
+
+	err = s.SaveTerraformPlan(&api.TerraformPlan{
+		Env:       "staging",
+		Name:      "myapp-db",
+		Namespace: "default",
+		PlanID:    "plan-main-def",
+		Status:    api.TerraformPlanPending,
+	})
+	assert.Nil(t, err)
+
+	plans, err = s.TerraformPlans("staging")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(plans), "should replace the earlier plan of the same object")
+	assert.Equal(t, "plan-main-def", plans[0].PlanID)
+
+	plans, err = s.TerraformPlans("production")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plans))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.SaveTerraformPlan(&api.TerraformPlan{
+				Env:       "production",
+				Namespace: "default",
+				Name:      fmt.Sprintf("my-app-db-%d", i),
+				PlanID:    "plan-main-abc",
+				Status:    api.TerraformPlanPending,
+			})
+		}(i)
+	}
+	wg.Wait()
+	plans, err = s.TerraformPlans("production")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(plans), "concurrent plans should not overwrite each other")
+}
+
+func TestIdlePreviews(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	err := s.SaveIdlePreview(&api.IdlePreview{
+		Env:       "staging",
+		Name:      "myapp-feature-x",
+		Namespace: "default",
+		Sleeping:  true,
+	})
+	assert.Nil(t, err)
+
+	err = s.SaveIdlePreview(&api.IdlePreview{
+		Env:       "staging",
+		Name:      "myapp-feature-x",
+		Namespace: "default",
+		Sleeping:  false,
+	})
+	assert.Nil(t, err)
+
+	previews, err := s.IdlePreviews("staging")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(previews), "should replace the earlier state of the same deployment")
+	assert.False(t, previews[0].Sleeping)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.SaveIdlePreview(&api.IdlePreview{
+				Env:       "production",
+				Namespace: "default",
+				Name:      fmt.Sprintf("myapp-feature-%d", i),
+				Sleeping:  true,
+			})
+		}(i)
+	}
+	wg.Wait()
+	previews, err = s.IdlePreviews("production")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(previews), "concurrent updates should not overwrite each other")
+}
+
+func TestRollouts(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	err := s.SaveRollout(&api.Rollout{
+		Env:       "staging",
+		Namespace: "default",
+		Name:      "myapp",
+		SHA:       "abc123",
+		Phase:     api.RolloutProgressing,
+	})
+	assert.Nil(t, err)
+
+	saved, err := s.UpdateRollout("staging", "default", "myapp", func(existing *api.Rollout) (*api.Rollout, error) {
+		assert.Equal(t, "abc123", existing.SHA)
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, saved, "should keep the stored rollout when the update returns nil")
+
+	err = s.SaveRollout(&api.Rollout{
+		Env:       "staging",
+		Namespace: "default",
+		Name:      "myapp",
+		SHA:       "abc123",
+		Phase:     api.RolloutSucceeded,
+	})
+	assert.Nil(t, err)
+
+	rollouts, err := s.Rollouts("staging")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rollouts), "should replace the earlier state of the same rollout")
+	assert.Equal(t, api.RolloutSucceeded, rollouts[0].Phase)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.SaveRollout(&api.Rollout{
+				Env:       "production",
+				Namespace: "default",
+				Name:      fmt.Sprintf("myapp-%d", i),
+				Phase:     api.RolloutProgressing,
+			})
+		}(i)
+	}
+	wg.Wait()
+	rollouts, err = s.Rollouts("production")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(rollouts), "concurrent rollouts should not overwrite each other")
+}
+
+func TestImageUpdates(t *testing.T) {
+	s := NewTest(encryptionKey, encryptionKeyNew)
+	defer func() {
+		s.Close()
+	}()
+
+	for _, tag := range []string{"1.1.0", "1.2.0"} {
+		err := s.SaveImageUpdate(&api.ImageUpdate{
+			Repo:  "gimlet-io/agent-config",
+			Env:   "production",
+			App:   "agent",
+			Image: "vendor/agent",
+			To:    tag,
+		})
+		assert.Nil(t, err)
+	}
+
+	imageUpdates, err := s.ImageUpdates("gimlet-io/agent-config")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(imageUpdates))
+	assert.Equal(t, "1.2.0", imageUpdates[0].To, "latest update should be first")
+
+	imageUpdates, err = s.ImageUpdates("gimlet-io/other")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(imageUpdates))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.SaveImageUpdate(&api.ImageUpdate{
+				Repo:  "gimlet-io/app-config",
+				Env:   "production",
+				App:   fmt.Sprintf("app-%d", i),
+				Image: "vendor/app",
+				To:    "1.0.0",
+			})
+		}(i)
+	}
+	wg.Wait()
+	imageUpdates, err = s.ImageUpdates("gimlet-io/app-config")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(imageUpdates), "concurrent updates should not overwrite each other")
+}
@@ -96,7 +96,7 @@ WHERE name = $1;
 DELETE FROM pods where name = $1;
 `,
 		SelectUnprocessedEvents: `
-SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id
+SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id, sensitive_vars
 FROM events
 WHERE status='new' and type!= 'imageBuild' order by created ASC limit 10;
 `,
@@ -211,7 +211,7 @@ WHERE name = $1;
 DELETE FROM pods where name = $1;
 `,
 		SelectUnprocessedEvents: `
-SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id
+SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id, sensitive_vars
 FROM events
 WHERE status='new' and type != 'imageBuild' order by created ASC limit 10;
 `,
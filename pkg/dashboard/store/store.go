@@ -35,6 +35,15 @@ type Store struct {
 
 	eventUpdatedCallbacksLock sync.Mutex
 	eventUpdatedCallbacks     []EventCallback
+
+	// guards the read-modify-write of the terraform plans key-value
+	terraformPlansLock sync.Mutex
+	// guards the read-modify-write of the idle previews key-value
+	idlePreviewsLock sync.Mutex
+	// guards the read-modify-write of the rollouts key-value
+	rolloutsLock sync.Mutex
+	// guards the read-modify-write of the image updates key-value
+	imageUpdatesLock sync.Mutex
 }
 
 // New creates a database connection for the given driver and datasource
@@ -93,6 +102,11 @@ func NewTest(encryptionKey, encryptionKeyNew string) *Store {
 		config: config,
 	}
 
+	// every connection to an in-memory DB is a new, empty database
+	if driver == "sqlite" {
+		store.DB.SetMaxOpenConns(1)
+	}
+
 	// if not in-memory DB, recreate tables between tests
 	if driver != "sqlite" {
 		store.Exec(`
@@ -3,17 +3,14 @@ package worker
 import (
 	"fmt"
 	"slices"
-	"time"
 
 	"github.com/gimlet-io/gimlet/pkg/dashboard/gitops"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
-	"github.com/gimlet-io/go-scm/scm"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/google/uuid"
 )
 
 type ArtifactsWorker struct {
@@ -141,26 +138,11 @@ func doGenerateFakeArtifact(
 	repoName string,
 	repo *git.Repository,
 ) error {
-	owner, name := scm.Split(repoName)
-	version, err := gitops.Version(owner, name, repo, hash, branch)
+	artifact, err := gitops.FakeArtifact(repo, repoName, hash, branch, manifests)
 	if err != nil {
 		return err
 	}
 
-	artifact := &dx.Artifact{
-		ID:           fmt.Sprintf("%s-%s", repoName, uuid.New().String()),
-		Created:      time.Now().Unix(),
-		Fake:         true,
-		Environments: manifests,
-		Version:      *version,
-		Vars: map[string]string{
-			"SHA":    hash,
-			"REPO":   repoName,
-			"OWNER":  owner,
-			"BRANCH": branch,
-		},
-	}
-
 	event, err := model.ToEvent(*artifact)
 	if err != nil {
 		return err
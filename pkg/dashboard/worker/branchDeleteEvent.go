@@ -26,23 +26,26 @@ import (
 const Dir_RWX_RX_R = 0754
 
 type BranchDeleteEventWorker struct {
-	tokenManager customScm.NonImpersonatedTokenManager
-	cachePath    string
-	dao          *store.Store
-	stopCh       chan os.Signal
+	tokenManager    customScm.NonImpersonatedTokenManager
+	cachePath       string
+	dao             *store.Store
+	gitopsRepoCache *commonGit.RepoCache
+	stopCh          chan os.Signal
 }
 
 func NewBranchDeleteEventWorker(
 	tokenManager customScm.NonImpersonatedTokenManager,
 	cachePath string,
 	dao *store.Store,
+	gitopsRepoCache *commonGit.RepoCache,
 	stopCh chan os.Signal,
 ) *BranchDeleteEventWorker {
 	branchDeleteEventWorker := &BranchDeleteEventWorker{
-		tokenManager: tokenManager,
-		cachePath:    cachePath,
-		dao:          dao,
-		stopCh:       stopCh,
+		tokenManager:    tokenManager,
+		cachePath:       cachePath,
+		dao:             dao,
+		gitopsRepoCache: gitopsRepoCache,
+		stopCh:          stopCh,
 	}
 
 	return branchDeleteEventWorker
@@ -97,6 +100,38 @@ func (r *BranchDeleteEventWorker) cleanup() {
 				os.RemoveAll(repoPath)
 				continue
 			}
+
+			for _, branch := range branches {
+				if contains(deletedBranches, branch) {
+					continue
+				}
+				expiredManifests := r.expiredManifests(branch, branchesWithManifests[branch])
+				if len(expiredManifests) == 0 {
+					continue
+				}
+
+				logrus.Infof("cleaning up expired app instances of %s", branch)
+
+				ttlExpiredEventStr, err := json.Marshal(dx.BranchDeletedEvent{
+					Repo:      repoName,
+					Branch:    branch,
+					Manifests: expiredManifests,
+				})
+				if err != nil {
+					logrus.Warnf("could not serialize ttl expired event: %s", err)
+					continue
+				}
+
+				_, err = r.dao.CreateEvent(&model.Event{
+					Type:       model.TTLExpiredEvent,
+					Blob:       string(ttlExpiredEventStr),
+					Repository: repoName,
+				})
+				if err != nil {
+					logrus.Warnf("could not store ttl expired event: %s", err)
+					continue
+				}
+			}
 			for _, deletedBranch := range deletedBranches {
 				manifests := branchesWithManifests[deletedBranch]
 
@@ -181,6 +216,100 @@ func (r *BranchDeleteEventWorker) extractManifestsFromBranch(repo *git.Repositor
 	return manifests, nil
 }
 
+// expiredManifests returns the manifests with a ttl cleanup policy
+// whose app instance was not redeployed from the branch within the ttl
+func (r *BranchDeleteEventWorker) expiredManifests(branch string, manifests []*dx.Manifest) []*dx.Manifest {
+	var expired []*dx.Manifest
+	for _, manifest := range manifests {
+		// working on a copy, the event processing preps the preview manifests again
+		m := *manifest
+		m.Values = nil
+		m.PrepPreview("")
+		if m.Cleanup == nil || m.Cleanup.Event != dx.TTL || m.Cleanup.TTLDays <= 0 {
+			continue
+		}
+
+		cleanup := *m.Cleanup
+		err := cleanup.ResolveVars(map[string]string{
+			"BRANCH": branch,
+		})
+		if err != nil {
+			logrus.Warnf("could not resolve cleanup policy: %s", err)
+			continue
+		}
+		if !cleanupTrigger(branch, &cleanup) {
+			continue
+		}
+
+		lastDeploy, err := r.lastDeploy(m.Env, cleanup.AppToCleanup)
+		if err != nil {
+			logrus.Warnf("could not determine last deploy of %s/%s: %s", m.Env, cleanup.AppToCleanup, err)
+			continue
+		}
+		if lastDeploy.IsZero() { // not deployed, or already cleaned up
+			continue
+		}
+
+		if time.Since(lastDeploy) > time.Duration(cleanup.TTLDays)*24*time.Hour {
+			expired = append(expired, manifest)
+		}
+	}
+
+	return expired
+}
+
+// lastDeploy returns the time of the last gitops commit of the app, or zero time if the app is not deployed
+func (r *BranchDeleteEventWorker) lastDeploy(env string, app string) (time.Time, error) {
+	envFromStore, err := r.dao.GetEnvironment(env)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	path := filepath.Join(env, app)
+	if envFromStore.RepoPerEnv {
+		path = app
+	}
+
+	var lastDeploy time.Time
+	var innerErr error
+	err = r.gitopsRepoCache.PerformActionWithHistory(envFromStore.AppsRepo, func(repo *git.Repository) {
+		release, err := commonGit.Content(repo, filepath.Join(path, "release.json"))
+		if err != nil || release == "" {
+			innerErr = err
+			return
+		}
+
+		commits, err := repo.Log(&git.LogOptions{})
+		if err != nil {
+			innerErr = err
+			return
+		}
+		commits = commonGit.NewCommitDirIterFromIter(path, commits, repo)
+		defer commits.Close()
+
+		commit, err := commits.Next()
+		if err != nil {
+			innerErr = err
+			return
+		}
+		lastDeploy = commit.Committer.When
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lastDeploy, innerErr
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 // difference returns the elements in `a` that aren't in `b`.
 func difference(a, b []string) []string {
 	mb := make(map[string]struct{}, len(b))
@@ -11,8 +11,10 @@ import (
 	"time"
 
 	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealedsecrets/v1alpha1"
+	"github.com/blang/semver/v4"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/fluxcd/flux2/v2/pkg/manifestgen"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
 	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/gitops"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/imageBuild"
@@ -23,7 +25,6 @@ import (
 	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/customScm"
-	"github.com/gimlet-io/gimlet/pkg/git/genericScm"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
 	bootstrap "github.com/gimlet-io/gimlet/pkg/gitops"
 	"github.com/gimlet-io/gimlet/pkg/gitops/sync"
@@ -52,6 +53,8 @@ type GitopsWorker struct {
 	gitopsQueue          chan int
 	agentHub             *streaming.AgentHub
 	dynamicConfig        *dynamicconfig.DynamicConfig
+	schemaValidator      *dx.SchemaValidator
+	policies             []dx.Policy
 }
 
 func NewGitopsWorker(
@@ -66,6 +69,8 @@ func NewGitopsWorker(
 	gitHost string,
 	agentHub *streaming.AgentHub,
 	dynamicConfig *dynamicconfig.DynamicConfig,
+	schemaValidator *dx.SchemaValidator,
+	policies []dx.Policy,
 ) *GitopsWorker {
 
 	return &GitopsWorker{
@@ -81,6 +86,8 @@ func NewGitopsWorker(
 		gitopsQueue:          make(chan int, 1000),
 		agentHub:             agentHub,
 		dynamicConfig:        dynamicConfig,
+		schemaValidator:      schemaValidator,
+		policies:             policies,
 	}
 }
 
@@ -123,6 +130,8 @@ func (w *GitopsWorker) Run() {
 				w.gitHost,
 				w.agentHub,
 				w.dynamicConfig,
+				w.schemaValidator,
+				w.policies,
 			)
 		}
 	}
@@ -140,6 +149,8 @@ func processEvent(
 	gitHost string,
 	agentHub *streaming.AgentHub,
 	dynamicConfig *dynamicconfig.DynamicConfig,
+	schemaValidator *dx.SchemaValidator,
+	policies []dx.Policy,
 ) {
 	var token string
 	if tokenManager != nil { // only needed for private helm charts
@@ -152,6 +163,9 @@ func processEvent(
 		envConfigs = map[string]*dx.StackConfig{}
 	}
 
+	// policies are loaded per env, on the first render of the env
+	policyEngines := newEnvPolicyEngines(store, repoCache, policies)
+
 	// process event based on type
 	var err error
 	var results []model.Result
@@ -167,18 +181,37 @@ func processEvent(
 			gitHost,
 			agentHub,
 			envConfigs,
+			schemaValidator,
+			policyEngines,
 		)
 	case model.ReleaseRequestedEvent:
-		results, err = processReleaseEvent(
-			store,
-			repoCache,
-			token,
-			event,
-			perf,
-			gitUser,
-			gitHost,
-			envConfigs,
-		)
+		var ready bool
+		ready, err = dependenciesReady(store, event)
+		if err == nil && !ready {
+			return // the release is processed on a later run, once its dependencies are healthy
+		}
+		if err == nil {
+			var supersededBy string
+			supersededBy, err = deferredReleaseSupersededBy(store, event)
+			if err == nil && supersededBy != "" {
+				event.StatusDesc = fmt.Sprintf("superseded by event %s", supersededBy)
+				break // releasing the deferred artifact would roll the app back
+			}
+		}
+		if err == nil {
+			results, err = processReleaseEvent(
+				store,
+				repoCache,
+				token,
+				event,
+				perf,
+				gitUser,
+				gitHost,
+				envConfigs,
+				schemaValidator,
+				policyEngines,
+			)
+		}
 	case model.RollbackRequestedEvent:
 		results, err = processRollbackEvent(
 			repoCache,
@@ -188,7 +221,10 @@ func processEvent(
 			gitUser,
 			gitHost,
 		)
-	case model.BranchDeletedEvent:
+	case model.BranchDeletedEvent,
+		model.PRClosedEvent,
+		model.PRMergedEvent,
+		model.TTLExpiredEvent:
 		results, err = processBranchDeletedEvent(
 			repoCache,
 			event,
@@ -238,6 +274,19 @@ func processEvent(
 		saveAndBroadcastGitopsCommit(result.GitopsRef, env, event, store, clientHub)
 	}
 
+	// sleeping previews are woken up by the next deploy
+	if event.Type == model.ArtifactCreatedEvent ||
+		event.Type == model.ReleaseRequestedEvent {
+		for _, result := range results {
+			if result.Status != model.Success ||
+				result.Manifest.Idle == nil ||
+				result.Manifest.Preview == nil || !*result.Manifest.Preview {
+				continue
+			}
+			agentHub.WakeUpPreview(result.Manifest.Env, result.Manifest.Namespace, result.Manifest.App)
+		}
+	}
+
 	// comment on github PRs
 	if event.Type == model.ArtifactCreatedEvent ||
 		event.Type == model.ReleaseRequestedEvent {
@@ -265,7 +314,10 @@ func processEvent(
 				fallthrough
 			case model.ReleaseRequestedEvent:
 				notificationsManager.Broadcast(notifications.DeployMessageFromGitOpsResult(result))
-			case model.BranchDeletedEvent:
+			case model.BranchDeletedEvent,
+				model.PRClosedEvent,
+				model.PRMergedEvent,
+				model.TTLExpiredEvent:
 				notificationsManager.Broadcast(notifications.MessageFromDeleteEvent(result))
 			}
 		}
@@ -279,7 +331,7 @@ func commentOnPR(result model.Result, dynamicConfig *dynamicconfig.DynamicConfig
 	gitSha := vars["SHA"]
 
 	if result.Status == model.Failure {
-		err := comment(dynamicConfig, token, gitRepo, branch, fmt.Sprintf(customScm.BodyFailed, result.Manifest.App, gitSha))
+		err := customScm.CommentOnPR(dynamicConfig, token, gitRepo, branch, fmt.Sprintf(customScm.BodyFailed, result.Manifest.App, gitSha))
 		if err != nil {
 			logrus.Warnf("could not update comment %v", err)
 		}
@@ -291,7 +343,7 @@ func commentOnPR(result model.Result, dynamicConfig *dynamicconfig.DynamicConfig
 				hostString = host.(string)
 			}
 		}
-		err := comment(dynamicConfig, token, gitRepo, branch, fmt.Sprintf(customScm.BodyReady, result.Manifest.App, gitSha, hostString, hostString))
+		err := customScm.CommentOnPR(dynamicConfig, token, gitRepo, branch, fmt.Sprintf(customScm.BodyReady, result.Manifest.App, gitSha, hostString, hostString))
 		if err != nil {
 			logrus.Warnf("could not update comment %v", err)
 		}
@@ -317,6 +369,9 @@ func processBranchDeletedEvent(
 		if manifest.Cleanup == nil {
 			continue
 		}
+		if !cleanupEventMatch(event.Type, manifest.Cleanup.Event) {
+			continue
+		}
 
 		envFromStore, err := store.GetEnvironment(manifest.Env)
 		if err != nil {
@@ -376,6 +431,8 @@ func processReleaseEvent(
 	gitUser *model.User,
 	gitHost string,
 	envConfigs map[string]*dx.StackConfig,
+	schemaValidator *dx.SchemaValidator,
+	policyEngines *envPolicyEngines,
 ) ([]model.Result, error) {
 	var deployResults []model.Result
 	var releaseRequest dx.ReleaseRequest
@@ -392,6 +449,19 @@ func processReleaseEvent(
 	if err != nil {
 		return deployResults, fmt.Errorf("cannot parse artifact %s", err.Error())
 	}
+	sensitiveVars, err := model.ToSensitiveVars(artifactEvent)
+	if err != nil {
+		return deployResults, err
+	}
+	// the signature and the templates need the sensitive vars, results keep the masked artifact
+	unmaskedArtifact := artifact.WithSensitiveVars(sensitiveVars)
+	if unmaskedArtifact.HasMaskedVars() {
+		return deployResults, fmt.Errorf("the sensitive vars of artifact %s are lost, it cannot be released", artifact.ID)
+	}
+	canonicalArtifact, err := unmaskedArtifact.CanonicalJSON()
+	if err != nil {
+		return deployResults, fmt.Errorf("cannot serialize artifact %s", err.Error())
+	}
 
 	manifests, err := artifact.CueEnvironmentsToManifests()
 	if err != nil {
@@ -399,6 +469,12 @@ func processReleaseEvent(
 	}
 	artifact.Environments = append(artifact.Environments, manifests...)
 
+	manifests, err = artifact.JsonnetEnvironmentsToManifests()
+	if err != nil {
+		return deployResults, err
+	}
+	artifact.Environments = append(artifact.Environments, manifests...)
+
 	var repoVars map[string]string
 	err = gitopsRepoCache.PerformAction(artifact.Version.RepositoryName, func(repo *git.Repository) error {
 		var innerErr error
@@ -449,13 +525,48 @@ func processReleaseEvent(
 			continue
 		}
 
-		vars := artifact.CollectVariables()
+		envValues, err := loadEnvValues(appsRepo, filepath.Dir(varsPath))
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		err = verifyArtifactSignature(appsRepo, filepath.Dir(varsPath), artifact, canonicalArtifact)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		// a deploy fails if the policies of its env can't be loaded, skipping them would let denied changes through
+		policyEngine, err := policyEngines.engine(manifest.Env)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		artifactPolicyViolations, err := checkArtifactPolicies(policyEngine, manifest, artifact)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResult.PolicyViolations = artifactPolicyViolations
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		vars := unmaskedArtifact.CollectVariables()
 		vars["APP"] = releaseRequest.App
 		for k, v := range envVars {
 			vars[k] = v
 		}
 
 		manifest.PrepPreview(ingressHost(envConfigs[manifest.Env]))
+		defaultedValues, overriddenValues := manifest.ApplyEnvValues(envValues)
 		err = manifest.ResolveVars(vars)
 		if err != nil {
 			deployResult.Status = model.Failure
@@ -469,20 +580,35 @@ func processReleaseEvent(
 			continue
 		}
 
+		// policy deploys never downgrade an env, eg. when tags are pushed out of order. Users can release any version
+		if releaseRequest.TriggeredBy == "policy" {
+			err = preventSemverDowngrade(appsRepo, envFromStore.RepoPerEnv, manifest, artifact.Version.Tag)
+			if err != nil {
+				deployResult.Status = model.Failure
+				deployResult.StatusDesc = err.Error()
+				deployResults = append(deployResults, deployResult)
+				continue
+			}
+		}
+
 		releaseMeta := &dx.Release{
 			App:         manifest.App,
 			Env:         manifest.Env,
 			ArtifactID:  artifact.ID,
 			Version:     &artifact.Version,
 			TriggeredBy: releaseRequest.TriggeredBy,
+
+			DefaultedValues:  defaultedValues,
+			OverriddenValues: overriddenValues,
 		}
 
-		sha, err := cloneTemplateWriteAndPush(
+		sha, policyViolations, err := cloneTemplateWriteAndPush(
 			appsRepo,
 			repoTmpPath,
 			gitopsRepoCache,
 			nonImpersonatedToken,
 			manifest,
+			manifest.HasDependents(artifact.Environments),
 			releaseMeta,
 			perf,
 			store,
@@ -491,7 +617,10 @@ func processReleaseEvent(
 			gitUser,
 			gitHost,
 			envConfigs[manifest.Env],
+			schemaValidator,
+			policyEngine,
 		)
+		deployResult.PolicyViolations = append(artifactPolicyViolations, policyViolations...)
 		if err != nil {
 			deployResult.Status = model.Failure
 			deployResult.StatusDesc = err.Error()
@@ -502,14 +631,14 @@ func processReleaseEvent(
 		deployResult.GitopsRef = sha
 		deployResults = append(deployResults, deployResult)
 
-		event.Results = deployResults
+		event.Results = redactResults(deployResults, sensitiveVars)
 		err = updateEvent(store, event)
 		if err != nil {
 			logrus.Warnf("could not update event status %v", err)
 		}
 	}
 
-	return deployResults, nil
+	return redactResults(deployResults, sensitiveVars), nil
 }
 
 func processRollbackEvent(
@@ -622,12 +751,28 @@ func processArtifactEvent(
 	gitHost string,
 	agentHub *streaming.AgentHub,
 	envConfigs map[string]*dx.StackConfig,
+	schemaValidator *dx.SchemaValidator,
+	policyEngines *envPolicyEngines,
 ) ([]model.Result, error) {
 	var deployResults []model.Result
 	artifact, err := model.ToArtifact(event)
 	if err != nil {
 		return deployResults, fmt.Errorf("cannot parse artifact %s", err.Error())
 	}
+	sensitiveVars, err := model.ToSensitiveVars(event)
+	if err != nil {
+		return deployResults, err
+	}
+	// the signature and the templates need the sensitive vars, results keep the masked artifact
+	unmaskedArtifact := artifact.WithSensitiveVars(sensitiveVars)
+	if unmaskedArtifact.HasMaskedVars() {
+		return deployResults, fmt.Errorf("the sensitive vars of artifact %s are lost, it cannot be released", artifact.ID)
+	}
+
+	canonicalArtifact, err := unmaskedArtifact.CanonicalJSON()
+	if err != nil {
+		return deployResults, fmt.Errorf("cannot serialize artifact %s", err.Error())
+	}
 
 	if artifact.HasCleanupPolicy() {
 		keepReposWithCleanupPolicyUpToDate(dao, artifact)
@@ -639,6 +784,12 @@ func processArtifactEvent(
 	}
 	artifact.Environments = append(artifact.Environments, manifests...)
 
+	manifests, err = artifact.JsonnetEnvironmentsToManifests()
+	if err != nil {
+		return deployResults, err
+	}
+	artifact.Environments = append(artifact.Environments, manifests...)
+
 	var repoVars map[string]string
 	err = gitRepoCache.PerformAction(artifact.Version.RepositoryName, func(repo *git.Repository) error {
 		var innerErr error
@@ -649,7 +800,14 @@ func processArtifactEvent(
 		return deployResults, fmt.Errorf("cannot load vars %s", err.Error())
 	}
 
-	for _, manifest := range artifact.Environments {
+	environments, err := dx.OrderByDependencies(artifact.Environments)
+	if err != nil {
+		return deployResults, err
+	}
+
+	// apps released in this event to envs without a Kustomization per app, where Flux can't order them
+	released := map[string]*dx.DependencyRelease{}
+	for _, manifest := range environments {
 		manifest.PrepPreview(ingressHost(envConfigs[manifest.Env]))
 		if !deployTrigger(artifact, manifest.Deploy) {
 			continue
@@ -673,6 +831,23 @@ func processArtifactEvent(
 			continue
 		}
 
+		if waitFor := dependencyReleases(manifest, released); !envFromStore.KustomizationPerApp && len(waitFor) > 0 {
+			// the worker doesn't wait for the dependencies, a release request is processed once they are healthy
+			deferredRelease, err := deferRelease(dao, artifact, manifest, waitFor)
+			if err != nil {
+				deployResult.Status = model.Failure
+				deployResult.StatusDesc = err.Error()
+				deployResults = append(deployResults, deployResult)
+				continue
+			}
+			deployResult.Status = model.Pending
+			deployResult.StatusDesc = fmt.Sprintf("waiting for %s to be healthy", strings.Join(manifest.DependsOn, ", "))
+			deployResult.TriggeredDeployRequestID = deferredRelease.EventID
+			deployResults = append(deployResults, deployResult)
+			released[releasedAppKey(manifest.Env, manifest.Namespace, manifest.App)] = deferredRelease
+			continue
+		}
+
 		appsRepo, repoTmpPath, err := gitRepoCache.InstanceForWrite(envFromStore.AppsRepo)
 		defer nativeGit.TmpFsCleanup(repoTmpPath)
 		if err != nil {
@@ -695,11 +870,46 @@ func processArtifactEvent(
 			continue
 		}
 
-		vars := artifact.CollectVariables()
+		envValues, err := loadEnvValues(appsRepo, filepath.Dir(varsPath))
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		err = verifyArtifactSignature(appsRepo, filepath.Dir(varsPath), artifact, canonicalArtifact)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		// a deploy fails if the policies of its env can't be loaded, skipping them would let denied changes through
+		policyEngine, err := policyEngines.engine(manifest.Env)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		artifactPolicyViolations, err := checkArtifactPolicies(policyEngine, manifest, artifact)
+		if err != nil {
+			deployResult.Status = model.Failure
+			deployResult.StatusDesc = err.Error()
+			deployResult.PolicyViolations = artifactPolicyViolations
+			deployResults = append(deployResults, deployResult)
+			continue
+		}
+
+		vars := unmaskedArtifact.CollectVariables()
 		vars["APP"] = manifest.App
 		for k, v := range envVars {
 			vars[k] = v
 		}
+		defaultedValues, overriddenValues := manifest.ApplyEnvValues(envValues)
 
 		strategy := gitops.ExtractImageStrategy(manifest)
 		if strategy == "buildpacks" || strategy == "dockerfile" { // image build
@@ -734,19 +944,33 @@ func processArtifactEvent(
 				deployResults = append(deployResults, deployResult)
 				continue
 			}
+
+			// policy deploys never downgrade an env, eg. when tags are pushed out of order
+			err = preventSemverDowngrade(appsRepo, envFromStore.RepoPerEnv, manifest, artifact.Version.Tag)
+			if err != nil {
+				deployResult.Status = model.Failure
+				deployResult.StatusDesc = err.Error()
+				deployResults = append(deployResults, deployResult)
+				continue
+			}
+
 			releaseMeta := &dx.Release{
 				App:         manifest.App,
 				Env:         manifest.Env,
 				ArtifactID:  artifact.ID,
 				Version:     &artifact.Version,
 				TriggeredBy: "policy",
+
+				DefaultedValues:  defaultedValues,
+				OverriddenValues: overriddenValues,
 			}
-			sha, err := cloneTemplateWriteAndPush(
+			sha, policyViolations, err := cloneTemplateWriteAndPush(
 				appsRepo,
 				repoTmpPath,
 				gitRepoCache,
 				githubChartAccessToken,
 				manifest,
+				manifest.HasDependents(artifact.Environments),
 				releaseMeta,
 				perf,
 				dao,
@@ -755,7 +979,10 @@ func processArtifactEvent(
 				gitUser,
 				gitHost,
 				envConfigs[manifest.Env],
+				schemaValidator,
+				policyEngine,
 			)
+			deployResult.PolicyViolations = append(artifactPolicyViolations, policyViolations...)
 			if err != nil {
 				deployResult.Status = model.Failure
 				deployResult.StatusDesc = err.Error()
@@ -763,58 +990,201 @@ func processArtifactEvent(
 			deployResult.GitopsRepo = envFromStore.AppsRepo
 			deployResult.GitopsRef = sha
 			deployResults = append(deployResults, deployResult)
+			if sha != "" && !envFromStore.KustomizationPerApp {
+				deadline, err := healthDeadline(manifest, time.Now().Unix())
+				if err != nil {
+					logrus.Warnf("cannot order the dependents of %s: %s", manifest.App, err)
+				} else {
+					released[releasedAppKey(manifest.Env, manifest.Namespace, manifest.App)] = &dx.DependencyRelease{
+						EventID:   event.ID,
+						Env:       manifest.Env,
+						Namespace: manifest.Namespace,
+						App:       manifest.App,
+						Deadline:  deadline,
+					}
+				}
+			}
 		}
 	}
 
-	return deployResults, nil
+	return redactResults(deployResults, sensitiveVars), nil
 }
 
-func comment(
-	dynamicConfig *dynamicconfig.DynamicConfig,
-	token string,
-	gitRepo, branch string,
-	commentBody string,
-) error {
-	gitSvc := customScm.NewGitService(dynamicConfig)
+func releasedAppKey(env, namespace, app string) string {
+	return env + "/" + namespace + "/" + app
+}
+
+// dependencyReleases returns the releases of the dependencies that are released in the same event
+func dependencyReleases(manifest *dx.Manifest, released map[string]*dx.DependencyRelease) []*dx.DependencyRelease {
+	var waitFor []*dx.DependencyRelease
+	for _, dependency := range manifest.DependsOn {
+		namespace, app := dx.ParseDependency(dependency, manifest.Namespace)
+		if dependencyRelease, ok := released[releasedAppKey(manifest.Env, namespace, app)]; ok {
+			waitFor = append(waitFor, dependencyRelease)
+		}
+	}
+	return waitFor
+}
 
-	goScm := genericScm.NewGoScmHelper(dynamicConfig, nil)
-	openpullrequests, err := goScm.ListOpenPRs(token, gitRepo)
+// healthDeadline is the unix timestamp until an app released at the given time has to become healthy
+func healthDeadline(manifest *dx.Manifest, since int64) (int64, error) {
+	timeout, err := manifest.HealthCheckTimeout()
 	if err != nil {
-		return fmt.Errorf("cannot list open pullrequests: %s", err)
+		return 0, err
 	}
+	return since + int64(timeout.Seconds()), nil
+}
 
-	var pullNumber int
-	for _, pr := range openpullrequests {
-		if pr.Source == branch {
-			pullNumber = pr.Number
+// deferRelease creates a release request for the app that is processed once its dependencies are healthy
+func deferRelease(
+	dao *store.Store,
+	artifact *dx.Artifact,
+	manifest *dx.Manifest,
+	waitFor []*dx.DependencyRelease,
+) (*dx.DependencyRelease, error) {
+	var since int64
+	for _, dependency := range waitFor {
+		if dependency.Deadline > since {
+			since = dependency.Deadline
 		}
 	}
-	if pullNumber == 0 {
-		return nil
+	deadline, err := healthDeadline(manifest, since)
+	if err != nil {
+		return nil, err
 	}
 
-	comments, err := gitSvc.Comments(token, gitRepo, pullNumber)
+	releaseRequestStr, err := json.Marshal(dx.ReleaseRequest{
+		Env:         manifest.Env,
+		App:         manifest.App,
+		ArtifactID:  artifact.ID,
+		TriggeredBy: "policy",
+		WaitFor:     waitFor,
+	})
 	if err != nil {
-		return fmt.Errorf("cannot list comments: %s", err)
+		return nil, err
 	}
 
-	for _, c := range comments {
-		if strings.Contains(*c.Body, "Deploy Preview for") {
-			return gitSvc.UpdateComment(
-				token,
-				gitRepo,
-				*c.ID,
-				commentBody,
-			)
+	releaseEvent, err := dao.CreateEvent(&model.Event{
+		Type:       model.ReleaseRequestedEvent,
+		Blob:       string(releaseRequestStr),
+		Repository: artifact.Version.RepositoryName,
+		SHA:        artifact.Version.SHA,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot defer release: %s", err)
+	}
+
+	return &dx.DependencyRelease{
+		EventID:   releaseEvent.ID,
+		Env:       manifest.Env,
+		Namespace: manifest.Namespace,
+		App:       manifest.App,
+		Deadline:  deadline,
+	}, nil
+}
+
+// dependenciesReady tells if the dependencies of a release request are healthy.
+// It returns an error if a dependency failed, or did not become healthy in time
+func dependenciesReady(dao *store.Store, event *model.Event) (bool, error) {
+	var releaseRequest dx.ReleaseRequest
+	err := json.Unmarshal([]byte(event.Blob), &releaseRequest)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse release request with id: %s", event.ID)
+	}
+
+	for _, dependency := range releaseRequest.WaitFor {
+		healthy, err := dependencyHealthy(dao, dependency)
+		if err != nil {
+			return false, fmt.Errorf("dependency %s/%s is not healthy: %s", dependency.Namespace, dependency.App, err)
+		}
+		if !healthy {
+			if time.Now().Unix() > dependency.Deadline {
+				return false, fmt.Errorf("dependency %s/%s did not become healthy in time", dependency.Namespace, dependency.App)
+			}
+			return false, nil
 		}
 	}
+	return true, nil
+}
 
-	return gitSvc.CreateComment(
-		token,
-		gitRepo,
-		pullNumber,
-		commentBody,
-	)
+// deferredReleaseSupersededBy returns the ID of the event that released, or is about to release, the app in the env
+// since the release was deferred. It returns an empty string if there is none, or the release was not deferred
+func deferredReleaseSupersededBy(dao *store.Store, event *model.Event) (string, error) {
+	var releaseRequest dx.ReleaseRequest
+	err := json.Unmarshal([]byte(event.Blob), &releaseRequest)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse release request with id: %s", event.ID)
+	}
+	if len(releaseRequest.WaitFor) == 0 {
+		return "", nil
+	}
+
+	newerEvents, err := dao.ReleaseEventsCreatedAfter(event)
+	if err != nil {
+		return "", fmt.Errorf("cannot get newer events: %s", err)
+	}
+	for _, newerEvent := range newerEvents {
+		if newerEvent.Type == model.ReleaseRequestedEvent && newerEvent.Status == model.StatusNew {
+			var newerRequest dx.ReleaseRequest
+			err := json.Unmarshal([]byte(newerEvent.Blob), &newerRequest)
+			if err == nil && newerRequest.Env == releaseRequest.Env && newerRequest.App == releaseRequest.App {
+				return newerEvent.ID, nil
+			}
+			continue
+		}
+
+		for _, result := range newerEvent.Results {
+			if result.GitopsRef == "" {
+				continue
+			}
+			if result.Manifest != nil && result.Manifest.Env == releaseRequest.Env && result.Manifest.App == releaseRequest.App {
+				return newerEvent.ID, nil
+			}
+			if result.RollbackRequest != nil && result.RollbackRequest.Env == releaseRequest.Env && result.RollbackRequest.App == releaseRequest.App {
+				return newerEvent.ID, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func dependencyHealthy(dao *store.Store, dependency *dx.DependencyRelease) (bool, error) {
+	dependencyEvent, err := dao.Event(dependency.EventID)
+	if err != nil {
+		return false, fmt.Errorf("cannot get release event: %s", err)
+	}
+	if dependencyEvent.Status == model.StatusNew {
+		return false, nil
+	}
+
+	for _, result := range dependencyEvent.Results {
+		if result.Manifest == nil ||
+			result.Manifest.Env != dependency.Env ||
+			result.Manifest.Namespace != dependency.Namespace ||
+			result.Manifest.App != dependency.App {
+			continue
+		}
+		if result.GitopsRef == "" {
+			return false, fmt.Errorf("not released: %s", result.StatusDesc)
+		}
+
+		gitopsCommit, err := dao.GitopsCommit(result.GitopsRef)
+		if err != nil {
+			return false, fmt.Errorf("could not get gitops commit: %s", err)
+		}
+		if gitopsCommit == nil {
+			return false, nil
+		}
+		// the Kustomizations that apply the dependency wait for it to become healthy, so reconciled means healthy
+		switch gitopsCommit.Status {
+		case model.ReconciliationSucceeded:
+			return true, nil
+		case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+			return false, fmt.Errorf("%s: %s", gitopsCommit.Status, gitopsCommit.StatusDesc)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("not released: %s", dependencyEvent.StatusDesc)
 }
 
 func loadVars(repo *git.Repository, varsPath string) (map[string]string, error) {
@@ -826,6 +1196,50 @@ func loadVars(repo *git.Repository, varsPath string) (map[string]string, error)
 	return godotenv.Unmarshal(envVarsString)
 }
 
+// loadEnvValues loads the value defaults and overrides of the environment from its .gimlet folder
+func loadEnvValues(repo *git.Repository, gimletPath string) (*dx.EnvValues, error) {
+	defaultsString, err := nativeGit.Content(repo, filepath.Join(gimletPath, dx.EnvDefaultsFile))
+	if err != nil {
+		return nil, err
+	}
+	overridesString, err := nativeGit.Content(repo, filepath.Join(gimletPath, dx.EnvOverridesFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return dx.ParseEnvValues(defaultsString, overridesString)
+}
+
+// verifyArtifactSignature checks the artifact signature against the signing policy of the environment
+func verifyArtifactSignature(repo *git.Repository, gimletPath string, artifact *dx.Artifact, canonicalArtifact []byte) error {
+	policyString, err := nativeGit.Content(repo, filepath.Join(gimletPath, dx.EnvSigningFile))
+	if err != nil {
+		return err
+	}
+	policy, err := dx.ParseSigningPolicy(policyString)
+	if err != nil {
+		return err
+	}
+
+	keyName, err := policy.Verify(artifact, canonicalArtifact)
+	if err != nil {
+		return err
+	}
+	if keyName != "" {
+		logrus.Infof("artifact %s is signed with %s", artifact.ID, keyName)
+	}
+	return nil
+}
+
+// checkArtifactPolicies evaluates the artifact policies of the environment, eg.: a required provenance attestation
+func checkArtifactPolicies(policyEngine *dx.PolicyEngine, manifest *dx.Manifest, artifact *dx.Artifact) ([]dx.PolicyViolation, error) {
+	violations, err := policyEngine.EvaluateArtifact(manifest, artifact)
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate policies: %s", err)
+	}
+	return violations, dx.DeniedPolicyViolations(violations)
+}
+
 func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact) {
 	reposWithCleanupPolicy, err := dao.ReposWithCleanupPolicy()
 	if err != nil && err != sql.ErrNoRows {
@@ -854,6 +1268,7 @@ func cloneTemplateWriteAndPush(
 	gitopsRepoCache *nativeGit.RepoCache,
 	nonImpersonatedToken string,
 	manifest *dx.Manifest,
+	hasDependents bool,
 	releaseMeta *dx.Release,
 	perf *prometheus.HistogramVec,
 	store *store.Store,
@@ -862,12 +1277,14 @@ func cloneTemplateWriteAndPush(
 	gitUser *model.User,
 	gitHost string,
 	stackConfig *dx.StackConfig,
-) (string, error) {
+	schemaValidator *dx.SchemaValidator,
+	policyEngine *dx.PolicyEngine,
+) (string, []dx.PolicyViolation, error) {
 	t0 := time.Now()
 
 	environment, err := store.GetEnvironment(manifest.Env)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	var kustomizationManifest *manifestgen.Manifest
@@ -877,9 +1294,10 @@ func cloneTemplateWriteAndPush(
 			environment.AppsRepo,
 			repoTmpPath,
 			environment.RepoPerEnv,
+			hasDependents,
 		)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 	}
 
@@ -889,22 +1307,22 @@ func cloneTemplateWriteAndPush(
 		environment.RepoPerEnv,
 	)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	owner, repository := server.ParseRepo(releaseMeta.Version.RepositoryName)
 	perRepoConfigMapName := fmt.Sprintf("%s-%s", strings.ToLower(owner), strings.ToLower(repository))
 	perRepoConfigMapManifest, err := sync.GenerateConfigMap(perRepoConfigMapName, manifest.Namespace, repoVars)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	perEnvConfigMapManifest, err := sync.GenerateConfigMap(strings.ToLower(environment.Name), manifest.Namespace, envVars)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	sha, err := gitopsTemplateAndWrite(
+	sha, policyViolations, err := gitopsTemplateAndWrite(
 		repo,
 		manifest,
 		releaseMeta,
@@ -914,9 +1332,11 @@ func cloneTemplateWriteAndPush(
 		imagepullSecretManifest,
 		perRepoConfigMapManifest,
 		perEnvConfigMapManifest,
+		schemaValidator,
+		policyEngine,
 	)
 	if err != nil {
-		return "", err
+		return "", policyViolations, err
 	}
 
 	if sha != "" { // if there is a change to push
@@ -937,13 +1357,13 @@ func cloneTemplateWriteAndPush(
 		backoffStrategy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)
 		err := backoff.Retry(operation, backoffStrategy)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		gitopsRepoCache.Invalidate(environment.AppsRepo)
 	}
 
 	perf.WithLabelValues("gitops_cloneTemplateWriteAndPush").Observe(float64(time.Since(t0).Seconds()))
-	return sha, nil
+	return sha, policyViolations, nil
 }
 
 func injectGimletCTA(manifest *dx.Manifest) {
@@ -1087,6 +1507,35 @@ func revertTo(
 	return nil
 }
 
+// redactResults masks the values of the sensitive vars in the results, as the resolved manifests and errors may contain them
+func redactResults(results []model.Result, sensitiveVars *dx.SensitiveVars) []model.Result {
+	if sensitiveVars == nil {
+		return results
+	}
+
+	redacted := []model.Result{}
+	for _, result := range results {
+		result.StatusDesc = sensitiveVars.Redact(result.StatusDesc)
+		if result.Manifest != nil {
+			manifest := &dx.Manifest{}
+			manifestJson, err := json.Marshal(result.Manifest)
+			if err == nil {
+				err = json.Unmarshal([]byte(sensitiveVars.Redact(string(manifestJson))), manifest)
+			}
+			if err != nil { // better to lose the manifest details than to leak them
+				manifest = &dx.Manifest{
+					App:       result.Manifest.App,
+					Env:       result.Manifest.Env,
+					Namespace: result.Manifest.Namespace,
+				}
+			}
+			result.Manifest = manifest
+		}
+		redacted = append(redacted, result)
+	}
+	return redacted
+}
+
 func updateEvent(store *store.Store, event *model.Event) error {
 	resultsString, err := json.Marshal(event.Results)
 	if err != nil {
@@ -1105,15 +1554,21 @@ func gitopsTemplateAndWrite(
 	imagepullsecretManifest *manifestgen.Manifest,
 	perRepoConfigMapManifest *manifestgen.Manifest,
 	perEnvConfigMapManifest *manifestgen.Manifest,
-) (string, error) {
+	schemaValidator *dx.SchemaValidator,
+	policyEngine *dx.PolicyEngine,
+) (string, []dx.PolicyViolation, error) {
 	if strings.HasPrefix(manifest.Chart.Name, "git@") {
-		return "", fmt.Errorf("only HTTPS git repo urls supported in GimletD for git based charts")
+		return "", nil, fmt.Errorf("only HTTPS git repo urls supported in GimletD for git based charts")
+	}
+	// local components would read files of the dashboard, remote ones would make it fetch arbitrary urls
+	if manifest.Kustomize != nil && len(manifest.Kustomize.Components) > 0 {
+		return "", nil, fmt.Errorf("Kustomize components are not supported in GimletD, they are only resolved by the gimlet CLI")
 	}
 	if strings.Contains(manifest.Chart.Name, ".git") {
 		t0 := time.Now().UnixNano()
 		tmpChartDir, err := dx.CloneChartFromRepo(manifest, tokenForChartClone)
 		if err != nil {
-			return "", fmt.Errorf("cannot fetch chart from git %s", err.Error())
+			return "", nil, fmt.Errorf("cannot fetch chart from git %s", err.Error())
 		}
 		logrus.Infof("Cloning chart took %d", (time.Now().UnixNano()-t0)/1000/1000)
 		manifest.Chart.Name = tmpChartDir
@@ -1121,12 +1576,28 @@ func gitopsTemplateAndWrite(
 	}
 
 	t0 := time.Now().UnixNano()
-	templatedManifests, err := manifest.Render()
+	templatedManifests, err := manifest.Render(release)
 	if err != nil {
-		return "", fmt.Errorf("cannot run render template %s", err.Error())
+		return "", nil, fmt.Errorf("cannot run render template %s", err.Error())
 	}
 	logrus.Infof("Helm template took %d", (time.Now().UnixNano()-t0)/1000/1000)
 
+	if schemaValidator != nil {
+		err = schemaValidator.Validate(templatedManifests)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	policyViolations, err := policyEngine.Evaluate(manifest, templatedManifests)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot evaluate policies: %s", err)
+	}
+	err = dx.DeniedPolicyViolations(policyViolations)
+	if err != nil {
+		return "", policyViolations, err
+	}
+
 	helmGeneratedFiles := dx.SplitHelmOutput(map[string]string{"manifest.yaml": templatedManifests})
 
 	envReleaseJsonPath := manifest.Env
@@ -1159,7 +1630,7 @@ func gitopsTemplateAndWrite(
 
 	releaseString, err := json.Marshal(release)
 	if err != nil {
-		return "", fmt.Errorf("cannot marshal release meta data %s", err.Error())
+		return "", nil, fmt.Errorf("cannot marshal release meta data %s", err.Error())
 	}
 	files[filepath.Join(appFolderPath, "release.json")] = string(releaseString)
 	files[filepath.Join(envReleaseJsonPath, "release.json")] = string(releaseString)
@@ -1171,10 +1642,66 @@ func gitopsTemplateAndWrite(
 		fmt.Sprintf("[Gimlet] %s/%s automated deploy", manifest.Env, manifest.App),
 	)
 	if err != nil {
-		return "", fmt.Errorf("cannot write to git: %s", err.Error())
+		return "", policyViolations, fmt.Errorf("cannot write to git: %s", err.Error())
 	}
 
-	return sha, nil
+	return sha, policyViolations, nil
+}
+
+// releasedTag returns the git tag of the current release in the app folder, if there is any
+func releasedTag(repo *git.Repository, appFolderPath string) (string, error) {
+	releaseString, err := nativeGit.Content(repo, filepath.Join(appFolderPath, "release.json"))
+	if err != nil {
+		return "", fmt.Errorf("cannot read release meta data %s", err.Error())
+	}
+	if releaseString == "" {
+		return "", nil
+	}
+
+	var release dx.Release
+	err = json.Unmarshal([]byte(releaseString), &release)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse release meta data %s", err.Error())
+	}
+	if release.Version == nil {
+		return "", nil
+	}
+	return release.Version.Tag, nil
+}
+
+// preventSemverDowngrade returns an error if the manifest has a semver deploy policy,
+// and the tag is older than the one released to the app folder of the resolved manifest
+func preventSemverDowngrade(repo *git.Repository, repoPerEnv bool, manifest *dx.Manifest, tag string) error {
+	if manifest.Deploy == nil || !manifest.Deploy.Tag.IsSemver() {
+		return nil
+	}
+
+	appFolderPath := filepath.Join(manifest.Env, manifest.App)
+	if repoPerEnv {
+		appFolderPath = manifest.App
+	}
+	released, err := releasedTag(repo, appFolderPath)
+	if err != nil {
+		return err
+	}
+	if semverDowngrade(tag, released) {
+		return fmt.Errorf("%s is not deployed to %s, %s is already released", tag, manifest.Env, released)
+	}
+	return nil
+}
+
+// semverDowngrade tells if the tag is an older semantic version than the released one.
+// Tags pushed out of order must not roll back an environment.
+func semverDowngrade(tag string, releasedTag string) bool {
+	version, err := semver.ParseTolerant(tag)
+	if err != nil {
+		return false
+	}
+	released, err := semver.ParseTolerant(releasedTag)
+	if err != nil {
+		return false
+	}
+	return version.LT(released)
 }
 
 func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
@@ -1184,7 +1711,7 @@ func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
 
 	if deployPolicy.Branch == "" &&
 		deployPolicy.Event == nil &&
-		deployPolicy.Tag == "" &&
+		deployPolicy.Tag.IsZero() &&
 		len(deployPolicy.CommitMessagePatterns) == 0 {
 		return false
 	}
@@ -1194,19 +1721,23 @@ func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
 		return false
 	}
 
-	if deployPolicy.Tag != "" &&
+	if !deployPolicy.Tag.IsZero() &&
 		(deployPolicy.Event == nil || *deployPolicy.Event != *dx.TagPtr()) {
 		return false
 	}
 
-	if deployPolicy.Tag != "" {
+	if deployPolicy.Tag.IsSemver() {
+		if !deployPolicy.Tag.SemverMatch(artifactToCheck.Version.Tag) {
+			return false
+		}
+	} else if !deployPolicy.Tag.IsZero() {
 		negate := false
 		tag := deployPolicy.Branch
-		if strings.HasPrefix(deployPolicy.Tag, "!") {
+		if strings.HasPrefix(deployPolicy.Tag.Pattern, "!") {
 			negate = true
-			tag = deployPolicy.Tag[1:]
+			tag = deployPolicy.Tag.Pattern[1:]
 		}
-		g := glob.MustCompile(deployPolicy.Tag)
+		g := glob.MustCompile(deployPolicy.Tag.Pattern)
 
 		exactMatch := tag == artifactToCheck.Version.Tag
 		patternMatch := g.Match(artifactToCheck.Version.Tag)
@@ -1317,6 +1848,22 @@ func cleanupTrigger(branch string, cleanupPolicy *dx.Cleanup) bool {
 	return false
 }
 
+// cleanupEventMatch tells if a cleanup policy is triggered by the event type.
+// Merged pull requests are closed too, so they trigger prClosed policies as well.
+func cleanupEventMatch(eventType string, cleanupEvent dx.CleanupEvent) bool {
+	switch eventType {
+	case model.BranchDeletedEvent:
+		return cleanupEvent == dx.BranchDeleted
+	case model.PRClosedEvent:
+		return cleanupEvent == dx.PRClosed
+	case model.PRMergedEvent:
+		return cleanupEvent == dx.PRClosed || cleanupEvent == dx.PRMerged
+	case model.TTLExpiredEvent:
+		return cleanupEvent == dx.TTL
+	}
+	return false
+}
+
 func saveAndBroadcastGitopsCommit(
 	sha string,
 	env string,
@@ -1349,6 +1896,7 @@ func kustomizationTemplate(
 	repoName string,
 	repoPath string,
 	repoPerEnv bool,
+	hasDependents bool,
 ) (*manifestgen.Manifest, error) {
 	owner, repository := server.ParseRepo(repoName)
 	kustomizationName := uniqueKustomizationName(repoPerEnv, owner, repository, manifest.Env, manifest.Namespace, manifest.App)
@@ -1363,12 +1911,69 @@ func kustomizationTemplate(
 		sourceName = bootstrap.UniqueGitopsRepoName(repoPerEnv, owner, repoName, manifest.Env)
 	}
 
+	sopsDecryptionSecret := ""
+	envPath := manifest.Env
+	if repoPerEnv {
+		envPath = ""
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, envPath, bootstrap.SopsConfigFile)); err == nil {
+		sopsDecryptionSecret = dx.SopsAgeSecret
+	}
+
+	var dependsOn []string
+	for _, dependency := range manifest.DependsOn {
+		namespace, app := dx.ParseDependency(dependency, manifest.Namespace)
+		dependsOn = append(dependsOn, uniqueKustomizationName(repoPerEnv, owner, repository, manifest.Env, namespace, app))
+	}
+
+	// Flux only waits for the app to become healthy if it is part of a dependsOn chain
+	var healthTimeout time.Duration
+	if len(dependsOn) > 0 || manifest.HealthTimeout != "" || hasDependents ||
+		hasDependentKustomizations(filepath.Join(repoPath, fluxPath), kustomizationName) {
+		var err error
+		healthTimeout, err = manifest.HealthCheckTimeout()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return sync.GenerateKustomizationForApp(
 		manifest.App,
 		manifest.Env,
 		kustomizationName,
 		sourceName,
-		repoPerEnv)
+		repoPerEnv,
+		sopsDecryptionSecret,
+		dependsOn,
+		healthTimeout)
+}
+
+// hasDependentKustomizations tells if a Kustomization in the flux folder of the gitops repo depends on the named one
+func hasDependentKustomizations(fluxPath string, kustomizationName string) bool {
+	files, err := os.ReadDir(fluxPath)
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), "kustomization-") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(fluxPath, file.Name()))
+		if err != nil {
+			continue
+		}
+		var kustomization kustomizev1.Kustomization
+		err = yaml.Unmarshal(content, &kustomization)
+		if err != nil {
+			continue
+		}
+		for _, dependency := range kustomization.Spec.DependsOn {
+			if dependency.Name == kustomizationName {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func imagepullSecretTemplate(
@@ -1505,6 +2110,78 @@ func ingressHost(envConfig *dx.StackConfig) string {
 	}
 }
 
+// envPolicyEngines compiles the policies of each environment, on first use.
+// Environment specific policies are loaded from the policies folder of the infra repo.
+type envPolicyEngines struct {
+	dao          *store.Store
+	gitRepoCache *nativeGit.RepoCache
+	policies     []dx.Policy
+
+	engines    map[string]*dx.PolicyEngine
+	loadErrors map[string]error
+}
+
+func newEnvPolicyEngines(
+	dao *store.Store,
+	gitRepoCache *nativeGit.RepoCache,
+	policies []dx.Policy,
+) *envPolicyEngines {
+	return &envPolicyEngines{
+		dao:          dao,
+		gitRepoCache: gitRepoCache,
+		policies:     policies,
+		engines:      map[string]*dx.PolicyEngine{},
+		loadErrors:   map[string]error{},
+	}
+}
+
+// engine returns the policy engine of an environment, or the error of loading its policies
+func (e *envPolicyEngines) engine(envName string) (*dx.PolicyEngine, error) {
+	if engine, ok := e.engines[envName]; ok {
+		return engine, nil
+	}
+	if err, ok := e.loadErrors[envName]; ok {
+		return nil, err
+	}
+
+	engine, err := e.load(envName)
+	if err != nil {
+		e.loadErrors[envName] = fmt.Errorf("cannot load policies of %s: %s", envName, err)
+		return nil, e.loadErrors[envName]
+	}
+	e.engines[envName] = engine
+	return engine, nil
+}
+
+func (e *envPolicyEngines) load(envName string) (*dx.PolicyEngine, error) {
+	env, err := e.dao.GetEnvironment(envName)
+	if err != nil {
+		return nil, err
+	}
+
+	policiesPath := "policies"
+	if !env.RepoPerEnv {
+		policiesPath = filepath.Join(env.Name, "policies")
+	}
+
+	var policyFiles map[string]string
+	err = e.gitRepoCache.PerformAction(env.InfraRepo, func(repo *git.Repository) error {
+		var inerErr error
+		policyFiles, inerErr = nativeGit.RemoteFolderOnBranchWithoutCheckout(repo, "", policiesPath)
+		return inerErr
+	})
+	if err != nil && !strings.Contains(err.Error(), "directory not found") {
+		return nil, err
+	}
+
+	envPolicies, err := dx.ParsePolicies(policyFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return dx.NewPolicyEngine(append(append([]dx.Policy{}, e.policies...), envPolicies...))
+}
+
 func envConfigs(
 	dao *store.Store,
 	gitRepoCache *nativeGit.RepoCache,
@@ -19,8 +19,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
 	"github.com/gimlet-io/gimlet/pkg/dx"
 	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
 	"github.com/go-git/go-billy/v5/memfs"
@@ -97,7 +101,7 @@ func Test_gitopsTemplateAndWrite(t *testing.T) {
 	repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{""}})
 
 	repoPerEnv := false
-	_, err := gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil)
+	_, _, err := gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil, nil, nil)
 	assert.Nil(t, err)
 	content, _ := nativeGit.Content(repo, "staging/my-app/deployment.yaml")
 	assert.True(t, len(content) > 100)
@@ -107,7 +111,7 @@ func Test_gitopsTemplateAndWrite(t *testing.T) {
 	assert.True(t, len(content) > 1)
 
 	repoPerEnv = true
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil)
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil, nil, nil)
 	assert.Nil(t, err)
 	content, _ = nativeGit.Content(repo, "my-app/deployment.yaml")
 	assert.True(t, len(content) > 100)
@@ -163,10 +167,10 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 	json.Unmarshal([]byte(withVolume), &a)
 
 	repoPerEnv := true
-	_, err := gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil)
+	_, _, err := gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil, nil, nil)
 	assert.Nil(t, err)
 
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil)
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", repoPerEnv, nil, nil, nil, nil, nil, nil)
 	assert.Nil(t, err)
 
 	content, _ := nativeGit.Content(repo, "my-app/deployment.yaml")
@@ -204,7 +208,7 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 
 	var b dx.Artifact
 	json.Unmarshal([]byte(withoutVolume), &b)
-	_, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, "", false, nil, nil, nil, nil)
+	_, _, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, "", false, nil, nil, nil, nil, nil, nil)
 	assert.Nil(t, err)
 
 	content, _ = nativeGit.Content(repo, "staging/my-app/pvc.yaml")
@@ -368,7 +372,7 @@ func Test_tag_and_branch_pattern_triggers(t *testing.T) {
 			},
 		},
 		&dx.Deploy{
-			Tag:   "v*",
+			Tag:   &dx.TagPolicy{Pattern: "v*"},
 			Event: dx.TagPtr(),
 		})
 	assert.True(t, triggered, "Matching tag pattern should trigger a deploy")
@@ -380,7 +384,7 @@ func Test_tag_and_branch_pattern_triggers(t *testing.T) {
 			},
 		},
 		&dx.Deploy{
-			Tag:   "v*",
+			Tag:   &dx.TagPolicy{Pattern: "v*"},
 			Event: dx.TagPtr(),
 		})
 	assert.False(t, triggered, "Non matching tag pattern should not trigger a deploy")
@@ -408,7 +412,7 @@ func Test_negative_tag_and_branch_triggers(t *testing.T) {
 			},
 		},
 		&dx.Deploy{
-			Tag:   "!v1",
+			Tag:   &dx.TagPolicy{Pattern: "!v1"},
 			Event: dx.TagPtr(),
 		})
 	assert.True(t, triggered, "Matching tag pattern should trigger a deploy")
@@ -426,6 +430,83 @@ func Test_negative_tag_and_branch_triggers(t *testing.T) {
 	assert.False(t, triggered, "Non matching branch pattern should not trigger a deploy")
 }
 
+func Test_semver_tag_triggers(t *testing.T) {
+	stableV2 := &dx.Deploy{
+		Tag:   &dx.TagPolicy{Semver: ">=2.0.0 <3.0.0"},
+		Event: dx.TagPtr(),
+	}
+	v2Candidates := &dx.Deploy{
+		Tag:   &dx.TagPolicy{Semver: ">=2.0.0 <3.0.0", Prerelease: true},
+		Event: dx.TagPtr(),
+	}
+	tagArtifact := func(tag string) *dx.Artifact {
+		return &dx.Artifact{
+			Version: dx.Version{
+				Tag:   tag,
+				Event: *dx.TagPtr(),
+			},
+		}
+	}
+
+	assert.True(t, deployTrigger(tagArtifact("v2.3.1"), stableV2), "Version in range should trigger a deploy")
+	assert.True(t, deployTrigger(tagArtifact("2.0.0"), stableV2), "Tags without the v prefix should trigger a deploy")
+	assert.False(t, deployTrigger(tagArtifact("v3.0.0"), stableV2), "Next major should not trigger a deploy")
+	assert.False(t, deployTrigger(tagArtifact("v1.9.9"), stableV2), "Previous major should not trigger a deploy")
+	assert.False(t, deployTrigger(tagArtifact("v2.4.0-rc.1"), stableV2), "Release candidate should not trigger a stable deploy")
+	assert.False(t, deployTrigger(tagArtifact("latest"), stableV2), "Non semver tag should not trigger a deploy")
+
+	assert.True(t, deployTrigger(tagArtifact("v2.4.0-rc.1"), v2Candidates), "Release candidate in range should trigger a deploy")
+	assert.True(t, deployTrigger(tagArtifact("v2.4.0"), v2Candidates), "Stable version in range should trigger a deploy")
+	assert.False(t, deployTrigger(tagArtifact("v3.0.0-rc.1"), v2Candidates), "Release candidate of the next major should not trigger a deploy")
+
+	pushArtifact := tagArtifact("v2.3.1")
+	pushArtifact.Version.Event = *dx.PushPtr()
+	assert.False(t, deployTrigger(pushArtifact, &dx.Deploy{Tag: &dx.TagPolicy{Semver: ">=2.0.0"}}), "Semver tag policy should require the tag event")
+}
+
+func Test_semverDowngrade(t *testing.T) {
+	assert.True(t, semverDowngrade("v2.3.1", "v2.4.0"), "Older patch should be a downgrade")
+	assert.True(t, semverDowngrade("v2.4.0-rc.1", "v2.4.0"), "Release candidate should be older than its release")
+	assert.False(t, semverDowngrade("v2.4.1", "v2.4.0"), "Newer version should not be a downgrade")
+	assert.False(t, semverDowngrade("v2.4.0", "v2.4.0"), "Same version should not be a downgrade")
+	assert.False(t, semverDowngrade("v2.4.0", ""), "First release should not be a downgrade")
+	assert.False(t, semverDowngrade("v2.4.0", "main-abc123"), "Non semver release should not be a downgrade")
+}
+
+func Test_unmarshalSemverTagPolicy(t *testing.T) {
+	var m dx.Manifest
+	err := yaml.Unmarshal([]byte(`
+app: hello
+deploy:
+  tag:
+    semver: ">=2.0.0 <3.0.0"
+    prerelease: true
+  event: tag
+`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, ">=2.0.0 <3.0.0", m.Deploy.Tag.Semver)
+	assert.True(t, m.Deploy.Tag.Prerelease)
+
+	err = yaml.Unmarshal([]byte(`
+app: hello
+deploy:
+  tag: v*
+  event: tag
+`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, "v*", m.Deploy.Tag.Pattern)
+	assert.False(t, m.Deploy.Tag.IsSemver())
+
+	err = yaml.Unmarshal([]byte(`
+app: hello
+deploy:
+  tag:
+    semver: "not a range"
+  event: tag
+`), &m)
+	assert.NotNil(t, err, "invalid semver range should not parse")
+}
+
 func Test_unmarshal(t *testing.T) {
 	var many dx.Manifest
 	err := yaml.Unmarshal([]byte(`
@@ -600,6 +681,47 @@ func Test_cleanupTrigger(t *testing.T) {
 	assert.False(t, triggered, "Should not trigger on missing app")
 }
 
+func Test_cleanupEventMatch(t *testing.T) {
+	assert.True(t, cleanupEventMatch(model.BranchDeletedEvent, dx.BranchDeleted))
+	assert.False(t, cleanupEventMatch(model.BranchDeletedEvent, dx.PRClosed), "Branch delete should not trigger pull request policies")
+
+	assert.True(t, cleanupEventMatch(model.PRClosedEvent, dx.PRClosed))
+	assert.False(t, cleanupEventMatch(model.PRClosedEvent, dx.PRMerged), "Closing without merge should not trigger merge policies")
+	assert.False(t, cleanupEventMatch(model.PRClosedEvent, dx.BranchDeleted), "Closed pull request should not trigger branch delete policies")
+
+	assert.True(t, cleanupEventMatch(model.PRMergedEvent, dx.PRMerged))
+	assert.True(t, cleanupEventMatch(model.PRMergedEvent, dx.PRClosed), "Merged pull requests are closed too")
+
+	assert.True(t, cleanupEventMatch(model.TTLExpiredEvent, dx.TTL))
+	assert.False(t, cleanupEventMatch(model.TTLExpiredEvent, dx.BranchDeleted))
+	assert.False(t, cleanupEventMatch(model.ArtifactCreatedEvent, dx.BranchDeleted))
+}
+
+func Test_unmarshalCleanupEvents(t *testing.T) {
+	var m dx.Manifest
+	err := yaml.Unmarshal([]byte(`
+app: hello
+cleanup:
+  app: hello-{{ .BRANCH }}
+  branch: feature/*
+  event: ttl
+  ttlDays: 7
+`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, dx.TTL, m.Cleanup.Event)
+	assert.Equal(t, 7, m.Cleanup.TTLDays)
+
+	err = yaml.Unmarshal([]byte(`
+app: hello
+cleanup:
+  app: hello-{{ .BRANCH }}
+  branch: feature/*
+  event: prMerged
+`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, dx.PRMerged, m.Cleanup.Event)
+}
+
 func Test_kustomizationTemplateAndWrite(t *testing.T) {
 	dirToWrite, err := ioutil.TempDir("/tmp", "gimlet")
 	defer os.RemoveAll(dirToWrite)
@@ -615,18 +737,189 @@ func Test_kustomizationTemplateAndWrite(t *testing.T) {
 	repoName := "test/test-app"
 	repoPerEnv := false
 
-	kustomization, err := kustomizationTemplate(m, repoName, dirToWrite, repoPerEnv)
+	kustomization, err := kustomizationTemplate(m, repoName, dirToWrite, repoPerEnv, false)
 	assert.Nil(t, err)
 	assert.True(t, kustomization != nil)
 	assert.Equal(t, "staging/flux/kustomization-myapp.yaml", kustomization.Path)
+	assert.NotContains(t, kustomization.Content, "wait: true", "apps without dependencies should not wait for health checks")
 
 	repoPerEnv = true
-	kustomization, err = kustomizationTemplate(m, repoName, dirToWrite, repoPerEnv)
+	kustomization, err = kustomizationTemplate(m, repoName, dirToWrite, repoPerEnv, false)
 	assert.Nil(t, err)
 	assert.True(t, kustomization != nil)
 	assert.Equal(t, "flux/kustomization-myapp.yaml", kustomization.Path)
 }
 
+func Test_kustomizationTemplateWithDependsOn(t *testing.T) {
+	dirToWrite, err := ioutil.TempDir("/tmp", "gimlet")
+	defer os.RemoveAll(dirToWrite)
+	if err != nil {
+		t.Errorf("Cannot create directory")
+		return
+	}
+
+	frontend := &dx.Manifest{
+		Env:           "staging",
+		App:           "frontend",
+		Namespace:     "default",
+		DependsOn:     []string{"api", "db/migrations"},
+		HealthTimeout: "10m",
+	}
+
+	kustomization, err := kustomizationTemplate(frontend, "gimlet-io/gitops-staging-infra", dirToWrite, false, false)
+	assert.Nil(t, err)
+	assert.Contains(t, kustomization.Content, "name: gimlet-io-staging-infra-staging-default-api")
+	assert.Contains(t, kustomization.Content, "name: gimlet-io-staging-infra-staging-db-migrations")
+	assert.Contains(t, kustomization.Content, "wait: true")
+	assert.Contains(t, kustomization.Content, "timeout: 10m0s")
+
+	api := &dx.Manifest{
+		Env:       "staging",
+		App:       "api",
+		Namespace: "default",
+	}
+	kustomization, err = kustomizationTemplate(api, "gimlet-io/gitops-staging-infra", dirToWrite, false, true)
+	assert.Nil(t, err)
+	assert.Contains(t, kustomization.Content, "timeout: 5m0s", "dependencies should wait for health checks")
+
+	frontendKustomization, _ := kustomizationTemplate(frontend, "gimlet-io/gitops-staging-infra", dirToWrite, false, false)
+	os.MkdirAll(filepath.Join(dirToWrite, "staging", "flux"), nativeGit.Dir_RWX_RX_R)
+	os.WriteFile(filepath.Join(dirToWrite, frontendKustomization.Path), []byte(frontendKustomization.Content), nativeGit.Dir_RWX_RX_R)
+	kustomization, err = kustomizationTemplate(api, "gimlet-io/gitops-staging-infra", dirToWrite, false, false)
+	assert.Nil(t, err)
+	assert.Contains(t, kustomization.Content, "wait: true", "dependencies of Kustomizations in the gitops repo should wait for health checks")
+
+	worker := &dx.Manifest{
+		Env:       "staging",
+		App:       "worker",
+		Namespace: "default",
+	}
+	kustomization, err = kustomizationTemplate(worker, "gimlet-io/gitops-staging-infra", dirToWrite, false, false)
+	assert.Nil(t, err)
+	assert.NotContains(t, kustomization.Content, "wait: true")
+}
+
+func Test_dependenciesReady(t *testing.T) {
+	dao := store.NewTest("", "")
+	defer func() {
+		dao.Close()
+	}()
+
+	artifactEvent, _ := dao.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}"})
+	api := dx.DependencyRelease{
+		EventID:   artifactEvent.ID,
+		Env:       "staging",
+		Namespace: "default",
+		App:       "api",
+		Deadline:  time.Now().Add(time.Minute).Unix(),
+	}
+	releaseRequestStr, _ := json.Marshal(dx.ReleaseRequest{
+		Env:         "staging",
+		App:         "frontend",
+		TriggeredBy: "policy",
+		WaitFor:     []*dx.DependencyRelease{&api},
+	})
+	releaseEvent := &model.Event{Type: model.ReleaseRequestedEvent, Blob: string(releaseRequestStr)}
+
+	ready, err := dependenciesReady(dao, releaseEvent)
+	assert.Nil(t, err)
+	assert.False(t, ready, "the dependency is not written yet")
+
+	results, _ := json.Marshal([]model.Result{{
+		Manifest:  &dx.Manifest{Env: "staging", Namespace: "default", App: "api"},
+		Status:    model.Success,
+		GitopsRef: "abc123",
+	}})
+	dao.UpdateEventStatus(artifactEvent.ID, model.StatusProcessed, "", string(results))
+	ready, err = dependenciesReady(dao, releaseEvent)
+	assert.Nil(t, err)
+	assert.False(t, ready, "the dependency is not reconciled yet")
+
+	dao.SaveOrUpdateGitopsCommit(&model.GitopsCommit{Sha: "abc123", Status: model.ReconciliationSucceeded})
+	ready, err = dependenciesReady(dao, releaseEvent)
+	assert.Nil(t, err)
+	assert.True(t, ready)
+
+	api.App = "not-released"
+	releaseRequestStr, _ = json.Marshal(dx.ReleaseRequest{WaitFor: []*dx.DependencyRelease{&api}})
+	_, err = dependenciesReady(dao, &model.Event{Blob: string(releaseRequestStr)})
+	assert.NotNil(t, err, "dependencies that were not released should fail the release")
+
+	api.App = "api"
+	api.Deadline = time.Now().Add(-time.Minute).Unix()
+	pendingEvent, _ := dao.CreateEvent(&model.Event{Type: model.ReleaseRequestedEvent, Blob: "{}"})
+	api.EventID = pendingEvent.ID
+	releaseRequestStr, _ = json.Marshal(dx.ReleaseRequest{WaitFor: []*dx.DependencyRelease{&api}})
+	_, err = dependenciesReady(dao, &model.Event{Blob: string(releaseRequestStr)})
+	assert.NotNil(t, err, "dependencies that are not healthy by the deadline should fail the release")
+}
+
+func Test_deferredReleaseSupersededBy(t *testing.T) {
+	dao := store.NewTest("", "")
+	defer func() {
+		dao.Close()
+	}()
+
+	releaseRequestStr, _ := json.Marshal(dx.ReleaseRequest{
+		Env:         "staging",
+		App:         "frontend",
+		ArtifactID:  "my-app-1",
+		TriggeredBy: "policy",
+		WaitFor:     []*dx.DependencyRelease{{Env: "staging", Namespace: "default", App: "api"}},
+	})
+	deferredEvent := &model.Event{
+		ID:      "deferred",
+		Type:    model.ReleaseRequestedEvent,
+		Blob:    string(releaseRequestStr),
+		Created: time.Now().Add(-time.Minute).Unix(),
+	}
+
+	supersededBy, err := deferredReleaseSupersededBy(dao, deferredEvent)
+	assert.Nil(t, err)
+	assert.Empty(t, supersededBy)
+
+	otherApp, _ := dao.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}"})
+	results, _ := json.Marshal([]model.Result{{
+		Manifest:  &dx.Manifest{Env: "staging", Namespace: "default", App: "api"},
+		Status:    model.Success,
+		GitopsRef: "abc123",
+	}})
+	dao.UpdateEventStatus(otherApp.ID, model.StatusProcessed, "", string(results))
+	supersededBy, err = deferredReleaseSupersededBy(dao, deferredEvent)
+	assert.Nil(t, err)
+	assert.Empty(t, supersededBy, "releases of other apps should not supersede the deferred release")
+
+	deploy, _ := dao.CreateEvent(&model.Event{Type: model.ArtifactCreatedEvent, Blob: "{}"})
+	results, _ = json.Marshal([]model.Result{{
+		Manifest:  &dx.Manifest{Env: "staging", Namespace: "default", App: "frontend"},
+		Status:    model.Success,
+		GitopsRef: "def456",
+	}})
+	dao.UpdateEventStatus(deploy.ID, model.StatusProcessed, "", string(results))
+	supersededBy, err = deferredReleaseSupersededBy(dao, deferredEvent)
+	assert.Nil(t, err)
+	assert.Equal(t, deploy.ID, supersededBy, "a newer deploy of the app should supersede the deferred release")
+
+	dao.DeleteEventByID(deploy.ID)
+	newerReleaseRequestStr, _ := json.Marshal(dx.ReleaseRequest{Env: "staging", App: "frontend", ArtifactID: "my-app-2"})
+	newerRelease, _ := dao.CreateEvent(&model.Event{Type: model.ReleaseRequestedEvent, Blob: string(newerReleaseRequestStr)})
+	supersededBy, err = deferredReleaseSupersededBy(dao, deferredEvent)
+	assert.Nil(t, err)
+	assert.Equal(t, newerRelease.ID, supersededBy, "a pending release of the app should supersede the deferred release")
+
+	dao.DeleteEventByID(newerRelease.ID)
+	rollback, _ := dao.CreateEvent(&model.Event{Type: model.RollbackRequestedEvent, Blob: "{}"})
+	results, _ = json.Marshal([]model.Result{{
+		RollbackRequest: &dx.RollbackRequest{Env: "staging", App: "frontend"},
+		Status:          model.Success,
+		GitopsRef:       "ghi789",
+	}})
+	dao.UpdateEventStatus(rollback.ID, model.StatusProcessed, "", string(results))
+	supersededBy, err = deferredReleaseSupersededBy(dao, deferredEvent)
+	assert.Nil(t, err)
+	assert.Equal(t, rollback.ID, supersededBy, "a rollback of the app should supersede the deferred release")
+}
+
 func Test_uniqueKustomizationName(t *testing.T) {
 	singleEnv := false
 	owner := "gimlet-io"
@@ -745,3 +1038,58 @@ func Test_commit_message_pattern_triggers(t *testing.T) {
 		})
 	assert.False(t, triggered, "Non matching commit message pattern should not trigger a deploy")
 }
+
+func Test_gitopsTemplateAndWrite_kustomizeComponents(t *testing.T) {
+	for _, component := range []string{"components/local", "https://github.com/gimlet-io/components//ha?ref=main"} {
+		manifest := &dx.Manifest{
+			App:       "my-app",
+			Env:       "staging",
+			Namespace: "staging",
+			Manifests: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app
+`,
+			Kustomize: &dx.Kustomize{Components: []string{component}},
+		}
+
+		repo, _ := git.Init(memory.NewStorage(), memfs.New())
+		_, _, err := gitopsTemplateAndWrite(repo, manifest, &dx.Release{}, "", false, nil, nil, nil, nil, nil, nil)
+		assert.NotNil(t, err, "components should not be resolved on the dashboard: %s", component)
+	}
+}
+
+func Test_envPolicyEnginesFailClosed(t *testing.T) {
+	dao := store.NewTest("", "")
+	defer dao.Close()
+
+	policyEngines := newEnvPolicyEngines(dao, nil, nil)
+	engine, err := policyEngines.engine("staging")
+	assert.NotNil(t, err, "a deploy should fail if the policies of its env can't be loaded")
+	assert.Nil(t, engine)
+
+	_, err = policyEngines.engine("staging")
+	assert.NotNil(t, err, "the load error should be kept for the env")
+}
+
+func Test_preventSemverDowngrade(t *testing.T) {
+	err := preventSemverDowngrade(nil, false, &dx.Manifest{App: "my-app", Env: "staging"}, "v2.3.1")
+	assert.Nil(t, err, "manifests without a deploy policy should not be checked")
+
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	_, err = nativeGit.CommitFilesToGit(repo, map[string]string{
+		"staging/my-app-v2/release.json": `{"version": {"tag": "v2.4.0"}}`,
+	}, []string{}, "release")
+	assert.Nil(t, err)
+
+	manifest := &dx.Manifest{
+		App:    "my-app-v2",
+		Env:    "staging",
+		Deploy: &dx.Deploy{Tag: &dx.TagPolicy{Semver: ">=2.0.0"}},
+	}
+	err = preventSemverDowngrade(repo, false, manifest, "v2.3.1")
+	assert.NotNil(t, err, "older tags should not be deployed")
+	err = preventSemverDowngrade(repo, false, manifest, "v2.4.1")
+	assert.Nil(t, err)
+}
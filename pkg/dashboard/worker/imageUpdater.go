@@ -0,0 +1,276 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/notifications"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/registry"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/server"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/gimlet-io/gimlet/pkg/git/customScm"
+	"github.com/gimlet-io/gimlet/pkg/git/genericScm"
+	helper "github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// ImageUpdater polls the registries of the images that env configs follow with an image update policy,
+// and updates the image tag in the env config when a newer matching tag appears.
+// The update is committed to the head branch of the app repo, or proposed in a pull request.
+// Once committed, the env's deploy policy releases it like any other commit
+type ImageUpdater struct {
+	store                *store.Store
+	dynamicConfig        *dynamicconfig.DynamicConfig
+	tokenManager         customScm.NonImpersonatedTokenManager
+	repoCache            *helper.RepoCache
+	notificationsManager notifications.Manager
+	registries           []*registry.Registry
+	interval             time.Duration
+}
+
+func NewImageUpdater(
+	store *store.Store,
+	dynamicConfig *dynamicconfig.DynamicConfig,
+	tokenManager customScm.NonImpersonatedTokenManager,
+	repoCache *helper.RepoCache,
+	notificationsManager notifications.Manager,
+	registries []*registry.Registry,
+	interval time.Duration,
+) *ImageUpdater {
+	return &ImageUpdater{
+		store:                store,
+		dynamicConfig:        dynamicConfig,
+		tokenManager:         tokenManager,
+		repoCache:            repoCache,
+		notificationsManager: notificationsManager,
+		registries:           registries,
+		interval:             interval,
+	}
+}
+
+// pendingImageUpdate is a newer image tag for an env config file
+type pendingImageUpdate struct {
+	fileName    string
+	content     string
+	manifest    *dx.Manifest
+	from        string
+	to          string
+	pullRequest bool
+}
+
+func (u *ImageUpdater) Run() {
+	for {
+		token, _, _ := u.tokenManager.Token()
+		gitSvc := customScm.NewGitService(u.dynamicConfig)
+
+		repos, err := gitSvc.InstallationRepos(token)
+		if err != nil {
+			logrus.Errorf("cannot get installation repos: %s", err)
+		}
+
+		tagsCache := map[string][]string{}
+		tags := func(image string) ([]string, error) {
+			if cached, ok := tagsCache[image]; ok {
+				return cached, nil
+			}
+			imageTags, err := registry.Tags(image, u.registries)
+			if err != nil {
+				return nil, err
+			}
+			tagsCache[image] = imageTags
+			return imageTags, nil
+		}
+
+		for _, repoName := range repos {
+			err = u.updateRepo(token, repoName, tags)
+			if err != nil {
+				logrus.Errorf("cannot update images for %s: %s", repoName, err)
+			}
+		}
+
+		time.Sleep(u.interval)
+	}
+}
+
+func (u *ImageUpdater) updateRepo(token string, repoName string, tags func(string) ([]string, error)) error {
+	var files map[string]string
+	err := u.repoCache.PerformAction(repoName, func(repo *git.Repository) error {
+		headBranch, err := helper.HeadBranch(repo)
+		if err != nil {
+			return fmt.Errorf("cannot get head branch: %s", err)
+		}
+		files, err = helper.RemoteFolderOnBranchWithoutCheckout(repo, headBranch, ".gimlet")
+		if err != nil && !strings.Contains(err.Error(), "directory not found") {
+			return fmt.Errorf("cannot list files in .gimlet/: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	history, err := u.store.ImageUpdates(repoName)
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range pendingImageUpdates(files, tags, history) {
+		imageUpdate, err := u.apply(token, repoName, pending)
+		if err != nil {
+			logrus.Warnf("cannot update %s to %s:%s in %s: %s",
+				pending.manifest.App, pending.manifest.ImageUpdate.Image, pending.to, repoName, err)
+			continue
+		}
+
+		err = u.store.SaveImageUpdate(imageUpdate)
+		if err != nil {
+			logrus.Warnf("cannot save image update: %s", err)
+		}
+		u.notificationsManager.Broadcast(notifications.MessageFromImageUpdate(*imageUpdate))
+		logrus.Infof("%s on %s is updated to %s:%s", imageUpdate.App, imageUpdate.Env, imageUpdate.Image, imageUpdate.To)
+	}
+
+	return nil
+}
+
+// pendingImageUpdates finds the env configs that follow an image with a newer matching tag.
+// Updates that are already proposed in a pull request are not repeated
+func pendingImageUpdates(
+	files map[string]string,
+	tags func(string) ([]string, error),
+	history []*api.ImageUpdate,
+) []*pendingImageUpdate {
+	fileNames := []string{}
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	pendingUpdates := []*pendingImageUpdate{}
+	for _, fileName := range fileNames {
+		var manifest dx.Manifest
+		err := yaml.Unmarshal([]byte(files[fileName]), &manifest)
+		if err != nil || manifest.ImageUpdate == nil {
+			continue
+		}
+		err = manifest.ImageUpdate.Validate()
+		if err != nil {
+			logrus.Warnf("invalid image update policy in %s: %s", fileName, err)
+			continue
+		}
+
+		current, err := manifest.ImageTag()
+		if err != nil {
+			logrus.Warnf("cannot follow %s in %s: %s", manifest.ImageUpdate.Image, fileName, err)
+			continue
+		}
+		imageTags, err := tags(manifest.ImageUpdate.Image)
+		if err != nil {
+			logrus.Warnf("cannot list tags of %s: %s", manifest.ImageUpdate.Image, err)
+			continue
+		}
+		newest := manifest.ImageUpdate.NewestTag(imageTags, current)
+		if newest == "" || proposed(history, &manifest, newest) {
+			continue
+		}
+
+		pendingUpdates = append(pendingUpdates, &pendingImageUpdate{
+			fileName:    fileName,
+			content:     files[fileName],
+			manifest:    &manifest,
+			from:        current,
+			to:          newest,
+			pullRequest: manifest.ImageUpdate.PullRequest,
+		})
+	}
+	return pendingUpdates
+}
+
+func proposed(history []*api.ImageUpdate, manifest *dx.Manifest, tag string) bool {
+	for _, imageUpdate := range history {
+		if imageUpdate.Env == manifest.Env && imageUpdate.App == manifest.App {
+			return imageUpdate.To == tag && imageUpdate.Link != ""
+		}
+	}
+	return false
+}
+
+// apply commits the new image tag to the head branch, or to a new branch with a pull request
+func (u *ImageUpdater) apply(token string, repoName string, pending *pendingImageUpdate) (*api.ImageUpdate, error) {
+	updatedContent, err := dx.UpdateImageTag(pending.content, pending.manifest.ImageUpdate.TagPath(), pending.to)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, tmpPath, err := u.repoCache.InstanceForWrite(repoName)
+	defer os.RemoveAll(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %s", repoName, err)
+	}
+
+	headBranch, err := helper.HeadBranch(repo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get head branch: %s", err)
+	}
+
+	sourceBranch := ""
+	if pending.pullRequest {
+		sourceBranch, err = server.GenerateBranchNameWithUniqueHash("gimlet-image-update", 4)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate branch name: %s", err)
+		}
+		err = helper.Branch(repo, fmt.Sprintf("refs/heads/%s", sourceBranch))
+		if err != nil {
+			return nil, fmt.Errorf("cannot checkout branch: %s", err)
+		}
+	}
+
+	err = os.WriteFile(filepath.Join(tmpPath, ".gimlet", pending.fileName), []byte(updatedContent), helper.Dir_RWX_RX_R)
+	if err != nil {
+		return nil, err
+	}
+
+	title := fmt.Sprintf("[Gimlet] Update %s to %s:%s on %s",
+		pending.manifest.App, pending.manifest.ImageUpdate.Image, pending.to, pending.manifest.Env)
+	err = server.StageCommitAndPushGimletFolder(repo, tmpPath, token, title)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stage, commit and push: %s", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	imageUpdate := &api.ImageUpdate{
+		Repo:    repoName,
+		Env:     pending.manifest.Env,
+		App:     pending.manifest.App,
+		Image:   pending.manifest.ImageUpdate.Image,
+		From:    pending.from,
+		To:      pending.to,
+		SHA:     head.Hash().String(),
+		Created: time.Now().Unix(),
+	}
+
+	if pending.pullRequest {
+		goScmHelper := genericScm.NewGoScmHelper(u.dynamicConfig, nil)
+		createdPr, _, err := goScmHelper.CreatePR(token, repoName, sourceBranch, headBranch, title,
+			fmt.Sprintf("This is an automated Pull Request that updates %s from %s to %s, the newest tag that matches the `%s` image update policy.",
+				pending.manifest.ImageUpdate.Image, pending.from, pending.to, pending.manifest.ImageUpdate.Tag.Semver))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create pull request: %s", err)
+		}
+		imageUpdate.Link = createdPr.Link
+	}
+
+	return imageUpdate, nil
+}
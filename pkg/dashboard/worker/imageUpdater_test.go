@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pendingImageUpdates(t *testing.T) {
+	files := map[string]string{
+		"agent-production.yaml": `
+app: agent
+env: production
+imageUpdate:
+  image: vendor/agent
+  tag:
+    semver: 1.x
+  pullRequest: true
+values:
+  image:
+    repository: vendor/agent
+    tag: 1.2.0
+`,
+		"agent-staging.yaml": `
+app: agent
+env: staging
+imageUpdate:
+  image: vendor/agent
+  tag:
+    semver: 1.x
+values:
+  image:
+    repository: vendor/agent
+    tag: 1.3.0
+`,
+		"other-staging.yaml": `
+app: other
+env: staging
+imageUpdate:
+  image: vendor/other
+  tag:
+    semver: 1.x
+values:
+  image:
+    tag: 1.0.0
+`,
+		"myapp-staging.yaml": `
+app: myapp
+env: staging
+values:
+  image:
+    tag: 1.0.0
+`,
+	}
+	tags := func(image string) ([]string, error) {
+		if image == "vendor/agent" {
+			return []string{"1.2.0", "1.3.0", "2.0.0"}, nil
+		}
+		return nil, fmt.Errorf("registry is down")
+	}
+
+	pending := pendingImageUpdates(files, tags, []*api.ImageUpdate{})
+	assert.Equal(t, 1, len(pending), "staging is up to date, the other image's tags can't be listed")
+	assert.Equal(t, "agent-production.yaml", pending[0].fileName)
+	assert.Equal(t, "1.2.0", pending[0].from)
+	assert.Equal(t, "1.3.0", pending[0].to)
+	assert.True(t, pending[0].pullRequest)
+
+	history := []*api.ImageUpdate{
+		{Env: "production", App: "agent", From: "1.2.0", To: "1.3.0", Link: "https://github.com/gimlet-io/agent-config/pull/1"},
+	}
+	pending = pendingImageUpdates(files, tags, history)
+	assert.Equal(t, 0, len(pending), "the update is already proposed in a pull request")
+}
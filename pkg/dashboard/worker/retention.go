@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/gitops"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/gimlet-io/gimlet/pkg/dx"
+	"github.com/gimlet-io/gimlet/pkg/git/nativeGit"
+	"github.com/go-git/go-git/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const retentionBatchSize = 100
+
+// RetentionWorker deletes expired artifacts and events from the database, and archives them if an archive is set
+type RetentionWorker struct {
+	dao                     *store.Store
+	repoCache               *nativeGit.RepoCache
+	archive                 archive.Archive
+	artifactDays            int
+	eventDays               int
+	releaseHistorySinceDays int
+	perf                    *prometheus.HistogramVec
+}
+
+func NewRetentionWorker(
+	dao *store.Store,
+	repoCache *nativeGit.RepoCache,
+	archive archive.Archive,
+	artifactDays int,
+	eventDays int,
+	releaseHistorySinceDays int,
+	perf *prometheus.HistogramVec,
+) *RetentionWorker {
+	return &RetentionWorker{
+		dao:                     dao,
+		repoCache:               repoCache,
+		archive:                 archive,
+		artifactDays:            artifactDays,
+		eventDays:               eventDays,
+		releaseHistorySinceDays: releaseHistorySinceDays,
+		perf:                    perf,
+	}
+}
+
+func (w *RetentionWorker) Run() {
+	for {
+		if w.eventDays > 0 {
+			before := time.Now().AddDate(0, 0, -w.eventDays).Unix()
+			expired, err := expireEvents(w.dao.ExpiredEvents, w.dao, w.archive, before, nil)
+			if err != nil {
+				logrus.Errorf("cannot expire events: %s", err)
+			} else if expired > 0 {
+				logrus.Infof("%d events expired", expired)
+			}
+		}
+
+		if w.artifactDays > 0 {
+			referenced, err := w.referencedArtifacts()
+			if err != nil {
+				logrus.Errorf("cannot expire artifacts, cannot get the deployed artifacts: %s", err)
+			} else {
+				before := time.Now().AddDate(0, 0, -w.artifactDays).Unix()
+				expired, err := expireEvents(w.dao.ExpiredArtifacts, w.dao, w.archive, before, referenced)
+				if err != nil {
+					logrus.Errorf("cannot expire artifacts: %s", err)
+				} else if expired > 0 {
+					logrus.Infof("%d artifacts expired", expired)
+				}
+			}
+		}
+
+		time.Sleep(1 * time.Hour)
+	}
+}
+
+// referencedArtifacts returns the IDs of the artifacts that are deployed,
+// or released in the release history window, in any of the environments
+func (w *RetentionWorker) referencedArtifacts() (map[string]bool, error) {
+	envs, err := w.dao.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	since := time.Now().AddDate(0, 0, -w.releaseHistorySinceDays)
+	for _, env := range envs {
+		if env.AppsRepo == "" {
+			continue
+		}
+
+		var deployed map[string]*dx.Release
+		var released []*dx.Release
+		err = w.repoCache.PerformAction(env.AppsRepo, func(repo *git.Repository) error {
+			var innerErr error
+			deployed, innerErr = gitops.Status(repo, "", env.Name, env.RepoPerEnv, w.perf)
+			if innerErr != nil {
+				return innerErr
+			}
+			released, innerErr = gitops.Releases(repo, "", env.Name, env.RepoPerEnv, &since, nil, -1, "", w.perf)
+			return innerErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot get releases of %s: %s", env.Name, err)
+		}
+
+		for _, release := range deployed {
+			if release != nil {
+				referenced[release.ArtifactID] = true
+			}
+		}
+		for _, release := range released {
+			referenced[release.ArtifactID] = true
+		}
+	}
+
+	return referenced, nil
+}
+
+// expireEvents archives and deletes the events that expired before the given time, except the kept ones.
+// Events that can't be archived are not deleted
+func expireEvents(
+	expiredEvents func(before int64, limit int, offset int) ([]*model.Event, error),
+	dao *store.Store,
+	a archive.Archive,
+	before int64,
+	keptArtifacts map[string]bool,
+) (int, error) {
+	expired := 0
+	offset := 0
+	for {
+		events, err := expiredEvents(before, retentionBatchSize, offset)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, event := range events {
+			if keptArtifacts[event.ArtifactID] {
+				offset++
+				continue
+			}
+
+			if event.Type == model.ArtifactCreatedEvent {
+				err = expireAttachments(dao, a, event.ArtifactID)
+				if err != nil {
+					return expired, fmt.Errorf("cannot expire the attachments of %s: %s", event.ArtifactID, err)
+				}
+				err = expireImageDigests(dao, a, event.ArtifactID)
+				if err != nil {
+					return expired, fmt.Errorf("cannot expire the image digests of %s: %s", event.ArtifactID, err)
+				}
+				if a != nil {
+					err = archiveSensitiveVars(dao, a, event.ArtifactID)
+					if err != nil {
+						return expired, fmt.Errorf("cannot archive the sensitive vars of %s: %s", event.ArtifactID, err)
+					}
+				}
+			}
+			if a != nil {
+				err = archive.Store(a, event)
+				if err != nil {
+					return expired, fmt.Errorf("cannot archive %s: %s", event.ID, err)
+				}
+			}
+			err = dao.DeleteEventByID(event.ID)
+			if err != nil {
+				return expired, err
+			}
+			expired++
+		}
+
+		if len(events) < retentionBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// archiveSensitiveVars archives the sensitive vars of an artifact as they are stored, encrypted
+func archiveSensitiveVars(dao *store.Store, a archive.Archive, artifactID string) error {
+	encrypted, err := dao.EncryptedSensitiveVars(artifactID)
+	if err != nil {
+		return err
+	}
+	if encrypted == "" {
+		return nil
+	}
+	return archive.StoreSensitiveVars(a, artifactID, encrypted)
+}
+
+// expireImageDigests archives and deletes the image digests recorded for an artifact
+func expireImageDigests(dao *store.Store, a archive.Archive, artifactID string) error {
+	if a != nil {
+		imageDigests, err := dao.ImageDigests(artifactID)
+		if err != nil {
+			return err
+		}
+		if len(imageDigests) > 0 {
+			err = archive.StoreImageDigests(a, artifactID, imageDigests)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return dao.DeleteImageDigests(artifactID)
+}
+
+// expireAttachments archives and deletes the attachments of an artifact
+func expireAttachments(dao *store.Store, a archive.Archive, artifactID string) error {
+	if a != nil {
+		attachments, err := dao.Attachments(artifactID)
+		if err != nil {
+			return err
+		}
+		for _, attachment := range attachments {
+			err = archive.StoreAttachment(a, attachment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return dao.DeleteAttachments(artifactID)
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimlet/pkg/dashboard/archive"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dashboard/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expireEvents(t *testing.T) {
+	dao := store.NewTest("", "")
+	defer func() {
+		dao.Close()
+	}()
+	a, _ := archive.New(t.TempDir(), archive.S3Config{})
+
+	aMonthAgo := time.Now().AddDate(0, 0, -30).Unix()
+	for _, event := range []*model.Event{
+		{ID: "1", Type: model.ArtifactCreatedEvent, ArtifactID: "my-app-1", Status: model.StatusProcessed, Created: aMonthAgo},
+		{ID: "2", Type: model.ArtifactCreatedEvent, ArtifactID: "my-app-2", Status: model.StatusProcessed, Created: aMonthAgo},
+		{ID: "3", Type: model.ArtifactCreatedEvent, ArtifactID: "my-app-3", Status: model.StatusProcessed, Created: time.Now().Unix()},
+		{ID: "4", Type: model.ReleaseRequestedEvent, Status: model.StatusProcessed, Created: aMonthAgo},
+	} {
+		err := dao.RestoreEvent(event)
+		assert.Nil(t, err)
+	}
+	err := dao.CreateImageDigest(&model.ImageDigest{ArtifactID: "my-app-1", Image: "nginx:1.25", Digest: "sha256:1111"})
+	assert.Nil(t, err)
+
+	before := time.Now().AddDate(0, 0, -7).Unix()
+	expired, err := expireEvents(dao.ExpiredArtifacts, dao, a, before, map[string]bool{"my-app-2": true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, expired, "deployed artifacts and recent artifacts should be kept")
+
+	_, err = dao.Event("1")
+	assert.NotNil(t, err)
+	_, err = dao.Event("2")
+	assert.Nil(t, err)
+	_, err = dao.Event("3")
+	assert.Nil(t, err)
+	_, err = dao.Event("4")
+	assert.Nil(t, err, "events are expired separately")
+
+	archived, err := archive.Restore(a, "my-app-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", archived.ID)
+
+	_, err = dao.ImageDigest("my-app-1", "nginx:1.25")
+	assert.NotNil(t, err)
+	imageDigests, err := archive.RestoreImageDigests(a, "my-app-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(imageDigests), "image digests should be archived with the artifact")
+
+	expired, err = expireEvents(dao.ExpiredEvents, dao, nil, before, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = dao.Event("4")
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,7 @@
 package dx
 
 import (
+	"crypto/sha256"
 	"fmt"
 
 	"gopkg.in/yaml.v3"
@@ -43,6 +44,12 @@ type Artifact struct {
 	// The complete set of Gimlet environments from the Gimlet environment files
 	CueEnvironments []string `json:"cueEnvironments,omitempty"`
 
+	// Gimlet environments in Jsonnet format
+	JsonnetEnvironments []string `json:"jsonnetEnvironments,omitempty"`
+
+	// Vendored Jsonnet libraries that JsonnetEnvironments import, keyed by their import path
+	JsonnetLibraries map[string]string `json:"jsonnetLibraries,omitempty"`
+
 	// CI job information, test results, Docker image information, etc
 	//
 	// Deprecated, please use Vars instead
@@ -51,8 +58,69 @@ type Artifact struct {
 	// CI context and arbitrary environment variables to pass along and to be used in manifest templating
 	Vars map[string]string `json:"vars,omitempty"`
 
+	// Names of the vars that are sensitive, on top of the ones whose name looks like a secret
+	SecretVars []string `json:"secretVars,omitempty"`
+
 	// Fake is true if the artifact was generated by the magic deploy link
 	Fake bool `json:"fake,omitempty"`
+
+	// Signature is the base64 encoded signature of the canonical artifact JSON
+	Signature string `json:"signature,omitempty"`
+
+	// IdempotencyKey identifies the push of the artifact, so a retried push doesn't create a duplicate
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+
+	// SBOMs, provenance attestations, test and coverage reports of the build
+	Attachments []*Attachment `json:"attachments,omitempty"`
+
+	// Container images of the build, with their digests pinned as tags are mutable
+	Images []*ArtifactImage `json:"images,omitempty"`
+}
+
+// CIBuildIDVars are the build identifiers of the common CI systems, in lookup order
+var CIBuildIDVars = []string{
+	"GITHUB_RUN_ID",
+	"CI_PIPELINE_ID",
+	"CIRCLE_WORKFLOW_ID",
+	"BUILDKITE_BUILD_ID",
+	"DRONE_BUILD_NUMBER",
+	"BITBUCKET_BUILD_NUMBER",
+	"BUILD_ID",
+}
+
+// DefaultIdempotencyKey is made of the repo, SHA and event of the artifact, the CI build ID, and the digest of the artifact.
+// The build ID is looked up in the artifact vars first, then with getenv.
+// It is empty if there is no build ID, as then retries can't be told apart from new builds.
+// The digest keeps a re-run build with a different artifact from being taken for a retry
+func (a *Artifact) DefaultIdempotencyKey(getenv func(string) string) string {
+	buildID := ciBuildID(a.CollectVariables())
+	if buildID == "" && getenv != nil {
+		env := map[string]string{}
+		for _, name := range CIBuildIDVars {
+			env[name] = getenv(name)
+		}
+		buildID = ciBuildID(env)
+	}
+	if buildID == "" {
+		return ""
+	}
+
+	canonicalArtifact, err := a.CanonicalJSON()
+	if err != nil {
+		return ""
+	}
+	digest := sha256.Sum256(canonicalArtifact)
+
+	return fmt.Sprintf("%s/%s/%s/%s/%x", a.Version.RepositoryName, a.Version.SHA, a.Version.Event, buildID, digest[:8])
+}
+
+func ciBuildID(vars map[string]string) string {
+	for _, name := range CIBuildIDVars {
+		if vars[name] != "" {
+			return vars[name]
+		}
+	}
+	return ""
 }
 
 func (a *Artifact) HasCleanupPolicy() bool {
@@ -103,3 +171,22 @@ func (a *Artifact) CueEnvironmentsToManifests() ([]*Manifest, error) {
 	}
 	return manifests, nil
 }
+
+func (a *Artifact) JsonnetEnvironmentsToManifests() ([]*Manifest, error) {
+	var manifests []*Manifest
+	for _, jsonnetManifest := range a.JsonnetEnvironments {
+		manifestStrings, err := RenderJsonnetToManifests(jsonnetManifest, a.JsonnetLibraries, nil)
+		if err != nil {
+			return manifests, fmt.Errorf("cannot render jsonnet file %s", err.Error())
+		}
+		for _, manifestString := range manifestStrings {
+			var m Manifest
+			err = yaml.Unmarshal([]byte(manifestString), &m)
+			if err != nil {
+				return manifests, fmt.Errorf("cannot parse manifest %s", err.Error())
+			}
+			manifests = append(manifests, &m)
+		}
+	}
+	return manifests, nil
+}
@@ -0,0 +1,62 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArtifactImage is a container image of the artifact.
+// The digest pins what the tag pointed to at build time, so a re-pushed tag is detected when it gets deployed
+type ArtifactImage struct {
+	// Name is the image reference with a tag, eg.: ghcr.io/gimlet-io/myapp:abc123
+	Name   string `json:"name"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// ParseArtifactImage parses an image reference with an optional digest, eg.: ghcr.io/gimlet-io/myapp:abc123@sha256:...
+func ParseArtifactImage(reference string) (*ArtifactImage, error) {
+	image := &ArtifactImage{Name: strings.TrimSpace(reference)}
+	if parts := strings.SplitN(image.Name, "@", 2); len(parts) == 2 {
+		image.Name = parts[0]
+		image.Digest = parts[1]
+		if !strings.HasPrefix(image.Digest, "sha256:") {
+			return nil, fmt.Errorf("invalid digest %s, sha256:<hex> expected", image.Digest)
+		}
+	}
+	if image.Name == "" {
+		return nil, fmt.Errorf("image name is mandatory")
+	}
+	return image, nil
+}
+
+// Image returns the pinned image with the given reference, matching Docker Hub's short and long forms too
+func (a *Artifact) Image(reference string) *ArtifactImage {
+	for _, image := range a.Images {
+		if NormalizeImage(image.Name) == NormalizeImage(reference) {
+			return image
+		}
+	}
+	return nil
+}
+
+// NormalizeImage expands an image reference to its fully qualified form, eg.: nginx to docker.io/library/nginx:latest
+func NormalizeImage(reference string) string {
+	reference = strings.SplitN(reference, "@", 2)[0]
+
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) == 1 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		reference = "docker.io/" + reference
+	}
+	if strings.HasPrefix(reference, "index.docker.io/") {
+		reference = "docker.io/" + strings.TrimPrefix(reference, "index.docker.io/")
+	}
+	if strings.HasPrefix(reference, "docker.io/") && strings.Count(reference, "/") == 1 {
+		reference = "docker.io/library/" + strings.TrimPrefix(reference, "docker.io/")
+	}
+
+	lastPart := reference[strings.LastIndex(reference, "/")+1:]
+	if !strings.Contains(lastPart, ":") {
+		reference = reference + ":latest"
+	}
+	return reference
+}
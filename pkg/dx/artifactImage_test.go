@@ -0,0 +1,33 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseArtifactImage(t *testing.T) {
+	image, err := ParseArtifactImage("ghcr.io/gimlet-io/myapp:abc123@sha256:4e3f")
+	assert.Nil(t, err)
+	assert.Equal(t, "ghcr.io/gimlet-io/myapp:abc123", image.Name)
+	assert.Equal(t, "sha256:4e3f", image.Digest)
+
+	image, err = ParseArtifactImage("ghcr.io/gimlet-io/myapp:abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, "", image.Digest)
+
+	_, err = ParseArtifactImage("ghcr.io/gimlet-io/myapp:abc123@md5:4e3f")
+	assert.NotNil(t, err)
+}
+
+func Test_normalizeImage(t *testing.T) {
+	assert.Equal(t, "docker.io/library/nginx:latest", NormalizeImage("nginx"))
+	assert.Equal(t, "docker.io/library/nginx:1.25", NormalizeImage("index.docker.io/library/nginx:1.25"))
+	assert.Equal(t, "docker.io/gimlet/agent:v1", NormalizeImage("gimlet/agent:v1"))
+	assert.Equal(t, "localhost:5000/myapp:latest", NormalizeImage("localhost:5000/myapp"))
+	assert.Equal(t, "ghcr.io/gimlet-io/myapp:abc123", NormalizeImage("ghcr.io/gimlet-io/myapp:abc123@sha256:4e3f"))
+
+	a := Artifact{Images: []*ArtifactImage{{Name: "nginx:1.25", Digest: "sha256:4e3f"}}}
+	assert.Equal(t, "sha256:4e3f", a.Image("docker.io/library/nginx:1.25").Digest)
+	assert.Nil(t, a.Image("nginx:1.26"))
+}
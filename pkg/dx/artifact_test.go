@@ -2,6 +2,7 @@ package dx
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +31,34 @@ func Test_vars(t *testing.T) {
 	assert.Equal(t, 1, len(a.Context))
 }
 
+func Test_defaultIdempotencyKey(t *testing.T) {
+	a := Artifact{
+		Version: Version{
+			RepositoryName: "my-app",
+			SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			Event:          PR,
+		},
+	}
+	assert.Equal(t, "", a.DefaultIdempotencyKey(nil), "no key without a CI build ID")
+
+	getenv := func(name string) string {
+		if name == "CI_PIPELINE_ID" {
+			return "42"
+		}
+		return ""
+	}
+	key := a.DefaultIdempotencyKey(getenv)
+	assert.True(t, strings.HasPrefix(key, "my-app/ea9ab7cc31b2599bf4afcfd639da516ca27a4780/pr/42/"), key)
+	assert.Equal(t, key, a.DefaultIdempotencyKey(getenv), "retries should get the same key")
+
+	a.Vars = map[string]string{"GITHUB_RUN_ID": "1234"}
+	key = a.DefaultIdempotencyKey(getenv)
+	assert.True(t, strings.HasPrefix(key, "my-app/ea9ab7cc31b2599bf4afcfd639da516ca27a4780/pr/1234/"), "artifact vars take precedence")
+
+	a.Vars["IMAGE_TAG"] = "v2"
+	assert.NotEqual(t, key, a.DefaultIdempotencyKey(getenv), "a different artifact of the same build should get a new key")
+}
+
 func Test_cueEnvironmentsToManifests(t *testing.T) {
 
 	const cueTemplate = `
@@ -66,3 +95,18 @@ configs: [ for instance in _instances {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(manifests))
 }
+
+func Test_jsonnetEnvironmentsToManifests(t *testing.T) {
+	artifact := &Artifact{
+		JsonnetEnvironments: []string{jsonnetTemplate},
+		JsonnetLibraries: map[string]string{
+			"app.libsonnet": jsonnetAppLibrary,
+		},
+	}
+
+	manifests, err := artifact.JsonnetEnvironmentsToManifests()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(manifests))
+	assert.Equal(t, "myapp-first", manifests[0].App)
+	assert.Equal(t, "cron-job", manifests[0].Chart.Name)
+}
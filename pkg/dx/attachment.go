@@ -0,0 +1,353 @@
+package dx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const AttachmentSBOM = "sbom"
+const AttachmentProvenance = "provenance"
+const AttachmentTestReport = "test"
+const AttachmentCoverage = "coverage"
+
+var attachmentTypes = []string{AttachmentSBOM, AttachmentProvenance, AttachmentTestReport, AttachmentCoverage}
+
+// Attachment is a structured build output of an artifact: an SBOM, a provenance attestation, a test or a coverage report.
+// Gimlet stores the content apart from the artifact, the artifact only holds its digest and summary
+type Attachment struct {
+	// Type is one of sbom, provenance, test or coverage
+	Type string `json:"type"`
+	// Name is unique within the artifact, defaults to the attached file name
+	Name string `json:"name"`
+	// Format is the detected format, eg.: spdx, cyclonedx, slsa, junit, cobertura, lcov, go
+	Format  string             `json:"format,omitempty"`
+	Digest  string             `json:"digest"`
+	Size    int64              `json:"size"`
+	Summary *AttachmentSummary `json:"summary,omitempty"`
+
+	// Content is only present until the artifact is pushed
+	Content []byte `json:"content,omitempty"`
+}
+
+// AttachmentSummary holds the key figures of an attachment, depending on its type
+type AttachmentSummary struct {
+	Tests    int `json:"tests,omitempty"`
+	Failures int `json:"failures,omitempty"`
+	Errors   int `json:"errors,omitempty"`
+	Skipped  int `json:"skipped,omitempty"`
+
+	Components int      `json:"components,omitempty"`
+	Licenses   []string `json:"licenses,omitempty"`
+
+	// Coverage is the percentage of covered lines or statements
+	Coverage float64 `json:"coverage,omitempty"`
+
+	Builder   string `json:"builder,omitempty"`
+	BuildType string `json:"buildType,omitempty"`
+}
+
+// NewAttachment detects the format of the content and summarizes it
+func NewAttachment(attachmentType string, name string, content []byte) (*Attachment, error) {
+	attachment := &Attachment{
+		Type:    attachmentType,
+		Name:    name,
+		Digest:  contentDigest(content),
+		Size:    int64(len(content)),
+		Content: content,
+	}
+
+	var err error
+	switch attachmentType {
+	case AttachmentSBOM:
+		attachment.Format, attachment.Summary, err = summarizeSBOM(content)
+	case AttachmentProvenance:
+		attachment.Format, attachment.Summary, err = summarizeProvenance(content)
+	case AttachmentTestReport:
+		attachment.Format, attachment.Summary, err = summarizeTestReport(content)
+	case AttachmentCoverage:
+		attachment.Format, attachment.Summary, err = summarizeCoverage(content)
+	default:
+		return nil, fmt.Errorf("unknown attachment type %s, use one of %s", attachmentType, strings.Join(attachmentTypes, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot summarize %s: %s", name, err)
+	}
+	return attachment, nil
+}
+
+// VerifyContent checks if the content matches the digest of the attachment
+func (a *Attachment) VerifyContent() error {
+	if contentDigest(a.Content) != a.Digest {
+		return fmt.Errorf("content of attachment %s doesn't match its digest", a.Name)
+	}
+	return nil
+}
+
+func contentDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func summarizeSBOM(content []byte) (string, *AttachmentSummary, error) {
+	var sbom struct {
+		SPDXVersion string `json:"spdxVersion"`
+		Packages    []struct {
+			LicenseConcluded string `json:"licenseConcluded"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+		} `json:"packages"`
+
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			Licenses []struct {
+				License struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"license"`
+				Expression string `json:"expression"`
+			} `json:"licenses"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(content, &sbom)
+	if err != nil {
+		return "", nil, fmt.Errorf("SPDX or CycloneDX JSON expected: %s", err)
+	}
+
+	licenses := map[string]bool{}
+	addLicense := func(license string) {
+		if license != "" && license != "NOASSERTION" && license != "NONE" {
+			licenses[license] = true
+		}
+	}
+
+	summary := &AttachmentSummary{}
+	format := ""
+	switch {
+	case sbom.SPDXVersion != "":
+		format = "spdx"
+		summary.Components = len(sbom.Packages)
+		for _, p := range sbom.Packages {
+			if p.LicenseConcluded != "" && p.LicenseConcluded != "NOASSERTION" {
+				addLicense(p.LicenseConcluded)
+			} else {
+				addLicense(p.LicenseDeclared)
+			}
+		}
+	case sbom.BOMFormat == "CycloneDX":
+		format = "cyclonedx"
+		summary.Components = len(sbom.Components)
+		for _, c := range sbom.Components {
+			for _, l := range c.Licenses {
+				addLicense(l.License.ID)
+				addLicense(l.License.Name)
+				addLicense(l.Expression)
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("SPDX or CycloneDX JSON expected")
+	}
+
+	for license := range licenses {
+		summary.Licenses = append(summary.Licenses, license)
+	}
+	sort.Strings(summary.Licenses)
+	return format, summary, nil
+}
+
+func summarizeProvenance(content []byte) (string, *AttachmentSummary, error) {
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+	}
+	err := json.Unmarshal(content, &envelope)
+	if err != nil {
+		return "", nil, fmt.Errorf("in-toto statement or DSSE envelope expected: %s", err)
+	}
+	if envelope.Payload != "" {
+		content, err = base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot decode DSSE payload: %s", err)
+		}
+	}
+
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			// SLSA v0.2
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+			BuildType string `json:"buildType"`
+			// SLSA v1
+			BuildDefinition struct {
+				BuildType string `json:"buildType"`
+			} `json:"buildDefinition"`
+			RunDetails struct {
+				Builder struct {
+					ID string `json:"id"`
+				} `json:"builder"`
+			} `json:"runDetails"`
+		} `json:"predicate"`
+	}
+	err = json.Unmarshal(content, &statement)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot parse in-toto statement: %s", err)
+	}
+	if !strings.Contains(statement.PredicateType, "slsa.dev/provenance") {
+		return "", nil, fmt.Errorf("SLSA provenance expected, got predicate type %q", statement.PredicateType)
+	}
+
+	summary := &AttachmentSummary{
+		Builder:   statement.Predicate.Builder.ID,
+		BuildType: statement.Predicate.BuildType,
+	}
+	if summary.Builder == "" {
+		summary.Builder = statement.Predicate.RunDetails.Builder.ID
+	}
+	if summary.BuildType == "" {
+		summary.BuildType = statement.Predicate.BuildDefinition.BuildType
+	}
+	return "slsa", summary, nil
+}
+
+// summarizeTestReport counts the test cases of a JUnit XML report, nested test suites included
+func summarizeTestReport(content []byte) (string, *AttachmentSummary, error) {
+	summary := &AttachmentSummary{}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	inTestCase := false
+	root := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("JUnit XML expected: %s", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if root == "" {
+				root = element.Name.Local
+			}
+			switch element.Name.Local {
+			case "testcase":
+				inTestCase = true
+				summary.Tests++
+			case "failure":
+				if inTestCase {
+					summary.Failures++
+				}
+			case "error":
+				if inTestCase {
+					summary.Errors++
+				}
+			case "skipped":
+				if inTestCase {
+					summary.Skipped++
+				}
+			}
+		case xml.EndElement:
+			if element.Name.Local == "testcase" {
+				inTestCase = false
+			}
+		}
+	}
+
+	if root != "testsuites" && root != "testsuite" {
+		return "", nil, fmt.Errorf("JUnit XML expected")
+	}
+	return "junit", summary, nil
+}
+
+// summarizeCoverage reads the coverage percentage of Cobertura XML, LCOV or Go cover profiles
+func summarizeCoverage(content []byte) (string, *AttachmentSummary, error) {
+	trimmed := bytes.TrimSpace(content)
+
+	if bytes.HasPrefix(trimmed, []byte("mode:")) {
+		var statements, covered int
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Scan() // mode line
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 {
+				continue
+			}
+			numStatements, _ := strconv.Atoi(fields[1])
+			count, _ := strconv.Atoi(fields[2])
+			statements += numStatements
+			if count > 0 {
+				covered += numStatements
+			}
+		}
+		return "go", &AttachmentSummary{Coverage: percentage(covered, statements)}, nil
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return "", nil, fmt.Errorf("Cobertura XML expected: %s", err)
+			}
+			element, ok := token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			if element.Name.Local != "coverage" {
+				return "", nil, fmt.Errorf("Cobertura XML expected")
+			}
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "line-rate" {
+					lineRate, err := strconv.ParseFloat(attr.Value, 64)
+					if err != nil {
+						return "", nil, fmt.Errorf("invalid line-rate %s", attr.Value)
+					}
+					return "cobertura", &AttachmentSummary{Coverage: roundPercentage(lineRate * 100)}, nil
+				}
+			}
+			return "", nil, fmt.Errorf("Cobertura XML without line-rate")
+		}
+	}
+
+	var found, hit int
+	isLcov := false
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "SF:") {
+			isLcov = true
+		} else if strings.HasPrefix(line, "LF:") {
+			n, _ := strconv.Atoi(strings.TrimPrefix(line, "LF:"))
+			found += n
+		} else if strings.HasPrefix(line, "LH:") {
+			n, _ := strconv.Atoi(strings.TrimPrefix(line, "LH:"))
+			hit += n
+		}
+	}
+	if !isLcov {
+		return "", nil, fmt.Errorf("Cobertura XML, LCOV or Go cover profile expected")
+	}
+	return "lcov", &AttachmentSummary{Coverage: percentage(hit, found)}, nil
+}
+
+func percentage(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return roundPercentage(float64(part) / float64(total) * 100)
+}
+
+func roundPercentage(p float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(p, 'f', 1, 64), 64)
+	return rounded
+}
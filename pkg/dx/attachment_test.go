@@ -0,0 +1,127 @@
+package dx
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sbomAttachment(t *testing.T) {
+	attachment, err := NewAttachment(AttachmentSBOM, "sbom.spdx.json", []byte(`{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"name": "github.com/gimlet-io/gimlet", "licenseConcluded": "NOASSERTION", "licenseDeclared": "Apache-2.0"},
+    {"name": "github.com/sirupsen/logrus", "licenseConcluded": "MIT"},
+    {"name": "unknown"}
+  ]
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "spdx", attachment.Format)
+	assert.Equal(t, 3, attachment.Summary.Components)
+	assert.Equal(t, []string{"Apache-2.0", "MIT"}, attachment.Summary.Licenses)
+	assert.Nil(t, attachment.VerifyContent())
+
+	attachment, err = NewAttachment(AttachmentSBOM, "bom.json", []byte(`{
+  "bomFormat": "CycloneDX",
+  "components": [
+    {"name": "logrus", "licenses": [{"license": {"id": "MIT"}}]},
+    {"name": "yaml", "licenses": [{"expression": "Apache-2.0 OR MIT"}]}
+  ]
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "cyclonedx", attachment.Format)
+	assert.Equal(t, 2, attachment.Summary.Components)
+	assert.Equal(t, []string{"Apache-2.0 OR MIT", "MIT"}, attachment.Summary.Licenses)
+
+	_, err = NewAttachment(AttachmentSBOM, "sbom.txt", []byte(`{}`))
+	assert.NotNil(t, err)
+}
+
+func Test_provenanceAttachment(t *testing.T) {
+	statement := `{
+  "_type": "https://in-toto.io/Statement/v1",
+  "predicateType": "https://slsa.dev/provenance/v1",
+  "predicate": {
+    "buildDefinition": {"buildType": "https://actions.github.io/buildtypes/workflow/v1"},
+    "runDetails": {"builder": {"id": "https://github.com/actions/runner"}}
+  }
+}`
+	envelope := `{"payloadType": "application/vnd.in-toto+json", "payload": "` + base64.StdEncoding.EncodeToString([]byte(statement)) + `"}`
+
+	for _, content := range []string{statement, envelope} {
+		attachment, err := NewAttachment(AttachmentProvenance, "provenance.json", []byte(content))
+		assert.Nil(t, err)
+		assert.Equal(t, "slsa", attachment.Format)
+		assert.Equal(t, "https://github.com/actions/runner", attachment.Summary.Builder)
+		assert.Equal(t, "https://actions.github.io/buildtypes/workflow/v1", attachment.Summary.BuildType)
+	}
+
+	_, err := NewAttachment(AttachmentProvenance, "sbom.json", []byte(`{"predicateType": "https://spdx.dev/Document"}`))
+	assert.NotNil(t, err)
+}
+
+func Test_testReportAttachment(t *testing.T) {
+	attachment, err := NewAttachment(AttachmentTestReport, "junit.xml", []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="pkg/dx" tests="3">
+    <testcase name="Test_a"/>
+    <testcase name="Test_b"><failure message="expected 1">assertion failed</failure></testcase>
+    <testsuite name="nested">
+      <testcase name="Test_c"><skipped/></testcase>
+      <testcase name="Test_d"><error message="panic"/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "junit", attachment.Format)
+	assert.Equal(t, &AttachmentSummary{Tests: 4, Failures: 1, Errors: 1, Skipped: 1}, attachment.Summary)
+
+	_, err = NewAttachment(AttachmentTestReport, "report.html", []byte(`<html></html>`))
+	assert.NotNil(t, err)
+}
+
+func Test_coverageAttachment(t *testing.T) {
+	attachment, err := NewAttachment(AttachmentCoverage, "cover.out", []byte(`mode: set
+github.com/gimlet-io/gimlet/pkg/dx/artifact.go:10.2,12.3 3 1
+github.com/gimlet-io/gimlet/pkg/dx/artifact.go:14.2,16.3 1 0
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "go", attachment.Format)
+	assert.Equal(t, 75.0, attachment.Summary.Coverage)
+
+	attachment, err = NewAttachment(AttachmentCoverage, "coverage.xml", []byte(`<?xml version="1.0" ?>
+<coverage line-rate="0.8312" branch-rate="0.5" version="1.9"></coverage>`))
+	assert.Nil(t, err)
+	assert.Equal(t, "cobertura", attachment.Format)
+	assert.Equal(t, 83.1, attachment.Summary.Coverage)
+
+	attachment, err = NewAttachment(AttachmentCoverage, "lcov.info", []byte(`TN:
+SF:src/index.js
+LF:10
+LH:5
+end_of_record
+SF:src/app.js
+LF:10
+LH:10
+end_of_record
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "lcov", attachment.Format)
+	assert.Equal(t, 75.0, attachment.Summary.Coverage)
+
+	_, err = NewAttachment("screenshot", "screen.png", []byte{})
+	assert.NotNil(t, err)
+}
+
+func Test_canonicalJSONWithAttachments(t *testing.T) {
+	attachment, _ := NewAttachment(AttachmentCoverage, "cover.out", []byte("mode: set\n"))
+	a := &Artifact{Attachments: []*Attachment{attachment}}
+	withContent, err := a.CanonicalJSON()
+	assert.Nil(t, err)
+
+	attachment.Content = nil
+	withoutContent, err := a.CanonicalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, string(withContent), string(withoutContent), "the stored artifact must verify without the attachment contents")
+}
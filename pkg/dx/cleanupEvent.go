@@ -12,6 +12,12 @@ type CleanupEvent int
 const (
 	// BranchDeleted indicates if a git branch is deleted
 	BranchDeleted CleanupEvent = iota
+	// PRClosed indicates if a pull request is closed, merged or not
+	PRClosed
+	// PRMerged indicates if a pull request is merged
+	PRMerged
+	// TTL indicates if an app instance was not redeployed for the days set in the cleanup policy
+	TTL
 )
 
 func (s CleanupEvent) String() string {
@@ -20,10 +26,16 @@ func (s CleanupEvent) String() string {
 
 var cleanupEventToString = map[CleanupEvent]string{
 	BranchDeleted: "branchDeleted",
+	PRClosed:      "prClosed",
+	PRMerged:      "prMerged",
+	TTL:           "ttl",
 }
 
 var cleanupEventToID = map[string]CleanupEvent{
 	"branchDeleted": BranchDeleted,
+	"prClosed":      PRClosed,
+	"prMerged":      PRMerged,
+	"ttl":           TTL,
 }
 
 // MarshalJSON marshals the enum as a quoted json string
@@ -0,0 +1,358 @@
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	giturl "github.com/whilp/git-urls"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// HelmSpec installs a supporting chart, like Redis, next to the app
+type HelmSpec struct {
+	Chart  Chart                  `yaml:"chart" json:"chart"`
+	Values map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
+	// Render templates the chart to yaml next to the app, instead of generating a Flux HelmRelease
+	Render bool `yaml:"render,omitempty" json:"render,omitempty"`
+}
+
+// KustomizeSpec applies a kustomization from a remote git repository.
+// Url takes the branch, tag, sha and path parameters like Terraform modules do.
+type KustomizeSpec struct {
+	Url    string `yaml:"url" json:"url"`
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// Substitute holds variables for Flux's post-build variable substitution
+	Substitute map[string]string `yaml:"substitute,omitempty" json:"substitute,omitempty"`
+}
+
+// ManifestSpec applies raw yamls from a folder of a remote git repository.
+// Url takes the branch, tag, sha and path parameters like Terraform modules do.
+type ManifestSpec struct {
+	Url    string `yaml:"url" json:"url"`
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+}
+
+func parseHelmSpec(spec interface{}) (HelmSpec, error) {
+	var helmSpec HelmSpec
+	err := remarshal(spec, &helmSpec)
+	if err != nil {
+		return helmSpec, fmt.Errorf("cannot parse helm dependency spec: %s", err)
+	}
+
+	if helmSpec.Chart.Name == "" {
+		return helmSpec, fmt.Errorf("chart name is mandatory for helm dependencies")
+	}
+	isGitChart := strings.HasPrefix(helmSpec.Chart.Name, "git@") || strings.Contains(helmSpec.Chart.Name, ".git")
+	if isGitChart && !helmSpec.Render {
+		return helmSpec, fmt.Errorf("git based charts are only supported with `render: true` in helm dependencies")
+	}
+	if !isGitChart && helmSpec.Chart.Repository == "" {
+		return helmSpec, fmt.Errorf("chart repository is mandatory for helm dependencies")
+	}
+
+	return helmSpec, nil
+}
+
+func parseKustomizeSpec(spec interface{}) (KustomizeSpec, error) {
+	var kustomizeSpec KustomizeSpec
+	err := remarshal(spec, &kustomizeSpec)
+	if err != nil {
+		return kustomizeSpec, fmt.Errorf("cannot parse kustomize dependency spec: %s", err)
+	}
+
+	if kustomizeSpec.Url == "" {
+		return kustomizeSpec, fmt.Errorf("url is mandatory for kustomize dependencies")
+	}
+	if _, err := parseGitSource(kustomizeSpec.Url); err != nil {
+		return kustomizeSpec, err
+	}
+
+	return kustomizeSpec, nil
+}
+
+func parseManifestSpec(spec interface{}) (ManifestSpec, error) {
+	var manifestSpec ManifestSpec
+	err := remarshal(spec, &manifestSpec)
+	if err != nil {
+		return manifestSpec, fmt.Errorf("cannot parse manifest dependency spec: %s", err)
+	}
+
+	if manifestSpec.Url == "" {
+		return manifestSpec, fmt.Errorf("url is mandatory for manifest dependencies")
+	}
+	if _, err := parseGitSource(manifestSpec.Url); err != nil {
+		return manifestSpec, err
+	}
+
+	return manifestSpec, nil
+}
+
+func remarshal(from interface{}, to interface{}) error {
+	if from == nil {
+		return fmt.Errorf("spec is mandatory")
+	}
+
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
+
+// gitSource is a git url with the ref and path parameters taken out
+type gitSource struct {
+	url    string
+	branch string
+	tag    string
+	sha    string
+	path   string
+}
+
+func parseGitSource(rawUrl string) (gitSource, error) {
+	gitAddress, err := giturl.Parse(rawUrl)
+	if err != nil {
+		return gitSource{}, fmt.Errorf("cannot parse dependency's git address: %s", err)
+	}
+	source := gitSource{}
+	source.url = strings.ReplaceAll(rawUrl, gitAddress.RawQuery, "")
+	source.url = strings.ReplaceAll(source.url, "?", "")
+
+	params, _ := url.ParseQuery(gitAddress.RawQuery)
+	if v, found := params["branch"]; found {
+		source.branch = v[0]
+	}
+	if v, found := params["tag"]; found {
+		source.tag = v[0]
+	}
+	if v, found := params["sha"]; found {
+		source.sha = v[0]
+	}
+	if v, found := params["path"]; found {
+		source.path = v[0]
+	}
+
+	return source, nil
+}
+
+// Outputs returns the values that a dependency exposes to the app.
+// They are available in the manifest with the `dependency` template function:
+// `{{ dependency "my-redis" "releaseName" }}`
+func (d *Dependency) Outputs(app string, namespace string) map[string]string {
+	name := app + "-" + d.Name
+	switch d.Kind {
+	case "terraform":
+		return map[string]string{
+			"secretName": name + "-output",
+		}
+	case "helm":
+		return map[string]string{
+			"releaseName": name,
+			"namespace":   namespace,
+		}
+	case "kustomize", "manifest":
+		return map[string]string{
+			"name":      name,
+			"namespace": namespace,
+		}
+	}
+	return map[string]string{}
+}
+
+func dependencyOutputFunc(dependencies []Dependency, app string, namespace string) func(string, string) (string, error) {
+	return func(name string, output string) (string, error) {
+		for _, dependency := range dependencies {
+			if dependency.Name != name {
+				continue
+			}
+			outputs := dependency.Outputs(app, namespace)
+			if value, ok := outputs[output]; ok {
+				return value, nil
+			}
+			return "", fmt.Errorf("dependency %s has no %s output", name, output)
+		}
+		return "", fmt.Errorf("no such dependency: %s", name)
+	}
+}
+
+func renderHelmDependency(name string, helmSpec HelmSpec, manifest *Manifest) (string, error) {
+	if helmSpec.Render {
+		dependencyManifest := &Manifest{
+			App:       name,
+			Env:       manifest.Env,
+			Namespace: manifest.Namespace,
+			Chart:     helmSpec.Chart,
+			Values:    helmSpec.Values,
+		}
+		templated, err := templateChart(dependencyManifest)
+		if err != nil {
+			return "", fmt.Errorf("cannot template Helm chart %s", err)
+		}
+		return templated, nil
+	}
+
+	depString := ""
+	helmRepositoryBytes, err := renderHelmRepository(name, manifest.Namespace, helmSpec.Chart.Repository)
+	if err != nil {
+		return "", err
+	}
+	depString += "---\n"
+	depString += string(helmRepositoryBytes)
+
+	helmReleaseBytes, err := renderHelmRelease(name, manifest.Namespace, helmSpec.Chart, helmSpec.Values)
+	if err != nil {
+		return "", err
+	}
+	depString += "---\n"
+	depString += string(helmReleaseBytes)
+
+	return depString, nil
+}
+
+func renderHelmRepository(name string, namespace string, repository string) ([]byte, error) {
+	gvk := sourcev1.GroupVersion.WithKind(sourcev1.HelmRepositoryKind)
+	helmRepository := sourcev1.HelmRepository{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       gvk.Kind,
+			APIVersion: gvk.GroupVersion().String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: sourcev1.HelmRepositorySpec{
+			URL: repository,
+			Interval: metav1.Duration{
+				Duration: 24 * time.Hour,
+			},
+		},
+	}
+
+	if strings.HasPrefix(repository, "oci://") {
+		helmRepository.Spec.Type = sourcev1.HelmRepositoryTypeOCI
+	}
+
+	return yaml.Marshal(helmRepository)
+}
+
+func renderHelmRelease(name string, namespace string, chart Chart, values map[string]interface{}) ([]byte, error) {
+	gvk := helmv2.GroupVersion.WithKind(helmv2.HelmReleaseKind)
+	helmRelease := helmv2.HelmRelease{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       gvk.Kind,
+			APIVersion: gvk.GroupVersion().String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: helmv2.HelmReleaseSpec{
+			Interval: metav1.Duration{
+				Duration: 24 * time.Hour,
+			},
+			ReleaseName: name,
+			Chart: &helmv2.HelmChartTemplate{
+				Spec: helmv2.HelmChartTemplateSpec{
+					Chart:   chart.Name,
+					Version: chart.Version,
+					SourceRef: helmv2.CrossNamespaceObjectReference{
+						Kind: sourcev1.HelmRepositoryKind,
+						Name: name,
+					},
+				},
+			},
+		},
+	}
+
+	if len(values) > 0 {
+		valuesBytes, err := json.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal helm dependency values: %s", err)
+		}
+		helmRelease.Spec.Values = &v1.JSON{Raw: valuesBytes}
+	}
+
+	return yaml.Marshal(helmRelease)
+}
+
+// renderGitKustomization renders a GitRepository and a Flux Kustomization that applies a path from it.
+// This serves both the kustomize and the manifest dependency kinds, as Flux generates a kustomization for raw yaml folders.
+func renderGitKustomization(
+	name string,
+	namespace string,
+	rawUrl string,
+	secretName string,
+	substitute map[string]string,
+) (string, error) {
+	source, err := parseGitSource(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	depString := ""
+	gitRepoBytes, err := renderTFGitRepo(
+		name,
+		namespace,
+		source.url,
+		source.branch,
+		source.tag,
+		source.sha,
+		secretName,
+	)
+	if err != nil {
+		return "", err
+	}
+	depString += "---\n"
+	depString += string(gitRepoBytes)
+
+	path := source.path
+	if path == "" {
+		path = "./"
+	}
+
+	gvk := kustomizev1.GroupVersion.WithKind(kustomizev1.KustomizationKind)
+	kustomization := kustomizev1.Kustomization{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       gvk.Kind,
+			APIVersion: gvk.GroupVersion().String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: kustomizev1.KustomizationSpec{
+			Interval: metav1.Duration{
+				Duration: 24 * time.Hour,
+			},
+			Path:            path,
+			Prune:           true,
+			TargetNamespace: namespace,
+			SourceRef: kustomizev1.CrossNamespaceSourceReference{
+				Kind: sourcev1.GitRepositoryKind,
+				Name: name,
+			},
+		},
+	}
+
+	if len(substitute) > 0 {
+		kustomization.Spec.PostBuild = &kustomizev1.PostBuild{
+			Substitute: substitute,
+		}
+	}
+
+	kustomizationBytes, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return "", err
+	}
+	depString += "---\n"
+	depString += string(kustomizationBytes)
+
+	return depString, nil
+}
@@ -0,0 +1,107 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultHealthTimeout is how long an app has to become healthy when it has no healthTimeout set
+const DefaultHealthTimeout = 5 * time.Minute
+
+// HealthCheckTimeout is how long the app has to become healthy before its dependents give up on it.
+// It is set in the healthTimeout field of the manifest, eg.: 10m
+func (m *Manifest) HealthCheckTimeout() (time.Duration, error) {
+	if m.HealthTimeout == "" {
+		return DefaultHealthTimeout, nil
+	}
+	timeout, err := time.ParseDuration(m.HealthTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid health timeout %s: %s", m.HealthTimeout, err)
+	}
+	return timeout, nil
+}
+
+// HasDependents tells if any of the manifests depends on the app in the same env
+func (m *Manifest) HasDependents(manifests []*Manifest) bool {
+	for _, other := range manifests {
+		if other.Env != m.Env {
+			continue
+		}
+		for _, dependency := range other.DependsOn {
+			namespace, app := ParseDependency(dependency, other.Namespace)
+			if namespace == m.Namespace && app == m.App {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DependencyRelease points to the release of a dependency that a deferred release waits for
+type DependencyRelease struct {
+	// EventID is the event that writes the dependency to the gitops repo
+	EventID   string `json:"eventId"`
+	Env       string `json:"env"`
+	Namespace string `json:"namespace"`
+	App       string `json:"app"`
+	// Deadline is the unix timestamp until the dependency has to become healthy
+	Deadline int64 `json:"deadline"`
+}
+
+// ParseDependency splits a dependsOn entry into namespace and app.
+// dependsOn lists the apps of the env that must be healthy before the app is deployed.
+// Entries are either an app name in the namespace of the dependent, or namespace/app
+func ParseDependency(dependency string, namespace string) (string, string) {
+	if parts := strings.SplitN(dependency, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return namespace, dependency
+}
+
+// OrderByDependencies orders the manifests so every app comes after the apps it depends on in the same env.
+// The original order is kept otherwise. Dependencies outside the given manifests are already deployed, and are ignored.
+func OrderByDependencies(manifests []*Manifest) ([]*Manifest, error) {
+	key := func(env, namespace, app string) string {
+		return env + "/" + namespace + "/" + app
+	}
+	index := map[string]*Manifest{}
+	for _, m := range manifests {
+		index[key(m.Env, m.Namespace, m.App)] = m
+	}
+
+	var ordered []*Manifest
+	visited := map[*Manifest]bool{}
+	inProgress := map[*Manifest]bool{}
+	var visit func(m *Manifest) error
+	visit = func(m *Manifest) error {
+		if visited[m] {
+			return nil
+		}
+		if inProgress[m] {
+			return fmt.Errorf("circular dependsOn in %s: %s", m.Env, m.App)
+		}
+		inProgress[m] = true
+		for _, dependency := range m.DependsOn {
+			namespace, app := ParseDependency(dependency, m.Namespace)
+			if dependencyManifest, ok := index[key(m.Env, namespace, app)]; ok {
+				err := visit(dependencyManifest)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		inProgress[m] = false
+		visited[m] = true
+		ordered = append(ordered, m)
+		return nil
+	}
+
+	for _, m := range manifests {
+		err := visit(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,40 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OrderByDependencies(t *testing.T) {
+	manifests := []*Manifest{
+		{App: "frontend", Env: "staging", Namespace: "default", DependsOn: []string{"api"}},
+		{App: "api", Env: "staging", Namespace: "default", DependsOn: []string{"db/migrations", "not-in-this-artifact"}},
+		{App: "frontend", Env: "production", Namespace: "default", DependsOn: []string{"api"}},
+		{App: "migrations", Env: "staging", Namespace: "db"},
+	}
+
+	ordered, err := OrderByDependencies(manifests)
+	assert.Nil(t, err)
+
+	var apps []string
+	for _, m := range ordered {
+		apps = append(apps, m.Env+"/"+m.App)
+	}
+	assert.Equal(t, []string{"staging/migrations", "staging/api", "staging/frontend", "production/frontend"}, apps)
+
+	manifests[3].DependsOn = []string{"default/frontend"}
+	_, err = OrderByDependencies(manifests)
+	assert.NotNil(t, err, "circular dependencies should be rejected")
+}
+
+func Test_HealthCheckTimeout(t *testing.T) {
+	m := &Manifest{}
+	timeout, err := m.HealthCheckTimeout()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultHealthTimeout, timeout)
+
+	m.HealthTimeout = "invalid"
+	_, err = m.HealthCheckTimeout()
+	assert.NotNil(t, err)
+}
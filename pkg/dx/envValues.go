@@ -0,0 +1,106 @@
+package dx
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// EnvDefaultsFile holds the values that every app of the environment gets, unless the app sets them.
+// It lives in the .gimlet folder of the environment in the gitops repo, next to the vars file.
+const EnvDefaultsFile = "defaults.yaml"
+
+// EnvOverridesFile holds the values that are enforced on every app of the environment
+const EnvOverridesFile = "overrides.yaml"
+
+// EnvValues are the environment level values of the platform team
+type EnvValues struct {
+	Defaults  map[string]interface{}
+	Overrides map[string]interface{}
+}
+
+// ParseEnvValues parses the contents of the defaults and overrides files. Both are optional
+func ParseEnvValues(defaultsString string, overridesString string) (*EnvValues, error) {
+	var envValues EnvValues
+	err := yaml.Unmarshal([]byte(defaultsString), &envValues.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", EnvDefaultsFile, err)
+	}
+	err = yaml.Unmarshal([]byte(overridesString), &envValues.Overrides)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", EnvOverridesFile, err)
+	}
+	return &envValues, nil
+}
+
+// ApplyEnvValues deep-merges the environment defaults under, and the overrides over the manifest values.
+// Maps are merged key by key, lists and scalars are replaced.
+// It returns the dot separated paths of the values that were defaulted, and that were overridden.
+func (m *Manifest) ApplyEnvValues(envValues *EnvValues) (defaulted []string, overridden []string) {
+	if envValues == nil || (len(envValues.Defaults) == 0 && len(envValues.Overrides) == 0) {
+		return nil, nil
+	}
+
+	values := m.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	defaulted = mergeValues(values, envValues.Defaults, "", false)
+	overridden = mergeValues(values, envValues.Overrides, "", true)
+	m.Values = values
+
+	sort.Strings(defaulted)
+	sort.Strings(overridden)
+	return defaulted, overridden
+}
+
+// mergeValues merges src into dst and returns the paths of the changed leaf values.
+// Without overwrite only the values that dst doesn't have are set.
+func mergeValues(dst map[string]interface{}, src map[string]interface{}, prefix string, overwrite bool) []string {
+	var changed []string
+	for k, srcValue := range src {
+		path := strings.TrimPrefix(prefix+"."+k, ".")
+		dstValue, exists := dst[k]
+
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		if srcIsMap && (dstIsMap || !exists) {
+			if !exists {
+				dstMap = map[string]interface{}{}
+				dst[k] = dstMap
+			}
+			changed = append(changed, mergeValues(dstMap, srcMap, path, overwrite)...)
+			continue
+		}
+
+		if exists && (!overwrite || reflect.DeepEqual(dstValue, srcValue)) {
+			continue
+		}
+		dst[k] = deepCopyValue(srcValue)
+		changed = append(changed, path)
+	}
+	return changed
+}
+
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := map[string]interface{}{}
+		for k, inner := range v {
+			copied[k] = deepCopyValue(inner)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, inner := range v {
+			copied[i] = deepCopyValue(inner)
+		}
+		return copied
+	default:
+		return v
+	}
+}
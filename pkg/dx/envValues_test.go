@@ -0,0 +1,59 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_applyEnvValues(t *testing.T) {
+	envValues, err := ParseEnvValues(`
+resources:
+  requests:
+    cpu: 100m
+    memory: 128Mi
+podDisruptionBudgetEnabled: true
+tolerations:
+  - key: dedicated
+    value: apps
+`, `
+securityContext:
+  runAsNonRoot: true
+replicas: 2
+`)
+	assert.Nil(t, err)
+
+	m := Manifest{
+		Values: map[string]interface{}{
+			"replicas": 1,
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{
+					"memory": "1Gi",
+				},
+			},
+		},
+	}
+	defaulted, overridden := m.ApplyEnvValues(envValues)
+
+	assert.Equal(t, []string{"podDisruptionBudgetEnabled", "resources.requests.cpu", "tolerations"}, defaulted)
+	assert.Equal(t, []string{"replicas", "securityContext.runAsNonRoot"}, overridden)
+
+	requests := m.Values["resources"].(map[string]interface{})["requests"].(map[string]interface{})
+	assert.Equal(t, "1Gi", requests["memory"], "app values should win over defaults")
+	assert.Equal(t, "100m", requests["cpu"])
+	assert.Equal(t, float64(2), m.Values["replicas"], "overrides should win over app values")
+	assert.Equal(t, true, m.Values["securityContext"].(map[string]interface{})["runAsNonRoot"])
+
+	m = Manifest{Values: map[string]interface{}{"replicas": float64(2)}}
+	_, overridden = m.ApplyEnvValues(envValues)
+	assert.Equal(t, []string{"securityContext.runAsNonRoot"}, overridden, "equal values are not overridden")
+
+	m = Manifest{}
+	defaulted, overridden = m.ApplyEnvValues(nil)
+	assert.Nil(t, defaulted)
+	assert.Nil(t, overridden)
+	assert.Nil(t, m.Values)
+
+	_, err = ParseEnvValues("resources: [", "")
+	assert.NotNil(t, err)
+}
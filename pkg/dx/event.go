@@ -1,6 +1,8 @@
 package dx
 
-// BranchDeletedEvent contains all metadata about the deleted branch
+// BranchDeletedEvent contains all metadata about the deleted branch.
+// It is also the payload of pull request and ttl cleanup events, with the source branch of the pull request
+// or the branch of the expired app instances.
 type BranchDeletedEvent struct {
 	Manifests []*Manifest
 	Branch    string
@@ -0,0 +1,43 @@
+package dx
+
+import (
+	"fmt"
+	"time"
+)
+
+const AnnotationIdleAfter = "gimlet.io/idle-after"
+const AnnotationIdleTraffic = "gimlet.io/idle-traffic"
+const AnnotationSleepingSince = "gimlet.io/sleeping-since"
+const AnnotationReplicasBeforeSleep = "gimlet.io/replicas-before-sleep"
+const AnnotationWokenAt = "gimlet.io/woken-at"
+
+// AnnotationFluxReconcile stops Flux from reverting the replica count of sleeping workloads
+const AnnotationFluxReconcile = "kustomize.toolkit.fluxcd.io/reconcile"
+
+// Idle is the policy of scaling preview workloads to zero when they are not in use.
+// Sleeping previews are woken up from the dashboard, or by the next deploy.
+type Idle struct {
+	// After is the duration without deploys after which the preview is scaled to zero, eg.: 8h
+	After string `yaml:"after" json:"after"`
+	// Traffic also requires no ingress traffic for the same duration. Read from ingress-nginx metrics where available
+	Traffic bool `yaml:"traffic,omitempty" json:"traffic,omitempty"`
+}
+
+// annotateIdleWorkloads marks the deployments with the idle policy, so the agent can scale them to zero
+func annotateIdleWorkloads(manifests string, idle *Idle) (string, error) {
+	_, err := time.ParseDuration(idle.After)
+	if err != nil {
+		return "", fmt.Errorf("invalid idle duration %s: %s", idle.After, err)
+	}
+
+	return MapYamlDocuments(manifests, func(object map[string]interface{}) bool {
+		if object["kind"] != "Deployment" {
+			return false
+		}
+		setMetadata(object, "annotations", map[string]string{
+			AnnotationIdleAfter:   idle.After,
+			AnnotationIdleTraffic: fmt.Sprintf("%t", idle.Traffic),
+		})
+		return true
+	})
+}
@@ -0,0 +1,44 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_annotateIdleWorkloads(t *testing.T) {
+	manifests := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+  annotations:
+    gimlet.io/git-sha: abc123
+spec:
+  replicas: 1`
+
+	annotated, err := annotateIdleWorkloads(manifests, &Idle{After: "8h", Traffic: true})
+	assert.Nil(t, err)
+
+	docs := splitYamlDocuments(annotated)
+	assert.Equal(t, 2, len(docs))
+	assert.Contains(t, docs[0], "kind: Service")
+	assert.NotContains(t, docs[0], AnnotationIdleAfter)
+
+	var deployment map[string]interface{}
+	err = yaml.Unmarshal([]byte(docs[1]), &deployment)
+	assert.Nil(t, err)
+	annotations := deployment["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.Equal(t, "8h", annotations[AnnotationIdleAfter])
+	assert.Equal(t, "true", annotations[AnnotationIdleTraffic])
+	assert.Equal(t, "abc123", annotations["gimlet.io/git-sha"])
+
+	_, err = annotateIdleWorkloads(manifests, &Idle{After: "a while"})
+	assert.NotNil(t, err, "invalid duration should not render")
+}
@@ -0,0 +1,73 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImagePolicy restricts the container images that an environment may run
+type ImagePolicy struct {
+	// Registries is the allow-list of registries or registry paths, eg.: ghcr.io/gimlet-io. Empty allows all registries
+	Registries []string `yaml:"registries,omitempty" json:"registries,omitempty"`
+	// DenyLatest denies the latest tag, and images without a tag
+	DenyLatest bool `yaml:"denyLatest,omitempty" json:"denyLatest,omitempty"`
+	// RequireDigest requires images to be pinned with a digest, eg.: ghcr.io/gimlet-io/myapp:abc123@sha256:...
+	RequireDigest bool `yaml:"requireDigest,omitempty" json:"requireDigest,omitempty"`
+}
+
+// violations returns a reason for every rule that a container image breaks
+func (p *ImagePolicy) violations(containers []interface{}) []string {
+	var reasons []string
+	for _, c := range containers {
+		container, _ := c.(map[string]interface{})
+		name, _ := container["name"].(string)
+		image, _ := container["image"].(string)
+		for _, reason := range p.check(image) {
+			reasons = append(reasons, fmt.Sprintf("container %s: %s", name, reason))
+		}
+	}
+	return reasons
+}
+
+func (p *ImagePolicy) check(image string) []string {
+	var reasons []string
+	if image == "" {
+		return []string{"image is not set"}
+	}
+
+	name, digest, _ := strings.Cut(image, "@")
+	if len(p.Registries) > 0 && !p.allowedRegistry(name) {
+		reasons = append(reasons, fmt.Sprintf("image %s is not from an approved registry (%s)", image, strings.Join(p.Registries, ", ")))
+	}
+	if p.DenyLatest && imageTag(name) == "latest" {
+		reasons = append(reasons, fmt.Sprintf("image %s uses the latest tag", image))
+	}
+	if p.DenyLatest && imageTag(name) == "" && digest == "" {
+		reasons = append(reasons, fmt.Sprintf("image %s has no tag, it defaults to latest", image))
+	}
+	if p.RequireDigest && digest == "" {
+		reasons = append(reasons, fmt.Sprintf("image %s is not pinned with a digest", image))
+	}
+	return reasons
+}
+
+func (p *ImagePolicy) allowedRegistry(name string) bool {
+	normalized := NormalizeImage(name)
+	for _, registry := range p.Registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if strings.HasPrefix(normalized, registry+"/") ||
+			strings.HasPrefix(name, registry+"/") { // Docker Hub short names, eg.: library/nginx
+			return true
+		}
+	}
+	return false
+}
+
+// imageTag returns the tag of an image reference without a digest, or an empty string if it has no tag
+func imageTag(name string) string {
+	lastPart := name[strings.LastIndex(name, "/")+1:]
+	if _, tag, found := strings.Cut(lastPart, ":"); found {
+		return tag
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package dx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultImageTagPath = "image.tag"
+
+// ImageUpdate follows the tags of an image that is not built from the app repo, eg.: a vendor's agent.
+// When a newer tag matches the policy, the image tag is updated in the env config
+type ImageUpdate struct {
+	// Image is the image name without the tag, eg.: vendor/agent
+	Image string `yaml:"image" json:"image"`
+	// Tag is the semver range of the followed tags, eg.: `tag: { semver: "1.x" }`
+	Tag *TagPolicy `yaml:"tag" json:"tag"`
+	// Path is the dot separated path of the image tag in the values. Defaults to image.tag
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// PullRequest opens a pull request with the update, instead of committing it to the head branch
+	PullRequest bool `yaml:"pullRequest,omitempty" json:"pullRequest,omitempty"`
+}
+
+func (u *ImageUpdate) Validate() error {
+	if u.Image == "" {
+		return fmt.Errorf("image is mandatory for image updates")
+	}
+	if !u.Tag.IsSemver() {
+		return fmt.Errorf("image updates follow a semver range, eg.: `tag: { semver: \"1.x\" }`")
+	}
+	return nil
+}
+
+func (u *ImageUpdate) TagPath() []string {
+	if u.Path == "" {
+		return strings.Split(DefaultImageTagPath, ".")
+	}
+	return strings.Split(u.Path, ".")
+}
+
+// NewestTag returns the highest tag that matches the policy and is newer than the current tag,
+// or an empty string if there is none
+func (u *ImageUpdate) NewestTag(tags []string, current string) string {
+	newest := ""
+	newestVersion, err := semver.ParseTolerant(current)
+	if err != nil {
+		newestVersion = semver.Version{}
+	}
+
+	for _, tag := range tags {
+		if !u.Tag.SemverMatch(tag) {
+			continue
+		}
+		version, _ := semver.ParseTolerant(tag)
+		if version.GT(newestVersion) {
+			newest = tag
+			newestVersion = version
+		}
+	}
+	return newest
+}
+
+// ImageTag returns the image tag that the env config sets at the image update path
+func (m *Manifest) ImageTag() (string, error) {
+	if m.ImageUpdate == nil {
+		return "", fmt.Errorf("no image update policy")
+	}
+
+	var value interface{} = m.Values
+	for _, key := range m.ImageUpdate.TagPath() {
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%s is not set in values", strings.Join(m.ImageUpdate.TagPath(), "."))
+		}
+		value, ok = values[key]
+		if !ok {
+			return "", fmt.Errorf("%s is not set in values", strings.Join(m.ImageUpdate.TagPath(), "."))
+		}
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// UpdateImageTag sets the image tag in the values of a raw env config.
+// It only rewrites the tag, the rest of the file is kept as is with its comments and formatting
+func UpdateImageTag(raw string, path []string, tag string) (string, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(raw), &doc)
+	if err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 {
+		return "", fmt.Errorf("empty env config")
+	}
+
+	node := mappingValue(doc.Content[0], "values")
+	for _, key := range path {
+		node = mappingValue(node, key)
+	}
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("values.%s is not set", strings.Join(path, "."))
+	}
+
+	lines := strings.Split(raw, "\n")
+	line := lines[node.Line-1]
+	prefix, rest := line[:node.Column-1], line[node.Column-1:]
+
+	quote := ""
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		quote = `"`
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		quote = "'"
+	default:
+		if _, err := strconv.ParseFloat(tag, 64); err == nil {
+			quote = `"` // tags like 1.10 would be numbers otherwise
+		}
+	}
+
+	oldValue := node.Value
+	if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		oldValue = rest[:strings.Index(rest[1:], rest[:1])+2]
+	}
+	if !strings.HasPrefix(rest, oldValue) {
+		return "", fmt.Errorf("cannot rewrite values.%s on line %d", strings.Join(path, "."), node.Line)
+	}
+
+	lines[node.Line-1] = prefix + quote + tag + quote + rest[len(oldValue):]
+	return strings.Join(lines, "\n"), nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
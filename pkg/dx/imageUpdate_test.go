@@ -0,0 +1,89 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_newestTag(t *testing.T) {
+	imageUpdate := &ImageUpdate{
+		Image: "vendor/agent",
+		Tag:   &TagPolicy{Semver: "1.x"},
+	}
+
+	tags := []string{"latest", "0.9.0", "1.2.0", "1.10.1", "1.11.0-rc.1", "2.0.0", "v1.4.0"}
+	assert.Equal(t, "1.10.1", imageUpdate.NewestTag(tags, "1.2.0"))
+	assert.Equal(t, "", imageUpdate.NewestTag(tags, "1.10.1"), "no newer tag in the range")
+	assert.Equal(t, "1.10.1", imageUpdate.NewestTag(tags, "latest"), "non-semver current tags are replaced")
+
+	imageUpdate.Tag.Prerelease = true
+	assert.Equal(t, "1.11.0-rc.1", imageUpdate.NewestTag(tags, "1.2.0"))
+}
+
+func Test_imageTag(t *testing.T) {
+	var m Manifest
+	err := yaml.Unmarshal([]byte(`
+app: agent
+env: production
+imageUpdate:
+  image: vendor/agent
+  tag:
+    semver: 1.x
+values:
+  image:
+    repository: vendor/agent
+    tag: 1.2.0
+`), &m)
+	assert.Nil(t, err)
+	assert.Nil(t, m.ImageUpdate.Validate())
+
+	tag, err := m.ImageTag()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", tag)
+
+	m.ImageUpdate.Path = "agent.image.tag"
+	_, err = m.ImageTag()
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, (&ImageUpdate{Image: "vendor/agent", Tag: &TagPolicy{Pattern: "v*"}}).Validate(), "only semver ranges are followed")
+}
+
+func Test_updateImageTag(t *testing.T) {
+	raw := `app: agent
+env: production
+values:
+  # the vendor's agent
+  image:
+    repository: vendor/agent
+    tag: 1.2.0 # updated by Gimlet
+  sidecar:
+    image:
+      tag: "1.0.0"
+`
+	updated, err := UpdateImageTag(raw, []string{"image", "tag"}, "1.3.0")
+	assert.Nil(t, err)
+	assert.Equal(t, `app: agent
+env: production
+values:
+  # the vendor's agent
+  image:
+    repository: vendor/agent
+    tag: 1.3.0 # updated by Gimlet
+  sidecar:
+    image:
+      tag: "1.0.0"
+`, updated)
+
+	updated, err = UpdateImageTag(raw, []string{"sidecar", "image", "tag"}, "1.1.0")
+	assert.Nil(t, err)
+	assert.Contains(t, updated, `      tag: "1.1.0"`)
+
+	updated, err = UpdateImageTag(raw, []string{"image", "tag"}, "1.10")
+	assert.Nil(t, err)
+	assert.Contains(t, updated, `    tag: "1.10" # updated by Gimlet`, "numeric looking tags are quoted")
+
+	_, err = UpdateImageTag(raw, []string{"image", "digest"}, "1.3.0")
+	assert.NotNil(t, err)
+}
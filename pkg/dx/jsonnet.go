@@ -0,0 +1,74 @@
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/google/go-jsonnet"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderJsonnetToManifests evaluates a Jsonnet file that has a `configs` field holding an array of Gimlet manifests.
+// Imports are resolved from the libraries map first (keyed by import path), then from the libPaths directories.
+func RenderJsonnetToManifests(fileContent string, libraries map[string]string, libPaths []string) ([]string, error) {
+	importer := &jsonnetImporter{
+		libraries: libraries,
+	}
+	if len(libPaths) > 0 {
+		importer.fileImporter = &jsonnet.FileImporter{
+			JPaths: libPaths,
+		}
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.Importer(importer)
+
+	jsonString, err := vm.EvaluateAnonymousSnippet("environment.jsonnet", fileContent)
+	if err != nil {
+		return []string{}, fmt.Errorf("cannot parse jsonnet file: %s", err)
+	}
+
+	var parsed map[string]interface{}
+	err = json.Unmarshal([]byte(jsonString), &parsed)
+	if err != nil {
+		return []string{}, fmt.Errorf("jsonnet files should evaluate to an object: %s", err)
+	}
+
+	configs, ok := parsed["configs"].([]interface{})
+	if !ok {
+		return []string{}, fmt.Errorf("jsonnet files should have a `configs` field that holds an array of Gimlet manfiests")
+	}
+
+	var manifests []string
+	for _, config := range configs {
+		m, err := yaml.Marshal(config)
+		if err != nil {
+			return []string{}, err
+		}
+		manifests = append(manifests, string(m))
+	}
+
+	return manifests, nil
+}
+
+// jsonnetImporter serves vendored libraries that were shipped in the artifact,
+// and falls back to the local filesystem only if library paths are set, like in the CLI
+type jsonnetImporter struct {
+	libraries    map[string]string
+	fileImporter *jsonnet.FileImporter
+}
+
+func (i *jsonnetImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	for _, candidate := range []string{path.Join(path.Dir(importedFrom), importedPath), importedPath} {
+		if content, ok := i.libraries[candidate]; ok {
+			return jsonnet.MakeContents(content), candidate, nil
+		}
+	}
+
+	if i.fileImporter == nil {
+		return jsonnet.Contents{}, "", fmt.Errorf("couldn't find %s in the vendored jsonnet libraries", importedPath)
+	}
+
+	return i.fileImporter.Import(importedFrom, importedPath)
+}
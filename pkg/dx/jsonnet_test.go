@@ -0,0 +1,53 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonnetTemplate = `
+local app = import 'app.libsonnet';
+
+{
+  configs: [
+    app.new('myapp-' + instance)
+    for instance in ['first', 'second']
+  ],
+}
+`
+
+const jsonnetAppLibrary = `
+{
+  new(name):: {
+    app: name,
+    env: 'production',
+    namespace: 'production',
+    chart: {
+      repository: 'https://chart.onechart.dev',
+      name: 'cron-job',
+      version: '0.32.0',
+    },
+    values: {
+      image: {
+        repository: '<account>.dkr.ecr.eu-west-1.amazonaws.com/myapp',
+        tag: '1.1.1',
+      },
+    },
+  },
+}
+`
+
+func Test_jsonnetRender(t *testing.T) {
+	manifests, err := RenderJsonnetToManifests(jsonnetTemplate, map[string]string{
+		"app.libsonnet": jsonnetAppLibrary,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(manifests))
+
+	_, err = RenderJsonnetToManifests(jsonnetTemplate, map[string]string{}, nil)
+	assert.NotNil(t, err, "should not fall back to the filesystem without library paths")
+
+	_, err = RenderJsonnetToManifests(`{ apps: [] }`, map[string]string{}, nil)
+	assert.NotNil(t, err, "should require a configs field")
+}
@@ -2,11 +2,17 @@ package dx
 
 import (
 	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 	"sigs.k8s.io/kustomize/api/filesys"
 	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
 )
 
 const bareKustomization = `
@@ -17,8 +23,26 @@ resources:
 `
 
 func ApplyPatches(strategicMergePatch string, jsonPatches []Json6902Patch, manifests string) (string, error) {
+	return ApplyKustomize(strategicMergePatch, jsonPatches, nil, manifests)
+}
+
+// ApplyKustomize runs the in-process Kustomize API on the rendered manifests
+// with the given patches and the manifest's kustomize block
+func ApplyKustomize(strategicMergePatch string, jsonPatches []Json6902Patch, overlay *Kustomize, manifests string) (string, error) {
 	fSys := filesys.MakeFsInMemory()
-	err := fSys.WriteFile("manifests.yaml", []byte(manifests))
+	root := "."
+	if overlay != nil && len(overlay.Components) > 0 {
+		// Kustomize clones remote components to disk, it can't load them into an in-memory filesystem
+		tmpDir, err := os.MkdirTemp("", "gimlet-kustomize-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmpDir)
+		fSys = filesys.MakeFsOnDisk()
+		root = tmpDir
+	}
+
+	err := fSys.WriteFile(filepath.Join(root, "manifests.yaml"), []byte(manifests))
 	if err != nil {
 		return "", err
 	}
@@ -26,7 +50,7 @@ func ApplyPatches(strategicMergePatch string, jsonPatches []Json6902Patch, manif
 	kustomization := bareKustomization
 
 	if strategicMergePatch != "" {
-		err = fSys.WriteFile("strategicMergePatches.yaml", []byte(strategicMergePatch))
+		err = fSys.WriteFile(filepath.Join(root, "strategicMergePatches.yaml"), []byte(strategicMergePatch))
 		if err != nil {
 			return "", err
 		}
@@ -42,7 +66,7 @@ patchesStrategicMerge:
 	}
 	for _, jsonPatch := range jsonPatches {
 		fileName := uuid.NewString()
-		err = fSys.WriteFile(fileName, []byte(jsonPatch.Patch))
+		err = fSys.WriteFile(filepath.Join(root, fileName), []byte(jsonPatch.Patch))
 		if err != nil {
 			return "", err
 		}
@@ -60,13 +84,29 @@ patchesStrategicMerge:
 		kustomization += b.String()
 	}
 
-	err = fSys.WriteFile("kustomization.yaml", []byte(kustomization))
+	if overlay != nil {
+		overlayKustomization, err := overlay.kustomization(fSys, root)
+		if err != nil {
+			return "", err
+		}
+
+		var b bytes.Buffer
+		yamlEncoder := yaml.NewEncoder(&b)
+		yamlEncoder.SetIndent(2)
+		err = yamlEncoder.Encode(overlayKustomization)
+		if err != nil {
+			return "", err
+		}
+		kustomization += b.String()
+	}
+
+	err = fSys.WriteFile(filepath.Join(root, "kustomization.yaml"), []byte(kustomization))
 	if err != nil {
 		return "", err
 	}
 
 	b := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
-	resources, err := b.Run(fSys, ".")
+	resources, err := b.Run(fSys, root)
 	if err != nil {
 		return "", err
 	}
@@ -90,3 +130,118 @@ type patch struct {
 	Path   string `yaml:"path" json:"path"`
 	Target Target `yaml:"target" json:"target"`
 }
+
+// kustomization translates the kustomize block to Kustomize's own format.
+// Inline generator files and local components are written to the filesystem that Kustomize runs on.
+func (k *Kustomize) kustomization(fSys filesys.FileSystem, root string) (*types.Kustomization, error) {
+	kustomization := &types.Kustomization{
+		CommonLabels:      k.CommonLabels,
+		CommonAnnotations: k.CommonAnnotations,
+		NamePrefix:        k.NamePrefix,
+	}
+
+	for _, image := range k.Images {
+		kustomization.Images = append(kustomization.Images, types.Image{
+			Name:    image.Name,
+			NewName: image.NewName,
+			NewTag:  image.NewTag,
+			Digest:  image.Digest,
+		})
+	}
+
+	for _, replica := range k.Replicas {
+		kustomization.Replicas = append(kustomization.Replicas, types.Replica{
+			Name:  replica.Name,
+			Count: replica.Count,
+		})
+	}
+
+	for _, generator := range k.ConfigMapGenerator {
+		args, err := generator.generatorArgs(fSys, root, "configmaps")
+		if err != nil {
+			return nil, err
+		}
+		kustomization.ConfigMapGenerator = append(kustomization.ConfigMapGenerator, types.ConfigMapArgs{
+			GeneratorArgs: args,
+		})
+	}
+
+	for _, generator := range k.SecretGenerator {
+		args, err := generator.generatorArgs(fSys, root, "secrets")
+		if err != nil {
+			return nil, err
+		}
+		kustomization.SecretGenerator = append(kustomization.SecretGenerator, types.SecretArgs{
+			GeneratorArgs: args,
+			Type:          generator.Type,
+		})
+	}
+
+	for idx, component := range k.Components {
+		if isRemoteKustomization(component) {
+			kustomization.Components = append(kustomization.Components, component)
+			continue
+		}
+
+		// local components are copied next to the kustomization, so Kustomize's load restrictions stay in place
+		if filepath.IsAbs(component) || strings.HasPrefix(filepath.Clean(component), "..") {
+			return nil, fmt.Errorf("local components must be relative paths inside the working directory: %s", component)
+		}
+		componentPath := filepath.Join("components", fmt.Sprintf("%d", idx))
+		err := os.CopyFS(filepath.Join(root, componentPath), os.DirFS(component))
+		if err != nil {
+			return nil, fmt.Errorf("cannot copy component %s: %s", component, err)
+		}
+		kustomization.Components = append(kustomization.Components, componentPath)
+	}
+
+	return kustomization, nil
+}
+
+func (g *KustomizeGenerator) generatorArgs(fSys filesys.FileSystem, root string, kind string) (types.GeneratorArgs, error) {
+	args := types.GeneratorArgs{
+		Name: g.Name,
+	}
+
+	for _, key := range sortedKeys(g.Literals) {
+		args.LiteralSources = append(args.LiteralSources, fmt.Sprintf("%s=%s", key, g.Literals[key]))
+	}
+
+	for _, key := range sortedKeys(g.Files) {
+		filePath := filepath.Join(kind, g.Name, key)
+		err := fSys.MkdirAll(filepath.Join(root, kind, g.Name))
+		if err != nil {
+			return args, err
+		}
+		err = fSys.WriteFile(filepath.Join(root, filePath), []byte(g.Files[key]))
+		if err != nil {
+			return args, err
+		}
+		args.FileSources = append(args.FileSources, fmt.Sprintf("%s=%s", key, filePath))
+	}
+
+	if g.DisableNameSuffixHash {
+		args.Options = &types.GeneratorOptions{
+			DisableNameSuffixHash: true,
+		}
+	}
+
+	return args, nil
+}
+
+func isRemoteKustomization(path string) bool {
+	return strings.HasPrefix(path, "https://") ||
+		strings.HasPrefix(path, "http://") ||
+		strings.HasPrefix(path, "git@") ||
+		strings.HasPrefix(path, "ssh://") ||
+		strings.HasPrefix(path, "github.com/")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -102,3 +102,70 @@ spec:
 	assert.True(t, strings.Contains(patched, "myapp-replaced"))
 	assert.True(t, strings.Contains(patched, "Always"))
 }
+
+func Test_ApplyKustomizeOverlay(t *testing.T) {
+	manifest := `
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+  namespace: my-team
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: myapp:abcdef
+        name: myapp
+        envFrom:
+        - configMapRef:
+            name: myapp-config
+`
+
+	overlay := &Kustomize{
+		CommonLabels: map[string]string{
+			"team": "platform",
+		},
+		CommonAnnotations: map[string]string{
+			"owner": "platform@mycompany.com",
+		},
+		NamePrefix: "prod-",
+		Images: []KustomizeImage{
+			{Name: "myapp", NewName: "registry.mycompany.com/myapp", NewTag: "v1.2.3"},
+		},
+		Replicas: []KustomizeReplica{
+			{Name: "myapp", Count: 3},
+		},
+		ConfigMapGenerator: []KustomizeGenerator{
+			{
+				Name:     "myapp-config",
+				Literals: map[string]string{"LOG_LEVEL": "debug"},
+				Files:    map[string]string{"app.properties": "timeout=30"},
+			},
+		},
+		SecretGenerator: []KustomizeGenerator{
+			{
+				Name:                  "myapp-secret",
+				Literals:              map[string]string{"PASSWORD": "hunter2"},
+				DisableNameSuffixHash: true,
+			},
+		},
+	}
+
+	kustomized, err := ApplyKustomize("", []Json6902Patch{}, overlay, manifest)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(kustomized, "name: prod-myapp\n"))
+	assert.True(t, strings.Contains(kustomized, "team: platform"))
+	assert.True(t, strings.Contains(kustomized, "owner: platform@mycompany.com"))
+	assert.True(t, strings.Contains(kustomized, "image: registry.mycompany.com/myapp:v1.2.3"))
+	assert.True(t, strings.Contains(kustomized, "replicas: 3"))
+	assert.True(t, strings.Contains(kustomized, "LOG_LEVEL: debug"))
+	assert.True(t, strings.Contains(kustomized, "timeout=30"))
+	assert.True(t, strings.Contains(kustomized, "name: prod-myapp-secret\n"))
+	assert.False(t, strings.Contains(kustomized, "name: prod-myapp-config\n"), "configmap should have a hash suffix")
+	assert.True(t, strings.Contains(kustomized, "name: prod-myapp-config-"), "configmap reference should be updated to the hashed name")
+
+	_, err = ApplyKustomize("", []Json6902Patch{}, &Kustomize{Components: []string{"../outside"}}, manifest)
+	assert.NotNil(t, err, "local components must not escape the working directory")
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"regexp"
 	"strings"
 	"text/template"
@@ -14,7 +13,6 @@ import (
 	"github.com/fluxcd/pkg/apis/meta"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	terraformv1 "github.com/weaveworks/tf-controller/api/v1alpha2"
-	giturl "github.com/whilp/git-urls"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
@@ -31,8 +29,15 @@ type Manifest struct {
 	Values                map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
 	StrategicMergePatches string                 `yaml:"strategicMergePatches,omitempty" json:"strategicMergePatches,omitempty"`
 	Json6902Patches       []Json6902Patch        `yaml:"json6902Patches,omitempty" json:"json6902Patches,omitempty"`
+	Kustomize             *Kustomize             `yaml:"kustomize,omitempty" json:"kustomize,omitempty"`
 	Manifests             string                 `yaml:"manifests,omitempty" json:"manifests,omitempty"`
 	Dependencies          []Dependency           `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	Idle                  *Idle                  `yaml:"idle,omitempty" json:"idle,omitempty"`
+	Secrets               *Secrets               `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+	DependsOn             []string               `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+	HealthTimeout         string                 `yaml:"healthTimeout,omitempty" json:"healthTimeout,omitempty"`
+	Rollout               *Rollout               `yaml:"rollout,omitempty" json:"rollout,omitempty"`
+	ImageUpdate           *ImageUpdate           `yaml:"imageUpdate,omitempty" json:"imageUpdate,omitempty"`
 }
 
 type Json6902Patch struct {
@@ -47,6 +52,40 @@ type Target struct {
 	Name    string `yaml:"name" json:"name"`
 }
 
+// Kustomize holds the Kustomize features that are applied on top of the rendered chart and raw yamls
+type Kustomize struct {
+	CommonLabels       map[string]string    `yaml:"commonLabels,omitempty" json:"commonLabels,omitempty"`
+	CommonAnnotations  map[string]string    `yaml:"commonAnnotations,omitempty" json:"commonAnnotations,omitempty"`
+	NamePrefix         string               `yaml:"namePrefix,omitempty" json:"namePrefix,omitempty"`
+	Images             []KustomizeImage     `yaml:"images,omitempty" json:"images,omitempty"`
+	Replicas           []KustomizeReplica   `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	ConfigMapGenerator []KustomizeGenerator `yaml:"configMapGenerator,omitempty" json:"configMapGenerator,omitempty"`
+	SecretGenerator    []KustomizeGenerator `yaml:"secretGenerator,omitempty" json:"secretGenerator,omitempty"`
+	// Remote (git) or local Kustomize components, resolved by the CLI only
+	Components []string `yaml:"components,omitempty" json:"components,omitempty"`
+}
+
+type KustomizeImage struct {
+	Name    string `yaml:"name" json:"name"`
+	NewName string `yaml:"newName,omitempty" json:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty" json:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty" json:"digest,omitempty"`
+}
+
+type KustomizeReplica struct {
+	Name  string `yaml:"name" json:"name"`
+	Count int64  `yaml:"count" json:"count"`
+}
+
+type KustomizeGenerator struct {
+	Name     string            `yaml:"name" json:"name"`
+	Literals map[string]string `yaml:"literals,omitempty" json:"literals,omitempty"`
+	// Files are inlined, keyed by their file name in the generated resource
+	Files                 map[string]string `yaml:"files,omitempty" json:"files,omitempty"`
+	Type                  string            `yaml:"type,omitempty" json:"type,omitempty"`
+	DisableNameSuffixHash bool              `yaml:"disableNameSuffixHash,omitempty" json:"disableNameSuffixHash,omitempty"`
+}
+
 type Chart struct {
 	Repository string `yaml:"repository,omitempty" json:"repository,omitempty"`
 	Name       string `yaml:"name" json:"name"`
@@ -54,16 +93,18 @@ type Chart struct {
 }
 
 type Deploy struct {
-	Tag                   string    `yaml:"tag,omitempty" json:"tag,omitempty"`
-	Branch                string    `yaml:"branch,omitempty" json:"branch,omitempty"`
-	Event                 *GitEvent `yaml:"event,omitempty" json:"event,omitempty"`
-	CommitMessagePatterns []string  `yaml:"commitMessagePatterns,omitempty" json:"commitMessagePatterns,omitempty"`
+	Tag                   *TagPolicy `yaml:"tag,omitempty" json:"tag,omitempty"`
+	Branch                string     `yaml:"branch,omitempty" json:"branch,omitempty"`
+	Event                 *GitEvent  `yaml:"event,omitempty" json:"event,omitempty"`
+	CommitMessagePatterns []string   `yaml:"commitMessagePatterns,omitempty" json:"commitMessagePatterns,omitempty"`
 }
 
 type Cleanup struct {
 	AppToCleanup string       `yaml:"app" json:"app"`
 	Event        CleanupEvent `yaml:"event" json:"event"`
 	Branch       string       `yaml:"branch,omitempty" json:"branch,omitempty"`
+	// TTLDays is the number of days an app instance is kept without a redeploy, used with the ttl event
+	TTLDays int `yaml:"ttlDays,omitempty" json:"ttlDays,omitempty"`
 }
 
 type Dependency struct {
@@ -79,37 +120,79 @@ func (d *Dependency) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
-	d.Name = dat["name"].(string)
+	d.Name, _ = dat["name"].(string)
 	if _, ok := dat["kind"]; !ok {
 		return fmt.Errorf("kind is mandatory for dependency")
 	}
-	d.Kind = dat["kind"].(string)
+	d.Kind, _ = dat["kind"].(string)
 
 	switch d.Kind {
 	case "terraform":
-		dat = dat["spec"].(map[string]interface{})
-		module := dat["module"].(map[string]interface{})
-		tfSpec := TFSpec{
-			Module: Module{
-				Url: module["url"].(string),
-			},
-			Values: dat["values"].(map[string]interface{}),
+		tfSpec, err := parseTFSpec(dat["spec"])
+		if err != nil {
+			return err
 		}
-		if val, ok := module["secret"]; ok {
-			tfSpec.Module.Secret = val.(string)
+		d.Spec = tfSpec
+	case "helm":
+		helmSpec, err := parseHelmSpec(dat["spec"])
+		if err != nil {
+			return err
 		}
-		if val, ok := dat["secret"]; ok {
-			tfSpec.Secret = val.(string)
+		d.Spec = helmSpec
+	case "kustomize":
+		kustomizeSpec, err := parseKustomizeSpec(dat["spec"])
+		if err != nil {
+			return err
 		}
-		d.Spec = tfSpec
+		d.Spec = kustomizeSpec
+	case "manifest":
+		manifestSpec, err := parseManifestSpec(dat["spec"])
+		if err != nil {
+			return err
+		}
+		d.Spec = manifestSpec
+	default:
+		// stored artifacts and env configs may have kinds that this version doesn't know, they fail at render time
+		d.Spec = dat["spec"]
 	}
 	return nil
 }
 
+func parseTFSpec(spec interface{}) (TFSpec, error) {
+	var tfSpec TFSpec
+	dat, ok := spec.(map[string]interface{})
+	if !ok {
+		return tfSpec, fmt.Errorf("spec is mandatory for terraform dependencies")
+	}
+	module, ok := dat["module"].(map[string]interface{})
+	if !ok {
+		return tfSpec, fmt.Errorf("module is mandatory for terraform dependencies")
+	}
+	tfSpec.Module.Url, _ = module["url"].(string)
+	tfSpec.Module.Secret, _ = module["secret"].(string)
+	tfSpec.Values, _ = dat["values"].(map[string]interface{})
+	tfSpec.Secret, _ = dat["secret"].(string)
+	if val, ok := dat["approval"]; ok {
+		tfSpec.Approval, _ = val.(string)
+		if tfSpec.Approval != TFApprovalAuto && tfSpec.Approval != TFApprovalManual {
+			return tfSpec, fmt.Errorf("terraform approval must be either %s or %s", TFApprovalAuto, TFApprovalManual)
+		}
+	}
+	tfSpec.DestroyOnCleanup, _ = dat["destroyOnCleanup"].(bool)
+	return tfSpec, nil
+}
+
+const TFApprovalAuto = "auto"
+const TFApprovalManual = "manual"
+
 type TFSpec struct {
 	Module Module                 `yaml:"module" json:"module"`
 	Values map[string]interface{} `yaml:"values" json:"values"`
 	Secret string                 `yaml:"secret" json:"secret"`
+	// Approval is either auto (default) or manual. Manual approval requires a user to approve the plan on the dashboard
+	Approval string `yaml:"approval,omitempty" json:"approval,omitempty"`
+	// DestroyOnCleanup destroys the Terraform managed resources when the app is deleted, eg by a preview cleanup policy
+	DestroyOnCleanup bool `yaml:"destroyOnCleanup,omitempty" json:"destroyOnCleanup,omitempty"`
 }
 
 type Module struct {
@@ -150,11 +233,16 @@ func (m *Manifest) PrepPreview(ingressHost string) {
 
 	m.Deploy = &Deploy{Event: PushPtr(), Branch: "!{main,master}"}
 
-	m.Cleanup = &Cleanup{
+	cleanup := &Cleanup{
 		AppToCleanup: m.App,
 		Event:        BranchDeleted,
 		Branch:       "*",
 	}
+	if m.Cleanup != nil { // previews can be cleaned up on other events, eg. when the pull request is closed
+		cleanup.Event = m.Cleanup.Event
+		cleanup.TTLDays = m.Cleanup.TTLDays
+	}
+	m.Cleanup = cleanup
 }
 
 func (m *Manifest) ResolveVars(vars map[string]string) error {
@@ -189,6 +277,17 @@ func (m *Manifest) ResolveVars(vars map[string]string) error {
 		return err
 	}
 
+	// dependency outputs are derived from the resolved app name
+	app, err := resolveString(m.App, functions, resolvedVars)
+	if err != nil {
+		return err
+	}
+	namespace, err := resolveString(m.Namespace, functions, resolvedVars)
+	if err != nil {
+		return err
+	}
+	functions["dependency"] = dependencyOutputFunc(m.Dependencies, app, namespace)
+
 	// then resolving the manifest
 	cleanupBkp := m.Cleanup
 	m.Cleanup = nil // cleanup only supports the BRANCH variable, not resolving it here
@@ -215,7 +314,23 @@ func (m *Manifest) ResolveVars(vars map[string]string) error {
 	return err
 }
 
-func (m *Manifest) Render() (string, error) {
+func resolveString(str string, functions map[string]interface{}, vars map[string]string) (string, error) {
+	tpl, err := template.New("").
+		Option("missingkey=error").
+		Funcs(functions).
+		Parse(str)
+	if err != nil {
+		return "", err
+	}
+
+	var templated bytes.Buffer
+	err = tpl.Execute(&templated, vars)
+	return templated.String(), err
+}
+
+// Render templates the chart, raw yamls, patches and dependencies of the manifest.
+// Every object gets the standard Gimlet labels and annotations, with the release metadata if release is set.
+func (m *Manifest) Render(release *Release) (string, error) {
 	var templatedManifests string
 	var err error
 	if m.Chart.Name != "" {
@@ -231,11 +346,12 @@ func (m *Manifest) Render() (string, error) {
 		return templatedManifests, fmt.Errorf("no chart or raw yaml has been found")
 	}
 
-	// Check for patches
-	if m.StrategicMergePatches != "" || len(m.Json6902Patches) > 0 {
-		templatedManifests, err = ApplyPatches(
+	// Check for patches and Kustomize overlays
+	if m.StrategicMergePatches != "" || len(m.Json6902Patches) > 0 || m.Kustomize != nil {
+		templatedManifests, err = ApplyKustomize(
 			m.StrategicMergePatches,
 			m.Json6902Patches,
+			m.Kustomize,
 			templatedManifests,
 		)
 		if err != nil {
@@ -243,6 +359,28 @@ func (m *Manifest) Render() (string, error) {
 		}
 	}
 
+	if m.Idle != nil && m.Preview != nil && *m.Preview {
+		templatedManifests, err = annotateIdleWorkloads(templatedManifests, m.Idle)
+		if err != nil {
+			return "", fmt.Errorf("cannot apply idle policy %s", err)
+		}
+	}
+
+	if m.Rollout != nil {
+		templatedManifests, err = renderRollout(templatedManifests, m)
+		if err != nil {
+			return "", fmt.Errorf("cannot render rollout %s", err)
+		}
+	}
+
+	if m.Secrets != nil {
+		secrets, err := renderSecrets(m)
+		if err != nil {
+			return "", fmt.Errorf("cannot render secrets %s", err)
+		}
+		templatedManifests += secrets
+	}
+
 	for _, dependency := range m.Dependencies {
 		renderredDep, err := renderDependency(dependency, m)
 		if err != nil {
@@ -251,6 +389,11 @@ func (m *Manifest) Render() (string, error) {
 		templatedManifests += renderredDep
 	}
 
+	templatedManifests, err = injectStandardMetadata(templatedManifests, m, release)
+	if err != nil {
+		return "", fmt.Errorf("cannot add standard labels and annotations %s", err)
+	}
+
 	return templatedManifests, nil
 }
 
@@ -258,40 +401,23 @@ func renderDependency(dependency Dependency, manifest *Manifest) (string, error)
 	depString := ""
 	switch dependency.Kind {
 	case "terraform":
-		tfSpec := dependency.Spec.(TFSpec)
-
-		gitAddress, err := giturl.Parse(tfSpec.Module.Url)
-		if err != nil {
-			return "", fmt.Errorf("cannot parse dependency's git address: %s", err)
+		tfSpec, ok := dependency.Spec.(TFSpec)
+		if !ok {
+			return "", fmt.Errorf("invalid terraform dependency spec: %s", dependency.Name)
 		}
-		moduleUrl := strings.ReplaceAll(tfSpec.Module.Url, gitAddress.RawQuery, "")
-		moduleUrl = strings.ReplaceAll(moduleUrl, "?", "")
 
-		params, _ := url.ParseQuery(gitAddress.RawQuery)
-		branch := ""
-		if v, found := params["branch"]; found {
-			branch = v[0]
-		}
-		tag := ""
-		if v, found := params["tag"]; found {
-			tag = v[0]
-		}
-		sha := ""
-		if v, found := params["sha"]; found {
-			sha = v[0]
-		}
-		path := ""
-		if v, found := params["path"]; found {
-			path = v[0]
+		source, err := parseGitSource(tfSpec.Module.Url)
+		if err != nil {
+			return "", err
 		}
 
 		gitRepoBytes, err := renderTFGitRepo(
 			manifest.App+"-"+dependency.Name,
 			manifest.Namespace,
-			moduleUrl,
-			branch,
-			tag,
-			sha,
+			source.url,
+			source.branch,
+			source.tag,
+			source.sha,
 			tfSpec.Module.Secret,
 		)
 		if err != nil {
@@ -303,20 +429,53 @@ func renderDependency(dependency Dependency, manifest *Manifest) (string, error)
 		tfKindBytes, err := renderTFKind(
 			manifest.App+"-"+dependency.Name,
 			manifest.Namespace,
-			moduleUrl,
-			branch,
-			tag,
-			sha,
-			path,
+			source.url,
+			source.branch,
+			source.tag,
+			source.sha,
+			source.path,
 			tfSpec.Secret,
 			tfSpec.Values,
+			tfSpec.Approval == TFApprovalManual,
+			tfSpec.DestroyOnCleanup,
 		)
 		if err != nil {
 			return "", err
 		}
 		depString += "---\n"
 		depString += string(tfKindBytes)
-
+	case "helm":
+		helmSpec, ok := dependency.Spec.(HelmSpec)
+		if !ok {
+			return "", fmt.Errorf("invalid helm dependency spec: %s", dependency.Name)
+		}
+		return renderHelmDependency(manifest.App+"-"+dependency.Name, helmSpec, manifest)
+	case "kustomize":
+		kustomizeSpec, ok := dependency.Spec.(KustomizeSpec)
+		if !ok {
+			return "", fmt.Errorf("invalid kustomize dependency spec: %s", dependency.Name)
+		}
+		return renderGitKustomization(
+			manifest.App+"-"+dependency.Name,
+			manifest.Namespace,
+			kustomizeSpec.Url,
+			kustomizeSpec.Secret,
+			kustomizeSpec.Substitute,
+		)
+	case "manifest":
+		manifestSpec, ok := dependency.Spec.(ManifestSpec)
+		if !ok {
+			return "", fmt.Errorf("invalid manifest dependency spec: %s", dependency.Name)
+		}
+		return renderGitKustomization(
+			manifest.App+"-"+dependency.Name,
+			manifest.Namespace,
+			manifestSpec.Url,
+			manifestSpec.Secret,
+			nil,
+		)
+	default:
+		return "", fmt.Errorf("unknown dependency kind: %s", dependency.Kind)
 	}
 	return depString, nil
 }
@@ -372,6 +531,8 @@ func renderTFKind(
 	path string,
 	secretName string,
 	vars map[string]interface{},
+	manualApproval bool,
+	destroyOnDeletion bool,
 ) ([]byte, error) {
 	terraform := terraformv1.Terraform{
 		TypeMeta: metav1.TypeMeta{
@@ -401,16 +562,27 @@ func renderTFKind(
 					Name: secretName,
 				},
 			},
-			Vars: []terraformv1.Variable{},
+			Vars:                       []terraformv1.Variable{},
+			DestroyResourcesOnDeletion: destroyOnDeletion,
 		},
 	}
 
+	if manualApproval {
+		// tf-controller stops at the plan, and stores it for review until its ID is set in ApprovePlan
+		terraform.Spec.ApprovePlan = ""
+		terraform.Spec.StoreReadablePlan = "human"
+	}
+
 	for k, v := range vars {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot serialize terraform value %s: %s", k, err)
+		}
 		terraform.Spec.Vars = append(
 			terraform.Spec.Vars,
 			terraformv1.Variable{
 				Name:  k,
-				Value: &v1.JSON{Raw: []byte("\"" + v.(string) + "\"")},
+				Value: &v1.JSON{Raw: value},
 			},
 		)
 	}
@@ -206,6 +206,44 @@ dependencies:
 	}
 }
 
+func Test_renderTFDependencyWithManualApproval(t *testing.T) {
+	manifestString := `
+app: hello
+manifests: |
+  ---
+  hello: yo
+dependencies:
+- name: my-db
+  kind: terraform
+  spec:
+    module:
+      url: https://github.com/gimlet-io/tfmodules?sha=xyz&path=azure/postgresql-flexible-server-database
+    values:
+      database: my-app
+    secret: db-admin-secret
+    approval: manual
+    destroyOnCleanup: true
+`
+
+	var m Manifest
+	err := yaml.Unmarshal([]byte(manifestString), &m)
+	if assert.NoError(t, err) {
+		renderredDep, err := renderDependency(m.Dependencies[0], &m)
+		if assert.NoError(t, err) {
+			assert.False(t, strings.Contains(string(renderredDep), "approvePlan: auto"), "plan must not be auto approved")
+			assert.True(t, strings.Contains(string(renderredDep), "storeReadablePlan: human"), "readable plan must be stored for review")
+			assert.True(t, strings.Contains(string(renderredDep), "destroyResourcesOnDeletion: true"), "resources must be destroyed on cleanup")
+		}
+	}
+
+	invalidManifest := strings.Replace(manifestString, "approval: manual", "approval: sometimes", 1)
+	err = yaml.Unmarshal([]byte(invalidManifest), &m)
+	if err == nil {
+		_, err = renderDependency(m.Dependencies[0], &m)
+	}
+	assert.Error(t, err, "approval must be either auto or manual")
+}
+
 func Test_PrepPreview(t *testing.T) {
 	notPreview := &Manifest{
 		App:       "my-app",
@@ -255,6 +293,23 @@ func Test_PrepPreview(t *testing.T) {
 
 	assert.NotNil(t, preview.Cleanup)
 	assert.Equal(t, "my-app-{{ .BRANCH | sanitizeDNSName }}", preview.Cleanup.AppToCleanup)
+	assert.Equal(t, BranchDeleted, preview.Cleanup.Event)
+
+	previewWithTTL := &Manifest{
+		App:       "my-app-preview",
+		Namespace: "my-namespace",
+		Preview:   &boolTrue,
+		Cleanup: &Cleanup{
+			Event:   TTL,
+			TTLDays: 7,
+		},
+	}
+
+	previewWithTTL.PrepPreview("")
+	assert.Equal(t, TTL, previewWithTTL.Cleanup.Event)
+	assert.Equal(t, 7, previewWithTTL.Cleanup.TTLDays)
+	assert.Equal(t, "*", previewWithTTL.Cleanup.Branch)
+	assert.Equal(t, "my-app-{{ .BRANCH | sanitizeDNSName }}", previewWithTTL.Cleanup.AppToCleanup)
 }
 
 func Test_PrepPreview_Ingress(t *testing.T) {
@@ -293,3 +348,167 @@ func Test_PrepPreview_Ingress(t *testing.T) {
 	assert.Equal(t, "my-app-{{ .BRANCH | sanitizeDNSName }}-blabla.gimlet.app", ingressValues["host"])
 
 }
+
+func Test_dependencyUnmarshalValidation(t *testing.T) {
+	manifestString := `
+app: hello
+dependencies:
+- name: my-redis
+  kind: helm
+  spec:
+    chart:
+      name: redis
+`
+	var m Manifest
+	err := yaml.Unmarshal([]byte(manifestString), &m)
+	assert.Error(t, err, "chart repository is mandatory")
+
+	manifestString = `
+app: hello
+dependencies:
+- name: my-queue
+  kind: kustomize
+  spec:
+    secret: xx
+`
+	err = yaml.Unmarshal([]byte(manifestString), &m)
+	assert.Error(t, err, "url is mandatory")
+
+	manifestString = `
+app: hello
+dependencies:
+- name: my-queue
+  kind: unknown
+  spec:
+    size: small
+`
+	m = Manifest{}
+	err = yaml.Unmarshal([]byte(manifestString), &m)
+	assert.NoError(t, err, "unknown kinds should not fail parsing")
+	_, err = renderDependency(m.Dependencies[0], &m)
+	assert.Error(t, err, "unknown kinds should fail rendering")
+
+	manifestString = `
+app: hello
+dependencies:
+- name: my-db
+  kind: terraform
+  spec:
+    module:
+      url: https://github.com/gimlet-io/tfmodules?branch=main&path=azure/postgresql-flexible-server-instance
+`
+	m = Manifest{}
+	err = yaml.Unmarshal([]byte(manifestString), &m)
+	assert.NoError(t, err, "terraform values are optional")
+
+	manifestString = `
+app: hello
+dependencies:
+- name: my-db
+  kind: terraform
+`
+	err = yaml.Unmarshal([]byte(manifestString), &m)
+	assert.Error(t, err, "terraform spec is mandatory")
+}
+
+func Test_renderHelmKustomizeAndManifestDependencies(t *testing.T) {
+	manifestString := `
+app: hello
+namespace: my-team
+manifests: |
+  ---
+  hello: yo
+dependencies:
+- name: redis
+  kind: helm
+  spec:
+    chart:
+      repository: oci://registry-1.docker.io/bitnamicharts
+      name: redis
+      version: 19.0.0
+    values:
+      architecture: standalone
+- name: queue
+  kind: kustomize
+  spec:
+    url: https://github.com/gimlet-io/kustomizations?tag=v1.0.0&path=rabbitmq
+    substitute:
+      size: small
+- name: crds
+  kind: manifest
+  spec:
+    url: https://github.com/gimlet-io/manifests?branch=main&path=crds
+    secret: gitDeployKey
+`
+
+	var m Manifest
+	err := yaml.Unmarshal([]byte(manifestString), &m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	helmDep, err := renderDependency(m.Dependencies[0], &m)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.Contains(helmDep, "kind: HelmRepository"), "helm repository must be generated")
+		assert.True(t, strings.Contains(helmDep, "type: oci"), "oci repositories must be flagged")
+		assert.True(t, strings.Contains(helmDep, "kind: HelmRelease"), "helm release must be generated")
+		assert.True(t, strings.Contains(helmDep, "releaseName: hello-redis"), "release name must be prefixed with the app name")
+		assert.True(t, strings.Contains(helmDep, "architecture: standalone"), "values must be set")
+	}
+
+	kustomizeDep, err := renderDependency(m.Dependencies[1], &m)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.Contains(kustomizeDep, "kind: GitRepository"), "git repository must be generated")
+		assert.True(t, strings.Contains(kustomizeDep, "tag: v1.0.0"), "git tag must be set")
+		assert.True(t, strings.Contains(kustomizeDep, "kind: Kustomization"), "kustomization must be generated")
+		assert.True(t, strings.Contains(kustomizeDep, "path: rabbitmq"), "path must be set")
+		assert.True(t, strings.Contains(kustomizeDep, "size: small"), "substitutions must be set")
+	}
+
+	manifestDep, err := renderDependency(m.Dependencies[2], &m)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.Contains(manifestDep, "branch: main"), "git branch must be set")
+		assert.True(t, strings.Contains(manifestDep, "name: gitDeployKey"), "git secret must be set")
+		assert.True(t, strings.Contains(manifestDep, "path: crds"), "path must be set")
+	}
+}
+
+func Test_dependencyOutputsInValues(t *testing.T) {
+	manifestString := `
+app: hello-{{ .POSTFIX }}
+namespace: my-team
+values:
+  redisHost: '{{ dependency "redis" "releaseName" }}-master'
+  dbSecret: '{{ dependency "db" "secretName" }}'
+dependencies:
+- name: redis
+  kind: helm
+  spec:
+    chart:
+      repository: https://charts.bitnami.com/bitnami
+      name: redis
+- name: db
+  kind: terraform
+  spec:
+    module:
+      url: https://github.com/gimlet-io/tfmodules?tag=v1.0.0&path=aws/rds
+    values:
+      size: 1GB
+`
+
+	var m Manifest
+	err := yaml.Unmarshal([]byte(manifestString), &m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = m.ResolveVars(map[string]string{"POSTFIX": "test"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello-test-redis-master", m.Values["redisHost"])
+		assert.Equal(t, "hello-test-db-output", m.Values["dbSecret"])
+	}
+
+	m.Values["missing"] = `{{ dependency "postgres" "secretName" }}`
+	err = m.ResolveVars(map[string]string{"POSTFIX": "test"})
+	assert.Error(t, err, "unknown dependencies must fail the resolution")
+}
@@ -0,0 +1,126 @@
+package dx
+
+import (
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const LabelApp = "gimlet.io/app"
+const LabelEnv = "gimlet.io/env"
+
+const AnnotationApp = "gimlet.io/app"
+const AnnotationEnv = "gimlet.io/env"
+const AnnotationGitSha = "gimlet.io/git-sha"
+const AnnotationGitBranch = "gimlet.io/git-branch"
+const AnnotationGitRepository = "gimlet.io/git-repository"
+const AnnotationArtifactID = "gimlet.io/artifact-id"
+const AnnotationTriggeredBy = "gimlet.io/triggered-by"
+
+var invalidLabelValueChars = regexp.MustCompile("[^0-9A-Za-z_.-]+")
+
+// injectStandardMetadata labels and annotates every rendered object with the Gimlet app and env,
+// and the release metadata when there is one, so objects of any chart show up in the dashboard.
+// Labels and annotations set by the chart are kept, SOPS encrypted objects are not touched.
+func injectStandardMetadata(manifests string, m *Manifest, release *Release) (string, error) {
+	labels := map[string]string{
+		LabelApp: labelValue(m.App),
+		LabelEnv: labelValue(m.Env),
+	}
+	annotations := map[string]string{
+		AnnotationApp: m.App,
+		AnnotationEnv: m.Env,
+	}
+	if release != nil {
+		annotations[AnnotationArtifactID] = release.ArtifactID
+		annotations[AnnotationTriggeredBy] = release.TriggeredBy
+		if release.Version != nil {
+			annotations[AnnotationGitSha] = release.Version.SHA
+			annotations[AnnotationGitBranch] = release.Version.Branch
+			annotations[AnnotationGitRepository] = release.Version.RepositoryName
+		}
+	}
+
+	return MapYamlDocuments(manifests, func(object map[string]interface{}) bool {
+		if isSopsEncrypted(object) { // the sops MAC covers the whole object
+			return false
+		}
+		setMetadata(object, "labels", labels)
+		setMetadata(object, "annotations", annotations)
+		return true
+	})
+}
+
+// setMetadata sets the non-empty values under metadata.<field> that the object doesn't have yet
+func setMetadata(object map[string]interface{}, field string, values map[string]string) {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	existing, _ := metadata[field].(map[string]interface{})
+	if existing == nil {
+		existing = map[string]interface{}{}
+	}
+	for k, v := range values {
+		if _, ok := existing[k]; ok || v == "" {
+			continue
+		}
+		existing[k] = v
+	}
+	if len(existing) > 0 {
+		metadata[field] = existing
+	}
+	object["metadata"] = metadata
+}
+
+// labelValue makes a string a valid Kubernetes label value
+func labelValue(str string) string {
+	str = invalidLabelValueChars.ReplaceAllString(str, "-")
+	if len(str) > 63 {
+		str = str[0:63]
+	}
+	return strings.Trim(str, "-_.")
+}
+
+// MapYamlDocuments calls mutate on every object of a multi-document yaml.
+// Documents are only re-serialized if mutate changed them, and their leading comments,
+// like the `# Source:` lines of Helm that SplitHelmOutput relies on, are kept.
+func MapYamlDocuments(manifests string, mutate func(object map[string]interface{}) bool) (string, error) {
+	var docs []string
+	for _, doc := range splitYamlDocuments(manifests) {
+		doc = strings.TrimPrefix(doc, "\n")
+		if !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+
+		var object map[string]interface{}
+		err := yaml.Unmarshal([]byte(doc), &object)
+		if err != nil {
+			return "", err
+		}
+		if object == nil || !mutate(object) {
+			docs = append(docs, doc)
+			continue
+		}
+
+		mutated, err := yaml.Marshal(object)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, leadingComments(doc)+string(mutated))
+	}
+
+	return "---\n" + strings.Join(docs, "---\n"), nil
+}
+
+func leadingComments(doc string) string {
+	comments := ""
+	for _, line := range strings.SplitAfter(doc, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+		comments += line
+	}
+	return comments
+}
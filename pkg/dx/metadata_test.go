@@ -0,0 +1,77 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_injectStandardMetadata(t *testing.T) {
+	manifests := `---
+# Source: my-chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+  annotations:
+    gimlet.io/git-sha: set-by-the-chart
+spec:
+  selector:
+    app: my-app
+---
+# Source: my-chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+`
+
+	m := &Manifest{App: "my-app", Env: "staging"}
+	release := &Release{
+		ArtifactID:  "my-app-123",
+		TriggeredBy: "policy",
+		Version: &Version{
+			RepositoryName: "gimlet-io/my-app",
+			SHA:            "abc123",
+			Branch:         "feature/my-branch",
+		},
+	}
+
+	injected, err := injectStandardMetadata(manifests, m, release)
+	assert.Nil(t, err)
+
+	files := SplitHelmOutput(map[string]string{"manifest.yaml": injected})
+	assert.Equal(t, 2, len(files), "helm source comments should be kept")
+
+	var service map[string]interface{}
+	err = yaml.Unmarshal([]byte(files["service.yaml"]), &service)
+	assert.Nil(t, err)
+	metadata := service["metadata"].(map[string]interface{})
+	annotations := metadata["annotations"].(map[string]interface{})
+	assert.Equal(t, "set-by-the-chart", annotations[AnnotationGitSha], "chart annotations should be kept")
+	assert.Equal(t, "gimlet-io/my-app", annotations[AnnotationGitRepository])
+	assert.Equal(t, "feature/my-branch", annotations[AnnotationGitBranch])
+	assert.Equal(t, "my-app-123", annotations[AnnotationArtifactID])
+	assert.Equal(t, "policy", annotations[AnnotationTriggeredBy])
+	labels := metadata["labels"].(map[string]interface{})
+	assert.Equal(t, "my-app", labels[LabelApp])
+	assert.Equal(t, "staging", labels[LabelEnv])
+	assert.Equal(t, "my-app", service["spec"].(map[string]interface{})["selector"].(map[string]interface{})["app"])
+
+	var deployment map[string]interface{}
+	err = yaml.Unmarshal([]byte(files["deployment.yaml"]), &deployment)
+	assert.Nil(t, err)
+	annotations = deployment["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.Equal(t, "abc123", annotations[AnnotationGitSha])
+
+	injected, err = injectStandardMetadata(manifests, m, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, injected, AnnotationArtifactID, "without a release only the app and env is set")
+	assert.Contains(t, injected, AnnotationEnv)
+}
+
+func Test_labelValue(t *testing.T) {
+	assert.Equal(t, "preview-feature-my-branch", labelValue("preview-feature/my-branch"))
+	assert.True(t, len(labelValue("a-very-long-app-name-that-does-not-fit-into-a-kubernetes-label-value")) <= 63)
+}
@@ -0,0 +1,424 @@
+package dx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"sigs.k8s.io/yaml"
+)
+
+const PolicyTargetManifest = "manifest"
+const PolicyTargetObject = "object"
+const PolicyTargetArtifact = "artifact"
+const PolicyTargetImage = "image"
+
+const PolicyWarn = "warn"
+const PolicyDeny = "deny"
+const PolicyOff = "off"
+
+// Policy is an organization rule that Gimlet manifests or the rendered Kubernetes objects must comply with.
+//
+// Rule is a CEL expression that evaluates to true if the checked item complies. Variables available in rules:
+// `manifest` the Gimlet manifest, `env` the environment name,
+// for object policies `object` the rendered Kubernetes object,
+// `containers` and `volumes` of the object's pod spec, if it has one,
+// and for artifact policies `artifact` the released artifact and `attachments` its SBOMs, provenance, test and coverage reports,
+// eg.: `attachments.exists(a, a.type == "provenance")`.
+//
+// Image policies have no rule, they check every container image of the rendered objects against the Image settings.
+type Policy struct {
+	Name string `yaml:"name" json:"name"`
+	// Target is manifest, object, artifact or image, defaults to object
+	Target  string       `yaml:"target,omitempty" json:"target,omitempty"`
+	Rule    string       `yaml:"rule,omitempty" json:"rule,omitempty"`
+	Image   *ImagePolicy `yaml:"image,omitempty" json:"image,omitempty"`
+	Message string       `yaml:"message,omitempty" json:"message,omitempty"`
+	// Enforcement is either warn or deny, defaults to deny
+	Enforcement string `yaml:"enforcement,omitempty" json:"enforcement,omitempty"`
+	// Envs overrides the enforcement level per environment. Use `off` to skip the policy in an environment
+	Envs map[string]string `yaml:"envs,omitempty" json:"envs,omitempty"`
+}
+
+// PolicyFile is the format of policy files in the infra repo or in the policy directory
+type PolicyFile struct {
+	Policies []Policy `yaml:"policies" json:"policies"`
+}
+
+type PolicyViolation struct {
+	Policy      string `json:"policy"`
+	Object      string `json:"object,omitempty"`
+	Message     string `json:"message"`
+	Enforcement string `json:"enforcement"`
+}
+
+func (v PolicyViolation) String() string {
+	if v.Object != "" {
+		return fmt.Sprintf("%s: %s (%s, %s)", v.Object, v.Message, v.Policy, v.Enforcement)
+	}
+	return fmt.Sprintf("%s (%s, %s)", v.Message, v.Policy, v.Enforcement)
+}
+
+type compiledPolicy struct {
+	Policy
+	program cel.Program
+}
+
+// PolicyEngine evaluates a set of compiled policies
+type PolicyEngine struct {
+	policies []compiledPolicy
+}
+
+// NewPolicyEngine validates and compiles the policies
+func NewPolicyEngine(policies []Policy) (*PolicyEngine, error) {
+	celEnv, err := cel.NewEnv(
+		cel.Variable("manifest", cel.DynType),
+		cel.Variable("env", cel.StringType),
+		cel.Variable("object", cel.DynType),
+		cel.Variable("containers", cel.ListType(cel.DynType)),
+		cel.Variable("volumes", cel.ListType(cel.DynType)),
+		cel.Variable("artifact", cel.DynType),
+		cel.Variable("attachments", cel.ListType(cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &PolicyEngine{}
+	for _, policy := range policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("policy name is mandatory")
+		}
+		if policy.Target == "" {
+			policy.Target = PolicyTargetObject
+		}
+		if policy.Target != PolicyTargetManifest && policy.Target != PolicyTargetObject &&
+			policy.Target != PolicyTargetArtifact && policy.Target != PolicyTargetImage {
+			return nil, fmt.Errorf("policy %s: target must be %s, %s, %s or %s",
+				policy.Name, PolicyTargetManifest, PolicyTargetObject, PolicyTargetArtifact, PolicyTargetImage)
+		}
+		if policy.Enforcement == "" {
+			policy.Enforcement = PolicyDeny
+		}
+		for _, enforcement := range append([]string{policy.Enforcement}, sortedValues(policy.Envs)...) {
+			if enforcement != PolicyWarn && enforcement != PolicyDeny && enforcement != PolicyOff {
+				return nil, fmt.Errorf("policy %s: enforcement must be one of %s, %s or %s", policy.Name, PolicyWarn, PolicyDeny, PolicyOff)
+			}
+		}
+
+		if policy.Target == PolicyTargetImage {
+			if policy.Image == nil {
+				return nil, fmt.Errorf("policy %s: image settings are mandatory for image policies", policy.Name)
+			}
+			engine.policies = append(engine.policies, compiledPolicy{Policy: policy})
+			continue
+		}
+
+		ast, issues := celEnv.Compile(policy.Rule)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("policy %s: cannot compile rule: %s", policy.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("policy %s: rule must evaluate to a bool", policy.Name)
+		}
+		program, err := celEnv.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %s", policy.Name, err)
+		}
+
+		engine.policies = append(engine.policies, compiledPolicy{Policy: policy, program: program})
+	}
+
+	return engine, nil
+}
+
+// Evaluate checks the manifest and the objects it rendered against the policies
+func (e *PolicyEngine) Evaluate(manifest *Manifest, renderedManifests string) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+	if e == nil || len(e.policies) == 0 {
+		return violations, nil
+	}
+
+	var manifestMap map[string]interface{}
+	err := remarshal(manifest, &manifestMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert manifest: %s", err)
+	}
+
+	var objects []map[string]interface{}
+	for _, doc := range splitYamlDocuments(renderedManifests) {
+		var object map[string]interface{}
+		err := yaml.Unmarshal([]byte(doc), &object)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse rendered manifests: %s", err)
+		}
+		if len(object) > 0 {
+			objects = append(objects, object)
+		}
+	}
+
+	for _, policy := range e.policies {
+		enforcement := policy.enforcement(manifest.Env)
+		if enforcement == PolicyOff || policy.Target == PolicyTargetArtifact {
+			continue
+		}
+
+		message := policy.Message
+		if message == "" {
+			message = fmt.Sprintf("violates %s", policy.Rule)
+		}
+
+		if policy.Target == PolicyTargetImage {
+			for _, object := range objects {
+				containers, _ := podSpecParts(object)
+				for _, reason := range policy.Image.violations(containers) {
+					if policy.Message != "" {
+						reason = policy.Message + ": " + reason
+					}
+					violations = append(violations, PolicyViolation{
+						Policy:      policy.Name,
+						Object:      objectID(object),
+						Message:     reason,
+						Enforcement: enforcement,
+					})
+				}
+			}
+			continue
+		}
+
+		if policy.Target == PolicyTargetManifest {
+			vars := map[string]interface{}{
+				"manifest":    manifestMap,
+				"env":         manifest.Env,
+				"object":      map[string]interface{}{},
+				"containers":  []interface{}{},
+				"volumes":     []interface{}{},
+				"artifact":    map[string]interface{}{},
+				"attachments": []interface{}{},
+			}
+			if complies, evalErr := evaluatePolicy(policy.program, vars); !complies {
+				violations = append(violations, PolicyViolation{
+					Policy:      policy.Name,
+					Message:     messageWithError(message, evalErr),
+					Enforcement: enforcement,
+				})
+			}
+			continue
+		}
+
+		for _, object := range objects {
+			containers, volumes := podSpecParts(object)
+			vars := map[string]interface{}{
+				"manifest":    manifestMap,
+				"env":         manifest.Env,
+				"object":      object,
+				"containers":  containers,
+				"volumes":     volumes,
+				"artifact":    map[string]interface{}{},
+				"attachments": []interface{}{},
+			}
+			if complies, evalErr := evaluatePolicy(policy.program, vars); !complies {
+				violations = append(violations, PolicyViolation{
+					Policy:      policy.Name,
+					Object:      objectID(object),
+					Message:     messageWithError(message, evalErr),
+					Enforcement: enforcement,
+				})
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// EvaluateArtifact checks the artifact that is released with the manifest against the artifact policies
+func (e *PolicyEngine) EvaluateArtifact(manifest *Manifest, artifact *Artifact) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+	if e == nil || len(e.policies) == 0 {
+		return violations, nil
+	}
+
+	var manifestMap map[string]interface{}
+	err := remarshal(manifest, &manifestMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert manifest: %s", err)
+	}
+	var artifactMap map[string]interface{}
+	err = remarshal(artifact, &artifactMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert artifact: %s", err)
+	}
+	attachments, _ := artifactMap["attachments"].([]interface{})
+	if attachments == nil {
+		attachments = []interface{}{}
+	}
+
+	for _, policy := range e.policies {
+		enforcement := policy.enforcement(manifest.Env)
+		if enforcement == PolicyOff || policy.Target != PolicyTargetArtifact {
+			continue
+		}
+
+		message := policy.Message
+		if message == "" {
+			message = fmt.Sprintf("violates %s", policy.Rule)
+		}
+
+		vars := map[string]interface{}{
+			"manifest":    manifestMap,
+			"env":         manifest.Env,
+			"object":      map[string]interface{}{},
+			"containers":  []interface{}{},
+			"volumes":     []interface{}{},
+			"artifact":    artifactMap,
+			"attachments": attachments,
+		}
+		if complies, evalErr := evaluatePolicy(policy.program, vars); !complies {
+			violations = append(violations, PolicyViolation{
+				Policy:      policy.Name,
+				Message:     messageWithError(message, evalErr),
+				Enforcement: enforcement,
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+func (p *compiledPolicy) enforcement(env string) string {
+	if envEnforcement, ok := p.Envs[env]; ok {
+		return envEnforcement
+	}
+	return p.Enforcement
+}
+
+// DeniedPolicyViolations returns an error listing the violations with deny enforcement, if there is any
+func DeniedPolicyViolations(violations []PolicyViolation) error {
+	var denied []string
+	for _, v := range violations {
+		if v.Enforcement == PolicyDeny {
+			denied = append(denied, v.String())
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("policy violations:\n- %s", strings.Join(denied, "\n- "))
+	}
+	return nil
+}
+
+// ParsePolicies parses policy files, keyed by file name
+func ParsePolicies(files map[string]string) ([]Policy, error) {
+	var policies []Policy
+	for _, fileName := range sortedKeys(files) {
+		ext := filepath.Ext(fileName)
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		var policyFile PolicyFile
+		err := yaml.Unmarshal([]byte(files[fileName]), &policyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse policy file %s: %s", fileName, err)
+		}
+		policies = append(policies, policyFile.Policies...)
+	}
+	return policies, nil
+}
+
+// LoadPolicies reads the policy files of a directory
+func LoadPolicies(dir string) ([]Policy, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = string(content)
+	}
+
+	return ParsePolicies(files)
+}
+
+func evaluatePolicy(program cel.Program, vars map[string]interface{}) (bool, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	complies, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("rule evaluated to %v instead of a bool", out.Value())
+	}
+	return complies, nil
+}
+
+func messageWithError(message string, err error) string {
+	if err != nil {
+		return fmt.Sprintf("%s: rule evaluation failed: %s", message, err)
+	}
+	return message
+}
+
+// podSpecParts returns the containers, init containers included, and the volumes of workload objects
+func podSpecParts(object map[string]interface{}) ([]interface{}, []interface{}) {
+	podSpec := nestedMap(object, "spec")
+	if template := nestedMap(object, "spec", "template", "spec"); template != nil {
+		podSpec = template
+	}
+	if jobTemplate := nestedMap(object, "spec", "jobTemplate", "spec", "template", "spec"); jobTemplate != nil {
+		podSpec = jobTemplate
+	}
+
+	containers := []interface{}{}
+	volumes := []interface{}{}
+	if podSpec == nil {
+		return containers, volumes
+	}
+	if c, ok := podSpec["initContainers"].([]interface{}); ok {
+		containers = append(containers, c...)
+	}
+	if c, ok := podSpec["containers"].([]interface{}); ok {
+		containers = append(containers, c...)
+	}
+	if v, ok := podSpec["volumes"].([]interface{}); ok {
+		volumes = append(volumes, v...)
+	}
+	return containers, volumes
+}
+
+func nestedMap(object map[string]interface{}, fields ...string) map[string]interface{} {
+	current := object
+	for _, field := range fields {
+		next, ok := current[field].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func objectID(object map[string]interface{}) string {
+	kind, _ := object["kind"].(string)
+	name, _ := nestedMap(object, "metadata")["name"].(string)
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+func sortedValues(m map[string]string) []string {
+	values := []string{}
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
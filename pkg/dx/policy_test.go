@@ -0,0 +1,182 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicies = `
+policies:
+- name: no-latest-tag
+  rule: containers.all(c, !c.image.endsWith(":latest"))
+  message: latest tags are not allowed
+  enforcement: warn
+  envs:
+    production: deny
+- name: trusted-registry
+  rule: containers.all(c, c.image.startsWith("ghcr.io/mycompany/"))
+  message: images must come from ghcr.io/mycompany
+  envs:
+    staging: "off"
+- name: no-hostpath
+  rule: volumes.all(v, !has(v.hostPath))
+- name: namespace-set
+  target: manifest
+  rule: has(manifest.namespace) && manifest.namespace != ""
+  message: namespace is mandatory
+`
+
+const testRenderedManifests = `
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  template:
+    spec:
+      containers:
+      - name: myapp
+        image: nginx:latest
+      volumes:
+      - name: host
+        hostPath:
+          path: /var/run
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+`
+
+func Test_PolicyEngine(t *testing.T) {
+	policies, err := ParsePolicies(map[string]string{"policies.yaml": testPolicies, "README.md": "not a policy"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(policies))
+
+	engine, err := NewPolicyEngine(policies)
+	assert.NoError(t, err)
+
+	staging := &Manifest{App: "myapp", Env: "staging", Namespace: "default"}
+	violations, err := engine.Evaluate(staging, testRenderedManifests)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(violations), "trusted-registry is off in staging, and the Service complies")
+	assert.Equal(t, "no-latest-tag", violations[0].Policy)
+	assert.Equal(t, PolicyWarn, violations[0].Enforcement)
+	assert.Equal(t, "Deployment/myapp", violations[0].Object)
+	assert.Equal(t, "no-hostpath", violations[1].Policy)
+
+	production := &Manifest{App: "myapp", Env: "production"}
+	violations, err = engine.Evaluate(production, testRenderedManifests)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(violations))
+	assert.Equal(t, PolicyDeny, violations[0].Enforcement)
+	err = DeniedPolicyViolations(violations)
+	assert.ErrorContains(t, err, "namespace is mandatory")
+	assert.ErrorContains(t, err, "latest tags are not allowed")
+
+	assert.NoError(t, DeniedPolicyViolations([]PolicyViolation{{Policy: "no-latest-tag", Enforcement: PolicyWarn}}))
+}
+
+func Test_PolicyEngineValidation(t *testing.T) {
+	_, err := NewPolicyEngine([]Policy{{Name: "broken", Rule: "containers.all(c,"}})
+	assert.ErrorContains(t, err, "cannot compile rule")
+
+	_, err = NewPolicyEngine([]Policy{{Name: "not-bool", Rule: "env"}})
+	assert.ErrorContains(t, err, "must evaluate to a bool")
+
+	_, err = NewPolicyEngine([]Policy{{Name: "level", Rule: "true", Enforcement: "block"}})
+	assert.ErrorContains(t, err, "enforcement must be one of")
+}
+
+func Test_PolicyEngineArtifact(t *testing.T) {
+	policies, err := ParsePolicies(map[string]string{"policies.yaml": `
+policies:
+- name: require-provenance
+  target: artifact
+  rule: attachments.exists(a, a.type == "provenance")
+  message: production releases need a provenance attestation
+  envs:
+    staging: "off"
+- name: tests-pass
+  target: artifact
+  rule: attachments.all(a, a.type != "test" || a.summary.failures == 0)
+  enforcement: warn
+`})
+	assert.NoError(t, err)
+	engine, err := NewPolicyEngine(policies)
+	assert.NoError(t, err)
+
+	artifact := &Artifact{
+		Attachments: []*Attachment{
+			{Type: AttachmentTestReport, Name: "junit.xml", Summary: &AttachmentSummary{Tests: 10, Failures: 1}},
+		},
+	}
+
+	violations, err := engine.EvaluateArtifact(&Manifest{Env: "production"}, artifact)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(violations))
+	assert.NotNil(t, DeniedPolicyViolations(violations))
+
+	violations, err = engine.EvaluateArtifact(&Manifest{Env: "staging"}, artifact)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(violations))
+	assert.Nil(t, DeniedPolicyViolations(violations), "failing tests only warn")
+
+	violations, err = engine.Evaluate(&Manifest{Env: "production"}, testRenderedManifests)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(violations), "artifact policies are not evaluated on manifests")
+}
+
+func Test_PolicyEngineImage(t *testing.T) {
+	policies, err := ParsePolicies(map[string]string{"images.yaml": `
+policies:
+- name: production-images
+  target: image
+  image:
+    registries:
+    - ghcr.io/mycompany
+    - docker.io/library
+    denyLatest: true
+    requireDigest: true
+  envs:
+    staging: "off"
+`})
+	assert.NoError(t, err)
+	engine, err := NewPolicyEngine(policies)
+	assert.NoError(t, err)
+
+	rendered := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: ghcr.io/mycompany/myapp:abc123@sha256:0d2f6a39
+      containers:
+      - name: myapp
+        image: nginx
+      - name: proxy
+        image: quay.io/envoy/envoy:v1.29@sha256:1b7e8f
+`
+	violations, err := engine.Evaluate(&Manifest{Env: "production"}, rendered)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(violations))
+	assert.Equal(t, "Deployment/myapp", violations[0].Object)
+	assert.Equal(t, "container myapp: image nginx has no tag, it defaults to latest", violations[0].Message)
+	assert.Equal(t, "container myapp: image nginx is not pinned with a digest", violations[1].Message)
+	assert.Equal(t, "container proxy: image quay.io/envoy/envoy:v1.29@sha256:1b7e8f is not from an approved registry (ghcr.io/mycompany, docker.io/library)", violations[2].Message)
+	assert.Error(t, DeniedPolicyViolations(violations))
+
+	violations, err = engine.Evaluate(&Manifest{Env: "staging"}, rendered)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(violations))
+
+	_, err = NewPolicyEngine([]Policy{{Name: "images", Target: PolicyTargetImage}})
+	assert.Error(t, err, "image settings are mandatory")
+}
@@ -29,6 +29,15 @@ type Release struct {
 	Created                int64  `json:"created,omitempty"`
 
 	RolledBack bool `json:"rolledBack,omitempty"`
+
+	// RolloutStatus is the Flagger phase of a progressive rollout: Progressing, Succeeded (promoted) or Failed (aborted)
+	RolloutStatus     string `json:"rolloutStatus,omitempty"`
+	RolloutStatusDesc string `json:"rolloutStatusDesc,omitempty"`
+
+	// DefaultedValues are the value paths set from the environment defaults
+	DefaultedValues []string `json:"defaultedValues,omitempty"`
+	// OverriddenValues are the value paths enforced by the environment overrides
+	OverriddenValues []string `json:"overriddenValues,omitempty"`
 }
 
 // ReleaseRequest contains all metadata about the release intent
@@ -37,6 +46,8 @@ type ReleaseRequest struct {
 	App         string `json:"app,omitempty"`
 	ArtifactID  string `json:"artifactId"`
 	TriggeredBy string `json:"triggeredBy"`
+	// WaitFor holds the dependencies that must be healthy before the release is written, see dependsOn
+	WaitFor []*DependencyRelease `json:"waitFor,omitempty"`
 }
 
 // ImageBuildRequest contains all metadata to be able to build an image
@@ -77,6 +88,8 @@ type Result struct {
 	Env                      string `json:"env,omitempty"`
 	StatusDesc               string `json:"statusDesc,omitempty"`
 	TriggeredDeployRequestID string `json:"triggeredDeployRequestID,omitempty"`
+	// PolicyViolations holds the policy warnings of a successful release, or the violations that denied it
+	PolicyViolations []PolicyViolation `json:"policyViolations,omitempty"`
 }
 
 // ReleaseStatus is the result of an artifact shipping or an on-demand deploy
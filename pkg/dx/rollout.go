@@ -0,0 +1,210 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const RolloutStrategyCanary = "canary"
+const RolloutStrategyBlueGreen = "blueGreen"
+
+// Rollout is the progressive delivery policy of the app.
+// It is rendered into a Flagger Canary that shifts traffic to the new version step by step,
+// or all at once in blue/green mode, while the analysis metrics hold.
+type Rollout struct {
+	// Strategy is canary (default) or blueGreen
+	Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty"`
+	// Provider is the Flagger mesh or ingress provider, eg.: nginx, istio, linkerd. Defaults to the Flagger install default
+	Provider string `yaml:"provider,omitempty" json:"provider,omitempty"`
+	// Port of the app's service. Defaults to the port of the chart's service
+	Port int `yaml:"port,omitempty" json:"port,omitempty"`
+	// Interval is the time between analysis runs, eg.: 1m
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// Threshold is the number of failed analysis runs before the rollout is aborted
+	Threshold int `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	// StepWeight is the traffic percentage shifted to the canary in each step
+	StepWeight int `yaml:"stepWeight,omitempty" json:"stepWeight,omitempty"`
+	// MaxWeight is the traffic percentage at which the canary is promoted
+	MaxWeight int `yaml:"maxWeight,omitempty" json:"maxWeight,omitempty"`
+	// Iterations is the number of analysis runs of a blue/green rollout before the switch
+	Iterations int              `yaml:"iterations,omitempty" json:"iterations,omitempty"`
+	Metrics    []*RolloutMetric `yaml:"metrics,omitempty" json:"metrics,omitempty"`
+}
+
+// RolloutMetric is a metric that must stay in range for the rollout to progress.
+// Flagger's builtin request-success-rate and request-duration metrics, or a MetricTemplate
+type RolloutMetric struct {
+	Name string `yaml:"name" json:"name"`
+	// Template is the name of a Flagger MetricTemplate, as name or namespace/name
+	Template string   `yaml:"template,omitempty" json:"template,omitempty"`
+	Min      *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max      *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	Interval string   `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+// renderRollout adds a Flagger Canary for the app's Deployment.
+// Flagger manages the app's Service from then on, so the chart's Service of the same name is replaced
+func renderRollout(manifests string, m *Manifest) (string, error) {
+	rollout := m.Rollout
+	strategy := orDefault(rollout.Strategy, RolloutStrategyCanary)
+	if strategy != RolloutStrategyCanary && strategy != RolloutStrategyBlueGreen {
+		return "", fmt.Errorf("unknown rollout strategy %s", rollout.Strategy)
+	}
+
+	var docs []string
+	var objects []map[string]interface{}
+	var deployment, ingress string
+	for _, doc := range splitYamlDocuments(manifests) {
+		doc = strings.TrimPrefix(doc, "\n")
+		if !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+		var object map[string]interface{}
+		err := yaml.Unmarshal([]byte(doc), &object)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, doc)
+		objects = append(objects, object)
+
+		if object["kind"] == "Deployment" && deployment == "" {
+			deployment = objectName(object)
+		} else if object["kind"] == "Ingress" && ingress == "" {
+			ingress = objectName(object)
+		}
+	}
+	if deployment == "" {
+		return "", fmt.Errorf("no Deployment to roll out")
+	}
+
+	port := rollout.Port
+	rendered := ""
+	for i, object := range objects {
+		if object["kind"] == "Service" && objectName(object) == deployment {
+			if port == 0 {
+				port = servicePort(object)
+			}
+			continue
+		}
+		rendered += "---\n" + docs[i]
+	}
+	if port == 0 {
+		return "", fmt.Errorf("rollout port is not set, and there is no Service for %s", deployment)
+	}
+
+	analysis := map[string]interface{}{
+		"interval":  orDefault(rollout.Interval, "1m"),
+		"threshold": intOrDefault(rollout.Threshold, 5),
+	}
+	if strategy == RolloutStrategyBlueGreen {
+		analysis["iterations"] = intOrDefault(rollout.Iterations, 10)
+	} else {
+		analysis["stepWeight"] = intOrDefault(rollout.StepWeight, 10)
+		analysis["maxWeight"] = intOrDefault(rollout.MaxWeight, 50)
+	}
+	var metrics []interface{}
+	for _, metric := range rollout.Metrics {
+		metrics = append(metrics, rolloutMetric(metric, rollout.Interval))
+	}
+	if len(metrics) > 0 {
+		analysis["metrics"] = metrics
+	}
+
+	spec := map[string]interface{}{
+		"targetRef": map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"name":       deployment,
+		},
+		"service": map[string]interface{}{
+			"port": port,
+		},
+		"analysis": analysis,
+	}
+	if rollout.Provider != "" {
+		spec["provider"] = rollout.Provider
+	}
+	if rollout.Provider == "nginx" && ingress != "" {
+		spec["ingressRef"] = map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"name":       ingress,
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"name": deployment,
+	}
+	if m.Namespace != "" {
+		metadata["namespace"] = m.Namespace
+	}
+	canary := map[string]interface{}{
+		"apiVersion": "flagger.app/v1beta1",
+		"kind":       "Canary",
+		"metadata":   metadata,
+		"spec":       spec,
+	}
+	canaryBytes, err := yaml.Marshal(canary)
+	if err != nil {
+		return "", err
+	}
+
+	return rendered + "---\n" + string(canaryBytes), nil
+}
+
+func rolloutMetric(metric *RolloutMetric, interval string) map[string]interface{} {
+	thresholdRange := map[string]interface{}{}
+	if metric.Min != nil {
+		thresholdRange["min"] = *metric.Min
+	}
+	if metric.Max != nil {
+		thresholdRange["max"] = *metric.Max
+	}
+
+	rendered := map[string]interface{}{
+		"name":           metric.Name,
+		"thresholdRange": thresholdRange,
+		"interval":       orDefault(metric.Interval, orDefault(interval, "1m")),
+	}
+	if metric.Template != "" {
+		templateRef := map[string]interface{}{"name": metric.Template}
+		if parts := strings.SplitN(metric.Template, "/", 2); len(parts) == 2 {
+			templateRef = map[string]interface{}{"namespace": parts[0], "name": parts[1]}
+		}
+		rendered["templateRef"] = templateRef
+	}
+	return rendered
+}
+
+func objectName(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+func servicePort(service map[string]interface{}) int {
+	spec, _ := service["spec"].(map[string]interface{})
+	ports, _ := spec["ports"].([]interface{})
+	if len(ports) == 0 {
+		return 0
+	}
+	port, _ := ports[0].(map[string]interface{})
+	number, _ := port["port"].(float64)
+	return int(number)
+}
+
+func orDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func intOrDefault(value int, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
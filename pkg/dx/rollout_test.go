@@ -0,0 +1,88 @@
+package dx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+const rolloutTestManifests = `---
+# Source: onechart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+spec:
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+# Source: onechart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+---
+# Source: onechart/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: my-app
+`
+
+func Test_renderCanaryRollout(t *testing.T) {
+	min := 99.0
+	m := &Manifest{
+		App:       "my-app",
+		Namespace: "production",
+		Rollout: &Rollout{
+			Provider: "nginx",
+			Metrics: []*RolloutMetric{
+				{Name: "request-success-rate", Min: &min},
+				{Name: "latency", Template: "flagger/latency"},
+			},
+		},
+	}
+
+	rendered, err := renderRollout(rolloutTestManifests, m)
+	assert.Nil(t, err)
+	assert.NotContains(t, rendered, "kind: Service", "Flagger manages the service of the app")
+	assert.Contains(t, rendered, "# Source: onechart/templates/deployment.yaml")
+
+	docs := splitYamlDocuments(rendered)
+	var canary map[string]interface{}
+	err = yaml.Unmarshal([]byte(docs[len(docs)-1]), &canary)
+	assert.Nil(t, err)
+	assert.Equal(t, "Canary", canary["kind"])
+	spec := canary["spec"].(map[string]interface{})
+	assert.Equal(t, "my-app", spec["targetRef"].(map[string]interface{})["name"])
+	assert.Equal(t, "my-app", spec["ingressRef"].(map[string]interface{})["name"])
+	assert.Equal(t, float64(80), spec["service"].(map[string]interface{})["port"])
+	analysis := spec["analysis"].(map[string]interface{})
+	assert.Equal(t, float64(10), analysis["stepWeight"])
+	metrics := analysis["metrics"].([]interface{})
+	assert.Equal(t, float64(99), metrics[0].(map[string]interface{})["thresholdRange"].(map[string]interface{})["min"])
+	assert.Equal(t, "flagger", metrics[1].(map[string]interface{})["templateRef"].(map[string]interface{})["namespace"])
+}
+
+func Test_renderBlueGreenRollout(t *testing.T) {
+	m := &Manifest{
+		App:     "my-app",
+		Rollout: &Rollout{Strategy: RolloutStrategyBlueGreen, Iterations: 3},
+	}
+	rendered, err := renderRollout(rolloutTestManifests, m)
+	assert.Nil(t, err)
+	assert.Contains(t, rendered, "iterations: 3")
+	assert.NotContains(t, rendered, "stepWeight")
+
+	m.Rollout.Strategy = "yolo"
+	_, err = renderRollout(rolloutTestManifests, m)
+	assert.NotNil(t, err)
+
+	m.Rollout.Strategy = ""
+	withoutDeployment := strings.Split(rolloutTestManifests, "# Source: onechart/templates/deployment.yaml")[0]
+	_, err = renderRollout(withoutDeployment, m)
+	assert.NotNil(t, err, "there must be a Deployment to roll out")
+}
@@ -0,0 +1,486 @@
+package dx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	terraformv1 "github.com/weaveworks/tf-controller/api/v1alpha2"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"sigs.k8s.io/yaml"
+)
+
+// kubeSchemas holds the OpenAPI definitions of Kubernetes versions, named after the minor version, eg. 1.27.json.gz.
+// They are generated from the swagger.json of the Kubernetes releases with `make kube-schemas`
+//
+//go:embed kubeschemas/*.json.gz
+var kubeSchemas embed.FS
+
+// quantityDefinition is a string in the schemas, but manifests may set it as a number too, eg. cpu: 1
+const quantityDefinition = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+
+// SchemaValidator validates rendered manifests without a cluster.
+// Built-in Kubernetes kinds are validated against the bundled OpenAPI schema of the Kubernetes version,
+// so fields and API versions that the version doesn't serve are rejected, just as missing required fields and invalid values.
+// Flux kinds are strictly decoded with the vendored Flux API types.
+// Custom resources are checked against the OpenAPI schemas of the CRDs that were loaded.
+type SchemaValidator struct {
+	kubeMinorVersion int
+	kubeSchema       *kubeSchema
+	decoder          runtime.Decoder
+	scheme           *runtime.Scheme
+	crdSchemas       map[schema.GroupVersionKind]*validate.SchemaValidator
+}
+
+// NewSchemaValidator returns a validator for the given Kubernetes version (eg.: 1.27 or v1.27.3),
+// or for the newest bundled version if not set. CRD definitions are loaded from crdDir, if set.
+func NewSchemaValidator(kubeVersion string, crdDir string) (*SchemaValidator, error) {
+	bundledVersions, err := bundledKubeVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeMinorVersion := bundledVersions[len(bundledVersions)-1]
+	if kubeVersion != "" {
+		kubeMinorVersion, err = parseKubeMinorVersion(kubeVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kubeSchema, err := loadKubeSchema(kubeMinorVersion)
+	if err != nil {
+		return nil, err
+	}
+	if kubeSchema == nil {
+		var versions []string
+		for _, v := range bundledVersions {
+			versions = append(versions, fmt.Sprintf("1.%d", v))
+		}
+		return nil, fmt.Errorf("there is no bundled schema for Kubernetes 1.%d, bundled versions are %s", kubeMinorVersion, strings.Join(versions, ", "))
+	}
+
+	validatorScheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		sourcev1.AddToScheme,
+		kustomizev1.AddToScheme,
+		helmv2.AddToScheme,
+		terraformv1.AddToScheme,
+	} {
+		err := addToScheme(validatorScheme)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	v := &SchemaValidator{
+		kubeMinorVersion: kubeMinorVersion,
+		kubeSchema:       kubeSchema,
+		scheme:           validatorScheme,
+		decoder: kjson.NewSerializerWithOptions(
+			kjson.DefaultMetaFactory,
+			validatorScheme,
+			validatorScheme,
+			kjson.SerializerOptions{Yaml: false, Strict: true},
+		),
+		crdSchemas: map[schema.GroupVersionKind]*validate.SchemaValidator{},
+	}
+
+	if crdDir != "" {
+		err := v.loadCRDs(crdDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Validate checks every document of a multi-document yaml, and returns all problems in a single error
+func (v *SchemaValidator) Validate(manifests string) error {
+	var problems []string
+	for _, doc := range splitYamlDocuments(manifests) {
+		var object map[string]interface{}
+		err := yaml.Unmarshal([]byte(doc), &object)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot parse yaml: %s", err))
+			continue
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		problems = append(problems, v.validateObject(object)...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("manifest validation failed:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
+
+func (v *SchemaValidator) validateObject(object map[string]interface{}) []string {
+	apiVersion, _ := object["apiVersion"].(string)
+	kind, _ := object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	if name == "" {
+		name, _ = metadata["generateName"].(string)
+	}
+
+	id := fmt.Sprintf("%s/%s", kind, name)
+	if apiVersion == "" || kind == "" {
+		return []string{fmt.Sprintf("%s: apiVersion and kind are mandatory", id)}
+	}
+	if name == "" {
+		return []string{fmt.Sprintf("%s: metadata.name is mandatory", id)}
+	}
+
+	// SOPS encrypted objects are only valid after Flux decrypts them
+	if isSopsEncrypted(object) {
+		return nil
+	}
+
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+	if definition, ok := v.kubeSchema.kinds[gvk]; ok {
+		var problems []string
+		for _, problem := range v.kubeSchema.validate("", object, definition) {
+			problems = append(problems, fmt.Sprintf("%s: %s", id, problem))
+		}
+		return problems
+	}
+	if v.kubeSchema.groups[gvk.Group] || scheme.Scheme.IsGroupRegistered(gvk.Group) {
+		return []string{fmt.Sprintf("%s: %s %s is not served by Kubernetes 1.%d", id, apiVersion, kind, v.kubeMinorVersion)}
+	}
+
+	if v.scheme.Recognizes(gvk) {
+		objectBytes, err := json.Marshal(object)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %s", id, err)}
+		}
+		_, _, err = v.decoder.Decode(objectBytes, &gvk, nil)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %s", id, err)}
+		}
+		return nil
+	}
+
+	if crdSchema, ok := v.crdSchemas[gvk]; ok {
+		var problems []string
+		result := crdSchema.Validate(object)
+		for _, err := range result.Errors {
+			problems = append(problems, fmt.Sprintf("%s: %s", id, err))
+		}
+		return problems
+	}
+
+	// kinds without a bundled schema or a loaded CRD are not validated
+	return nil
+}
+
+// kubeSchema holds the OpenAPI definitions of a Kubernetes version, and the kinds and groups that it serves
+type kubeSchema struct {
+	definitions map[string]*spec.Schema
+	kinds       map[schema.GroupVersionKind]*spec.Schema
+	groups      map[string]bool
+}
+
+// bundledKubeVersions returns the minor versions of the bundled Kubernetes schemas, in ascending order
+func bundledKubeVersions() ([]int, error) {
+	files, err := kubeSchemas.ReadDir("kubeschemas")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, file := range files {
+		minor, err := parseKubeMinorVersion(strings.TrimSuffix(file.Name(), ".json.gz"))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, minor)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("there are no bundled Kubernetes schemas")
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// loadKubeSchema reads the bundled schema of a Kubernetes minor version, it is nil if the version is not bundled
+func loadKubeSchema(kubeMinorVersion int) (*kubeSchema, error) {
+	compressed, err := kubeSchemas.ReadFile(fmt.Sprintf("kubeschemas/1.%d.json.gz", kubeMinorVersion))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var swagger struct {
+		Definitions map[string]*spec.Schema `json:"definitions"`
+	}
+	err = json.NewDecoder(r).Decode(&swagger)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the schema of Kubernetes 1.%d: %s", kubeMinorVersion, err)
+	}
+
+	s := &kubeSchema{
+		definitions: swagger.Definitions,
+		kinds:       map[schema.GroupVersionKind]*spec.Schema{},
+		groups:      map[string]bool{},
+	}
+	for _, definition := range swagger.Definitions {
+		gvks, _ := definition.Extensions["x-kubernetes-group-version-kind"].([]interface{})
+		for _, gvk := range gvks {
+			gvkMap, _ := gvk.(map[string]interface{})
+			group, _ := gvkMap["group"].(string)
+			version, _ := gvkMap["version"].(string)
+			kind, _ := gvkMap["kind"].(string)
+			s.kinds[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = definition
+			s.groups[group] = true
+		}
+	}
+	return s, nil
+}
+
+// validate checks a value against a schema of the definitions, and returns the problems with the path of the field
+func (s *kubeSchema) validate(path string, value interface{}, fieldSchema *spec.Schema) []string {
+	if value == nil {
+		return nil
+	}
+
+	if ref := fieldSchema.Ref.String(); ref != "" {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		if name == quantityDefinition {
+			switch value.(type) {
+			case string, float64:
+				return nil
+			}
+			return []string{fmt.Sprintf("%s must be a quantity", fieldPath(path))}
+		}
+		definition, ok := s.definitions[name]
+		if !ok {
+			return nil
+		}
+		return s.validate(path, value, definition)
+	}
+
+	if fieldSchema.Format == "int-or-string" {
+		switch value.(type) {
+		case string, float64:
+			return nil
+		}
+		return []string{fmt.Sprintf("%s must be an integer or a string", fieldPath(path))}
+	}
+
+	if len(fieldSchema.Enum) > 0 {
+		valid := false
+		for _, allowed := range fieldSchema.Enum {
+			if value == allowed {
+				valid = true
+			}
+		}
+		if !valid {
+			return []string{fmt.Sprintf("%s must be one of %v", fieldPath(path), fieldSchema.Enum)}
+		}
+	}
+
+	// fields without a type are free-form, eg. RawExtension
+	if len(fieldSchema.Type) == 0 {
+		return nil
+	}
+	switch fieldSchema.Type[0] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an object", fieldPath(path))}
+		}
+		return s.validateProperties(path, object, fieldSchema)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an array", fieldPath(path))}
+		}
+		if fieldSchema.Items == nil || fieldSchema.Items.Schema == nil {
+			return nil
+		}
+		var problems []string
+		for i, item := range array {
+			problems = append(problems, s.validate(fmt.Sprintf("%s[%d]", path, i), item, fieldSchema.Items.Schema)...)
+		}
+		return problems
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a string", fieldPath(path))}
+		}
+		if strfmt.Default.ContainsName(fieldSchema.Format) && !strfmt.Default.Validates(fieldSchema.Format, str) {
+			return []string{fmt.Sprintf("%s must be in %s format", fieldPath(path), fieldSchema.Format)}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return []string{fmt.Sprintf("%s must be an integer", fieldPath(path))}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []string{fmt.Sprintf("%s must be a number", fieldPath(path))}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s must be a boolean", fieldPath(path))}
+		}
+	}
+	return nil
+}
+
+func (s *kubeSchema) validateProperties(path string, object map[string]interface{}, objectSchema *spec.Schema) []string {
+	var problems []string
+	for _, required := range objectSchema.Required {
+		if _, ok := object[required]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", fieldPath(joinFieldPath(path, required))))
+		}
+	}
+
+	preserveUnknownFields, _ := objectSchema.Extensions["x-kubernetes-preserve-unknown-fields"].(bool)
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if property, ok := objectSchema.Properties[key]; ok {
+			problems = append(problems, s.validate(joinFieldPath(path, key), object[key], &property)...)
+		} else if objectSchema.AdditionalProperties != nil && objectSchema.AdditionalProperties.Schema != nil {
+			problems = append(problems, s.validate(joinFieldPath(path, key), object[key], objectSchema.AdditionalProperties.Schema)...)
+		} else if len(objectSchema.Properties) > 0 && !preserveUnknownFields {
+			problems = append(problems, fmt.Sprintf("unknown field %s", fieldPath(joinFieldPath(path, key))))
+		}
+	}
+	return problems
+}
+
+func joinFieldPath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func fieldPath(path string) string {
+	if path == "" {
+		return "the object"
+	}
+	return fmt.Sprintf("%q", path)
+}
+
+// loadCRDs reads CustomResourceDefinitions from yaml and json files in a directory, recursively
+func (v *SchemaValidator) loadCRDs(crdDir string) error {
+	return filepath.WalkDir(crdDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if d.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, doc := range splitYamlDocuments(string(content)) {
+			var crd apiextensionsv1.CustomResourceDefinition
+			err := yaml.Unmarshal([]byte(doc), &crd)
+			if err != nil {
+				return fmt.Errorf("cannot parse %s: %s", path, err)
+			}
+			if crd.Kind != "CustomResourceDefinition" {
+				continue
+			}
+
+			err = v.addCRD(crd)
+			if err != nil {
+				return fmt.Errorf("cannot load CRD %s from %s: %s", crd.Name, path, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (v *SchemaValidator) addCRD(crd apiextensionsv1.CustomResourceDefinition) error {
+	for _, version := range crd.Spec.Versions {
+		if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+
+		schemaBytes, err := json.Marshal(version.Schema.OpenAPIV3Schema)
+		if err != nil {
+			return err
+		}
+		var openAPISchema spec.Schema
+		err = json.Unmarshal(schemaBytes, &openAPISchema)
+		if err != nil {
+			return err
+		}
+
+		gvk := schema.GroupVersionKind{
+			Group:   crd.Spec.Group,
+			Version: version.Name,
+			Kind:    crd.Spec.Names.Kind,
+		}
+		v.crdSchemas[gvk] = validate.NewSchemaValidator(&openAPISchema, nil, "", strfmt.Default)
+	}
+	return nil
+}
+
+var yamlSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+func splitYamlDocuments(manifests string) []string {
+	var docs []string
+	for _, doc := range yamlSeparator.Split(manifests, -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func parseKubeMinorVersion(kubeVersion string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(kubeVersion, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("cannot parse Kubernetes version %s, use the 1.29 format", kubeVersion)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse Kubernetes version %s, use the 1.29 format", kubeVersion)
+	}
+	return minor, nil
+}
@@ -0,0 +1,242 @@
+package dx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SchemaValidator(t *testing.T) {
+	validator, err := NewSchemaValidator("1.27", "")
+	assert.NoError(t, err)
+
+	valid := `
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+    spec:
+      containers:
+      - name: myapp
+        image: nginx:1.25
+        imagePullPolicy: IfNotPresent
+        resources:
+          requests:
+            cpu: 1
+            memory: 200Mi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+spec:
+  ports:
+  - port: 80
+    targetPort: http
+`
+	assert.NoError(t, validator.Validate(valid))
+
+	unknownField := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    spec:
+      containers:
+      - name: myapp
+        imagee: nginx:1.25
+`
+	err = validator.Validate(unknownField)
+	assert.ErrorContains(t, err, `unknown field "spec.template.spec.containers[0].imagee"`)
+
+	wrongType := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+spec:
+  ports:
+  - port: "eighty"
+`
+	assert.ErrorContains(t, validator.Validate(wrongType), `"spec.ports[0].port" must be an integer`)
+
+	missingRequired := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx:1.25
+`
+	err = validator.Validate(missingRequired)
+	assert.ErrorContains(t, err, `"spec.selector" is required`)
+	assert.ErrorContains(t, err, `"spec.template.spec.containers[0].name" is required`)
+
+	invalidEnum := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+spec:
+  ports:
+  - port: 80
+    protocol: HTTP
+`
+	assert.ErrorContains(t, validator.Validate(invalidEnum), `"spec.ports[0].protocol" must be one of`)
+
+	invalidFormat := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: myapp
+data:
+  password: not base64!
+`
+	assert.ErrorContains(t, validator.Validate(invalidFormat), `"data.password" must be in byte format`)
+
+	// the sleep action of lifecycle hooks was added in Kubernetes 1.29
+	newerField := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: myapp
+spec:
+  containers:
+  - name: myapp
+    image: nginx:1.25
+    lifecycle:
+      preStop:
+        sleep:
+          seconds: 5
+`
+	assert.ErrorContains(t, validator.Validate(newerField), `unknown field "spec.containers[0].lifecycle.preStop.sleep"`)
+
+	removedAPI := `
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: myapp
+`
+	err = validator.Validate(removedAPI)
+	assert.ErrorContains(t, err, "policy/v1beta1 PodDisruptionBudget is not served by Kubernetes 1.27")
+
+	_, err = NewSchemaValidator("1.12", "")
+	assert.ErrorContains(t, err, "there is no bundled schema for Kubernetes 1.12")
+
+	_, err = NewSchemaValidator("latest", "")
+	assert.Error(t, err)
+
+	defaultValidator, err := NewSchemaValidator("", "")
+	assert.NoError(t, err, "the newest bundled version is the default")
+	assert.NoError(t, defaultValidator.Validate(valid))
+}
+
+func Test_SchemaValidatorWithFluxKinds(t *testing.T) {
+	validator, err := NewSchemaValidator("", "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, validator.Validate(`
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: myapp
+spec:
+  interval: 1m
+  path: ./staging/myapp
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: gitops-repo
+`))
+
+	err = validator.Validate(`
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: myapp
+spec:
+  pathh: ./staging/myapp
+`)
+	assert.ErrorContains(t, err, "pathh")
+}
+
+func Test_SchemaValidatorWithCRDs(t *testing.T) {
+	crdDir := t.TempDir()
+	crd := `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - size
+            properties:
+              size:
+                type: integer
+`
+	err := os.WriteFile(filepath.Join(crdDir, "widget.yaml"), []byte(crd), 0644)
+	assert.NoError(t, err)
+
+	validator, err := NewSchemaValidator("", crdDir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, validator.Validate(`
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-widget
+spec:
+  size: 3
+`))
+
+	err = validator.Validate(`
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-widget
+spec:
+  size: large
+`)
+	assert.ErrorContains(t, err, "Widget/my-widget")
+
+	assert.NoError(t, validator.Validate(`
+apiVersion: unknown.com/v1
+kind: Gadget
+metadata:
+  name: not-validated
+`), "kinds without a schema are not validated")
+}
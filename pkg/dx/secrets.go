@@ -0,0 +1,178 @@
+package dx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// SopsAgeSecret is the Secret in flux-system that holds the age private key of the environment.
+// Flux decrypts SOPS encrypted manifests with it.
+const SopsAgeSecret = "sops-age"
+
+// Secrets are the secrets of the app. Plaintext values are never part of the manifest:
+// they are either synced from a secret store by External Secrets Operator,
+// or committed encrypted with SOPS, using the age key of the environment.
+type Secrets struct {
+	// Name of the Secret. Defaults to the app name
+	Name           string          `yaml:"name,omitempty" json:"name,omitempty"`
+	ExternalSecret *ExternalSecret `yaml:"externalSecret,omitempty" json:"externalSecret,omitempty"`
+	// Sops is a Secret manifest encrypted with `sops --encrypt --age <recipient> --encrypted-regex '^(data|stringData)$'`.
+	// The recipient of the environment is in the .sops.yaml file of the gitops repo.
+	Sops string `yaml:"sops,omitempty" json:"sops,omitempty"`
+}
+
+type ExternalSecret struct {
+	// SecretStore is the name of the secret store configured in the cluster
+	SecretStore string `yaml:"secretStore" json:"secretStore"`
+	// SecretStoreKind is ClusterSecretStore or SecretStore. Defaults to ClusterSecretStore
+	SecretStoreKind string `yaml:"secretStoreKind,omitempty" json:"secretStoreKind,omitempty"`
+	RefreshInterval string `yaml:"refreshInterval,omitempty" json:"refreshInterval,omitempty"`
+	// Data maps the keys of the Secret to keys in the store. Properties of a key are addressed as `key#property`
+	Data map[string]string `yaml:"data" json:"data"`
+}
+
+func renderSecrets(m *Manifest) (string, error) {
+	if m.Secrets.ExternalSecret != nil && m.Secrets.Sops != "" {
+		return "", fmt.Errorf("use either externalSecret or sops")
+	}
+
+	if m.Secrets.ExternalSecret != nil {
+		return renderExternalSecret(m)
+	}
+
+	if m.Secrets.Sops != "" {
+		err := validateSopsSecret(m.Secrets.Sops)
+		if err != nil {
+			return "", err
+		}
+		sops := strings.TrimPrefix(m.Secrets.Sops, "---\n")
+		if !strings.HasSuffix(sops, "\n") {
+			sops += "\n"
+		}
+		return "---\n" + sops, nil
+	}
+
+	return "", nil
+}
+
+func renderExternalSecret(m *Manifest) (string, error) {
+	externalSecret := m.Secrets.ExternalSecret
+	if externalSecret.SecretStore == "" {
+		return "", fmt.Errorf("externalSecret.secretStore is mandatory")
+	}
+
+	name := m.Secrets.Name
+	if name == "" {
+		name = m.App
+	}
+	storeKind := externalSecret.SecretStoreKind
+	if storeKind == "" {
+		storeKind = "ClusterSecretStore"
+	}
+	refreshInterval := externalSecret.RefreshInterval
+	if refreshInterval == "" {
+		refreshInterval = "1h"
+	}
+
+	var secretKeys []string
+	for secretKey := range externalSecret.Data {
+		secretKeys = append(secretKeys, secretKey)
+	}
+	sort.Strings(secretKeys)
+
+	var data []interface{}
+	for _, secretKey := range secretKeys {
+		remoteRef := map[string]interface{}{}
+		key, property, hasProperty := strings.Cut(externalSecret.Data[secretKey], "#")
+		remoteRef["key"] = key
+		if hasProperty {
+			remoteRef["property"] = property
+		}
+		data = append(data, map[string]interface{}{
+			"secretKey": secretKey,
+			"remoteRef": remoteRef,
+		})
+	}
+
+	object := map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": m.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"refreshInterval": refreshInterval,
+			"secretStoreRef": map[string]interface{}{
+				"name": externalSecret.SecretStore,
+				"kind": storeKind,
+			},
+			"target": map[string]interface{}{
+				"name":           name,
+				"creationPolicy": "Owner",
+			},
+			"data": data,
+		},
+	}
+
+	externalSecretString, err := yaml.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	return "---\n" + string(externalSecretString), nil
+}
+
+// validateSopsSecret makes sure that no plaintext secret gets to the gitops repo
+func validateSopsSecret(sopsString string) error {
+	// the whole string is rendered, so a second document would get to the gitops repo unchecked
+	decoder := yamlv3.NewDecoder(strings.NewReader(sopsString))
+	documents := 0
+	for {
+		var document yamlv3.Node
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("cannot parse sops secret: %s", err)
+		}
+		documents++
+	}
+	if documents != 1 {
+		return fmt.Errorf("sops must be a single encrypted Secret, found %d yaml documents", documents)
+	}
+
+	var object map[string]interface{}
+	err := yaml.Unmarshal([]byte(sopsString), &object)
+	if err != nil {
+		return fmt.Errorf("cannot parse sops secret: %s", err)
+	}
+
+	if object["kind"] != "Secret" {
+		return fmt.Errorf("sops must be an encrypted Secret")
+	}
+	if !isSopsEncrypted(object) {
+		return fmt.Errorf("sops secret is not encrypted, encrypt it with the age recipient of the environment")
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		values, _ := object[field].(map[string]interface{})
+		for key, value := range values {
+			valueString, _ := value.(string)
+			if !strings.HasPrefix(valueString, "ENC[") {
+				return fmt.Errorf("%s.%s of the sops secret is not encrypted", field, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isSopsEncrypted(object map[string]interface{}) bool {
+	_, ok := object["sops"]
+	return ok
+}
@@ -0,0 +1,106 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_renderExternalSecret(t *testing.T) {
+	m := &Manifest{
+		App:       "my-app",
+		Namespace: "staging",
+		Secrets: &Secrets{
+			ExternalSecret: &ExternalSecret{
+				SecretStore: "vault",
+				Data: map[string]string{
+					"DB_PASSWORD": "my-app/db#password",
+					"API_KEY":     "my-app/api-key",
+				},
+			},
+		},
+	}
+
+	rendered, err := renderSecrets(m)
+	assert.Nil(t, err)
+
+	var externalSecret map[string]interface{}
+	err = yaml.Unmarshal([]byte(rendered), &externalSecret)
+	assert.Nil(t, err)
+	assert.Equal(t, "ExternalSecret", externalSecret["kind"])
+	spec := externalSecret["spec"].(map[string]interface{})
+	assert.Equal(t, "ClusterSecretStore", spec["secretStoreRef"].(map[string]interface{})["kind"])
+	assert.Equal(t, "my-app", spec["target"].(map[string]interface{})["name"])
+	data := spec["data"].([]interface{})
+	assert.Equal(t, 2, len(data))
+	assert.Equal(t, "API_KEY", data[0].(map[string]interface{})["secretKey"])
+	dbPassword := data[1].(map[string]interface{})["remoteRef"].(map[string]interface{})
+	assert.Equal(t, "my-app/db", dbPassword["key"])
+	assert.Equal(t, "password", dbPassword["property"])
+}
+
+func Test_renderSopsSecret(t *testing.T) {
+	encrypted := `apiVersion: v1
+kind: Secret
+metadata:
+  name: my-app
+  namespace: staging
+stringData:
+  DB_PASSWORD: ENC[AES256_GCM,data:Zm9v,iv:YmFy,tag:YmF6,type:str]
+sops:
+  age:
+    - recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+  encrypted_regex: ^(data|stringData)$
+`
+	m := &Manifest{
+		App:     "my-app",
+		Env:     "staging",
+		Secrets: &Secrets{Sops: encrypted},
+	}
+	rendered, err := renderSecrets(m)
+	assert.Nil(t, err)
+	assert.Contains(t, rendered, "ENC[AES256_GCM,data:Zm9v")
+
+	injected, err := injectStandardMetadata(rendered, m, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, injected, AnnotationApp, "sops encrypted objects must not be modified")
+
+	m.Secrets.Sops = `apiVersion: v1
+kind: Secret
+metadata:
+  name: my-app
+stringData:
+  DB_PASSWORD: hunter2
+sops:
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+`
+	_, err = renderSecrets(m)
+	assert.NotNil(t, err, "plaintext values should not render")
+
+	m.Secrets.Sops = `apiVersion: v1
+kind: Secret
+metadata:
+  name: my-app
+stringData:
+  DB_PASSWORD: hunter2
+`
+	_, err = renderSecrets(m)
+	assert.NotNil(t, err, "unencrypted secrets should not render")
+
+	m.Secrets.Sops = encrypted + `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-other-secret
+stringData:
+  DB_PASSWORD: hunter2
+`
+	_, err = renderSecrets(m)
+	assert.NotNil(t, err, "further documents should not render unchecked")
+
+	m.Secrets.Sops = "---\n" + encrypted
+	_, err = renderSecrets(m)
+	assert.Nil(t, err, "a leading document separator is fine")
+}
@@ -0,0 +1,176 @@
+package dx
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SensitiveVarMask replaces the values of sensitive vars wherever the artifact is shown
+const SensitiveVarMask = "********"
+
+// sensitiveVarPattern matches the var names that are treated sensitive without an explicit marker
+var sensitiveVarPattern = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|credential|private_?key|api_?key)`)
+
+// SensitiveVars holds the values of the sensitive vars that are masked in an artifact
+type SensitiveVars struct {
+	Context map[string]string         `json:"context,omitempty"`
+	Items   map[int]map[string]string `json:"items,omitempty"`
+	Vars    map[string]string         `json:"vars,omitempty"`
+}
+
+// IsSensitiveVar tells if a var is sensitive either by its name, or because it is marked with --secret-var
+func (a *Artifact) IsSensitiveVar(name string) bool {
+	for _, secretVar := range a.SecretVars {
+		if secretVar == name {
+			return true
+		}
+	}
+	return sensitiveVarPattern.MatchString(name)
+}
+
+// MaskSensitiveVars replaces the values of the sensitive vars with SensitiveVarMask,
+// and returns the original values. It returns nil if the artifact has no sensitive vars
+func (a *Artifact) MaskSensitiveVars() *SensitiveVars {
+	sensitiveVars := &SensitiveVars{}
+	empty := true
+
+	for k, v := range a.Context {
+		if a.IsSensitiveVar(k) && v != SensitiveVarMask {
+			if sensitiveVars.Context == nil {
+				sensitiveVars.Context = map[string]string{}
+			}
+			sensitiveVars.Context[k] = v
+			a.Context[k] = SensitiveVarMask
+			empty = false
+		}
+	}
+	for i, values := range a.Items {
+		for k, v := range values {
+			if w, ok := v.(string); ok && a.IsSensitiveVar(k) && w != SensitiveVarMask {
+				if sensitiveVars.Items == nil {
+					sensitiveVars.Items = map[int]map[string]string{}
+				}
+				if sensitiveVars.Items[i] == nil {
+					sensitiveVars.Items[i] = map[string]string{}
+				}
+				sensitiveVars.Items[i][k] = w
+				values[k] = SensitiveVarMask
+				empty = false
+			}
+		}
+	}
+	for k, v := range a.Vars {
+		if a.IsSensitiveVar(k) && v != SensitiveVarMask {
+			if sensitiveVars.Vars == nil {
+				sensitiveVars.Vars = map[string]string{}
+			}
+			sensitiveVars.Vars[k] = v
+			a.Vars[k] = SensitiveVarMask
+			empty = false
+		}
+	}
+
+	if empty {
+		return nil
+	}
+	return sensitiveVars
+}
+
+// WithSensitiveVars returns a copy of the masked artifact with the original values of its sensitive vars.
+// The artifact itself stays masked, so it is safe to put in results
+func (a *Artifact) WithSensitiveVars(sensitiveVars *SensitiveVars) *Artifact {
+	unmasked := *a
+	if sensitiveVars == nil {
+		return &unmasked
+	}
+
+	unmasked.Context = copyVars(a.Context, sensitiveVars.Context)
+	if a.Items != nil {
+		unmasked.Items = make([]map[string]interface{}, len(a.Items))
+		for i, values := range a.Items {
+			items := map[string]interface{}{}
+			for k, v := range values {
+				items[k] = v
+			}
+			for k, v := range sensitiveVars.Items[i] {
+				items[k] = v
+			}
+			unmasked.Items[i] = items
+		}
+	}
+	unmasked.Vars = copyVars(a.Vars, sensitiveVars.Vars)
+	return &unmasked
+}
+
+// HasMaskedVars tells if the artifact has sensitive vars whose values are masked,
+// eg. an unmasked artifact whose sensitive vars were lost
+func (a *Artifact) HasMaskedVars() bool {
+	for k, v := range a.Context {
+		if a.IsSensitiveVar(k) && v == SensitiveVarMask {
+			return true
+		}
+	}
+	for _, values := range a.Items {
+		for k, v := range values {
+			if a.IsSensitiveVar(k) && v == SensitiveVarMask {
+				return true
+			}
+		}
+	}
+	for k, v := range a.Vars {
+		if a.IsSensitiveVar(k) && v == SensitiveVarMask {
+			return true
+		}
+	}
+	return false
+}
+
+func copyVars(vars map[string]string, overrides map[string]string) map[string]string {
+	if vars == nil {
+		return nil
+	}
+	copied := map[string]string{}
+	for k, v := range vars {
+		copied[k] = v
+	}
+	for k, v := range overrides {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Redact masks the sensitive var values in a text, eg. in an error message or a rendered manifest
+func (s *SensitiveVars) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+
+	values := []string{}
+	for _, v := range s.Context {
+		values = append(values, v)
+	}
+	for _, items := range s.Items {
+		for _, v := range items {
+			values = append(values, v)
+		}
+	}
+	for _, v := range s.Vars {
+		values = append(values, v)
+	}
+	// longer values first, so a value that contains another is masked whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		text = strings.ReplaceAll(text, v, SensitiveVarMask)
+		// the value as it shows in JSON, eg. in a serialized manifest
+		if escaped, err := json.Marshal(v); err == nil {
+			text = strings.ReplaceAll(text, strings.Trim(string(escaped), `"`), SensitiveVarMask)
+		}
+	}
+	return text
+}
@@ -0,0 +1,81 @@
+package dx
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_maskSensitiveVars(t *testing.T) {
+	artifact := &Artifact{
+		Version: Version{RepositoryName: "gimlet-io/my-app", SHA: "abc123", Event: Push},
+		Context: map[string]string{"GITHUB_TOKEN": "ghp_123", "GITHUB_SHA": "abc123"},
+		Items: []map[string]interface{}{
+			{"name": "CI", "DB_PASSWORD": "hunter2"},
+		},
+		Vars: map[string]string{
+			"SENTRY_DSN": "https://key@sentry.example.com/42",
+			"API_KEY":    "abc",
+			"IMAGE_TAG":  "abc123",
+			"MY_APP_ENV": "production",
+		},
+		SecretVars: []string{"SENTRY_DSN"},
+	}
+
+	sensitiveVars := artifact.MaskSensitiveVars()
+	assert.NotNil(t, sensitiveVars)
+	assert.Equal(t, SensitiveVarMask, artifact.Context["GITHUB_TOKEN"])
+	assert.Equal(t, "abc123", artifact.Context["GITHUB_SHA"])
+	assert.Equal(t, SensitiveVarMask, artifact.Items[0]["DB_PASSWORD"])
+	assert.Equal(t, SensitiveVarMask, artifact.Vars["SENTRY_DSN"], "explicitly marked vars are sensitive")
+	assert.Equal(t, SensitiveVarMask, artifact.Vars["API_KEY"])
+	assert.Equal(t, "production", artifact.Vars["MY_APP_ENV"])
+
+	unmasked := artifact.WithSensitiveVars(sensitiveVars)
+	vars := unmasked.CollectVariables()
+	assert.Equal(t, "ghp_123", vars["GITHUB_TOKEN"])
+	assert.Equal(t, "hunter2", vars["DB_PASSWORD"])
+	assert.Equal(t, "https://key@sentry.example.com/42", vars["SENTRY_DSN"])
+	assert.Equal(t, SensitiveVarMask, artifact.Vars["SENTRY_DSN"], "the artifact stays masked")
+	assert.True(t, artifact.HasMaskedVars())
+	assert.False(t, unmasked.HasMaskedVars())
+	assert.True(t, artifact.WithSensitiveVars(nil).HasMaskedVars(), "lost sensitive vars should be detected")
+
+	assert.Nil(t, (&Artifact{Vars: map[string]string{"IMAGE_TAG": "abc123"}}).MaskSensitiveVars())
+
+	redacted := sensitiveVars.Redact(`could not resolve "hunter2" in https://key@sentry.example.com/42`)
+	assert.Equal(t, `could not resolve "********" in ********`, redacted)
+}
+
+func Test_verifyMaskedArtifact(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	artifact := &Artifact{
+		Version: Version{RepositoryName: "gimlet-io/my-app", SHA: "abc123", Event: Push},
+		Vars:    map[string]string{"API_TOKEN": "secret"},
+	}
+	err := artifact.Sign(privateKeyPEM(t, edPrivate))
+	assert.Nil(t, err)
+
+	// what the dashboard stores
+	artifactJson, _ := json.Marshal(artifact)
+	var received Artifact
+	json.Unmarshal(artifactJson, &received)
+	sensitiveVars := received.MaskSensitiveVars()
+
+	policy := &SigningPolicy{
+		Enforce: true,
+		Keys: []*TrustedKey{
+			{Name: "ci", PublicKey: string(publicKeyPEM(t, edPublic)), Repos: []string{"gimlet-io/my-app"}},
+		},
+	}
+	canonical, _ := received.CanonicalJSON()
+	_, err = policy.Verify(&received, canonical)
+	assert.NotNil(t, err, "the signature covers the original values")
+
+	canonical, _ = received.WithSensitiveVars(sensitiveVars).CanonicalJSON()
+	_, err = policy.Verify(&received, canonical)
+	assert.Nil(t, err)
+}
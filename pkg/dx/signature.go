@@ -0,0 +1,207 @@
+package dx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvSigningFile holds the artifact signing policy of an environment, in its .gimlet folder
+const EnvSigningFile = "signing.yaml"
+
+// SigningPolicy is the artifact signing policy of an environment
+type SigningPolicy struct {
+	// Enforce rejects unsigned artifacts. Artifacts with an invalid signature are always rejected
+	Enforce bool          `yaml:"enforce" json:"enforce"`
+	Keys    []*TrustedKey `yaml:"keys" json:"keys"`
+}
+
+// TrustedKey is a public key that artifacts are signed with
+type TrustedKey struct {
+	Name string `yaml:"name" json:"name"`
+	// PublicKey is a PEM encoded ed25519 or ECDSA (cosign) public key
+	PublicKey string `yaml:"publicKey" json:"publicKey"`
+	// Repos the key is trusted for, all repos if empty
+	Repos []string `yaml:"repos,omitempty" json:"repos,omitempty"`
+}
+
+func ParseSigningPolicy(policy string) (*SigningPolicy, error) {
+	signingPolicy := &SigningPolicy{}
+	if policy == "" {
+		return signingPolicy, nil
+	}
+	err := yaml.Unmarshal([]byte(policy), signingPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", EnvSigningFile, err)
+	}
+	return signingPolicy, nil
+}
+
+// Verify checks the artifact signature against the keys trusted for the artifact's repo.
+// canonical is the CanonicalJSON of the artifact as it was received
+func (p *SigningPolicy) Verify(artifact *Artifact, canonical []byte) (string, error) {
+	if artifact.Signature == "" {
+		if p.Enforce {
+			return "", fmt.Errorf("artifact is not signed, the environment only accepts signed artifacts")
+		}
+		return "", nil
+	}
+
+	trusted := false
+	for _, key := range p.Keys {
+		if !key.trustedFor(artifact.Version.RepositoryName) {
+			continue
+		}
+		trusted = true
+		publicKey, err := ParsePublicKey([]byte(key.PublicKey))
+		if err != nil {
+			return "", fmt.Errorf("cannot parse trusted key %s: %s", key.Name, err)
+		}
+		if VerifySignature(publicKey, canonical, artifact.Signature) == nil {
+			return key.Name, nil
+		}
+	}
+	if !trusted && !p.Enforce {
+		return "", nil
+	}
+	return "", fmt.Errorf("artifact signature is not valid with any of the trusted keys")
+}
+
+func (k *TrustedKey) trustedFor(repo string) bool {
+	if len(k.Repos) == 0 {
+		return true
+	}
+	for _, r := range k.Repos {
+		if r == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalJSON is the signed form of the artifact.
+// It leaves out the signature, the idempotency key that push sets, the ID and creation time that the dashboard sets,
+// and the attachment contents that the dashboard stores apart.
+// It orders the keys of every object, so it is the same on the CLI and on the dashboard
+func (a *Artifact) CanonicalJSON() ([]byte, error) {
+	artifactJson, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// a round trip to normalize the fields that unmarshal to typed structs
+	var normalized Artifact
+	err = json.Unmarshal(artifactJson, &normalized)
+	if err != nil {
+		return nil, err
+	}
+	normalized.ID = ""
+	normalized.Created = 0
+	normalized.Signature = ""
+	normalized.IdempotencyKey = ""
+	for _, attachment := range normalized.Attachments {
+		attachment.Content = nil // the digest is signed, the content is stored apart
+	}
+	artifactJson, err = json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	var object interface{}
+	err = json.Unmarshal(artifactJson, &object)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+// Sign signs the canonical artifact JSON with a PEM encoded ed25519 or ECDSA private key
+func (a *Artifact) Sign(privateKeyPEM []byte) error {
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return err
+	}
+	canonical, err := a.CanonicalJSON()
+	if err != nil {
+		return err
+	}
+
+	var signature []byte
+	switch key := privateKey.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, canonical)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(canonical)
+		signature, err = ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T, use ed25519 or ECDSA", privateKey)
+	}
+
+	a.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// VerifySignature verifies a base64 encoded ed25519 signature, or an ECDSA SHA-256 signature
+// like the ones `cosign sign-blob` makes
+func VerifySignature(publicKey crypto.PublicKey, payload []byte, signature string) error {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("cannot decode signature: %s", err)
+	}
+
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, signatureBytes) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(key, digest[:], signatureBytes) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T, use ed25519 or ECDSA", publicKey)
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS8 ed25519 or ECDSA, or a SEC1 ECDSA private key
+func ParsePrivateKey(privateKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %s", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key
+func ParsePublicKey(publicKeyPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
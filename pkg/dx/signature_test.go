@@ -0,0 +1,105 @@
+package dx
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_signAndVerifyArtifact(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	for name, keys := range map[string][]interface{}{
+		"ed25519": {edPrivate, edPublic},
+		"ecdsa":   {ecPrivate, &ecPrivate.PublicKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var m Manifest
+			err := yaml.Unmarshal([]byte(`
+app: my-app
+env: production
+namespace: default
+values:
+  replicas: 2
+`), &m)
+			assert.Nil(t, err)
+			artifact := &Artifact{
+				Version:      Version{RepositoryName: "gimlet-io/my-app", SHA: "abc123", Event: Push},
+				Environments: []*Manifest{&m},
+			}
+
+			err = artifact.Sign(privateKeyPEM(t, keys[0]))
+			assert.Nil(t, err)
+
+			// what the dashboard receives and stores
+			artifactJson, _ := json.Marshal(artifact)
+			var received Artifact
+			json.Unmarshal(artifactJson, &received)
+			received.ID = "gimlet-io/my-app-123"
+			received.Created = 1234
+
+			policy := &SigningPolicy{
+				Enforce: true,
+				Keys: []*TrustedKey{
+					{Name: "ci", PublicKey: string(publicKeyPEM(t, keys[1])), Repos: []string{"gimlet-io/my-app"}},
+				},
+			}
+			canonical, err := received.CanonicalJSON()
+			assert.Nil(t, err)
+			keyName, err := policy.Verify(&received, canonical)
+			assert.Nil(t, err)
+			assert.Equal(t, "ci", keyName)
+
+			received.Environments[0].Values["replicas"] = 20
+			canonical, _ = received.CanonicalJSON()
+			_, err = policy.Verify(&received, canonical)
+			assert.NotNil(t, err, "tampered artifacts should be rejected")
+		})
+	}
+}
+
+func Test_signingPolicy(t *testing.T) {
+	unsigned := &Artifact{Version: Version{RepositoryName: "gimlet-io/my-app"}}
+	canonical, _ := unsigned.CanonicalJSON()
+
+	policy, err := ParseSigningPolicy("")
+	assert.Nil(t, err)
+	_, err = policy.Verify(unsigned, canonical)
+	assert.Nil(t, err, "unsigned artifacts are accepted by default")
+
+	policy, err = ParseSigningPolicy("enforce: true")
+	assert.Nil(t, err)
+	_, err = policy.Verify(unsigned, canonical)
+	assert.NotNil(t, err, "unsigned artifacts are rejected when signing is enforced")
+
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	signed := &Artifact{Version: Version{RepositoryName: "gimlet-io/other-app"}}
+	signed.Sign(privateKeyPEM(t, edPrivate))
+	canonical, _ = signed.CanonicalJSON()
+	policy.Keys = []*TrustedKey{
+		{Name: "ci", PublicKey: string(publicKeyPEM(t, edPublic)), Repos: []string{"gimlet-io/my-app"}},
+	}
+	_, err = policy.Verify(signed, canonical)
+	assert.NotNil(t, err, "keys are only trusted for their repos")
+}
+
+func privateKeyPEM(t *testing.T, key interface{}) []byte {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) []byte {
+	keyBytes, err := x509.MarshalPKIXPublicKey(key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyBytes})
+}
@@ -0,0 +1,118 @@
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// TagPolicy selects the git tags that trigger a deploy.
+// It is either a glob pattern, eg.: `tag: v*`,
+// or a semantic version range, eg.: `tag: { semver: ">=2.0.0 <3.0.0", prerelease: false }`
+type TagPolicy struct {
+	Pattern string `yaml:"-" json:"-"`
+	// Semver is a semantic version range, eg.: ">=2.0.0 <3.0.0"
+	Semver string `yaml:"semver,omitempty" json:"semver,omitempty"`
+	// Prerelease allows tags with a prerelease part, eg.: v2.1.0-rc.1
+	Prerelease bool `yaml:"prerelease,omitempty" json:"prerelease,omitempty"`
+}
+
+type tagPolicyObject struct {
+	Semver     string `yaml:"semver,omitempty" json:"semver,omitempty"`
+	Prerelease bool   `yaml:"prerelease,omitempty" json:"prerelease,omitempty"`
+}
+
+// IsZero tells if the policy is not set. It also drives yaml omitempty
+func (t *TagPolicy) IsZero() bool {
+	return t == nil || (t.Pattern == "" && t.Semver == "")
+}
+
+// IsSemver tells if the policy matches tags by semantic version
+func (t *TagPolicy) IsSemver() bool {
+	return t != nil && t.Semver != ""
+}
+
+// SemverMatch tells if the tag is a semantic version that satisfies the range of the policy.
+// Leading `v`s are allowed in the tag.
+func (t *TagPolicy) SemverMatch(tag string) bool {
+	version, err := semver.ParseTolerant(tag)
+	if err != nil {
+		return false
+	}
+	versionRange, err := semver.ParseRange(t.Semver)
+	if err != nil {
+		return false
+	}
+
+	if len(version.Pre) > 0 {
+		if !t.Prerelease {
+			return false
+		}
+		// release candidates belong to the version line of their release
+		version.Pre = nil
+	}
+
+	return versionRange(version)
+}
+
+func (t *TagPolicy) validate() error {
+	if t.Semver == "" {
+		return nil
+	}
+	_, err := semver.ParseRange(t.Semver)
+	if err != nil {
+		return fmt.Errorf("invalid semver range %s: %s", t.Semver, err)
+	}
+	return nil
+}
+
+// MarshalJSON marshals glob patterns as a json string, semver ranges as an object
+func (t TagPolicy) MarshalJSON() ([]byte, error) {
+	if t.Semver == "" {
+		return json.Marshal(t.Pattern)
+	}
+	return json.Marshal(tagPolicyObject{Semver: t.Semver, Prerelease: t.Prerelease})
+}
+
+// UnmarshalJSON unmarshals either a glob pattern string or a semver range object
+func (t *TagPolicy) UnmarshalJSON(b []byte) error {
+	var pattern string
+	if err := json.Unmarshal(b, &pattern); err == nil {
+		*t = TagPolicy{Pattern: pattern}
+		return nil
+	}
+
+	var object tagPolicyObject
+	err := json.Unmarshal(b, &object)
+	if err != nil {
+		return fmt.Errorf("tag must be a pattern or an object with a semver range: %s", err)
+	}
+	*t = TagPolicy{Semver: object.Semver, Prerelease: object.Prerelease}
+	return t.validate()
+}
+
+// MarshalYAML marshals glob patterns as a yaml string, semver ranges as a mapping
+func (t TagPolicy) MarshalYAML() (interface{}, error) {
+	if t.Semver == "" {
+		return t.Pattern, nil
+	}
+	return tagPolicyObject{Semver: t.Semver, Prerelease: t.Prerelease}, nil
+}
+
+// UnmarshalYAML unmarshals either a glob pattern string or a semver range mapping
+func (t *TagPolicy) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*t = TagPolicy{Pattern: n.Value}
+		return nil
+	}
+
+	var object tagPolicyObject
+	err := n.Decode(&object)
+	if err != nil {
+		return fmt.Errorf("tag must be a pattern or an object with a semver range: %s", err)
+	}
+	*t = TagPolicy{Semver: object.Semver, Prerelease: object.Prerelease}
+	return t.validate()
+}
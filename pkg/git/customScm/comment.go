@@ -0,0 +1,58 @@
+package customScm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gimlet-io/gimlet/cmd/dashboard/dynamicconfig"
+	"github.com/gimlet-io/gimlet/pkg/git/genericScm"
+)
+
+// CommentOnPR creates or updates the deploy preview comment on the open pull request of the branch
+func CommentOnPR(
+	dynamicConfig *dynamicconfig.DynamicConfig,
+	token string,
+	gitRepo, branch string,
+	commentBody string,
+) error {
+	gitSvc := NewGitService(dynamicConfig)
+
+	goScm := genericScm.NewGoScmHelper(dynamicConfig, nil)
+	openpullrequests, err := goScm.ListOpenPRs(token, gitRepo)
+	if err != nil {
+		return fmt.Errorf("cannot list open pullrequests: %s", err)
+	}
+
+	var pullNumber int
+	for _, pr := range openpullrequests {
+		if pr.Source == branch {
+			pullNumber = pr.Number
+		}
+	}
+	if pullNumber == 0 {
+		return nil
+	}
+
+	comments, err := gitSvc.Comments(token, gitRepo, pullNumber)
+	if err != nil {
+		return fmt.Errorf("cannot list comments: %s", err)
+	}
+
+	for _, c := range comments {
+		if strings.Contains(*c.Body, "Deploy Preview for") {
+			return gitSvc.UpdateComment(
+				token,
+				gitRepo,
+				*c.ID,
+				commentBody,
+			)
+		}
+	}
+
+	return gitSvc.CreateComment(
+		token,
+		gitRepo,
+		pullNumber,
+		commentBody,
+	)
+}
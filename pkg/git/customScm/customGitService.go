@@ -31,6 +31,16 @@ const (
 |  Name | Link |
 |:-:|------------------------|
 |<span aria-hidden="true">🔨</span> Latest commit | %s |
+`
+
+	BodySleeping = `### <span aria-hidden="true">😴</span> Deploy Preview for *%s* is sleeping.
+
+It was scaled to zero as it was idle. Push a commit or wake it up on the Gimlet dashboard.
+
+| Name | Link |
+|:-:|------------------------|
+|<span aria-hidden="true">🔨</span> Latest commit | %s |
+|<span aria-hidden="true">⏰</span> Wake up | [%s](%s) |
 `
 )
 
@@ -297,9 +297,10 @@ func (helper *GoScmHelper) RegisterWebhook(
 		Target: hookPath,
 		Secret: webhookSecret,
 		Events: scm.HookEvents{
-			Push:   true,
-			Status: true,
-			Branch: true,
+			Push:        true,
+			Status:      true,
+			Branch:      true,
+			PullRequest: true,
 			//CheckRun: true,
 		},
 	}
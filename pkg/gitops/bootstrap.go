@@ -13,6 +13,7 @@ import (
 	"github.com/fluxcd/pkg/ssh"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	helper "github.com/gimlet-io/gimlet/pkg/git/nativeGit"
 	"github.com/gimlet-io/gimlet/pkg/gitops/sync"
 	"github.com/gimlet-io/go-scm/scm"
@@ -37,6 +38,9 @@ type ManifestOpts struct {
 	ShouldGenerateBasicAuthSecret      bool
 	BasicAuthUser                      string
 	BasicAuthPassword                  string
+	// SopsAgeRecipient is the age public key of the environment. Flux decrypts SOPS encrypted secrets
+	// with its private key, that is kept in the sops-age secret of flux-system, outside of git
+	SopsAgeRecipient string
 }
 
 func DefaultManifestOpts() ManifestOpts {
@@ -136,11 +140,24 @@ func GenerateManifests(opts ManifestOpts) (string, string, string, error) {
 		}
 		if opts.KustomizationPerApp {
 			syncOpts.TargetPath = fluxPath
+		} else {
+			// dependent apps are released once the env Kustomization reconciled, that has to mean the apps are healthy.
+			// With a Kustomization per app, the per app Kustomizations wait for their own health checks
+			syncOpts.HealthTimeout = dx.DefaultHealthTimeout
 		}
 		syncOpts.GimletPath = filepath.Join(opts.Env, ".gimlet")
 		if opts.SingleEnv {
 			syncOpts.GimletPath = ".gimlet"
 		}
+		if opts.SopsAgeRecipient == "" {
+			// regenerating an environment that was bootstrapped with SOPS must keep its decryption
+			opts.SopsAgeRecipient = existingSopsAgeRecipient(path.Join(opts.GitopsRepoPath, opts.Env))
+		}
+		if opts.SopsAgeRecipient != "" {
+			syncOpts.SopsDecryptionSecret = dx.SopsAgeSecret
+		} else if existingGitopsRepoFileName != "" {
+			syncOpts.SopsDecryptionSecret = existingDecryptionSecret(path.Join(opts.GitopsRepoPath, opts.Env, "flux", existingGitopsRepoFileName))
+		}
 		syncManifest, err := sync.Generate(syncOpts)
 		if err != nil {
 			return "", "", "", fmt.Errorf("cannot generate git manifests %s", err)
@@ -151,6 +168,13 @@ func GenerateManifests(opts ManifestOpts) (string, string, string, error) {
 			return "", "", "", fmt.Errorf("cannot write git manifests %s", err)
 		}
 
+		if opts.SopsAgeRecipient != "" {
+			err = ioutil.WriteFile(path.Join(opts.GitopsRepoPath, opts.Env, SopsConfigFile), sopsConfig(opts.SopsAgeRecipient), os.ModePerm)
+			if err != nil {
+				return "", "", "", fmt.Errorf("cannot write sops config %s", err)
+			}
+		}
+
 		if opts.ShouldGenerateDependencies {
 			err = os.MkdirAll(path.Join(opts.GitopsRepoPath, opts.Env, "dependencies"), os.ModePerm)
 			if err != nil {
@@ -189,6 +213,70 @@ func GenerateManifests(opts ManifestOpts) (string, string, string, error) {
 	return gitopsRepoFileName, publicKey, secretFileName, nil
 }
 
+// SopsConfigFile holds the age recipient of the environment, to encrypt secrets with
+const SopsConfigFile = ".sops.yaml"
+
+// existingSopsAgeRecipient reads the age recipient from the SOPS config of the environment, if there is one
+func existingSopsAgeRecipient(envPath string) string {
+	content, err := ioutil.ReadFile(path.Join(envPath, SopsConfigFile))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		CreationRules []struct {
+			Age string `json:"age"`
+		} `json:"creation_rules"`
+	}
+	err = yaml.Unmarshal(content, &config)
+	if err != nil {
+		logrus.Warnf("couldn't unmarshal %s: %s", SopsConfigFile, err)
+		return ""
+	}
+	for _, rule := range config.CreationRules {
+		if rule.Age != "" {
+			return rule.Age
+		}
+	}
+	return ""
+}
+
+// existingDecryptionSecret returns the decryption secret of the environment Kustomization in the sync manifest, if it has one
+func existingDecryptionSecret(syncManifestPath string) string {
+	content, err := ioutil.ReadFile(syncManifestPath)
+	if err != nil {
+		return ""
+	}
+
+	for _, document := range strings.Split(string(content), "\n---") {
+		var kustomization struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				Decryption *struct {
+					SecretRef *struct {
+						Name string `json:"name"`
+					} `json:"secretRef"`
+				} `json:"decryption"`
+			} `json:"spec"`
+		}
+		err = yaml.Unmarshal([]byte(document), &kustomization)
+		if err != nil || kustomization.Kind != "Kustomization" {
+			continue
+		}
+		if kustomization.Spec.Decryption != nil && kustomization.Spec.Decryption.SecretRef != nil {
+			return kustomization.Spec.Decryption.SecretRef.Name
+		}
+	}
+	return ""
+}
+
+func sopsConfig(ageRecipient string) []byte {
+	return []byte(fmt.Sprintf(`creation_rules:
+  - encrypted_regex: ^(data|stringData)$
+    age: %s
+`, ageRecipient))
+}
+
 func UniqueName(singleEnv bool, owner string, repoName string, env string) string {
 	if len(owner) > 10 {
 		owner = owner[:10]
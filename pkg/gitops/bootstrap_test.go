@@ -4,9 +4,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gimlet-io/gimlet/pkg/dashboard/model"
+	"github.com/gimlet-io/gimlet/pkg/dx"
 	"gotest.tools/assert"
 )
 
@@ -182,6 +184,38 @@ func Test_generateManifestWithKustomizationAndRepoWithoutDeployKey(t *testing.T)
 	}
 }
 
+func Test_regenerateManifestKeepsSopsDecryption(t *testing.T) {
+	dirToWrite, err := ioutil.TempDir("/tmp", "gimlet")
+	defer os.RemoveAll(dirToWrite)
+	if err != nil {
+		t.Errorf("Cannot create directory")
+		return
+	}
+
+	opts := DefaultManifestOpts()
+	opts.SingleEnv = false
+	opts.Env = "staging"
+	opts.ShouldGenerateController = false
+	opts.ShouldGenerateDeployKey = false
+	opts.GitopsRepoUrl = "git@github.com:gimlet-io/gitops-staging-infra.git"
+	opts.GitopsRepoPath = dirToWrite
+	opts.SopsAgeRecipient = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+
+	_, _, _, err = GenerateManifests(opts)
+	assert.NilError(t, err)
+
+	// regenerating the environment, like the dashboard does on upgrades, doesn't know about the recipient
+	opts.SopsAgeRecipient = ""
+	_, _, _, err = GenerateManifests(opts)
+	assert.NilError(t, err)
+
+	syncManifest, err := ioutil.ReadFile(filepath.Join(dirToWrite, "staging", "flux", "gitops-repo-gimlet-io-gitops-staging-infra-staging.yaml"))
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(syncManifest), "decryption:"), "decryption should survive regeneration")
+	assert.Equal(t, existingDecryptionSecret(filepath.Join(dirToWrite, "staging", "flux", "gitops-repo-gimlet-io-gitops-staging-infra-staging.yaml")), dx.SopsAgeSecret)
+	assert.Equal(t, existingSopsAgeRecipient(filepath.Join(dirToWrite, "staging")), "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")
+}
+
 func Test_generateManifestProviderAndAlert(t *testing.T) {
 	dirToWrite, err := ioutil.TempDir("/tmp", "gimlet")
 	defer os.RemoveAll(dirToWrite)
@@ -33,6 +33,9 @@ type Options struct {
 	ManifestFile         string
 	RecurseSubmodules    bool
 	GenerateDependencies bool
+	SopsDecryptionSecret string
+	// HealthTimeout makes the env Kustomization wait for the workloads it applies to become healthy
+	HealthTimeout time.Duration
 }
 
 func MakeDefaultOptions() Options {
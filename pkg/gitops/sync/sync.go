@@ -123,6 +123,12 @@ func Generate(options Options) (*manifestgen.Manifest, error) {
 		},
 	}
 
+	kustomization.Spec.Decryption = sopsDecryption(options.SopsDecryptionSecret)
+	if options.HealthTimeout > 0 { // reconciliation only succeeds once the apps are healthy, so dependents can rely on it
+		kustomization.Spec.Wait = true
+		kustomization.Spec.Timeout = &metav1.Duration{Duration: options.HealthTimeout}
+	}
+
 	if options.GenerateDependencies {
 		kustomization.Spec.DependsOn = []meta.NamespacedObjectReference{
 			{
@@ -221,6 +227,9 @@ func GenerateKustomizationForApp(
 	kustomizationName string,
 	sourceName string,
 	singleEnv bool,
+	sopsDecryptionSecret string,
+	dependsOn []string,
+	healthTimeout time.Duration,
 ) (*manifestgen.Manifest, error) {
 	filePath := filepath.Join(env, "flux")
 	kustomizationPath := filepath.Join(env, app)
@@ -248,8 +257,14 @@ func GenerateKustomizationForApp(
 				Kind: sourcev1.GitRepositoryKind,
 				Name: sourceName,
 			},
+			Decryption: sopsDecryption(sopsDecryptionSecret),
+			DependsOn:  kustomizationReferences(dependsOn),
 		},
 	}
+	if healthTimeout > 0 { // the Kustomization is only Ready once the app is healthy, so dependents can rely on it
+		kustomization.Spec.Wait = true
+		kustomization.Spec.Timeout = &metav1.Duration{Duration: healthTimeout}
+	}
 
 	ksData, err := yaml.Marshal(kustomization)
 	if err != nil {
@@ -296,6 +311,30 @@ func GenerateConfigMap(
 	}, nil
 }
 
+// sopsDecryption makes Flux decrypt SOPS encrypted manifests with the age key in the given secret
+func sopsDecryption(secretName string) *kustomizev1.Decryption {
+	if secretName == "" {
+		return nil
+	}
+	return &kustomizev1.Decryption{
+		Provider: "sops",
+		SecretRef: &meta.LocalObjectReference{
+			Name: secretName,
+		},
+	}
+}
+
+func kustomizationReferences(names []string) []meta.NamespacedObjectReference {
+	var references []meta.NamespacedObjectReference
+	for _, name := range names {
+		references = append(references, meta.NamespacedObjectReference{
+			Name:      name,
+			Namespace: "flux-system",
+		})
+	}
+	return references
+}
+
 func resourceToString(data []byte) string {
 	data = bytes.Replace(data, []byte("  creationTimestamp: null\n"), []byte(""), 1)
 	data = bytes.Replace(data, []byte("status: {}\n"), []byte(""), 1)
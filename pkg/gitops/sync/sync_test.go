@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1"
 	notifv1 "github.com/fluxcd/notification-controller/api/v1beta3"
@@ -39,9 +40,26 @@ func TestGenerate(t *testing.T) {
 		}
 	}
 
+	if strings.Contains(output.Content, "wait: true") {
+		t.Errorf("health check should only be set with a health timeout")
+	}
+
 	fmt.Println(output.Content)
 }
 
+func TestGenerateWithHealthTimeout(t *testing.T) {
+	opts := MakeDefaultOptions()
+	opts.HealthTimeout = 5 * time.Minute
+	output, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.Content, "timeout: 5m0s") || !strings.Contains(output.Content, "wait: true") {
+		t.Errorf("health check not found")
+	}
+}
+
 func TestGenerateNotificationProvider(t *testing.T) {
 	envName := "staging"
 	gimletdUrl := "https://test.gimlet.io"
@@ -84,6 +102,9 @@ func TestGenerateKustomizationForApp(t *testing.T) {
 		kustomizationName,
 		sourceName,
 		singleEnv,
+		"",
+		nil,
+		0,
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -92,6 +113,55 @@ func TestGenerateKustomizationForApp(t *testing.T) {
 	if !strings.Contains(output.Content, kustomizev1.GroupVersion.String()) {
 		t.Errorf("apiVersion '%s' not found", kustomizev1.GroupVersion.String())
 	}
+	if strings.Contains(output.Content, "wait: true") || strings.Contains(output.Content, "timeout:") {
+		t.Errorf("health check should only be set with a health timeout")
+	}
 
 	fmt.Println(output.Content)
 }
+
+func TestGenerateKustomizationForAppWithSopsDecryption(t *testing.T) {
+	output, err := GenerateKustomizationForApp(
+		"test-app",
+		"staging",
+		"gitops-repo-gimlet-io-gitops-staging-infra-staging-test-app",
+		"gitops-repo-gimlet-io-gitops-staging-infra",
+		true,
+		"sops-age",
+		nil,
+		0,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.Content, "provider: sops") {
+		t.Errorf("sops decryption not found")
+	}
+	if !strings.Contains(output.Content, "name: sops-age") {
+		t.Errorf("sops decryption secret not found")
+	}
+}
+
+func TestGenerateKustomizationForAppWithDependsOn(t *testing.T) {
+	output, err := GenerateKustomizationForApp(
+		"frontend",
+		"staging",
+		"gimlet-io-gitops-staging-default-frontend",
+		"gitops-repo-gimlet-io-gitops-staging-infra",
+		true,
+		"",
+		[]string{"gimlet-io-gitops-staging-default-api"},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.Content, "dependsOn:\n  - name: gimlet-io-gitops-staging-default-api\n    namespace: flux-system") {
+		t.Errorf("dependsOn not found")
+	}
+	if !strings.Contains(output.Content, "timeout: 10m0s") || !strings.Contains(output.Content, "wait: true") {
+		t.Errorf("health check not found")
+	}
+}
@@ -185,10 +185,42 @@ function ArtifactEventWidget(props) {
           )
         })}
       </ul>
+      {event.attachments?.length > 0 &&
+      <ul className='pl-5 pt-1'>
+        {event.attachments.map(attachment => (
+          <li key={attachment.name} className='text-sm'>
+            <a
+              href={`/api/artifacts/attachment?artifactId=${encodeURIComponent(event.artifactId)}&name=${encodeURIComponent(attachment.name)}`}
+              className='font-mono'
+            >
+              📄 {attachment.name}
+            </a>
+            <span className='pl-1 text-gray-500'>{attachment.format ?? attachment.type}</span>
+            <span className='pl-1'>{attachmentSummary(attachment)}</span>
+          </li>
+        ))}
+      </ul>
+      }
     </div>
   )
 }
 
+function attachmentSummary(attachment) {
+  const summary = attachment.summary ?? {}
+  switch (attachment.type) {
+    case 'test':
+      return `${summary.tests ?? 0} tests, ${summary.failures ?? 0} failures, ${summary.errors ?? 0} errors, ${summary.skipped ?? 0} skipped`
+    case 'coverage':
+      return `${summary.coverage ?? 0}% coverage`
+    case 'sbom':
+      return `${summary.components ?? 0} components` + (summary.licenses ? `, licenses: ${summary.licenses.join(', ')}` : '')
+    case 'provenance':
+      return summary.builder ? `built by ${summary.builder}` : ''
+    default:
+      return ''
+  }
+}
+
 function ImageBuildEventWidget(props) {
   const {event, scmUrl} = props
 
@@ -403,9 +403,19 @@ export function Pod(props) {
       break;
   }
 
+  const mismatchingImages = pod.images?.filter(image => image.releasedDigest) ?? [];
+  if (mismatchingImages.length > 0) {
+    textColor = 'text-neutral-900 dark:text-orange-300'
+    color = 'bg-orange-400 dark:bg-orange-800';
+  }
+  const title = mismatchingImages.length > 0 ?
+    `${pod.name} - ${pod.status} - image digest mismatch: ` +
+      mismatchingImages.map(image => `${image.image} runs ${image.digest}, released ${image.releasedDigest}`).join(', ') :
+    `${pod.name} - ${pod.status}`;
+
   return (
-    <span className={`inline-block mr-1 mt-2 shadow-lg ${textColor} ${color} ${pulsar} font-bold px-2 cursor-default`} title={`${pod.name} - ${pod.status}`}>
-      {pod.status}
+    <span className={`inline-block mr-1 mt-2 shadow-lg ${textColor} ${color} ${pulsar} font-bold px-2 cursor-default`} title={title}>
+      {pod.status}{mismatchingImages.length > 0 && ' ⚠'}
     </span>
   );
 }
@@ -430,7 +440,9 @@ function DeployIndicator(props) {
       indicator = <span><ArrowPathIcon className="h-4 mr-1 mt-0.5" aria-hidden="true" />Continuously deployed on {deploy.branch}</span>;
       break;
     case "tag":
-      indicator = <span>Deployed on {deploy.tag} git tags </span>;
+      indicator = deploy.tag && deploy.tag.semver
+        ? <span>Deployed on {deploy.tag.semver} {deploy.tag.prerelease ? "" : "stable "}semver git tags </span>
+        : <span>Deployed on {deploy.tag} git tags </span>;
       break;
     default:
       indicator = <span><a href={`/repo/${owner}/${repo}/commits?branch=${branch}`}>Deploy manually</a></span>;
@@ -53,11 +53,13 @@ export function podUpdated(state, event) {
       stack.deployment.pods.forEach((pod, podID) => {
         if (pod.namespace + '/' + pod.name === event.subject) {
           stacks[stackID].deployment.pods[podID] = {
+            ...pod,
             name: podName,
             namespace: namespace,
             status: event.status,
             errorCause: event.errorCause,
-            logs: event.logs
+            logs: event.logs,
+            images: event.images
           };
         }
       });